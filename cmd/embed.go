@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/inference"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+// defaultEmbeddingModel is the Hugging Face model embed uses without --model
+const defaultEmbeddingModel = "sentence-transformers/all-MiniLM-L6-v2"
+
+// embedding is an entry of the JSON output of embed
+type embedding struct {
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+func embedCmd() *cobra.Command {
+	var local, pooling string
+	var normalize bool
+	cmd := &cobra.Command{
+		Use:   "embed [text...]",
+		Short: "Compute sentence embeddings",
+		Long: `Embed prints an embedding vector for each text, one per line with
+space-separated values. Texts are embedded with a Hugging Face
+feature-extraction model, or with a local BERT-style model directory given
+by --local.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			var embedder models.Embedder
+			if local != "" {
+				m, err := inference.LoadBertModel(local)
+				if err != nil {
+					return err
+				}
+				if pooling != "" {
+					m.Pooling = pooling
+				}
+				if cmd.Flags().Changed("normalize") {
+					m.Normalize = normalize
+				}
+				embedder = m
+			} else {
+				name := modelName
+				if name == "" {
+					name = defaultEmbeddingModel
+				}
+				embedder = hfModel(name)
+			}
+
+			vectors, err := embedder.Embed(ctx, args)
+			if err != nil {
+				return fmt.Errorf("embedding failed: %w", err)
+			}
+
+			if outputJSON {
+				results := make([]embedding, len(args))
+				for i, text := range args {
+					results[i] = embedding{Text: text, Embedding: vectors[i]}
+				}
+				output, err := json.MarshalIndent(results, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(output))
+			} else {
+				for _, v := range vectors {
+					values := make([]string, len(v))
+					for i, x := range v {
+						values[i] = strconv.FormatFloat(float64(x), 'g', -1, 32)
+					}
+					fmt.Println(strings.Join(values, " "))
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&local, "local", "", "Local BERT-style model directory to embed with instead of the API")
+	cmd.Flags().StringVar(&pooling, "pooling", "", "Pooling of a local model: mean or cls (default from the model)")
+	cmd.Flags().BoolVar(&normalize, "normalize", false, "Scale the embeddings of a local model to unit length (default from the model)")
+
+	return cmd
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/gguf"
+	"github.com/spf13/cobra"
+)
+
+// ggufSummary is the output of gguf inspect
+type ggufSummary struct {
+	Version       uint32         `json:"version"`
+	Architecture  string         `json:"architecture"`
+	Name          string         `json:"name,omitempty"`
+	ContextLength uint64         `json:"context_length,omitempty"`
+	FileType      string         `json:"file_type,omitempty"`
+	Tokenizer     string         `json:"tokenizer,omitempty"`
+	VocabSize     int            `json:"vocab_size,omitempty"`
+	MetadataCount int            `json:"metadata_count"`
+	TensorCount   int            `json:"tensor_count"`
+	TensorTypes   map[string]int `json:"tensor_types"`
+	TensorBytes   uint64         `json:"tensor_bytes"`
+}
+
+func ggufCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gguf",
+		Short: "Work with GGUF model files",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "inspect [file]",
+		Short: "Print the architecture, context length and quantization of a GGUF file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := gguf.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			summary := summarizeGGUF(f)
+			if outputJSON {
+				output, err := json.MarshalIndent(summary, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(output))
+				return nil
+			}
+
+			fmt.Printf("Version:        %d\n", summary.Version)
+			fmt.Printf("Architecture:   %s\n", summary.Architecture)
+			if summary.Name != "" {
+				fmt.Printf("Name:           %s\n", summary.Name)
+			}
+			if summary.ContextLength > 0 {
+				fmt.Printf("Context length: %d\n", summary.ContextLength)
+			}
+			if summary.FileType != "" {
+				fmt.Printf("File type:      %s\n", summary.FileType)
+			}
+			if summary.Tokenizer != "" {
+				fmt.Printf("Tokenizer:      %s (%d tokens)\n", summary.Tokenizer, summary.VocabSize)
+			}
+			fmt.Printf("Metadata keys:  %d\n", summary.MetadataCount)
+			fmt.Printf("Tensors:        %d (%.1f MiB)\n", summary.TensorCount, float64(summary.TensorBytes)/(1<<20))
+
+			types := make([]string, 0, len(summary.TensorTypes))
+			for t := range summary.TensorTypes {
+				types = append(types, t)
+			}
+			sort.Slice(types, func(i, j int) bool {
+				a, b := summary.TensorTypes[types[i]], summary.TensorTypes[types[j]]
+				return a > b || a == b && types[i] < types[j]
+			})
+			for _, t := range types {
+				fmt.Printf("  %-8s %d\n", t, summary.TensorTypes[t])
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+func summarizeGGUF(f *gguf.File) ggufSummary {
+	s := ggufSummary{
+		Version:       f.Version,
+		Architecture:  f.Architecture(),
+		MetadataCount: len(f.Metadata),
+		TensorCount:   len(f.Tensors),
+		TensorTypes:   make(map[string]int),
+	}
+	s.Name, _ = f.String("general.name")
+	s.ContextLength, _ = f.Uint(s.Architecture + ".context_length")
+	if ft, ok := f.Uint("general.file_type"); ok {
+		s.FileType = gguf.FileTypeName(ft)
+	}
+	s.Tokenizer, _ = f.String("tokenizer.ggml.model")
+	if tokens, ok := f.Strings("tokenizer.ggml.tokens"); ok {
+		s.VocabSize = len(tokens)
+	}
+	for _, t := range f.Tensors {
+		s.TensorTypes[t.Type.String()]++
+		s.TensorBytes += t.Size()
+	}
+	return s
+}
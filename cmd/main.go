@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/kelleyblackmore/go-transformer"
+	"github.com/kelleyblackmore/go-transformer/pkg/api"
 	"github.com/kelleyblackmore/go-transformer/pkg/models"
 	"github.com/spf13/cobra"
 )
@@ -18,6 +19,7 @@ var (
 	outputJSON  bool
 	maxLength   int
 	temperature float64
+	stream      bool
 	timeout     time.Duration
 )
 
@@ -37,6 +39,10 @@ func main() {
 	// Add subcommands
 	rootCmd.AddCommand(classifyCmd())
 	rootCmd.AddCommand(generateCmd())
+	rootCmd.AddCommand(embedCmd())
+	rootCmd.AddCommand(nerCmd())
+	rootCmd.AddCommand(ggufCmd())
+	rootCmd.AddCommand(quantizeCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -109,17 +115,19 @@ func generateCmd() *cobra.Command {
 				DoSample:    temperature > 0,
 			}
 
+			if stream && !outputJSON {
+				name := modelName
+				if name == "" {
+					name = "gpt2"
+				}
+				return streamGeneration(ctx, hfModel(name), prompt, options)
+			}
+
 			var result *models.GenerationResult
 			var err error
 
 			if modelName != "" {
-				var model models.Model
-				if apiToken != "" {
-					model = gotransformers.NewHFModelWithToken(modelName, apiToken)
-				} else {
-					model = gotransformers.NewHFModel(modelName)
-				}
-				result, err = model.Generate(ctx, prompt, options)
+				result, err = hfModel(modelName).Generate(ctx, prompt, options)
 			} else {
 				result, err = gotransformers.QuickGenerate(ctx, prompt)
 			}
@@ -144,6 +152,37 @@ func generateCmd() *cobra.Command {
 
 	cmd.Flags().IntVar(&maxLength, "max-length", 50, "Maximum length of generated text")
 	cmd.Flags().Float64Var(&temperature, "temperature", 0.7, "Temperature for text generation")
+	cmd.Flags().BoolVar(&stream, "stream", false, "Print tokens as they are generated (ignored with --json)")
 
 	return cmd
 }
+
+// hfModel returns the hosted model name, authenticated with --token when
+// one is given
+func hfModel(name string) *api.HFModel {
+	if apiToken != "" {
+		return api.NewHFModelWithToken(name, apiToken)
+	}
+	return api.NewHFModel(name)
+}
+
+// streamGeneration prints the prompt followed by each generated token as it
+// arrives
+func streamGeneration(ctx context.Context, model models.Model, prompt string, options *models.GenerationOptions) error {
+	tokens, err := model.GenerateStream(ctx, prompt, options)
+	if err != nil {
+		return fmt.Errorf("generation failed: %w", err)
+	}
+	fmt.Print(prompt)
+	for token := range tokens {
+		if token.Err != nil {
+			fmt.Println()
+			return fmt.Errorf("generation failed: %w", token.Err)
+		}
+		if !token.Special {
+			fmt.Print(token.Text)
+		}
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/inference"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+// defaultNERModel is the Hugging Face model ner uses without --model
+const defaultNERModel = "dslim/bert-base-NER"
+
+func nerCmd() *cobra.Command {
+	var local, aggregation string
+	cmd := &cobra.Command{
+		Use:   "ner [text]",
+		Short: "Find named entities in text",
+		Long: `NER prints the text with each entity found in it marked inline, as in
+"[Wolfgang](PER) lives in [Berlin](LOC)". Entities are found with a Hugging
+Face token-classification model, or with a local BERT-style model directory
+given by --local.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			var classifier models.TokenClassifier
+			if local != "" {
+				m, err := inference.LoadBertModel(local)
+				if err != nil {
+					return err
+				}
+				classifier = m
+			} else {
+				name := modelName
+				if name == "" {
+					name = defaultNERModel
+				}
+				classifier = hfModel(name)
+			}
+
+			text := args[0]
+			entities, err := classifier.ClassifyTokens(ctx, text, &models.TokenClassificationOptions{AggregationStrategy: aggregation})
+			if err != nil {
+				return fmt.Errorf("token classification failed: %w", err)
+			}
+
+			if outputJSON {
+				output, err := json.MarshalIndent(entities, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(output))
+			} else {
+				fmt.Println(markEntities(text, entities))
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&local, "local", "", "Local BERT-style model directory to use instead of the API")
+	cmd.Flags().StringVar(&aggregation, "aggregation", models.AggregationSimple, "Aggregation strategy: none, simple, first, average or max")
+
+	return cmd
+}
+
+// markEntities writes each entity of text as [word](label). Entities that
+// overlap an earlier one are left unmarked.
+func markEntities(text string, entities []models.Entity) string {
+	runes := []rune(text)
+	var b strings.Builder
+	last := 0
+	for _, e := range entities {
+		if e.Start < last || e.End > len(runes) || e.Start >= e.End {
+			continue
+		}
+		b.WriteString(string(runes[last:e.Start]))
+		fmt.Fprintf(&b, "[%s](%s)", string(runes[e.Start:e.End]), e.Label)
+		last = e.End
+	}
+	b.WriteString(string(runes[last:]))
+	return b.String()
+}
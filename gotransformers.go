@@ -10,12 +10,14 @@ import (
 )
 
 // NewHFModel creates a new Hugging Face model instance
-// This uses the Hugging Face Inference API for cloud-based inference
+// This uses the Hugging Face Inference API for cloud-based inference, retrying
+// failed requests according to api.DefaultRetryPolicy
 func NewHFModel(modelName string) models.Model {
 	return api.NewHFModel(modelName)
 }
 
-// NewHFModelWithToken creates a new Hugging Face model with explicit API token
+// NewHFModelWithToken creates a new Hugging Face model with explicit API token,
+// retrying failed requests according to api.DefaultRetryPolicy
 func NewHFModelWithToken(modelName, apiToken string) models.Model {
 	return api.NewHFModelWithToken(modelName, apiToken)
 }
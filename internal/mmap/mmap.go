@@ -0,0 +1,10 @@
+// Package mmap gives read-only access to the contents of large model files.
+// Files are memory-mapped where the platform supports it, so their pages are
+// loaded on demand, and read into memory elsewhere.
+package mmap
+
+// Data returns the file contents. The slice must not be modified and is
+// only valid until Close.
+func (f *File) Data() []byte {
+	return f.data
+}
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package mmap
+
+import "os"
+
+// File holds a file's contents. Platforms without mmap support read the
+// whole file into memory.
+type File struct {
+	data []byte
+}
+
+// Open reads a file into memory
+func Open(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &File{data: data}, nil
+}
+
+// Close releases the file contents
+func (f *File) Close() error {
+	f.data = nil
+	return nil
+}
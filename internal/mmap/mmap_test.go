@@ -0,0 +1,41 @@
+package mmap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.bin")
+	if err := os.WriteFile(path, []byte("weights"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(f.Data()) != "weights" {
+		t.Errorf("Expected 'weights', got %q", f.Data())
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Expected no error closing, got %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Expected a second Close to be a no-op, got %v", err)
+	}
+
+	empty := filepath.Join(dir, "empty.bin")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := Open(empty); err != nil || len(f.Data()) != 0 {
+		t.Errorf("Expected an empty file to open with no data, got %v", err)
+	}
+
+	if _, err := Open(filepath.Join(dir, "missing.bin")); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+}
@@ -0,0 +1,222 @@
+// Package protowire implements the subset of the protocol buffers wire
+// format needed to read model files (SentencePiece models, ONNX graphs)
+// without generated code or external dependencies.
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Wire types
+const (
+	VarintType  = 0
+	Fixed64Type = 1
+	BytesType   = 2
+	Fixed32Type = 5
+)
+
+// ErrTruncated is returned when a message ends in the middle of a field
+var ErrTruncated = errors.New("protowire: truncated message")
+
+// Decoder reads the fields of a single serialized message
+type Decoder struct {
+	buf []byte
+	pos int
+}
+
+// NewDecoder returns a decoder over a serialized message
+func NewDecoder(buf []byte) *Decoder {
+	return &Decoder{buf: buf}
+}
+
+// Done reports whether every field has been read
+func (d *Decoder) Done() bool {
+	return d.pos >= len(d.buf)
+}
+
+// Next reads the tag of the next field
+func (d *Decoder) Next() (field int, wireType int, err error) {
+	tag, err := d.Varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	field, wireType = int(tag>>3), int(tag&7)
+	if field <= 0 {
+		return 0, 0, fmt.Errorf("protowire: invalid field number %d", field)
+	}
+	return field, wireType, nil
+}
+
+// Varint reads a base-128 varint
+func (d *Decoder) Varint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if d.pos >= len(d.buf) {
+			return 0, ErrTruncated
+		}
+		b := d.buf[d.pos]
+		d.pos++
+		v |= uint64(b&0x7F) << shift
+		if b < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("protowire: varint overflows 64 bits")
+}
+
+// Int64 reads a varint-encoded int64 or int32 field
+func (d *Decoder) Int64() (int64, error) {
+	v, err := d.Varint()
+	return int64(v), err
+}
+
+// Bool reads a varint-encoded bool field
+func (d *Decoder) Bool() (bool, error) {
+	v, err := d.Varint()
+	return v != 0, err
+}
+
+// Fixed32 reads a little-endian 32-bit value
+func (d *Decoder) Fixed32() (uint32, error) {
+	if len(d.buf)-d.pos < 4 {
+		return 0, ErrTruncated
+	}
+	v := binary.LittleEndian.Uint32(d.buf[d.pos:])
+	d.pos += 4
+	return v, nil
+}
+
+// Fixed64 reads a little-endian 64-bit value
+func (d *Decoder) Fixed64() (uint64, error) {
+	if len(d.buf)-d.pos < 8 {
+		return 0, ErrTruncated
+	}
+	v := binary.LittleEndian.Uint64(d.buf[d.pos:])
+	d.pos += 8
+	return v, nil
+}
+
+// Float reads a float field
+func (d *Decoder) Float() (float32, error) {
+	v, err := d.Fixed32()
+	return math.Float32frombits(v), err
+}
+
+// Double reads a double field
+func (d *Decoder) Double() (float64, error) {
+	v, err := d.Fixed64()
+	return math.Float64frombits(v), err
+}
+
+// Bytes reads a length-delimited field. The result aliases the input buffer.
+func (d *Decoder) Bytes() ([]byte, error) {
+	n, err := d.Varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.buf)-d.pos) {
+		return nil, ErrTruncated
+	}
+	b := d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// String reads a length-delimited string field
+func (d *Decoder) String() (string, error) {
+	b, err := d.Bytes()
+	return string(b), err
+}
+
+// Skip discards the value of a field with the given wire type
+func (d *Decoder) Skip(wireType int) error {
+	var err error
+	switch wireType {
+	case VarintType:
+		_, err = d.Varint()
+	case Fixed64Type:
+		_, err = d.Fixed64()
+	case BytesType:
+		_, err = d.Bytes()
+	case Fixed32Type:
+		_, err = d.Fixed32()
+	default:
+		err = fmt.Errorf("protowire: unsupported wire type %d", wireType)
+	}
+	return err
+}
+
+// PackedVarints reads a repeated varint field. Repeated scalars may be
+// encoded either packed in one length-delimited field or as individual
+// varints, so callers pass the wire type they observed.
+func (d *Decoder) PackedVarints(wireType int, dst []int64) ([]int64, error) {
+	if wireType == VarintType {
+		v, err := d.Int64()
+		return append(dst, v), err
+	}
+	b, err := d.Bytes()
+	if err != nil {
+		return dst, err
+	}
+	inner := NewDecoder(b)
+	for !inner.Done() {
+		v, err := inner.Int64()
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, v)
+	}
+	return dst, nil
+}
+
+// PackedFloats reads a repeated float field, packed or not
+func (d *Decoder) PackedFloats(wireType int, dst []float32) ([]float32, error) {
+	if wireType == Fixed32Type {
+		v, err := d.Float()
+		return append(dst, v), err
+	}
+	b, err := d.Bytes()
+	if err != nil {
+		return dst, err
+	}
+	if len(b)%4 != 0 {
+		return dst, ErrTruncated
+	}
+	for i := 0; i < len(b); i += 4 {
+		dst = append(dst, math.Float32frombits(binary.LittleEndian.Uint32(b[i:])))
+	}
+	return dst, nil
+}
+
+// AppendTag appends a field tag
+func AppendTag(b []byte, field, wireType int) []byte {
+	return AppendVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+// AppendVarint appends a base-128 varint
+func AppendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// AppendBytes appends a length-delimited value
+func AppendBytes(b []byte, v []byte) []byte {
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// AppendFixed32 appends a little-endian 32-bit value
+func AppendFixed32(b []byte, v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+// AppendFixed64 appends a little-endian 64-bit value
+func AppendFixed64(b []byte, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(b, v)
+}
@@ -0,0 +1,71 @@
+package protowire
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDecoder_RoundTrip(t *testing.T) {
+	var b []byte
+	b = AppendTag(b, 1, VarintType)
+	b = AppendVarint(b, 300)
+	b = AppendTag(b, 2, BytesType)
+	b = AppendBytes(b, []byte("hello"))
+	b = AppendTag(b, 3, Fixed32Type)
+	b = AppendFixed32(b, math.Float32bits(1.5))
+	b = AppendTag(b, 4, BytesType)
+	b = AppendBytes(b, AppendVarint(AppendVarint(nil, 7), 1<<40))
+	b = AppendTag(b, 5, Fixed64Type)
+	b = AppendFixed64(b, 42)
+
+	d := NewDecoder(b)
+	var ints []int64
+	for !d.Done() {
+		field, wt, err := d.Next()
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		switch field {
+		case 1:
+			v, err := d.Varint()
+			if err != nil || v != 300 {
+				t.Errorf("Expected varint 300, got %d (%v)", v, err)
+			}
+		case 2:
+			s, err := d.String()
+			if err != nil || s != "hello" {
+				t.Errorf("Expected 'hello', got %q (%v)", s, err)
+			}
+		case 3:
+			f, err := d.Float()
+			if err != nil || f != 1.5 {
+				t.Errorf("Expected 1.5, got %f (%v)", f, err)
+			}
+		case 4:
+			if ints, err = d.PackedVarints(wt, ints); err != nil {
+				t.Errorf("PackedVarints failed: %v", err)
+			}
+		default:
+			if err := d.Skip(wt); err != nil {
+				t.Errorf("Skip failed: %v", err)
+			}
+		}
+	}
+	if len(ints) != 2 || ints[0] != 7 || ints[1] != 1<<40 {
+		t.Errorf("Expected packed values [7 %d], got %v", int64(1<<40), ints)
+	}
+}
+
+func TestDecoder_Truncated(t *testing.T) {
+	b := AppendTag(nil, 1, BytesType)
+	b = AppendVarint(b, 10)
+	b = append(b, "short"...)
+
+	d := NewDecoder(b)
+	if _, _, err := d.Next(); err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if _, err := d.Bytes(); err != ErrTruncated {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+}
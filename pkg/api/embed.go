@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/tidwall/gjson"
+)
+
+var _ models.Embedder = (*HFModel)(nil)
+
+// Embed returns an embedding for each text using the feature-extraction task
+// of the Hugging Face API. Sentence-transformers models answer with one
+// pooled vector per text; other models answer with a vector per token,
+// which are mean pooled here.
+func (hf *HFModel) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return [][]float32{}, nil
+	}
+	payload := map[string]interface{}{
+		"inputs": texts,
+	}
+
+	response, err := hf.makeRequest(ctx, "POST", fmt.Sprintf("/pipeline/feature-extraction/%s", hf.ModelName), payload)
+	if err != nil {
+		return nil, fmt.Errorf("feature extraction request failed: %w", err)
+	}
+
+	if !gjson.Valid(response) {
+		return nil, fmt.Errorf("invalid JSON response: %s", response)
+	}
+	list := gjson.Parse(response).Array()
+	if len(list) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings in response, got %d", len(texts), len(list))
+	}
+
+	embeddings := make([][]float32, len(list))
+	for i, e := range list {
+		if embeddings[i], err = embedding(e); err != nil {
+			return nil, fmt.Errorf("embedding %d: %w", i, err)
+		}
+	}
+	return embeddings, nil
+}
+
+// embedding converts the features of one text, which are a vector, a
+// [tokens, dim] matrix or a matrix wrapped in a batch of one, to a vector
+func embedding(features gjson.Result) ([]float32, error) {
+	for features.Get("0.0").IsArray() {
+		features = features.Get("0")
+	}
+	rows := features.Array()
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no features in response")
+	}
+	if !rows[0].IsArray() {
+		return floats(rows), nil
+	}
+
+	// Mean pool the token vectors
+	sum := make([]float32, len(rows[0].Array()))
+	for _, row := range rows {
+		values := row.Array()
+		if len(values) != len(sum) {
+			return nil, fmt.Errorf("token vectors of %d and %d dimensions", len(sum), len(values))
+		}
+		for j, v := range values {
+			sum[j] += float32(v.Float())
+		}
+	}
+	for j := range sum {
+		sum[j] /= float32(len(rows))
+	}
+	return sum, nil
+}
+
+func floats(values []gjson.Result) []float32 {
+	f := make([]float32, len(values))
+	for i, v := range values {
+		f[i] = float32(v.Float())
+	}
+	return f
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHFModel_Embed(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		expected [][]float32
+	}{
+		{"pooled", `[[0.5, -1], [0.25, 2]]`, [][]float32{{0.5, -1}, {0.25, 2}}},
+		{"token level", `[[[1, 2], [3, 4]], [[0, 1]]]`, [][]float32{{2, 3}, {0, 1}}},
+		{"token level in a batch", `[[[[1, 2], [3, 6]]], [[[0, 1]]]]`, [][]float32{{2, 4}, {0, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/pipeline/feature-extraction/test-model" {
+					t.Errorf("Expected the feature-extraction pipeline, got %s", r.URL.Path)
+				}
+				var payload struct {
+					Inputs []string `json:"inputs"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || len(payload.Inputs) != 2 {
+					t.Errorf("Expected two inputs, got %+v (%v)", payload, err)
+				}
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			model := NewHFModel("test-model")
+			model.BaseURL = server.URL
+
+			embeddings, err := model.Embed(context.Background(), []string{"first", "second"})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(embeddings, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, embeddings)
+			}
+		})
+	}
+}
+
+func TestHFModel_EmbedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[[0.5, -1]]`))
+	}))
+	defer server.Close()
+
+	model := NewHFModel("test-model")
+	model.BaseURL = server.URL
+
+	if _, err := model.Embed(context.Background(), []string{"first", "second"}); err == nil {
+		t.Error("Expected an error when the response has fewer embeddings than texts")
+	}
+	embeddings, err := model.Embed(context.Background(), nil)
+	if err != nil || len(embeddings) != 0 {
+		t.Errorf("Expected no embeddings and no error for no texts, got %v, %v", embeddings, err)
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/tidwall/gjson"
+)
+
+// HFError is an error response of the Hugging Face Inference API. It
+// matches the errors in pkg/errs for the statuses that have one:
+// ErrUnauthorized for 401 and 403, ErrRateLimited for 429, ErrInvalidInput
+// for 400 and 422, and ErrModelLoading for a 503 while the model loads.
+type HFError struct {
+	StatusCode int
+
+	// Message is the error field of the response, or the response body when
+	// it has none
+	Message string
+
+	// EstimatedTime is how long a loading model expects to take before it
+	// can serve requests, zero when the response does not say
+	EstimatedTime time.Duration
+
+	Warnings []string
+
+	// RetryAfter is the wait the Retry-After header asks for, zero when the
+	// header is absent
+	RetryAfter time.Duration
+}
+
+func (e *HFError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+// Is reports whether target is the error in pkg/errs matching the status
+func (e *HFError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return target == errs.ErrUnauthorized
+	case http.StatusTooManyRequests:
+		return target == errs.ErrRateLimited
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return target == errs.ErrInvalidInput
+	case http.StatusServiceUnavailable:
+		return target == errs.ErrModelLoading && e.ModelLoading()
+	}
+	return false
+}
+
+// ModelLoading reports whether the error is a 503 sent while the model is
+// being loaded, which the API marks with an estimated time or a message
+// saying so
+func (e *HFError) ModelLoading() bool {
+	return e.StatusCode == http.StatusServiceUnavailable &&
+		(e.EstimatedTime > 0 || strings.Contains(e.Message, "currently loading"))
+}
+
+// newHFError parses an error response. The error field is a string, or a
+// list of strings for some validation errors.
+func newHFError(resp *http.Response, body []byte) *HFError {
+	e := &HFError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+	if !gjson.ValidBytes(body) {
+		return e
+	}
+
+	if msg := gjson.GetBytes(body, "error"); msg.IsArray() {
+		var parts []string
+		for _, m := range msg.Array() {
+			parts = append(parts, m.String())
+		}
+		e.Message = strings.Join(parts, "; ")
+	} else if msg.Exists() {
+		e.Message = msg.String()
+	}
+	if t := gjson.GetBytes(body, "estimated_time"); t.Exists() {
+		e.EstimatedTime = time.Duration(t.Float() * float64(time.Second))
+	}
+	for _, w := range gjson.GetBytes(body, "warnings").Array() {
+		e.Warnings = append(e.Warnings, w.String())
+	}
+	return e
+}
+
+// parseRetryAfter returns the wait a Retry-After header value asks for,
+// given either in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+func TestHFError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		expected   HFError
+		loading    bool
+	}{
+		{
+			name:     "model loading",
+			status:   http.StatusServiceUnavailable,
+			body:     `{"error": "Model test-model is currently loading", "estimated_time": 20.5}`,
+			expected: HFError{StatusCode: 503, Message: "Model test-model is currently loading", EstimatedTime: 20500 * time.Millisecond},
+			loading:  true,
+		},
+		{
+			name:       "rate limited",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "30",
+			body:       `{"error": "Rate limit reached", "warnings": ["Slow down"]}`,
+			expected:   HFError{StatusCode: 429, Message: "Rate limit reached", Warnings: []string{"Slow down"}, RetryAfter: 30 * time.Second},
+		},
+		{
+			name:     "validation errors",
+			status:   http.StatusBadRequest,
+			body:     `{"error": ["inputs is required", "max_new_tokens must be positive"]}`,
+			expected: HFError{StatusCode: 400, Message: "inputs is required; max_new_tokens must be positive"},
+		},
+		{
+			name:     "plain text body",
+			status:   http.StatusBadGateway,
+			body:     "upstream unavailable\n",
+			expected: HFError{StatusCode: 502, Message: "upstream unavailable"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			model := NewHFModel("test-model")
+			model.BaseURL = server.URL
+			model.Retry = RetryPolicy{}
+			_, err := model.Classify(context.Background(), "Hello")
+
+			var hfErr *HFError
+			if !errors.As(err, &hfErr) {
+				t.Fatalf("Expected an HFError, got %v", err)
+			}
+			if !reflect.DeepEqual(*hfErr, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, *hfErr)
+			}
+			if hfErr.ModelLoading() != tt.loading || errors.Is(err, errs.ErrModelLoading) != tt.loading {
+				t.Errorf("Expected model loading %v, got %v", tt.loading, hfErr.ModelLoading())
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{"Wed, 01 May 2024 12:00:45 GMT", 45 * time.Second},
+		{"Wed, 01 May 2024 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.expected {
+			t.Errorf("parseRetryAfter(%q): expected %v, got %v", tt.value, tt.expected, got)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/kelleyblackmore/go-transformer/pkg/models"
@@ -25,9 +26,16 @@ type HFModel struct {
 	APIToken  string
 	Client    *http.Client
 	BaseURL   string
+
+	// Retry controls how failed requests are retried. The zero value sends
+	// every request once.
+	Retry RetryPolicy
 }
 
-// NewHFModel creates a new Hugging Face model instance
+// NewHFModel creates a new Hugging Face model instance. It retries failed
+// requests according to DefaultRetryPolicy, so a call may make several
+// attempts and wait between them; set Retry to the zero RetryPolicy to send
+// every request once.
 func NewHFModel(modelName string) *HFModel {
 	apiToken := os.Getenv("HUGGINGFACE_API_TOKEN")
 	if apiToken == "" {
@@ -41,10 +49,12 @@ func NewHFModel(modelName string) *HFModel {
 			Timeout: DefaultTimeout,
 		},
 		BaseURL: HuggingFaceAPIBase,
+		Retry:   DefaultRetryPolicy,
 	}
 }
 
-// NewHFModelWithToken creates a new Hugging Face model instance with explicit token
+// NewHFModelWithToken creates a new Hugging Face model instance with explicit
+// token. Like NewHFModel, it retries according to DefaultRetryPolicy.
 func NewHFModelWithToken(modelName, apiToken string) *HFModel {
 	return &HFModel{
 		ModelName: modelName,
@@ -53,9 +63,16 @@ func NewHFModelWithToken(modelName, apiToken string) *HFModel {
 			Timeout: DefaultTimeout,
 		},
 		BaseURL: HuggingFaceAPIBase,
+		Retry:   DefaultRetryPolicy,
 	}
 }
 
+var (
+	_ models.Model          = (*HFModel)(nil)
+	_ models.Classifier     = (*HFModel)(nil)
+	_ models.MultiGenerator = (*HFModel)(nil)
+)
+
 // GetModelInfo returns information about the model
 func (hf *HFModel) GetModelInfo() *models.ModelInfo {
 	return &models.ModelInfo{
@@ -65,38 +82,154 @@ func (hf *HFModel) GetModelInfo() *models.ModelInfo {
 	}
 }
 
-// Classify performs text classification using Hugging Face API
+// Classify performs text classification using Hugging Face API, returning
+// the most likely label
 func (hf *HFModel) Classify(ctx context.Context, text string) (*models.ClassificationResult, error) {
+	results, err := hf.classify(ctx, text, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// ClassifyAll returns the scores of the labels for text, best first. TopK
+// and FunctionToApply are sent to the API as top_k and function_to_apply.
+// The labels it returns are then sorted by score, those below Threshold are
+// dropped and at most TopK are kept. Deployments that ignore top_k return
+// only the best label, so the result may hold a single label even when
+// TopK asks for more.
+func (hf *HFModel) ClassifyAll(ctx context.Context, text string, options *models.ClassificationOptions) ([]models.ClassificationResult, error) {
+	if options == nil {
+		options = &models.ClassificationOptions{}
+	}
+	parameters := make(map[string]interface{})
+	if options.TopK > 0 {
+		parameters["top_k"] = options.TopK
+	}
+	if options.FunctionToApply != "" {
+		parameters["function_to_apply"] = options.FunctionToApply
+	}
+
+	results, err := hf.classify(ctx, text, parameters)
+	if err != nil {
+		return nil, err
+	}
+	if options.Threshold > 0 {
+		kept := results[:0]
+		for _, r := range results {
+			if r.Score >= options.Threshold {
+				kept = append(kept, r)
+			}
+		}
+		results = kept
+	}
+	if options.TopK > 0 && len(results) > options.TopK {
+		results = results[:options.TopK]
+	}
+	return results, nil
+}
+
+// classify requests the label scores for text, best first
+func (hf *HFModel) classify(ctx context.Context, text string, parameters map[string]interface{}) ([]models.ClassificationResult, error) {
 	payload := map[string]interface{}{
 		"inputs": text,
 	}
+	if len(parameters) > 0 {
+		payload["parameters"] = parameters
+	}
 
 	response, err := hf.makeRequest(ctx, "POST", fmt.Sprintf("/models/%s", hf.ModelName), payload)
 	if err != nil {
 		return nil, fmt.Errorf("classification request failed: %w", err)
 	}
 
-	// Parse the response - HF returns an array of classification results
+	// Parse the response - HF returns an array of classification results,
+	// nested in another array for each input on most models
 	if !gjson.Valid(response) {
 		return nil, fmt.Errorf("invalid JSON response: %s", response)
 	}
+	list := gjson.Parse(response)
+	if first := list.Get("0"); first.IsArray() {
+		list = first
+	}
 
-	result := gjson.Get(response, "0")
-	if !result.Exists() {
+	var results []models.ClassificationResult
+	for _, r := range list.Array() {
+		results = append(results, models.ClassificationResult{
+			Label: r.Get("label").String(),
+			Score: r.Get("score").Float(),
+		})
+	}
+	if len(results) == 0 {
 		return nil, fmt.Errorf("no classification results in response")
 	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results, nil
+}
+
+// Generate performs text generation and returns the first sequence
+func (hf *HFModel) Generate(ctx context.Context, prompt string, options *models.GenerationOptions) (*models.GenerationResult, error) {
+	results, err := hf.GenerateAll(ctx, prompt, options)
+	if err != nil {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// GenerateAll performs text generation and returns every sequence the API
+// generated. The reason each one finished is only reported when
+// options.Details or options.Stop is set.
+func (hf *HFModel) GenerateAll(ctx context.Context, prompt string, options *models.GenerationOptions) ([]models.GenerationResult, error) {
+	payload := generationPayload(prompt, options)
+
+	response, err := hf.makeRequest(ctx, "POST", fmt.Sprintf("/models/%s", hf.ModelName), payload)
+	if err != nil {
+		return nil, fmt.Errorf("generation request failed: %w", err)
+	}
+
+	// Parse the response
+	if !gjson.Valid(response) {
+		return nil, fmt.Errorf("invalid JSON response: %s", response)
+	}
 
-	label := gjson.Get(result.Raw, "label").String()
-	score := gjson.Get(result.Raw, "score").Float()
+	// Sequences come as a list, or as a single object with the other
+	// best_of sequences in its details
+	parsed := gjson.Parse(response)
+	sequences := []gjson.Result{parsed}
+	if parsed.IsArray() {
+		sequences = parsed.Array()
+	}
 
-	return &models.ClassificationResult{
-		Label: label,
-		Score: score,
-	}, nil
+	var results []models.GenerationResult
+	for _, seq := range sequences {
+		if !seq.Get("generated_text").Exists() {
+			continue
+		}
+		results = append(results, generationResult(seq))
+		for _, other := range seq.Get("details.best_of_sequences").Array() {
+			results = append(results, generationResult(other))
+		}
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no generation results in response")
+	}
+	return results, nil
 }
 
-// Generate performs text generation using Hugging Face API
-func (hf *HFModel) Generate(ctx context.Context, prompt string, options *models.GenerationOptions) (*models.GenerationResult, error) {
+// generationResult converts a generated sequence of the API response
+func generationResult(seq gjson.Result) models.GenerationResult {
+	reason := seq.Get("details.finish_reason")
+	if !reason.Exists() {
+		reason = seq.Get("finish_reason")
+	}
+	return models.GenerationResult{
+		GeneratedText: seq.Get("generated_text").String(),
+		FinishReason:  reason.String(),
+	}
+}
+
+// generationPayload builds the request body for text generation
+func generationPayload(prompt string, options *models.GenerationOptions) map[string]interface{} {
 	payload := map[string]interface{}{
 		"inputs": prompt,
 	}
@@ -108,6 +241,9 @@ func (hf *HFModel) Generate(ctx context.Context, prompt string, options *models.
 		if options.MaxLength > 0 {
 			parameters["max_length"] = options.MaxLength
 		}
+		if options.MaxNewTokens > 0 {
+			parameters["max_new_tokens"] = options.MaxNewTokens
+		}
 		if options.Temperature > 0 {
 			parameters["temperature"] = options.Temperature
 		}
@@ -117,77 +253,140 @@ func (hf *HFModel) Generate(ctx context.Context, prompt string, options *models.
 		if options.TopK > 0 {
 			parameters["top_k"] = options.TopK
 		}
+		if options.TypicalP > 0 {
+			parameters["typical_p"] = options.TypicalP
+		}
+		if options.RepetitionPenalty > 0 {
+			parameters["repetition_penalty"] = options.RepetitionPenalty
+		}
 		if options.DoSample {
 			parameters["do_sample"] = options.DoSample
 		}
 		if options.NumReturn > 0 {
 			parameters["num_return_sequences"] = options.NumReturn
 		}
+		if options.ReturnFullText != nil {
+			parameters["return_full_text"] = *options.ReturnFullText
+		}
+		if len(options.Stop) > 0 {
+			parameters["stop"] = options.Stop
+		}
+		if options.Seed != nil {
+			parameters["seed"] = *options.Seed
+		}
+		if options.Truncate > 0 {
+			parameters["truncate"] = options.Truncate
+		}
+		// The finish reason tells whether a stop sequence ended generation
+		if options.Details || len(options.Stop) > 0 {
+			parameters["details"] = true
+		}
 
 		if len(parameters) > 0 {
 			payload["parameters"] = parameters
 		}
-	}
 
-	response, err := hf.makeRequest(ctx, "POST", fmt.Sprintf("/models/%s", hf.ModelName), payload)
-	if err != nil {
-		return nil, fmt.Errorf("generation request failed: %w", err)
+		apiOptions := make(map[string]interface{})
+		if options.UseCache != nil {
+			apiOptions["use_cache"] = *options.UseCache
+		}
+		if options.WaitForModel {
+			apiOptions["wait_for_model"] = true
+		}
+		if len(apiOptions) > 0 {
+			payload["options"] = apiOptions
+		}
 	}
+	return payload
+}
 
-	// Parse the response
-	if !gjson.Valid(response) {
-		return nil, fmt.Errorf("invalid JSON response: %s", response)
+// setParameter sets a generation parameter of payload
+func setParameter(payload map[string]interface{}, name string, value interface{}) {
+	parameters, _ := payload["parameters"].(map[string]interface{})
+	if parameters == nil {
+		parameters = make(map[string]interface{})
+		payload["parameters"] = parameters
 	}
+	parameters[name] = value
+}
 
-	result := gjson.Get(response, "0")
-	if !result.Exists() {
-		return nil, fmt.Errorf("no generation results in response")
+// makeRequest makes an HTTP request to the Hugging Face API, retrying it
+// according to hf.Retry
+func (hf *HFModel) makeRequest(ctx context.Context, method, endpoint string, payload interface{}) (string, error) {
+	jsonData, err := hf.marshal(payload)
+	if err != nil {
+		return "", err
 	}
 
-	generatedText := gjson.Get(result.Raw, "generated_text").String()
+	return withRetries(ctx, hf.Retry, func() (string, error) {
+		resp, err := hf.send(ctx, method, hf.BaseURL+endpoint, jsonData, "application/json")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
 
-	return &models.GenerationResult{
-		GeneratedText: generatedText,
-	}, nil
+		responseBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", &transportError{"failed to read response", err}
+		}
+		return string(responseBody), nil
+	})
 }
 
-// makeRequest makes an HTTP request to the Hugging Face API
-func (hf *HFModel) makeRequest(ctx context.Context, method, endpoint string, payload interface{}) (string, error) {
-	var body io.Reader
-
-	if payload != nil {
-		jsonData, err := json.Marshal(payload)
-		if err != nil {
-			return "", fmt.Errorf("failed to marshal payload: %w", err)
+// marshal encodes a request payload, asking the API to wait for a loading
+// model when hf.Retry says so
+func (hf *HFModel) marshal(payload interface{}) ([]byte, error) {
+	if payload == nil {
+		return nil, nil
+	}
+	if m, ok := payload.(map[string]interface{}); ok && hf.Retry.WaitForModel {
+		options, _ := m["options"].(map[string]interface{})
+		if options == nil {
+			options = make(map[string]interface{})
+			m["options"] = options
 		}
-		body = bytes.NewBuffer(jsonData)
+		options["wait_for_model"] = true
+	}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return jsonData, nil
+}
+
+// send makes a single HTTP request, returning the response when its status
+// is 200 and an *HFError otherwise
+func (hf *HFModel) send(ctx context.Context, method, url string, jsonData []byte, accept string) (*http.Response, error) {
+	var body io.Reader
+	if jsonData != nil {
+		body = bytes.NewReader(jsonData)
 	}
 
-	url := hf.BaseURL + endpoint
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
 	if hf.APIToken != "" {
 		req.Header.Set("Authorization", "Bearer "+hf.APIToken)
 	}
-
-	resp, err := hf.Client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+	if hf.Retry.WaitForModel {
+		req.Header.Set("x-wait-for-model", "true")
 	}
-	defer resp.Body.Close()
 
-	responseBody, err := io.ReadAll(resp.Body)
+	resp, err := hf.Client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return nil, &transportError{"failed to make request", err}
 	}
-
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(responseBody))
+		defer resp.Body.Close()
+		responseBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, &transportError{"failed to read response", err}
+		}
+		return nil, newHFError(resp, responseBody)
 	}
-
-	return string(responseBody), nil
+	return resp, nil
 }
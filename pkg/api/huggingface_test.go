@@ -2,11 +2,15 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
 	"github.com/kelleyblackmore/go-transformer/pkg/models"
 )
 
@@ -89,6 +93,54 @@ func TestHFModel_Classify(t *testing.T) {
 	}
 }
 
+func TestHFModel_ClassifyNested(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[[{"label": "NEGATIVE", "score": 0.2}, {"label": "POSITIVE", "score": 0.8}]]`))
+	}))
+	defer server.Close()
+
+	model := NewHFModel("test-model")
+	model.BaseURL = server.URL
+
+	result, err := model.Classify(context.Background(), "This is a test")
+	if err != nil {
+		t.Fatalf("Classification failed: %v", err)
+	}
+	if result.Label != "POSITIVE" || result.Score != 0.8 {
+		t.Errorf("Expected POSITIVE with score 0.8, got %s with %f", result.Label, result.Score)
+	}
+}
+
+func TestHFModel_ClassifyAll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Parameters map[string]interface{} `json:"parameters"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		expected := map[string]interface{}{"top_k": float64(2), "function_to_apply": "sigmoid"}
+		if !reflect.DeepEqual(payload.Parameters, expected) {
+			t.Errorf("Expected parameters %v, got %v", expected, payload.Parameters)
+		}
+		_, _ = w.Write([]byte(`[[{"label": "joy", "score": 0.4}, {"label": "love", "score": 0.9}, {"label": "anger", "score": 0.1}]]`))
+	}))
+	defer server.Close()
+
+	model := NewHFModel("test-model")
+	model.BaseURL = server.URL
+
+	results, err := model.ClassifyAll(context.Background(), "This is a test",
+		&models.ClassificationOptions{TopK: 2, FunctionToApply: models.FunctionSigmoid, Threshold: 0.3})
+	if err != nil {
+		t.Fatalf("Classification failed: %v", err)
+	}
+	expected := []models.ClassificationResult{{Label: "love", Score: 0.9}, {Label: "joy", Score: 0.4}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, results)
+	}
+}
+
 func TestHFModel_Generate(t *testing.T) {
 	// Mock server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -125,6 +177,99 @@ func TestHFModel_Generate(t *testing.T) {
 	}
 }
 
+func TestHFModel_GenerateAll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Parameters map[string]interface{} `json:"parameters"`
+			Options    map[string]interface{} `json:"options"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		expected := map[string]interface{}{
+			"max_new_tokens":       float64(20),
+			"repetition_penalty":   1.2,
+			"return_full_text":     false,
+			"stop":                 []interface{}{"\n"},
+			"seed":                 float64(42),
+			"typical_p":            0.9,
+			"truncate":             float64(100),
+			"do_sample":            true,
+			"num_return_sequences": float64(2),
+			"details":              true,
+		}
+		if !reflect.DeepEqual(payload.Parameters, expected) {
+			t.Errorf("Expected parameters %v, got %v", expected, payload.Parameters)
+		}
+		expectedOptions := map[string]interface{}{"use_cache": false, "wait_for_model": true}
+		if !reflect.DeepEqual(payload.Options, expectedOptions) {
+			t.Errorf("Expected options %v, got %v", expectedOptions, payload.Options)
+		}
+
+		_, _ = w.Write([]byte(`[
+			{"generated_text": " world", "details": {"finish_reason": "stop_sequence", "generated_tokens": 2}},
+			{"generated_text": " there, how are you", "details": {"finish_reason": "length", "generated_tokens": 20,
+				"best_of_sequences": [{"generated_text": " friend", "finish_reason": "eos_token"}]}}
+		]`))
+	}))
+	defer server.Close()
+
+	model := NewHFModel("test-model")
+	model.BaseURL = server.URL
+
+	fullText, useCache, seed := false, false, int64(42)
+	results, err := model.GenerateAll(context.Background(), "Hello", &models.GenerationOptions{
+		MaxNewTokens:      20,
+		RepetitionPenalty: 1.2,
+		ReturnFullText:    &fullText,
+		Stop:              []string{"\n"},
+		Seed:              &seed,
+		TypicalP:          0.9,
+		Truncate:          100,
+		DoSample:          true,
+		NumReturn:         2,
+		Details:           true,
+		UseCache:          &useCache,
+		WaitForModel:      true,
+	})
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	expected := []models.GenerationResult{
+		{GeneratedText: " world", FinishReason: models.FinishStopSequence},
+		{GeneratedText: " there, how are you", FinishReason: models.FinishLength},
+		{GeneratedText: " friend", FinishReason: models.FinishEOSToken},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, results)
+	}
+}
+
+func TestHFModel_GenerateSingleObject(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		if expected := map[string]interface{}{"inputs": "Hello"}; !reflect.DeepEqual(payload, expected) {
+			t.Errorf("Expected payload %v, got %v", expected, payload)
+		}
+		_, _ = w.Write([]byte(`{"generated_text": "Hello world", "details": {"finish_reason": "eos_token"}}`))
+	}))
+	defer server.Close()
+
+	model := NewHFModel("test-model")
+	model.BaseURL = server.URL
+
+	result, err := model.Generate(context.Background(), "Hello", nil)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if result.GeneratedText != "Hello world" || result.FinishReason != models.FinishEOSToken {
+		t.Errorf("Expected Hello world finished by eos_token, got %+v", result)
+	}
+}
+
 func TestHFModel_APIError(t *testing.T) {
 	// Mock server that returns an error
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -148,3 +293,49 @@ func TestHFModel_APIError(t *testing.T) {
 		t.Error("Expected a non-empty error message")
 	}
 }
+
+func TestHFModel_ErrorKinds(t *testing.T) {
+	tests := []struct {
+		status   int
+		body     string
+		expected error
+	}{
+		{http.StatusUnauthorized, `{"error": "Invalid credentials in Authorization header"}`, errs.ErrUnauthorized},
+		{http.StatusForbidden, `{"error": "Forbidden"}`, errs.ErrUnauthorized},
+		{http.StatusTooManyRequests, `{"error": "Rate limit reached"}`, errs.ErrRateLimited},
+		{http.StatusServiceUnavailable, `{"error": "Model test-model is currently loading", "estimated_time": 20.0}`, errs.ErrModelLoading},
+		{http.StatusBadRequest, `{"error": "Input should be a valid string"}`, errs.ErrInvalidInput},
+		{http.StatusUnprocessableEntity, `{"error": "Input validation error"}`, errs.ErrInvalidInput},
+	}
+	kinds := []error{errs.ErrUnauthorized, errs.ErrRateLimited, errs.ErrModelLoading, errs.ErrInvalidInput}
+
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			_, _ = w.Write([]byte(tt.body))
+		}))
+		model := NewHFModel("test-model")
+		model.BaseURL = server.URL
+		model.Retry = RetryPolicy{}
+
+		_, err := model.Generate(context.Background(), "Hello", nil)
+		for _, kind := range kinds {
+			if errors.Is(err, kind) != (kind == tt.expected) {
+				t.Errorf("Status %d: expected errors.Is(%v) to be %v, got error %v", tt.status, kind, kind == tt.expected, err)
+			}
+		}
+		server.Close()
+	}
+
+	// A 503 without an estimated time is not a loading model
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	model := NewHFModel("test-model")
+	model.BaseURL = server.URL
+	model.Retry = RetryPolicy{}
+	if _, err := model.Classify(context.Background(), "Hello"); err == nil || errors.Is(err, errs.ErrModelLoading) {
+		t.Errorf("Expected an error other than ErrModelLoading, got %v", err)
+	}
+}
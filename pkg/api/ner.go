@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/tidwall/gjson"
+)
+
+var _ models.TokenClassifier = (*HFModel)(nil)
+
+// ClassifyTokens labels the tokens of text using the token-classification
+// task of the Hugging Face API, which also performs the aggregation
+func (hf *HFModel) ClassifyTokens(ctx context.Context, text string, options *models.TokenClassificationOptions) ([]models.Entity, error) {
+	payload := map[string]interface{}{
+		"inputs": text,
+	}
+	if options != nil {
+		parameters := make(map[string]interface{})
+		if options.AggregationStrategy != "" {
+			parameters["aggregation_strategy"] = options.AggregationStrategy
+		}
+		if options.IgnoreLabels != nil {
+			parameters["ignore_labels"] = options.IgnoreLabels
+		}
+		if len(parameters) > 0 {
+			payload["parameters"] = parameters
+		}
+	}
+
+	response, err := hf.makeRequest(ctx, "POST", fmt.Sprintf("/models/%s", hf.ModelName), payload)
+	if err != nil {
+		return nil, fmt.Errorf("token classification request failed: %w", err)
+	}
+
+	// Parse the response - aggregated entities are labelled by entity_group
+	// and single tokens by entity
+	if !gjson.Valid(response) {
+		return nil, fmt.Errorf("invalid JSON response: %s", response)
+	}
+	list := gjson.Parse(response)
+	if !list.IsArray() {
+		return nil, fmt.Errorf("unexpected token classification response: %s", response)
+	}
+
+	entities := make([]models.Entity, 0, len(list.Array()))
+	for _, e := range list.Array() {
+		label := e.Get("entity_group")
+		if !label.Exists() {
+			label = e.Get("entity")
+		}
+		entities = append(entities, models.Entity{
+			Label: label.String(),
+			Score: e.Get("score").Float(),
+			Word:  e.Get("word").String(),
+			Start: int(e.Get("start").Int()),
+			End:   int(e.Get("end").Int()),
+		})
+	}
+	return entities, nil
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+)
+
+func TestHFModel_ClassifyTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  *models.TokenClassificationOptions
+		params   map[string]interface{}
+		response string
+		expected []models.Entity
+	}{
+		{
+			name:     "aggregated",
+			options:  &models.TokenClassificationOptions{AggregationStrategy: models.AggregationSimple},
+			params:   map[string]interface{}{"aggregation_strategy": "simple"},
+			response: `[{"entity_group": "PER", "score": 0.99, "word": "Wolfgang", "start": 11, "end": 19}]`,
+			expected: []models.Entity{{Label: "PER", Score: 0.99, Word: "Wolfgang", Start: 11, End: 19}},
+		},
+		{
+			name:     "tokens",
+			options:  &models.TokenClassificationOptions{IgnoreLabels: []string{}},
+			params:   map[string]interface{}{"ignore_labels": []interface{}{}},
+			response: `[{"entity": "B-PER", "score": 0.98, "index": 4, "word": "Wolf", "start": 11, "end": 15}, {"entity": "I-PER", "score": 0.97, "index": 5, "word": "##gang", "start": 15, "end": 19}]`,
+			expected: []models.Entity{
+				{Label: "B-PER", Score: 0.98, Word: "Wolf", Start: 11, End: 15},
+				{Label: "I-PER", Score: 0.97, Word: "##gang", Start: 15, End: 19},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var payload struct {
+					Inputs     string                 `json:"inputs"`
+					Parameters map[string]interface{} `json:"parameters"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("Failed to decode payload: %v", err)
+				}
+				if !reflect.DeepEqual(payload.Parameters, tt.params) {
+					t.Errorf("Expected parameters %v, got %v", tt.params, payload.Parameters)
+				}
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			model := NewHFModel("test-model")
+			model.BaseURL = server.URL
+
+			entities, err := model.ClassifyTokens(context.Background(), "My name is Wolfgang", tt.options)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(entities, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, entities)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/tidwall/gjson"
+)
+
+var _ models.QuestionAnswerer = (*HFModel)(nil)
+
+// Answer extracts the answer to question from passage using the
+// question-answering task of the Hugging Face API
+func (hf *HFModel) Answer(ctx context.Context, question, passage string, options *models.QuestionAnsweringOptions) (*models.QuestionAnswer, error) {
+	payload := map[string]interface{}{
+		"inputs": map[string]string{
+			"question": question,
+			"context":  passage,
+		},
+	}
+	if options != nil {
+		parameters := make(map[string]interface{})
+		if options.MaxAnswerLength > 0 {
+			parameters["max_answer_len"] = options.MaxAnswerLength
+		}
+		if options.MaxSeqLength > 0 {
+			parameters["max_seq_len"] = options.MaxSeqLength
+		}
+		if options.DocStride > 0 {
+			parameters["doc_stride"] = options.DocStride
+		}
+		if len(parameters) > 0 {
+			payload["parameters"] = parameters
+		}
+	}
+
+	response, err := hf.makeRequest(ctx, "POST", fmt.Sprintf("/models/%s", hf.ModelName), payload)
+	if err != nil {
+		return nil, fmt.Errorf("question answering request failed: %w", err)
+	}
+
+	// Parse the response - a single answer, or a list of them best first
+	if !gjson.Valid(response) {
+		return nil, fmt.Errorf("invalid JSON response: %s", response)
+	}
+	answer := gjson.Parse(response)
+	if answer.IsArray() {
+		answer = answer.Get("0")
+	}
+	if !answer.Get("answer").Exists() {
+		return nil, fmt.Errorf("no answer in response")
+	}
+
+	return &models.QuestionAnswer{
+		Answer: answer.Get("answer").String(),
+		Score:  answer.Get("score").Float(),
+		Start:  int(answer.Get("start").Int()),
+		End:    int(answer.Get("end").Int()),
+	}, nil
+}
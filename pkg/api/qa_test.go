@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+)
+
+func TestHFModel_Answer(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{"single answer", `{"score": 0.97, "start": 11, "end": 16, "answer": "Paris"}`},
+		{"top answers", `[{"score": 0.97, "start": 11, "end": 16, "answer": "Paris"}, {"score": 0.01, "start": 0, "end": 5, "answer": "Where"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var payload struct {
+					Inputs     map[string]string      `json:"inputs"`
+					Parameters map[string]interface{} `json:"parameters"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("Failed to decode payload: %v", err)
+				}
+				expectedInputs := map[string]string{"question": "Where do I live?", "context": "My home is Paris."}
+				if !reflect.DeepEqual(payload.Inputs, expectedInputs) {
+					t.Errorf("Expected inputs %v, got %v", expectedInputs, payload.Inputs)
+				}
+				expectedParameters := map[string]interface{}{"max_answer_len": float64(5), "doc_stride": float64(64)}
+				if !reflect.DeepEqual(payload.Parameters, expectedParameters) {
+					t.Errorf("Expected parameters %v, got %v", expectedParameters, payload.Parameters)
+				}
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			model := NewHFModel("test-model")
+			model.BaseURL = server.URL
+
+			answer, err := model.Answer(context.Background(), "Where do I live?", "My home is Paris.",
+				&models.QuestionAnsweringOptions{MaxAnswerLength: 5, DocStride: 64})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			expected := &models.QuestionAnswer{Answer: "Paris", Score: 0.97, Start: 11, End: 16}
+			if !reflect.DeepEqual(answer, expected) {
+				t.Errorf("Expected %+v, got %+v", expected, answer)
+			}
+		})
+	}
+}
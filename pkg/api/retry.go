@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how HFModel retries requests that failed because of a
+// rate limit, a model that is still loading or a transient server or
+// network error
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. A
+	// value of 0 or 1 disables retries.
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the first retry. It grows by
+	// Multiplier for each further retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Jitter randomizes each backoff by up to this fraction of it in either
+	// direction, so that clients failing together do not retry together
+	Jitter float64
+
+	// MaxWait caps the waits the server asks for through Retry-After or
+	// estimated_time. When it is zero, MaxBackoff caps them instead.
+	MaxWait time.Duration
+
+	// WaitForModel asks the API to hold requests for a cold model until it
+	// has loaded, instead of answering 503 straight away
+	WaitForModel bool
+}
+
+// DefaultRetryPolicy is the retry policy of the models returned by
+// NewHFModel and NewHFModelWithToken
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	MaxWait:        2 * time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// transportError is a failure to send a request or to read its response,
+// which, unlike a request that could not be built, may be transient
+type transportError struct {
+	op  string
+	err error
+}
+
+func (e *transportError) Error() string { return e.op + ": " + e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+// retryable reports whether a failed request may succeed when sent again
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var tErr *transportError
+	if errors.As(err, &tErr) {
+		return true
+	}
+	var hfErr *HFError
+	if !errors.As(err, &hfErr) {
+		return false
+	}
+	switch hfErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// delay returns the wait before retry number retry, counting from 1. The
+// jittered exponential backoff is capped at MaxBackoff, then lengthened to
+// the Retry-After header or the estimated loading time of an HFError when
+// those are longer, up to MaxWait.
+func (p RetryPolicy) delay(retry int, err error, rng func() float64) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(max(p.Multiplier, 1), float64(retry-1))
+	backoff *= 1 + p.Jitter*(2*rng()-1)
+	if p.MaxBackoff > 0 {
+		backoff = min(backoff, float64(p.MaxBackoff))
+	}
+	d := time.Duration(max(backoff, 0))
+
+	var hfErr *HFError
+	if errors.As(err, &hfErr) {
+		hint := max(hfErr.RetryAfter, hfErr.EstimatedTime)
+		if limit := p.maxWait(); limit > 0 {
+			hint = min(hint, limit)
+		}
+		d = max(d, hint)
+	}
+	return d
+}
+
+// maxWait returns the longest wait the server may ask for, or 0 when the
+// policy sets no bound
+func (p RetryPolicy) maxWait() time.Duration {
+	if p.MaxWait > 0 {
+		return p.MaxWait
+	}
+	return p.MaxBackoff
+}
+
+// sleep waits for d, returning false without waiting when the context would
+// expire first or true once d has passed
+func sleep(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// withRetries calls do until it succeeds, fails with an error that is not
+// worth retrying, or runs out of attempts or time
+func withRetries[T any](ctx context.Context, p RetryPolicy, do func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := do()
+		if err == nil || attempt >= p.MaxAttempts || !retryable(ctx, err) {
+			return result, err
+		}
+		if !sleep(ctx, p.delay(attempt, err, rand.Float64)) {
+			var zero T
+			return zero, err
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+// fastRetries retries quickly so that tests do not wait on real backoffs
+var fastRetries = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Multiplier: 2}
+
+func TestHFModel_RetryModelLoading(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-wait-for-model") != "true" {
+			t.Errorf("Expected x-wait-for-model header, got %q", r.Header.Get("x-wait-for-model"))
+		}
+		var payload struct {
+			Options struct {
+				WaitForModel bool `json:"wait_for_model"`
+			} `json:"options"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || !payload.Options.WaitForModel {
+			t.Errorf("Expected options.wait_for_model in the payload, got %+v (%v)", payload, err)
+		}
+
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error": "Model test-model is currently loading", "estimated_time": 0.002}`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"label": "POSITIVE", "score": 0.9}]`))
+	}))
+	defer server.Close()
+
+	model := NewHFModel("test-model")
+	model.BaseURL = server.URL
+	model.Retry = fastRetries
+	model.Retry.WaitForModel = true
+
+	result, err := model.Classify(context.Background(), "Hello")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Label != "POSITIVE" {
+		t.Errorf("Expected POSITIVE, got %s", result.Label)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+}
+
+func TestHFModel_RetryLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		attempts int32
+		expected error
+	}{
+		{"rate limit until attempts run out", http.StatusTooManyRequests, 3, errs.ErrRateLimited},
+		{"bad request is not retried", http.StatusBadRequest, 1, errs.ErrInvalidInput},
+		{"unauthorized is not retried", http.StatusUnauthorized, 1, errs.ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(`{"error": "failed"}`))
+			}))
+			defer server.Close()
+
+			model := NewHFModel("test-model")
+			model.BaseURL = server.URL
+			model.Retry = fastRetries
+
+			if _, err := model.Generate(context.Background(), "Hello", nil); !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+			if n := attempts.Load(); n != tt.attempts {
+				t.Errorf("Expected %d attempts, got %d", tt.attempts, n)
+			}
+		})
+	}
+}
+
+func TestHFModel_RetryTransport(t *testing.T) {
+	// A server that is gone fails every attempt
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	model := NewHFModel("test-model")
+	model.BaseURL = server.URL
+	model.Retry = fastRetries
+	var tErr *transportError
+	if _, err := model.Classify(context.Background(), "Hello"); !errors.As(err, &tErr) {
+		t.Errorf("Expected a transport error, got %v", err)
+	}
+	if !retryable(context.Background(), tErr) {
+		t.Error("Expected a transport error to be retried")
+	}
+
+	// A request that cannot be built is not retried
+	model.BaseURL = "http://bad host"
+	model.Retry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute}
+	start := time.Now()
+	if _, err := model.Classify(context.Background(), "Hello"); err == nil {
+		t.Error("Expected an error for a malformed URL")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected no retries of a malformed request, took %v", elapsed)
+	}
+}
+
+func TestHFModel_RetryDeadline(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	model := NewHFModel("test-model")
+	model.BaseURL = server.URL
+
+	// Waiting a minute would outlast the deadline, so the error is returned
+	// straight away
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := model.Classify(ctx, "Hello")
+	if !errors.Is(err, errs.ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second || attempts.Load() != 1 {
+		t.Errorf("Expected one attempt without waiting, got %d in %v", attempts.Load(), elapsed)
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, MaxWait: time.Minute, Multiplier: 2, Jitter: 0.2}
+	middle := func() float64 { return 0.5 }
+	for retry, expected := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		if got := p.delay(retry+1, errors.New("connection reset"), middle); got != expected*time.Millisecond {
+			t.Errorf("Retry %d: expected %v, got %v", retry+1, expected*time.Millisecond, got)
+		}
+	}
+
+	// Jitter of up to 20% either way
+	if got := p.delay(1, nil, func() float64 { return 1 }); got != 120*time.Millisecond {
+		t.Errorf("Expected 120ms, got %v", got)
+	}
+	if got := p.delay(1, nil, func() float64 { return 0 }); got != 80*time.Millisecond {
+		t.Errorf("Expected 80ms, got %v", got)
+	}
+	if got := p.delay(5, nil, func() float64 { return 1 }); got != time.Second {
+		t.Errorf("Expected the jittered backoff capped at 1s, got %v", got)
+	}
+
+	// Server hints longer than the backoff win
+	if got := p.delay(1, &HFError{StatusCode: 429, RetryAfter: 5 * time.Second}, middle); got != 5*time.Second {
+		t.Errorf("Expected the Retry-After of 5s, got %v", got)
+	}
+	if got := p.delay(1, &HFError{StatusCode: 503, EstimatedTime: 20 * time.Second}, middle); got != 20*time.Second {
+		t.Errorf("Expected the estimated time of 20s, got %v", got)
+	}
+
+	// but only up to MaxWait, or MaxBackoff when it is not set
+	if got := p.delay(1, &HFError{StatusCode: 429, RetryAfter: 24 * time.Hour}, middle); got != time.Minute {
+		t.Errorf("Expected the Retry-After to be capped at 1m, got %v", got)
+	}
+	p.MaxWait = 0
+	if got := p.delay(1, &HFError{StatusCode: 503, EstimatedTime: 20 * time.Second}, middle); got != time.Second {
+		t.Errorf("Expected the estimated time to be capped at 1s, got %v", got)
+	}
+}
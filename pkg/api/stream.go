@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/tidwall/gjson"
+)
+
+// errStreamDone stops reading a stream after its final event
+var errStreamDone = errors.New("stream done")
+
+// GenerateStream performs text generation using Hugging Face API, sending
+// each token as the server streams it. It uses the Server-Sent Events of
+// text-generation-inference, which the API serves for text generation
+// models; the final event carries the details of the generation.
+func (hf *HFModel) GenerateStream(ctx context.Context, prompt string, options *models.GenerationOptions) (<-chan models.Token, error) {
+	payload := generationPayload(prompt, options)
+	payload["stream"] = true
+	setParameter(payload, "details", true)
+
+	jsonData, err := hf.marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	url := hf.BaseURL + fmt.Sprintf("/models/%s", hf.ModelName)
+	resp, err := withRetries(ctx, hf.Retry, func() (*http.Response, error) {
+		return hf.send(ctx, "POST", url, jsonData, "text/event-stream")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("generation request failed: %w", err)
+	}
+
+	tokens := make(chan models.Token)
+	go func() {
+		defer close(tokens)
+		defer resp.Body.Close()
+
+		send := func(t models.Token) error {
+			select {
+			case tokens <- t:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err := readEvents(resp.Body, func(data string) error {
+			if data == "[DONE]" {
+				return io.EOF
+			}
+			tok, done, err := streamToken(data)
+			if err != nil {
+				return err
+			}
+			if err := send(tok); err != nil {
+				return err
+			}
+			if done {
+				return errStreamDone
+			}
+			return nil
+		})
+		switch {
+		case err == nil, err == io.EOF:
+			err = errors.New("stream ended before the generation finished")
+		case errors.Is(err, errStreamDone):
+			return
+		case ctx.Err() != nil:
+			err = ctx.Err()
+		}
+		_ = send(models.Token{Err: err})
+	}()
+	return tokens, nil
+}
+
+// streamToken parses the data of a text-generation-inference stream event.
+// It reports whether the event is the final one, which holds the generated
+// text and details.
+func streamToken(data string) (models.Token, bool, error) {
+	if !gjson.Valid(data) {
+		return models.Token{}, false, fmt.Errorf("invalid JSON event: %s", data)
+	}
+	event := gjson.Parse(data)
+	if msg := event.Get("error"); msg.Exists() {
+		return models.Token{}, false, fmt.Errorf("stream failed: %s", msg.String())
+	}
+
+	tok := event.Get("token")
+	t := models.Token{
+		ID:      int(tok.Get("id").Int()),
+		Text:    tok.Get("text").String(),
+		Logprob: tok.Get("logprob").Float(),
+		Special: tok.Get("special").Bool(),
+	}
+	text := event.Get("generated_text")
+	if !text.Exists() || text.Type == gjson.Null {
+		return t, false, nil
+	}
+	t.Details = &models.GenerationDetails{
+		GeneratedText:   text.String(),
+		FinishReason:    event.Get("details.finish_reason").String(),
+		GeneratedTokens: int(event.Get("details.generated_tokens").Int()),
+	}
+	return t, true, nil
+}
+
+// readEvents calls fn with the data of each Server-Sent Event in r, stopping
+// at the first error fn returns
+func readEvents(r io.Reader, fn func(data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// A blank line dispatches the event
+			if len(data) > 0 {
+				if err := fn(strings.Join(data, "\n")); err != nil {
+					return err
+				}
+				data = nil
+			}
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		if field == "data" {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	if len(data) > 0 {
+		return fn(strings.Join(data, "\n"))
+	}
+	return nil
+}
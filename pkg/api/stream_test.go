@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+)
+
+// streamServer serves events as a text-generation-inference stream
+func streamServer(t *testing.T, events ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Stream     bool                   `json:"stream"`
+			Parameters map[string]interface{} `json:"parameters"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		if !payload.Stream || payload.Parameters["details"] != true {
+			t.Errorf("Expected a streaming request with details, got %+v", payload)
+		}
+		if r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("Expected Accept text/event-stream, got %q", r.Header.Get("Accept"))
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			fmt.Fprint(w, e)
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+func collect(t *testing.T, tokens <-chan models.Token) []models.Token {
+	t.Helper()
+	var all []models.Token
+	for tok := range tokens {
+		all = append(all, tok)
+	}
+	return all
+}
+
+func TestHFModel_GenerateStream(t *testing.T) {
+	server := streamServer(t,
+		": keep-alive\n\n",
+		`data:{"token":{"id":15496,"text":" Hello","logprob":-0.5,"special":false},"generated_text":null,"details":null}`+"\n\n",
+		`data: {"token":{"id":995,"text":" world","logprob":-1.25,"special":false},"generated_text":null,"details":null}`+"\n\n",
+		`data: {"token":{"id":50256,"text":"<|endoftext|>","logprob":-0.1,"special":true},"generated_text":" Hello world",`+
+			`"details":{"finish_reason":"eos_token","generated_tokens":3,"seed":null}}`+"\n\n",
+	)
+	defer server.Close()
+
+	model := NewHFModel("test-model")
+	model.BaseURL = server.URL
+	tokens, err := model.GenerateStream(context.Background(), "Say", &models.GenerationOptions{MaxLength: 10})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []models.Token{
+		{ID: 15496, Text: " Hello", Logprob: -0.5},
+		{ID: 995, Text: " world", Logprob: -1.25},
+		{ID: 50256, Text: "<|endoftext|>", Logprob: -0.1, Special: true, Details: &models.GenerationDetails{
+			GeneratedText: " Hello world", FinishReason: models.FinishEOSToken, GeneratedTokens: 3,
+		}},
+	}
+	if got := collect(t, tokens); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestHFModel_GenerateStreamErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+	}{
+		{"error event", []string{`data: {"error":"Input validation error","error_type":"validation"}` + "\n\n"}},
+		{"stream cut short", []string{`data: {"token":{"id":1,"text":"a","logprob":0},"generated_text":null}` + "\n\n"}},
+		{"invalid event", []string{"data: {oops\n\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := streamServer(t, tt.events...)
+			defer server.Close()
+
+			model := NewHFModel("test-model")
+			model.BaseURL = server.URL
+			tokens, err := model.GenerateStream(context.Background(), "Say", nil)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			all := collect(t, tokens)
+			if len(all) == 0 || all[len(all)-1].Err == nil {
+				t.Errorf("Expected the stream to end with an error, got %+v", all)
+			}
+		})
+	}
+
+	// Errors before the stream starts are returned directly
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error": "Invalid token"}`))
+	}))
+	defer server.Close()
+	model := NewHFModel("test-model")
+	model.BaseURL = server.URL
+	if _, err := model.GenerateStream(context.Background(), "Say", nil); !errors.Is(err, errs.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+// Package errs defines the errors shared by the model backends, the API
+// client and the tokenizers, so that callers can branch on the kind of a
+// failure with errors.Is and errors.As whichever backend produced it.
+//
+// Backends wrap a sentinel with the details of the failure, as in
+//
+//	fmt.Errorf("%w: prompt of %d tokens exceeds the model maximum of %d", errs.ErrInvalidInput, n, max)
+//
+// and report tasks a model cannot perform with an *UnsupportedTaskError.
+package errs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+)
+
+var (
+	// ErrNotImplemented reports a feature, file format or model component
+	// this library does not implement yet
+	ErrNotImplemented = errors.New("not implemented")
+
+	// ErrUnsupportedTask reports a task the model cannot perform, such as
+	// generating text with a classifier
+	ErrUnsupportedTask = errors.New("unsupported task")
+
+	// ErrModelLoading reports a hosted model that is still being loaded and
+	// cannot serve requests yet
+	ErrModelLoading = errors.New("model is loading")
+
+	// ErrRateLimited reports a request rejected by a rate limit
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrUnauthorized reports a missing, invalid or insufficient API token
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrInvalidInput reports an input the model cannot process, such as a
+	// prompt longer than its context or a token ID outside its vocabulary
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// UnsupportedTaskError reports a task a kind of model cannot perform. It
+// matches ErrUnsupportedTask.
+type UnsupportedTaskError struct {
+	Model string // kind of model, such as "gpt2" or "ONNX classification"
+	Task  models.Task
+}
+
+func (e *UnsupportedTaskError) Error() string {
+	return fmt.Sprintf("%s models do not support %s", e.Model, e.Task)
+}
+
+// Is reports whether target is ErrUnsupportedTask
+func (e *UnsupportedTaskError) Is(target error) bool {
+	return target == ErrUnsupportedTask
+}
@@ -0,0 +1,27 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+)
+
+func TestUnsupportedTaskError(t *testing.T) {
+	err := fmt.Errorf("generation failed: %w", &UnsupportedTaskError{Model: "bert", Task: models.TaskTextGeneration})
+	if !errors.Is(err, ErrUnsupportedTask) {
+		t.Errorf("Expected %v to match ErrUnsupportedTask", err)
+	}
+	if errors.Is(err, ErrNotImplemented) {
+		t.Errorf("Expected %v not to match ErrNotImplemented", err)
+	}
+
+	var taskErr *UnsupportedTaskError
+	if !errors.As(err, &taskErr) || taskErr.Model != "bert" || taskErr.Task != models.TaskTextGeneration {
+		t.Fatalf("Expected an UnsupportedTaskError for bert text generation, got %v", err)
+	}
+	if got := taskErr.Error(); got != "bert models do not support text-generation" {
+		t.Errorf("Expected 'bert models do not support text-generation', got %q", got)
+	}
+}
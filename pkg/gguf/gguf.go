@@ -0,0 +1,519 @@
+// Package gguf reads GGUF model files, the format used by llama.cpp.
+//
+// A GGUF file starts with typed key/value metadata describing the model and
+// its tokenizer, followed by a table of tensors whose data is stored, aligned,
+// at the end of the file. Files are memory-mapped, so opening even a large
+// model is cheap and tensor data is only read when accessed.
+package gguf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/kelleyblackmore/go-transformer/internal/mmap"
+)
+
+// magic is "GGUF" read as a little-endian uint32
+const magic = 0x46554747
+
+// defaultAlignment applies when general.alignment is not set
+const defaultAlignment = 32
+
+// maxDims is the most dimensions a ggml tensor can have
+const maxDims = 4
+
+// maxArrayDepth bounds the nesting of metadata arrays
+const maxArrayDepth = 8
+
+// KV is a metadata entry. Value holds the Go type matching Type: uint8,
+// int8, uint16, int16, uint32, int32, float32, bool, string, uint64, int64 or
+// float64. Arrays are typed slices such as []string or []float32, or []any
+// for arrays of arrays.
+type KV struct {
+	Key   string
+	Type  ValueType
+	Value any
+}
+
+// TensorInfo describes a tensor stored in a GGUF file
+type TensorInfo struct {
+	Name string
+	// Dims lists the dimensions in ggml order, innermost first, so Dims[0]
+	// is the length of a row
+	Dims   []uint64
+	Type   TensorType
+	Offset uint64 // relative to the start of the data section
+}
+
+// NumElements returns the number of values in the tensor, or 0 when it
+// does not fit in a uint64
+func (t TensorInfo) NumElements() uint64 {
+	n, _ := t.numElements()
+	return n
+}
+
+// Size returns the number of bytes the tensor occupies, or 0 when it does
+// not fit in a uint64
+func (t TensorInfo) Size() uint64 {
+	size, _ := t.size()
+	return size
+}
+
+// numElements returns the number of values in the tensor and whether
+// counting them did not overflow
+func (t TensorInfo) numElements() (uint64, bool) {
+	n := uint64(1)
+	for _, d := range t.Dims {
+		hi, lo := bits.Mul64(n, d)
+		if hi != 0 {
+			return 0, false
+		}
+		n = lo
+	}
+	return n, true
+}
+
+// size returns the number of bytes the tensor occupies and whether
+// computing it did not overflow
+func (t TensorInfo) size() (uint64, bool) {
+	n, ok := t.numElements()
+	if !ok {
+		return 0, false
+	}
+	hi, size := bits.Mul64(n/uint64(t.Type.BlockSize()), uint64(t.Type.TypeSize()))
+	if hi != 0 {
+		return 0, false
+	}
+	return size, true
+}
+
+// Shape returns the dimensions outermost first, the order used by PyTorch
+// and pkg/tensor
+func (t TensorInfo) Shape() []int {
+	shape := make([]int, len(t.Dims))
+	for i, d := range t.Dims {
+		shape[len(shape)-1-i] = int(d)
+	}
+	return shape
+}
+
+// File is an open GGUF file
+type File struct {
+	Version   uint32
+	Metadata  []KV // in file order
+	Tensors   []TensorInfo
+	Alignment uint64
+
+	mm      *mmap.File
+	data    []byte // the tensor data section
+	keys    map[string]int
+	tensors map[string]int
+}
+
+// Open memory-maps and parses a GGUF file. The file must be released with
+// Close.
+func Open(path string) (*File, error) {
+	mm, err := mmap.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GGUF file: %w", err)
+	}
+	f, err := parse(mm.Data())
+	if err != nil {
+		mm.Close()
+		return nil, fmt.Errorf("invalid GGUF file %s: %w", path, err)
+	}
+	f.mm = mm
+	return f, nil
+}
+
+// Close releases the mapped file. Tensor data returned by TensorData is
+// invalid afterwards.
+func (f *File) Close() error {
+	f.data = nil
+	if f.mm == nil {
+		return nil
+	}
+	return f.mm.Close()
+}
+
+// parse decodes the header, metadata and tensor table of a GGUF file
+func parse(buf []byte) (*File, error) {
+	r := &reader{buf: buf}
+	if m := r.u32(); r.err == nil && m != magic {
+		if m == binary.BigEndian.Uint32(buf) {
+			return nil, errors.New("big-endian GGUF files are not supported")
+		}
+		return nil, errors.New("missing GGUF magic number")
+	}
+	f := &File{Version: r.u32(), keys: make(map[string]int), tensors: make(map[string]int)}
+	if r.err == nil && (f.Version < 2 || f.Version > 3) {
+		return nil, fmt.Errorf("unsupported GGUF version %d", f.Version)
+	}
+	tensorCount, kvCount := r.u64(), r.u64()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	// Every entry takes at least 8 bytes, which bounds the counts before
+	// anything is allocated
+	if kvCount > r.remaining()/8 || tensorCount > r.remaining()/8 {
+		return nil, fmt.Errorf("header declares %d metadata entries and %d tensors, more than the file can hold", kvCount, tensorCount)
+	}
+
+	f.Metadata = make([]KV, 0, kvCount)
+	for i := uint64(0); i < kvCount; i++ {
+		key := r.str()
+		typ := ValueType(r.u32())
+		value := r.value(typ, 0)
+		if r.err != nil {
+			return nil, fmt.Errorf("metadata entry %d: %w", i, r.err)
+		}
+		if _, dup := f.keys[key]; dup {
+			return nil, fmt.Errorf("duplicate metadata key %q", key)
+		}
+		f.keys[key] = len(f.Metadata)
+		f.Metadata = append(f.Metadata, KV{Key: key, Type: typ, Value: value})
+	}
+
+	f.Alignment = defaultAlignment
+	if kv, ok := f.lookup("general.alignment"); ok {
+		a, ok := toUint(kv.Value)
+		if !ok || a == 0 || a&(a-1) != 0 {
+			return nil, fmt.Errorf("general.alignment %v is not a power of two", kv.Value)
+		}
+		f.Alignment = a
+	}
+
+	f.Tensors = make([]TensorInfo, 0, tensorCount)
+	for i := uint64(0); i < tensorCount; i++ {
+		t := TensorInfo{Name: r.str()}
+		nDims := r.u32()
+		if r.err == nil && nDims > maxDims {
+			return nil, fmt.Errorf("tensor %q has %d dimensions, more than %d", t.Name, nDims, maxDims)
+		}
+		for d := uint32(0); d < nDims && r.err == nil; d++ {
+			t.Dims = append(t.Dims, r.u64())
+		}
+		t.Type = TensorType(r.u32())
+		t.Offset = r.u64()
+		if r.err != nil {
+			return nil, fmt.Errorf("tensor %d: %w", i, r.err)
+		}
+		if err := f.checkTensor(t); err != nil {
+			return nil, err
+		}
+		f.tensors[t.Name] = len(f.Tensors)
+		f.Tensors = append(f.Tensors, t)
+	}
+
+	start := (r.pos + f.Alignment - 1) / f.Alignment * f.Alignment
+	if start > uint64(len(buf)) {
+		start = uint64(len(buf))
+	}
+	f.data = buf[start:]
+	for _, t := range f.Tensors {
+		size, ok := t.size()
+		if !ok {
+			return nil, fmt.Errorf("tensor %q with dimensions %v is too large", t.Name, t.Dims)
+		}
+		if t.Offset > uint64(len(f.data)) || size > uint64(len(f.data))-t.Offset {
+			return nil, fmt.Errorf("tensor %q data of %d bytes at offset %d extends past the %d bytes of tensor data", t.Name, size, t.Offset, len(f.data))
+		}
+	}
+	return f, nil
+}
+
+// checkTensor validates a tensor table entry before it is added
+func (f *File) checkTensor(t TensorInfo) error {
+	if _, dup := f.tensors[t.Name]; dup {
+		return fmt.Errorf("duplicate tensor %q", t.Name)
+	}
+	if _, ok := tensorTypes[t.Type]; !ok {
+		return fmt.Errorf("tensor %q has unknown type %d", t.Name, uint32(t.Type))
+	}
+	n := uint64(1)
+	for _, d := range t.Dims {
+		if d == 0 || d > math.MaxInt32 || n > math.MaxInt64/d {
+			return fmt.Errorf("tensor %q has invalid dimensions %v", t.Name, t.Dims)
+		}
+		n *= d
+	}
+	if len(t.Dims) > 0 && t.Dims[0]%uint64(t.Type.BlockSize()) != 0 {
+		return fmt.Errorf("tensor %q row length %d is not a multiple of the %s block size %d", t.Name, t.Dims[0], t.Type, t.Type.BlockSize())
+	}
+	if t.Offset%f.Alignment != 0 {
+		return fmt.Errorf("tensor %q offset %d is not aligned to %d bytes", t.Name, t.Offset, f.Alignment)
+	}
+	return nil
+}
+
+// Keys returns the metadata keys in file order
+func (f *File) Keys() []string {
+	keys := make([]string, len(f.Metadata))
+	for i, kv := range f.Metadata {
+		keys[i] = kv.Key
+	}
+	return keys
+}
+
+func (f *File) lookup(key string) (KV, bool) {
+	i, ok := f.keys[key]
+	if !ok {
+		return KV{}, false
+	}
+	return f.Metadata[i], true
+}
+
+// Get returns the value of a metadata key
+func (f *File) Get(key string) (any, bool) {
+	kv, ok := f.lookup(key)
+	return kv.Value, ok
+}
+
+// String returns a string metadata value
+func (f *File) String(key string) (string, bool) {
+	kv, _ := f.lookup(key)
+	s, ok := kv.Value.(string)
+	return s, ok
+}
+
+// Uint returns an integer metadata value of any width, provided it is not
+// negative
+func (f *File) Uint(key string) (uint64, bool) {
+	kv, _ := f.lookup(key)
+	return toUint(kv.Value)
+}
+
+// Float returns a floating-point or integer metadata value
+func (f *File) Float(key string) (float64, bool) {
+	kv, _ := f.lookup(key)
+	switch v := kv.Value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	if u, ok := toUint(kv.Value); ok {
+		return float64(u), true
+	}
+	return 0, false
+}
+
+// Bool returns a boolean metadata value
+func (f *File) Bool(key string) (bool, bool) {
+	kv, _ := f.lookup(key)
+	b, ok := kv.Value.(bool)
+	return b, ok
+}
+
+// Strings returns a string array metadata value
+func (f *File) Strings(key string) ([]string, bool) {
+	kv, _ := f.lookup(key)
+	s, ok := kv.Value.([]string)
+	return s, ok
+}
+
+// Architecture returns general.architecture, such as "llama"
+func (f *File) Architecture() string {
+	arch, _ := f.String("general.architecture")
+	return arch
+}
+
+// Tensor returns the description of a tensor
+func (f *File) Tensor(name string) (TensorInfo, bool) {
+	i, ok := f.tensors[name]
+	if !ok {
+		return TensorInfo{}, false
+	}
+	return f.Tensors[i], true
+}
+
+// TensorData returns the stored bytes of a tensor. The slice aliases the
+// mapped file and is only valid until Close.
+func (f *File) TensorData(name string) ([]byte, TensorInfo, error) {
+	t, ok := f.Tensor(name)
+	if !ok {
+		return nil, TensorInfo{}, fmt.Errorf("tensor %q not found in GGUF file", name)
+	}
+	end := t.Offset + t.Size()
+	return f.data[t.Offset:end:end], t, nil
+}
+
+func toUint(v any) (uint64, bool) {
+	switch v := v.(type) {
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case int8:
+		return uint64(v), v >= 0
+	case int16:
+		return uint64(v), v >= 0
+	case int32:
+		return uint64(v), v >= 0
+	case int64:
+		return uint64(v), v >= 0
+	}
+	return 0, false
+}
+
+// reader decodes little-endian values from a buffer. After the first error
+// every read returns a zero value and the error is kept in err.
+type reader struct {
+	buf []byte
+	pos uint64
+	err error
+}
+
+func (r *reader) remaining() uint64 {
+	return uint64(len(r.buf)) - r.pos
+}
+
+func (r *reader) next(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > r.remaining() {
+		r.err = fmt.Errorf("unexpected end of file at byte %d reading %d bytes", r.pos, n)
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) u8() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) u32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) u64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *reader) str() string {
+	return string(r.next(r.u64()))
+}
+
+// value decodes a metadata value of type typ
+func (r *reader) value(typ ValueType, depth int) any {
+	switch typ {
+	case TypeUint8:
+		return r.u8()
+	case TypeInt8:
+		return int8(r.u8())
+	case TypeUint16:
+		return r.u16()
+	case TypeInt16:
+		return int16(r.u16())
+	case TypeUint32:
+		return r.u32()
+	case TypeInt32:
+		return int32(r.u32())
+	case TypeFloat32:
+		return math.Float32frombits(r.u32())
+	case TypeBool:
+		b := r.u8()
+		if r.err == nil && b > 1 {
+			r.err = fmt.Errorf("invalid bool value %d", b)
+		}
+		return b == 1
+	case TypeString:
+		return r.str()
+	case TypeUint64:
+		return r.u64()
+	case TypeInt64:
+		return int64(r.u64())
+	case TypeFloat64:
+		return math.Float64frombits(r.u64())
+	case TypeArray:
+		return r.array(depth + 1)
+	}
+	if r.err == nil {
+		r.err = fmt.Errorf("unknown metadata value type %d", uint32(typ))
+	}
+	return nil
+}
+
+// array decodes an array value into a typed slice
+func (r *reader) array(depth int) any {
+	typ := ValueType(r.u32())
+	n := r.u64()
+	if r.err != nil {
+		return nil
+	}
+	if depth > maxArrayDepth {
+		r.err = errors.New("metadata arrays are nested too deeply")
+		return nil
+	}
+	// Every element takes at least one byte
+	if n > r.remaining() {
+		r.err = fmt.Errorf("array of %d elements exceeds the file size", n)
+		return nil
+	}
+
+	switch typ {
+	case TypeUint8:
+		return readArray(r, n, (*reader).u8)
+	case TypeInt8:
+		return readArray(r, n, func(r *reader) int8 { return int8(r.u8()) })
+	case TypeUint16:
+		return readArray(r, n, (*reader).u16)
+	case TypeInt16:
+		return readArray(r, n, func(r *reader) int16 { return int16(r.u16()) })
+	case TypeUint32:
+		return readArray(r, n, (*reader).u32)
+	case TypeInt32:
+		return readArray(r, n, func(r *reader) int32 { return int32(r.u32()) })
+	case TypeFloat32:
+		return readArray(r, n, func(r *reader) float32 { return math.Float32frombits(r.u32()) })
+	case TypeBool:
+		return readArray(r, n, func(r *reader) bool { return r.value(TypeBool, depth).(bool) })
+	case TypeString:
+		return readArray(r, n, (*reader).str)
+	case TypeUint64:
+		return readArray(r, n, (*reader).u64)
+	case TypeInt64:
+		return readArray(r, n, func(r *reader) int64 { return int64(r.u64()) })
+	case TypeFloat64:
+		return readArray(r, n, func(r *reader) float64 { return math.Float64frombits(r.u64()) })
+	case TypeArray:
+		return readArray(r, n, func(r *reader) any { return r.array(depth + 1) })
+	}
+	r.err = fmt.Errorf("unknown array element type %d", uint32(typ))
+	return nil
+}
+
+func readArray[T any](r *reader, n uint64, read func(*reader) T) []T {
+	values := make([]T, 0, n)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		values = append(values, read(r))
+	}
+	return values
+}
@@ -0,0 +1,304 @@
+package gguf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// builder writes GGUF files for tests
+type builder struct {
+	bytes.Buffer
+}
+
+func (b *builder) u32(v uint32) { binary.Write(b, binary.LittleEndian, v) }
+func (b *builder) u64(v uint64) { binary.Write(b, binary.LittleEndian, v) }
+
+func (b *builder) str(s string) {
+	b.u64(uint64(len(s)))
+	b.WriteString(s)
+}
+
+func (b *builder) header(version uint32, tensors, kvs uint64) {
+	b.WriteString("GGUF")
+	b.u32(version)
+	b.u64(tensors)
+	b.u64(kvs)
+}
+
+// kv writes a key followed by a typed value, encoded little-endian
+func (b *builder) kv(key string, typ ValueType, value any) {
+	b.str(key)
+	b.u32(uint32(typ))
+	b.value(typ, value)
+}
+
+func (b *builder) value(typ ValueType, value any) {
+	switch v := value.(type) {
+	case string:
+		b.str(v)
+	case bool:
+		if v {
+			b.WriteByte(1)
+		} else {
+			b.WriteByte(0)
+		}
+	case []string:
+		b.u32(uint32(TypeString))
+		b.u64(uint64(len(v)))
+		for _, s := range v {
+			b.str(s)
+		}
+	case []float32:
+		b.u32(uint32(TypeFloat32))
+		b.u64(uint64(len(v)))
+		binary.Write(b, binary.LittleEndian, v)
+	case []int32:
+		b.u32(uint32(TypeInt32))
+		b.u64(uint64(len(v)))
+		binary.Write(b, binary.LittleEndian, v)
+	case []any:
+		b.u32(uint32(TypeArray))
+		b.u64(uint64(len(v)))
+		for _, e := range v {
+			b.value(TypeArray, e)
+		}
+	default:
+		binary.Write(b, binary.LittleEndian, v)
+	}
+}
+
+func (b *builder) tensor(name string, typ TensorType, offset uint64, dims ...uint64) {
+	b.str(name)
+	b.u32(uint32(len(dims)))
+	for _, d := range dims {
+		b.u64(d)
+	}
+	b.u32(uint32(typ))
+	b.u64(offset)
+}
+
+func (b *builder) align(n int) {
+	for b.Len()%n != 0 {
+		b.WriteByte(0)
+	}
+}
+
+func (b *builder) write(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "model.gguf")
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeTestFile writes a small LLaMA-style GGUF file with one value of every
+// type, a tokenizer and two tensors
+func writeTestFile(t *testing.T) string {
+	var b builder
+	b.header(3, 2, 21)
+	b.kv("general.architecture", TypeString, "llama")
+	b.kv("general.alignment", TypeUint32, uint32(64))
+	b.kv("general.file_type", TypeUint32, uint32(7))
+	b.kv("llama.context_length", TypeUint64, uint64(2048))
+	b.kv("test.u8", TypeUint8, uint8(200))
+	b.kv("test.i8", TypeInt8, int8(-5))
+	b.kv("test.u16", TypeUint16, uint16(60000))
+	b.kv("test.i16", TypeInt16, int16(-300))
+	b.kv("test.i32", TypeInt32, int32(-70000))
+	b.kv("test.i64", TypeInt64, int64(-1))
+	b.kv("test.f64", TypeFloat64, 2.5)
+	b.kv("test.nested", TypeArray, []any{[]int32{1, 2}, []string{"x"}})
+	b.kv("llama.rope.freq_base", TypeFloat32, float32(10000))
+	b.kv("tokenizer.ggml.model", TypeString, "gpt2")
+	b.kv("tokenizer.ggml.tokens", TypeArray, []string{"<s>", "</s>", "h", "i", "hi"})
+	b.kv("tokenizer.ggml.scores", TypeArray, []float32{0, 0, -1, -2, -3})
+	b.kv("tokenizer.ggml.token_type", TypeArray, []int32{3, 3, 1, 1, 1})
+	b.kv("tokenizer.ggml.merges", TypeArray, []string{"h i"})
+	b.kv("tokenizer.ggml.bos_token_id", TypeUint32, uint32(0))
+	b.kv("tokenizer.ggml.eos_token_id", TypeUint32, uint32(1))
+	b.kv("tokenizer.ggml.add_bos_token", TypeBool, true)
+
+	b.tensor("output_norm.weight", TensorF32, 0, 4)
+	b.tensor("token_embd.weight", TensorQ8_0, 64, 32, 2)
+	b.align(64)
+	binary.Write(&b, binary.LittleEndian, []float32{1, 2, 3, 4})
+	b.align(64)
+	for i := 0; i < 2*34; i++ {
+		b.WriteByte(byte(i))
+	}
+	return b.write(t)
+}
+
+func TestOpen(t *testing.T) {
+	f, err := Open(writeTestFile(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer f.Close()
+
+	if f.Version != 3 {
+		t.Errorf("Expected version 3, got %d", f.Version)
+	}
+	if f.Alignment != 64 {
+		t.Errorf("Expected alignment 64, got %d", f.Alignment)
+	}
+	if f.Architecture() != "llama" {
+		t.Errorf("Expected architecture 'llama', got %q", f.Architecture())
+	}
+	if keys := f.Keys(); len(keys) != 21 || keys[0] != "general.architecture" || keys[20] != "tokenizer.ggml.add_bos_token" {
+		t.Errorf("Expected keys in file order, got %v", keys)
+	}
+
+	if n, ok := f.Uint("llama.context_length"); !ok || n != 2048 {
+		t.Errorf("Expected context length 2048, got %d", n)
+	}
+	if n, ok := f.Uint("test.u16"); !ok || n != 60000 {
+		t.Errorf("Expected 60000, got %d", n)
+	}
+	if _, ok := f.Uint("test.i8"); ok {
+		t.Error("Expected a negative value not to convert to uint")
+	}
+	if v, ok := f.Float("llama.rope.freq_base"); !ok || v != 10000 {
+		t.Errorf("Expected 10000, got %v", v)
+	}
+	if _, ok := f.String("llama.context_length"); ok {
+		t.Error("Expected String to reject an integer value")
+	}
+
+	expected := map[string]any{
+		"test.u8":  uint8(200),
+		"test.i8":  int8(-5),
+		"test.i16": int16(-300),
+		"test.i32": int32(-70000),
+		"test.i64": int64(-1),
+		"test.f64": 2.5,
+		"test.nested": []any{
+			[]int32{1, 2},
+			[]string{"x"},
+		},
+	}
+	for key, want := range expected {
+		if got, _ := f.Get(key); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %s = %#v, got %#v", key, want, got)
+		}
+	}
+}
+
+func TestTensors(t *testing.T) {
+	f, err := Open(writeTestFile(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer f.Close()
+
+	if len(f.Tensors) != 2 {
+		t.Fatalf("Expected 2 tensors, got %d", len(f.Tensors))
+	}
+	data, info, err := f.TensorData("output_norm.weight")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if info.Type != TensorF32 || len(data) != 16 || math.Float32frombits(binary.LittleEndian.Uint32(data[12:])) != 4 {
+		t.Errorf("Expected 4 float32 values ending in 4, got %s %v", info.Type, data)
+	}
+
+	data, info, err = f.TensorData("token_embd.weight")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(info.Shape(), []int{2, 32}) {
+		t.Errorf("Expected shape [2 32], got %v", info.Shape())
+	}
+	if info.NumElements() != 64 || info.Size() != 68 || len(data) != 68 || data[0] != 0 || data[67] != 67 {
+		t.Errorf("Expected 68 bytes of Q8_0 data for 64 elements, got %d bytes for %d", len(data), info.NumElements())
+	}
+
+	if _, _, err := f.TensorData("missing"); err == nil {
+		t.Error("Expected error for a missing tensor")
+	}
+}
+
+func TestTokenizer(t *testing.T) {
+	f, err := Open(writeTestFile(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer f.Close()
+
+	tok, err := f.Tokenizer()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if tok.Model != "gpt2" || len(tok.Tokens) != 5 || tok.Tokens[4] != "hi" {
+		t.Errorf("Expected a 5 token gpt2 vocabulary, got %q %v", tok.Model, tok.Tokens)
+	}
+	if !reflect.DeepEqual(tok.Merges, []string{"h i"}) {
+		t.Errorf("Expected merges [h i], got %v", tok.Merges)
+	}
+	if tok.Scores[3] != -2 || tok.TokenTypes[0] != TokenControl {
+		t.Errorf("Expected scores and token types, got %v %v", tok.Scores, tok.TokenTypes)
+	}
+	if tok.BOSTokenID != 0 || tok.EOSTokenID != 1 || tok.UnknownTokenID != -1 || tok.PaddingTokenID != -1 {
+		t.Errorf("Expected BOS 0, EOS 1 and no UNK or PAD, got %d %d %d %d", tok.BOSTokenID, tok.EOSTokenID, tok.UnknownTokenID, tok.PaddingTokenID)
+	}
+	if !tok.AddBOS || tok.AddEOS {
+		t.Errorf("Expected AddBOS only, got %v %v", tok.AddBOS, tok.AddEOS)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *builder)
+		err   string
+	}{
+		{"magic", func(b *builder) { b.WriteString("GGML\x03\x00\x00\x00") }, "magic"},
+		{"version", func(b *builder) { b.header(1, 0, 0) }, "version 1"},
+		{"truncated", func(b *builder) { b.header(3, 0, 1); b.str("key") }, "unexpected end"},
+		{"counts", func(b *builder) { b.header(3, 1<<40, 0) }, "more than the file can hold"},
+		{"value type", func(b *builder) { b.header(3, 0, 1); b.kv("k", 99, uint8(0)) }, "unknown metadata value type"},
+		{"array size", func(b *builder) {
+			b.header(3, 0, 1)
+			b.str("k")
+			b.u32(uint32(TypeArray))
+			b.u32(uint32(TypeUint64))
+			b.u64(1 << 40)
+		}, "exceeds the file size"},
+		{"duplicate key", func(b *builder) {
+			b.header(3, 0, 2)
+			b.kv("k", TypeUint8, uint8(1))
+			b.kv("k", TypeUint8, uint8(2))
+		}, "duplicate metadata key"},
+		{"alignment", func(b *builder) { b.header(3, 0, 1); b.kv("general.alignment", TypeUint32, uint32(24)) }, "power of two"},
+		{"tensor type", func(b *builder) { b.header(3, 1, 0); b.tensor("w", 99, 0, 4) }, "unknown type"},
+		{"block size", func(b *builder) { b.header(3, 1, 0); b.tensor("w", TensorQ4_0, 0, 16) }, "block size"},
+		{"offset alignment", func(b *builder) { b.header(3, 1, 0); b.tensor("w", TensorF32, 4, 1) }, "not aligned"},
+		{"data bounds", func(b *builder) { b.header(3, 1, 0); b.tensor("w", TensorF32, 0, 1024) }, "extends past"},
+		{"offset overflow", func(b *builder) { b.header(3, 1, 0); b.tensor("w", TensorF32, 0xFFFFFFFFFFFFFFE0, 8) }, "extends past"},
+		{"size overflow", func(b *builder) {
+			b.header(3, 1, 0)
+			b.tensor("w", TensorF32, 0, math.MaxInt32, math.MaxInt32, 2)
+		}, "too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b builder
+			tt.build(&b)
+			_, err := Open(b.write(t))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.gguf")); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+}
@@ -0,0 +1,82 @@
+package gguf
+
+import "fmt"
+
+// Token types stored in tokenizer.ggml.token_type
+const (
+	TokenNormal      int32 = 1
+	TokenUnknown     int32 = 2
+	TokenControl     int32 = 3
+	TokenUserDefined int32 = 4
+	TokenUnused      int32 = 5
+	TokenByte        int32 = 6
+)
+
+// Tokenizer is the vocabulary embedded in a GGUF file under the
+// tokenizer.ggml keys
+type Tokenizer struct {
+	// Model names the tokenizer algorithm: "llama" for SentencePiece, "gpt2"
+	// for byte-level BPE or "bert" for WordPiece
+	Model string
+	// Pre names the pre-tokenizer variant, such as "llama-bpe" or "qwen2"
+	Pre        string
+	Tokens     []string
+	Scores     []float32 // optional, one per token
+	TokenTypes []int32   // optional, one per token
+	Merges     []string  // BPE merges as "a b" pairs
+
+	// Special token IDs are -1 when not set
+	BOSTokenID     int
+	EOSTokenID     int
+	UnknownTokenID int
+	PaddingTokenID int
+	AddBOS         bool
+	AddEOS         bool
+
+	ChatTemplate string
+}
+
+// Tokenizer returns the embedded tokenizer vocabulary
+func (f *File) Tokenizer() (*Tokenizer, error) {
+	tokens, ok := f.Strings("tokenizer.ggml.tokens")
+	if !ok {
+		return nil, fmt.Errorf("GGUF file has no tokenizer.ggml.tokens")
+	}
+	t := &Tokenizer{Tokens: tokens}
+	t.Model, _ = f.String("tokenizer.ggml.model")
+	t.Pre, _ = f.String("tokenizer.ggml.pre")
+	t.Merges, _ = f.Strings("tokenizer.ggml.merges")
+	t.AddBOS, _ = f.Bool("tokenizer.ggml.add_bos_token")
+	t.AddEOS, _ = f.Bool("tokenizer.ggml.add_eos_token")
+	t.ChatTemplate, _ = f.String("tokenizer.chat_template")
+
+	if v, ok := f.Get("tokenizer.ggml.scores"); ok {
+		if t.Scores, ok = v.([]float32); !ok || len(t.Scores) != len(tokens) {
+			return nil, fmt.Errorf("tokenizer.ggml.scores must hold %d float32 values", len(tokens))
+		}
+	}
+	if v, ok := f.Get("tokenizer.ggml.token_type"); ok {
+		if t.TokenTypes, ok = v.([]int32); !ok || len(t.TokenTypes) != len(tokens) {
+			return nil, fmt.Errorf("tokenizer.ggml.token_type must hold %d int32 values", len(tokens))
+		}
+	}
+
+	for _, id := range []struct {
+		key string
+		dst *int
+	}{
+		{"tokenizer.ggml.bos_token_id", &t.BOSTokenID},
+		{"tokenizer.ggml.eos_token_id", &t.EOSTokenID},
+		{"tokenizer.ggml.unknown_token_id", &t.UnknownTokenID},
+		{"tokenizer.ggml.padding_token_id", &t.PaddingTokenID},
+	} {
+		*id.dst = -1
+		if v, ok := f.Uint(id.key); ok {
+			if v >= uint64(len(tokens)) {
+				return nil, fmt.Errorf("%s %d is outside the vocabulary of %d tokens", id.key, v, len(tokens))
+			}
+			*id.dst = int(v)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,149 @@
+package gguf
+
+import "fmt"
+
+// ValueType identifies the type of a metadata value
+type ValueType uint32
+
+const (
+	TypeUint8 ValueType = iota
+	TypeInt8
+	TypeUint16
+	TypeInt16
+	TypeUint32
+	TypeInt32
+	TypeFloat32
+	TypeBool
+	TypeString
+	TypeArray
+	TypeUint64
+	TypeInt64
+	TypeFloat64
+)
+
+var valueTypeNames = [...]string{"uint8", "int8", "uint16", "int16", "uint32", "int32", "float32", "bool", "string", "array", "uint64", "int64", "float64"}
+
+func (t ValueType) String() string {
+	if int(t) < len(valueTypeNames) {
+		return valueTypeNames[t]
+	}
+	return fmt.Sprintf("ValueType(%d)", uint32(t))
+}
+
+// TensorType is the ggml element type of a tensor, including the quantized
+// block formats
+type TensorType uint32
+
+const (
+	TensorF32     TensorType = 0
+	TensorF16     TensorType = 1
+	TensorQ4_0    TensorType = 2
+	TensorQ4_1    TensorType = 3
+	TensorQ5_0    TensorType = 6
+	TensorQ5_1    TensorType = 7
+	TensorQ8_0    TensorType = 8
+	TensorQ8_1    TensorType = 9
+	TensorQ2_K    TensorType = 10
+	TensorQ3_K    TensorType = 11
+	TensorQ4_K    TensorType = 12
+	TensorQ5_K    TensorType = 13
+	TensorQ6_K    TensorType = 14
+	TensorQ8_K    TensorType = 15
+	TensorIQ2_XXS TensorType = 16
+	TensorIQ2_XS  TensorType = 17
+	TensorIQ3_XXS TensorType = 18
+	TensorIQ1_S   TensorType = 19
+	TensorIQ4_NL  TensorType = 20
+	TensorIQ3_S   TensorType = 21
+	TensorIQ2_S   TensorType = 22
+	TensorIQ4_XS  TensorType = 23
+	TensorI8      TensorType = 24
+	TensorI16     TensorType = 25
+	TensorI32     TensorType = 26
+	TensorI64     TensorType = 27
+	TensorF64     TensorType = 28
+	TensorIQ1_M   TensorType = 29
+	TensorBF16    TensorType = 30
+	TensorTQ1_0   TensorType = 34
+	TensorTQ2_0   TensorType = 35
+)
+
+// typeTraits describes how a tensor type is stored: elements are packed in
+// blocks of blockSize values taking typeSize bytes
+type typeTraits struct {
+	name      string
+	blockSize int
+	typeSize  int
+}
+
+var tensorTypes = map[TensorType]typeTraits{
+	TensorF32:     {"F32", 1, 4},
+	TensorF16:     {"F16", 1, 2},
+	TensorQ4_0:    {"Q4_0", 32, 18},
+	TensorQ4_1:    {"Q4_1", 32, 20},
+	TensorQ5_0:    {"Q5_0", 32, 22},
+	TensorQ5_1:    {"Q5_1", 32, 24},
+	TensorQ8_0:    {"Q8_0", 32, 34},
+	TensorQ8_1:    {"Q8_1", 32, 36},
+	TensorQ2_K:    {"Q2_K", 256, 84},
+	TensorQ3_K:    {"Q3_K", 256, 110},
+	TensorQ4_K:    {"Q4_K", 256, 144},
+	TensorQ5_K:    {"Q5_K", 256, 176},
+	TensorQ6_K:    {"Q6_K", 256, 210},
+	TensorQ8_K:    {"Q8_K", 256, 292},
+	TensorIQ2_XXS: {"IQ2_XXS", 256, 66},
+	TensorIQ2_XS:  {"IQ2_XS", 256, 74},
+	TensorIQ3_XXS: {"IQ3_XXS", 256, 98},
+	TensorIQ1_S:   {"IQ1_S", 256, 50},
+	TensorIQ4_NL:  {"IQ4_NL", 32, 18},
+	TensorIQ3_S:   {"IQ3_S", 256, 110},
+	TensorIQ2_S:   {"IQ2_S", 256, 82},
+	TensorIQ4_XS:  {"IQ4_XS", 256, 136},
+	TensorI8:      {"I8", 1, 1},
+	TensorI16:     {"I16", 1, 2},
+	TensorI32:     {"I32", 1, 4},
+	TensorI64:     {"I64", 1, 8},
+	TensorF64:     {"F64", 1, 8},
+	TensorIQ1_M:   {"IQ1_M", 256, 56},
+	TensorBF16:    {"BF16", 1, 2},
+	TensorTQ1_0:   {"TQ1_0", 256, 54},
+	TensorTQ2_0:   {"TQ2_0", 256, 66},
+}
+
+func (t TensorType) String() string {
+	if traits, ok := tensorTypes[t]; ok {
+		return traits.name
+	}
+	return fmt.Sprintf("TensorType(%d)", uint32(t))
+}
+
+// BlockSize returns the number of elements stored together in a block
+func (t TensorType) BlockSize() int {
+	return tensorTypes[t].blockSize
+}
+
+// TypeSize returns the number of bytes in a block
+func (t TensorType) TypeSize() int {
+	return tensorTypes[t].typeSize
+}
+
+// fileTypes names the values of general.file_type, which describe the
+// predominant quantization of a model
+var fileTypes = map[uint64]string{
+	0: "ALL_F32", 1: "MOSTLY_F16", 2: "MOSTLY_Q4_0", 3: "MOSTLY_Q4_1", 7: "MOSTLY_Q8_0",
+	8: "MOSTLY_Q5_0", 9: "MOSTLY_Q5_1", 10: "MOSTLY_Q2_K", 11: "MOSTLY_Q3_K_S",
+	12: "MOSTLY_Q3_K_M", 13: "MOSTLY_Q3_K_L", 14: "MOSTLY_Q4_K_S", 15: "MOSTLY_Q4_K_M",
+	16: "MOSTLY_Q5_K_S", 17: "MOSTLY_Q5_K_M", 18: "MOSTLY_Q6_K", 19: "MOSTLY_IQ2_XXS",
+	20: "MOSTLY_IQ2_XS", 21: "MOSTLY_Q2_K_S", 22: "MOSTLY_IQ3_XS", 23: "MOSTLY_IQ3_XXS",
+	24: "MOSTLY_IQ1_S", 25: "MOSTLY_IQ4_NL", 26: "MOSTLY_IQ3_S", 27: "MOSTLY_IQ3_M",
+	28: "MOSTLY_IQ2_S", 29: "MOSTLY_IQ2_M", 30: "MOSTLY_IQ4_XS", 31: "MOSTLY_IQ1_M",
+	32: "MOSTLY_BF16", 36: "MOSTLY_TQ1_0", 37: "MOSTLY_TQ2_0",
+}
+
+// FileTypeName returns the name of a general.file_type value
+func FileTypeName(fileType uint64) string {
+	if name, ok := fileTypes[fileType]; ok {
+		return name
+	}
+	return fmt.Sprintf("FILE_TYPE_%d", fileType)
+}
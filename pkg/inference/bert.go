@@ -0,0 +1,445 @@
+package inference
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+	"github.com/kelleyblackmore/go-transformer/pkg/tokenizers"
+)
+
+// BertConfig holds the architecture of a BERT or DistilBERT model. DistilBERT
+// configs use different key names, which are mapped onto these fields.
+type BertConfig struct {
+	ModelType             string            `json:"model_type"`
+	VocabSize             int               `json:"vocab_size"`
+	HiddenSize            int               `json:"hidden_size"`
+	NumHiddenLayers       int               `json:"num_hidden_layers"`
+	NumAttentionHeads     int               `json:"num_attention_heads"`
+	IntermediateSize      int               `json:"intermediate_size"`
+	HiddenAct             string            `json:"hidden_act"`
+	MaxPositionEmbeddings int               `json:"max_position_embeddings"`
+	TypeVocabSize         int               `json:"type_vocab_size"`
+	LayerNormEps          float32           `json:"layer_norm_eps"`
+	ID2Label              map[string]string `json:"id2label"`
+	ProblemType           string            `json:"problem_type"`
+	Architectures         []string          `json:"architectures"`
+}
+
+// distilBertConfig holds the DistilBERT names for BertConfig fields
+type distilBertConfig struct {
+	Dim        int    `json:"dim"`
+	NLayers    int    `json:"n_layers"`
+	NHeads     int    `json:"n_heads"`
+	HiddenDim  int    `json:"hidden_dim"`
+	Activation string `json:"activation"`
+}
+
+// BertModel runs a BERT or DistilBERT encoder in pure Go, with a sequence
+// classification, token classification or extractive question answering
+// head or, for checkpoints without one, as a bare encoder producing
+// embeddings
+type BertModel struct {
+	Config    BertConfig
+	Tokenizer tokenizers.Tokenizer
+
+	// Pooling and Normalize control Embed. They default to the settings of
+	// a sentence-transformers checkpoint, or to mean pooling without
+	// normalization.
+	Pooling   string
+	Normalize bool
+
+	name       string
+	distilled  bool
+	act        func(*tensor.Tensor) *tensor.Tensor
+	embeddings bertEmbeddings
+	layers     []bertLayer
+
+	// Classification head, if any. BERT applies a tanh pooler to the [CLS]
+	// state; DistilBERT applies a ReLU pre-classifier instead.
+	pooler     linear
+	poolerAct  func(*tensor.Tensor) *tensor.Tensor
+	classifier linear
+
+	// Token classification head, if any, labelling each token
+	tokenClassifier linear
+
+	// Extractive question answering head, if any, scoring each token as
+	// the start and end of the answer
+	qaOutputs linear
+}
+
+type bertEmbeddings struct {
+	word, position, tokenType *tensor.Tensor
+	norm                      layerNorm
+}
+
+type bertLayer struct {
+	query, key, value, attnOut linear
+	attnNorm                   layerNorm
+	intermediate, output       linear
+	outNorm                    layerNorm
+}
+
+var (
+	_ models.Model            = (*BertModel)(nil)
+	_ models.Classifier       = (*BertModel)(nil)
+	_ models.Embedder         = (*BertModel)(nil)
+	_ models.QuestionAnswerer = (*BertModel)(nil)
+)
+
+// LoadBertModel loads a BERT or DistilBERT model for sequence or token
+// classification or question answering, or a bare encoder such as a
+// sentence-transformers model, from a directory containing config.json,
+// safetensors weights and a tokenizer
+func LoadBertModel(dir string) (*BertModel, error) {
+	var cfg BertConfig
+	if err := readConfig(dir, &cfg); err != nil {
+		return nil, err
+	}
+	distilled := cfg.ModelType == "distilbert"
+	if distilled {
+		var dc distilBertConfig
+		if err := readConfig(dir, &dc); err != nil {
+			return nil, err
+		}
+		cfg.HiddenSize, cfg.NumHiddenLayers, cfg.NumAttentionHeads = dc.Dim, dc.NLayers, dc.NHeads
+		cfg.IntermediateSize, cfg.HiddenAct = dc.HiddenDim, dc.Activation
+		cfg.LayerNormEps = 1e-12
+	}
+	if cfg.LayerNormEps == 0 {
+		cfg.LayerNormEps = 1e-12
+	}
+	if cfg.HiddenSize <= 0 || cfg.NumAttentionHeads <= 0 || cfg.HiddenSize%cfg.NumAttentionHeads != 0 {
+		return nil, fmt.Errorf("invalid model config: hidden size %d is not divisible into %d heads", cfg.HiddenSize, cfg.NumAttentionHeads)
+	}
+	act, err := activation(cfg.HiddenAct)
+	if err != nil {
+		return nil, fmt.Errorf("invalid model config: %w", err)
+	}
+
+	st, err := OpenSafeTensors(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+
+	m := &BertModel{Config: cfg, name: dir, distilled: distilled, act: act}
+	if err := m.loadWeights(st); err != nil {
+		return nil, fmt.Errorf("failed to load weights from %s: %w", dir, err)
+	}
+
+	m.Tokenizer, err = loadTokenizer(dir, cfg.MaxPositionEmbeddings)
+	if err != nil {
+		return nil, err
+	}
+	m.Pooling, m.Normalize, err = sentenceTransformersConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// loadWeights reads every weight, accepting checkpoints saved with or
+// without the bert./distilbert. base model prefix
+func (m *BertModel) loadWeights(st *SafeTensors) error {
+	cfg := m.Config
+	h, inter := cfg.HiddenSize, cfg.IntermediateSize
+	w := &weightLoader{st: st}
+	for _, prefix := range []string{"bert.", "distilbert.", ""} {
+		w.prefix = prefix
+		if w.has("embeddings.word_embeddings.weight") {
+			break
+		}
+	}
+
+	m.embeddings = bertEmbeddings{
+		word:     w.tensor("embeddings.word_embeddings.weight", cfg.VocabSize, h),
+		position: w.tensor("embeddings.position_embeddings.weight", cfg.MaxPositionEmbeddings, h),
+		norm:     w.layerNorm("embeddings.LayerNorm", h, cfg.LayerNormEps),
+	}
+	if !m.distilled && cfg.TypeVocabSize > 0 {
+		m.embeddings.tokenType = w.tensor("embeddings.token_type_embeddings.weight", cfg.TypeVocabSize, h)
+	}
+
+	m.layers = make([]bertLayer, cfg.NumHiddenLayers)
+	for i := range m.layers {
+		if m.distilled {
+			p := fmt.Sprintf("transformer.layer.%d.", i)
+			m.layers[i] = bertLayer{
+				query:        w.linear(p+"attention.q_lin", h, h),
+				key:          w.linear(p+"attention.k_lin", h, h),
+				value:        w.linear(p+"attention.v_lin", h, h),
+				attnOut:      w.linear(p+"attention.out_lin", h, h),
+				attnNorm:     w.layerNorm(p+"sa_layer_norm", h, cfg.LayerNormEps),
+				intermediate: w.linear(p+"ffn.lin1", inter, h),
+				output:       w.linear(p+"ffn.lin2", h, inter),
+				outNorm:      w.layerNorm(p+"output_layer_norm", h, cfg.LayerNormEps),
+			}
+		} else {
+			p := fmt.Sprintf("encoder.layer.%d.", i)
+			m.layers[i] = bertLayer{
+				query:        w.linear(p+"attention.self.query", h, h),
+				key:          w.linear(p+"attention.self.key", h, h),
+				value:        w.linear(p+"attention.self.value", h, h),
+				attnOut:      w.linear(p+"attention.output.dense", h, h),
+				attnNorm:     w.layerNorm(p+"attention.output.LayerNorm", h, cfg.LayerNormEps),
+				intermediate: w.linear(p+"intermediate.dense", inter, h),
+				output:       w.linear(p+"output.dense", h, inter),
+				outNorm:      w.layerNorm(p+"output.LayerNorm", h, cfg.LayerNormEps),
+			}
+		}
+	}
+
+	// The BERT pooler belongs to the base model; the rest of the
+	// classification head lives outside its prefix. Question answering
+	// models and bare encoders have no classifier, and any pooler they have
+	// is not needed.
+	base := w.prefix
+	w.prefix = ""
+	if w.has("qa_outputs.weight") {
+		m.qaOutputs = w.linear("qa_outputs", 2, h)
+		return w.err
+	}
+	if !w.has("classifier.weight") {
+		return w.err
+	}
+	labels := len(cfg.ID2Label)
+	if info, ok := st.Info("classifier.weight"); ok && labels == 0 && len(info.Shape) == 2 {
+		labels = info.Shape[0]
+	}
+
+	// Token classifiers label every hidden state directly. They are named
+	// as such in config.json, and have no pooler or pre-classifier.
+	hasPooler := w.has("pre_classifier.weight")
+	if !m.distilled {
+		_, hasPooler = st.Info(base + "pooler.dense.weight")
+	}
+	if m.isTokenClassifier(hasPooler) {
+		m.tokenClassifier = w.linear("classifier", labels, h)
+		return w.err
+	}
+
+	if m.distilled {
+		m.pooler, m.poolerAct = w.linear("pre_classifier", h, h), tensor.ReLU
+	} else {
+		w.prefix = base
+		m.pooler, m.poolerAct = w.linear("pooler.dense", h, h), tensor.Tanh
+		w.prefix = ""
+	}
+	m.classifier = w.linear("classifier", labels, h)
+	return w.err
+}
+
+// isTokenClassifier reports whether the classifier of the checkpoint labels
+// tokens rather than whole sequences, going by the architectures of the
+// config and otherwise by whether the checkpoint has a pooler
+func (m *BertModel) isTokenClassifier(hasPooler bool) bool {
+	for _, arch := range m.Config.Architectures {
+		switch {
+		case strings.HasSuffix(arch, "ForTokenClassification"):
+			return true
+		case strings.HasSuffix(arch, "ForSequenceClassification"):
+			return false
+		}
+	}
+	return !hasPooler
+}
+
+// forward runs the encoder over a single encoding and returns the final
+// hidden states with shape [tokens, hidden]
+func (m *BertModel) forward(ctx context.Context, enc *tokenizers.Encoding) (*tensor.Tensor, error) {
+	cfg := m.Config
+	n := enc.Len()
+	if n > cfg.MaxPositionEmbeddings {
+		return nil, fmt.Errorf("%w: input of %d tokens exceeds the model maximum of %d", errs.ErrInvalidInput, n, cfg.MaxPositionEmbeddings)
+	}
+
+	positions := make([]int, n)
+	for i := range positions {
+		positions[i] = i
+	}
+	x := tensor.Add(tensor.Embedding(m.embeddings.word, enc.IDs), tensor.Embedding(m.embeddings.position, positions))
+	if m.embeddings.tokenType != nil {
+		x = tensor.Add(x, tensor.Embedding(m.embeddings.tokenType, enc.TypeIDs))
+	}
+	x = m.embeddings.norm.forward(x)
+
+	mask := paddingMask(enc.AttentionMask)
+	for _, l := range m.layers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		a := attention(l.query.forward(x), l.key.forward(x), l.value.forward(x), cfg.NumAttentionHeads, cfg.NumAttentionHeads, mask)
+		x = l.attnNorm.forward(tensor.Add(x, l.attnOut.forward(a)))
+		ff := l.output.forward(m.act(l.intermediate.forward(x)))
+		x = l.outNorm.forward(tensor.Add(x, ff))
+	}
+	return x, nil
+}
+
+// Logits returns the unnormalized classification scores for text, one per
+// label
+func (m *BertModel) Logits(ctx context.Context, text string) ([]float32, error) {
+	if !m.hasClassifier() {
+		return nil, &errs.UnsupportedTaskError{Model: m.Config.ModelType + " encoder", Task: models.TaskTextClassification}
+	}
+	enc, err := m.Tokenizer.Encode(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize input: %w", err)
+	}
+	hidden, err := m.forward(ctx, enc)
+	if err != nil {
+		return nil, err
+	}
+	cls := hidden.Slice(0, 0, 1)
+	pooled := m.poolerAct(m.pooler.forward(cls))
+	return m.classifier.forward(pooled).Data(), nil
+}
+
+// Embed returns an embedding of each text, pooled from the final hidden
+// states as m.Pooling selects and scaled to unit length if m.Normalize is
+// set
+func (m *BertModel) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		enc, err := m.Tokenizer.Encode(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to tokenize input: %w", err)
+		}
+		hidden, err := m.forward(ctx, enc)
+		if err != nil {
+			return nil, err
+		}
+		if embeddings[i], err = pool(hidden, enc.AttentionMask, m.Pooling); err != nil {
+			return nil, err
+		}
+		if m.Normalize {
+			normalizeL2(embeddings[i])
+		}
+	}
+	return embeddings, nil
+}
+
+func (m *BertModel) hasClassifier() bool {
+	return m.classifier.weight != nil || m.classifier.qweight != nil
+}
+
+// Classify returns the most likely label for text and its softmax score
+func (m *BertModel) Classify(ctx context.Context, text string) (*models.ClassificationResult, error) {
+	logits, err := m.Logits(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return classify(logits, m.Config.ID2Label), nil
+}
+
+// ClassifyAll returns the scores of the labels for text, best first
+func (m *BertModel) ClassifyAll(ctx context.Context, text string, options *models.ClassificationOptions) ([]models.ClassificationResult, error) {
+	logits, err := m.Logits(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return classifyAll(logits, m.Config.ID2Label, m.Config.ProblemType, options)
+}
+
+// classify picks the label with the highest softmax score, naming it from
+// id2label and defaulting to LABEL_i
+func classify(logits []float32, id2label map[string]string) *models.ClassificationResult {
+	probs := tensor.Softmax(tensor.New(logits, len(logits)), -1).Data()
+	best := 0
+	for i, p := range probs {
+		if p > probs[best] {
+			best = i
+		}
+	}
+	return &models.ClassificationResult{Label: labelName(id2label, best), Score: float64(probs[best])}
+}
+
+// classifyAll scores every label as options ask, best first. problemType is
+// the problem_type of config.json, which makes multi-label models default to
+// sigmoid scores.
+func classifyAll(logits []float32, id2label map[string]string, problemType string, options *models.ClassificationOptions) ([]models.ClassificationResult, error) {
+	if options == nil {
+		options = &models.ClassificationOptions{}
+	}
+	function := options.FunctionToApply
+	if function == "" {
+		function = models.FunctionSoftmax
+		if problemType == "multi_label_classification" || len(logits) == 1 {
+			function = models.FunctionSigmoid
+		}
+	}
+
+	scores := make([]float64, len(logits))
+	switch function {
+	case models.FunctionSoftmax:
+		for i, p := range tensor.Softmax(tensor.New(logits, len(logits)), -1).Data() {
+			scores[i] = float64(p)
+		}
+	case models.FunctionSigmoid:
+		for i, l := range logits {
+			scores[i] = 1 / (1 + math.Exp(-float64(l)))
+		}
+	case models.FunctionNone:
+		for i, l := range logits {
+			scores[i] = float64(l)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown function_to_apply %q", errs.ErrInvalidInput, function)
+	}
+
+	results := make([]models.ClassificationResult, 0, len(scores))
+	for i, score := range scores {
+		if options.Threshold == 0 || score >= options.Threshold {
+			results = append(results, models.ClassificationResult{Label: labelName(id2label, i), Score: score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if options.TopK > 0 && len(results) > options.TopK {
+		results = results[:options.TopK]
+	}
+	return results, nil
+}
+
+// labelName names label i from id2label, defaulting to LABEL_i
+func labelName(id2label map[string]string, i int) string {
+	if label, ok := id2label[strconv.Itoa(i)]; ok {
+		return label
+	}
+	return fmt.Sprintf("LABEL_%d", i)
+}
+
+// Generate is not supported by encoder-only models
+func (m *BertModel) Generate(ctx context.Context, prompt string, options *models.GenerationOptions) (*models.GenerationResult, error) {
+	return nil, &errs.UnsupportedTaskError{Model: m.Config.ModelType, Task: models.TaskTextGeneration}
+}
+
+// GenerateStream is not supported by encoder-only models
+func (m *BertModel) GenerateStream(ctx context.Context, prompt string, options *models.GenerationOptions) (<-chan models.Token, error) {
+	return nil, &errs.UnsupportedTaskError{Model: m.Config.ModelType, Task: models.TaskTextGeneration}
+}
+
+// GetModelInfo returns information about the model
+func (m *BertModel) GetModelInfo() *models.ModelInfo {
+	task := models.TaskTextClassification
+	switch {
+	case m.hasQAHead():
+		task = models.TaskQuestionAnswering
+	case m.hasTokenClassifier():
+		task = models.TaskTokenClassification
+	case !m.hasClassifier():
+		task = models.TaskFeatureExtraction
+	}
+	return &models.ModelInfo{
+		Name:     m.name,
+		Task:     task,
+		Provider: "safetensors",
+	}
+}
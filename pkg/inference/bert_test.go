@@ -0,0 +1,456 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+)
+
+// testWeights produces reproducible pseudo-random weights from a linear
+// congruential generator, so that reference values can be computed outside Go
+type testWeights struct {
+	state   uint32
+	tensors []rawTensor
+}
+
+func (w *testWeights) next() float32 {
+	w.state = (w.state*1103515245 + 12345) % (1 << 31)
+	return float32((float64(w.state)/(1<<31) - 0.5) * 0.4)
+}
+
+// add appends a tensor of the given shape filled with base plus noise
+func (w *testWeights) add(name string, base float32, shape ...int) {
+	n := 1
+	for _, s := range shape {
+		n *= s
+	}
+	values := make([]float32, n)
+	for i := range values {
+		values[i] = base + w.next()
+	}
+	w.tensors = append(w.tensors, rawTensor{name, DTypeF32, shape, f32Bytes(values...)})
+}
+
+func (w *testWeights) linear(name string, out, in int) {
+	w.add(name+".weight", 0, out, in)
+	w.add(name+".bias", 0, out)
+}
+
+func (w *testWeights) layerNorm(name string, n int) {
+	w.add(name+".weight", 1, n)
+	w.add(name+".bias", 0, n)
+}
+
+var testBertVocab = []string{"[PAD]", "[UNK]", "[CLS]", "[SEP]", "[MASK]", "the", "movie", "was", "great", "terrible", "not", "##s"}
+
+// writeTestBertModel writes a tiny two-layer BERT or DistilBERT classifier
+func writeTestBertModel(t *testing.T, distilled bool) string {
+	t.Helper()
+	const hidden, inter, layers, positions = 8, 16, 2, 16
+	dir := t.TempDir()
+
+	config := map[string]any{
+		"vocab_size":              len(testBertVocab),
+		"max_position_embeddings": positions,
+		"id2label":                map[string]string{"0": "NEGATIVE", "1": "POSITIVE"},
+	}
+	if distilled {
+		config["model_type"] = "distilbert"
+		config["dim"], config["n_layers"], config["n_heads"] = hidden, layers, 2
+		config["hidden_dim"], config["activation"] = inter, "gelu"
+	} else {
+		config["model_type"] = "bert"
+		config["hidden_size"], config["num_hidden_layers"], config["num_attention_heads"] = hidden, layers, 2
+		config["intermediate_size"], config["hidden_act"] = inter, "gelu"
+		config["type_vocab_size"], config["layer_norm_eps"] = 2, 1e-12
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "config.json"), data)
+	writeFile(t, filepath.Join(dir, "vocab.txt"), []byte(strings.Join(testBertVocab, "\n")+"\n"))
+
+	w := &testWeights{state: 42}
+	base := "bert."
+	if distilled {
+		base = "distilbert."
+	}
+	w.add(base+"embeddings.word_embeddings.weight", 0, len(testBertVocab), hidden)
+	w.add(base+"embeddings.position_embeddings.weight", 0, positions, hidden)
+	if !distilled {
+		w.add(base+"embeddings.token_type_embeddings.weight", 0, 2, hidden)
+	}
+	w.layerNorm(base+"embeddings.LayerNorm", hidden)
+	for i := 0; i < layers; i++ {
+		if distilled {
+			p := fmt.Sprintf("%stransformer.layer.%d.", base, i)
+			for _, name := range []string{"q_lin", "k_lin", "v_lin", "out_lin"} {
+				w.linear(p+"attention."+name, hidden, hidden)
+			}
+			w.layerNorm(p+"sa_layer_norm", hidden)
+			w.linear(p+"ffn.lin1", inter, hidden)
+			w.linear(p+"ffn.lin2", hidden, inter)
+			w.layerNorm(p+"output_layer_norm", hidden)
+		} else {
+			p := fmt.Sprintf("%sencoder.layer.%d.", base, i)
+			for _, name := range []string{"self.query", "self.key", "self.value", "output.dense"} {
+				w.linear(p+"attention."+name, hidden, hidden)
+			}
+			w.layerNorm(p+"attention.output.LayerNorm", hidden)
+			w.linear(p+"intermediate.dense", inter, hidden)
+			w.linear(p+"output.dense", hidden, inter)
+			w.layerNorm(p+"output.LayerNorm", hidden)
+		}
+	}
+	if distilled {
+		w.linear("pre_classifier", hidden, hidden)
+	} else {
+		w.linear(base+"pooler.dense", hidden, hidden)
+	}
+	w.linear("classifier", 2, hidden)
+
+	writeFile(t, filepath.Join(dir, "model.safetensors"), encodeSafeTensors(t, nil, w.tensors...))
+	return dir
+}
+
+func TestBertModel_Logits(t *testing.T) {
+	// Reference logits from an independent implementation of the
+	// Hugging Face forward pass using the same weights
+	tests := []struct {
+		name      string
+		distilled bool
+		text      string
+		want      []float32
+	}{
+		{"bert", false, "the movie was great", []float32{0.19678474, 0.03821759}},
+		{"bert", false, "the movie was not terrible", []float32{0.19730994, 0.03828186}},
+		{"distilbert", true, "the movie was great", []float32{0.12677161, -0.00224248}},
+	}
+
+	for _, tt := range tests {
+		m, err := LoadBertModel(writeTestBertModel(t, tt.distilled))
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		logits, err := m.Logits(context.Background(), tt.text)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		for i := range tt.want {
+			if math.Abs(float64(logits[i]-tt.want[i])) > 1e-5 {
+				t.Errorf("%s %q: expected logits %v, got %v", tt.name, tt.text, tt.want, logits)
+				break
+			}
+		}
+	}
+}
+
+func TestBertModel_Classify(t *testing.T) {
+	m, err := LoadBertModel(writeTestBertModel(t, false))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var _ models.Model = m
+
+	result, err := m.Classify(context.Background(), "the movie was great")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// softmax([0.19678474, 0.03821759])
+	if result.Label != "NEGATIVE" || math.Abs(result.Score-0.53956) > 1e-4 {
+		t.Errorf("Expected NEGATIVE with score 0.53956, got %s with %v", result.Label, result.Score)
+	}
+
+	if info := m.GetModelInfo(); info.Task != models.TaskTextClassification {
+		t.Errorf("Expected task %s, got %s", models.TaskTextClassification, info.Task)
+	}
+	var taskErr *errs.UnsupportedTaskError
+	if _, err := m.Generate(context.Background(), "the", nil); !errors.As(err, &taskErr) || taskErr.Task != models.TaskTextGeneration {
+		t.Errorf("Expected an unsupported text generation error, got %v", err)
+	}
+	if _, err := m.GenerateStream(context.Background(), "the", nil); !errors.Is(err, errs.ErrUnsupportedTask) {
+		t.Errorf("Expected an unsupported task error for streaming, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Classify(ctx, "the movie"); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestBertModel_ClassifyAll(t *testing.T) {
+	m, err := LoadBertModel(writeTestBertModel(t, false))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var _ models.Classifier = m
+
+	results, err := m.ClassifyAll(context.Background(), "the movie was great", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 2 || results[0].Label != "NEGATIVE" || results[1].Label != "POSITIVE" ||
+		math.Abs(results[0].Score-0.53956) > 1e-4 || math.Abs(results[1].Score-0.46044) > 1e-4 {
+		t.Errorf("Expected NEGATIVE 0.53956 and POSITIVE 0.46044, got %+v", results)
+	}
+}
+
+func TestClassifyAll(t *testing.T) {
+	logits := []float32{2, -1, 0.5}
+	id2label := map[string]string{"0": "sports", "1": "politics"}
+	tests := []struct {
+		name        string
+		problemType string
+		options     *models.ClassificationOptions
+		expected    []models.ClassificationResult
+	}{
+		{
+			name:     "softmax by default",
+			expected: []models.ClassificationResult{{Label: "sports", Score: 0.78559703}, {Label: "LABEL_2", Score: 0.17529039}, {Label: "politics", Score: 0.03911257}},
+		},
+		{
+			name:        "sigmoid for multi-label models",
+			problemType: "multi_label_classification",
+			options:     &models.ClassificationOptions{Threshold: 0.5},
+			expected:    []models.ClassificationResult{{Label: "sports", Score: 0.88079708}, {Label: "LABEL_2", Score: 0.62245933}},
+		},
+		{
+			name:     "raw logits",
+			options:  &models.ClassificationOptions{FunctionToApply: models.FunctionNone, TopK: 2},
+			expected: []models.ClassificationResult{{Label: "sports", Score: 2}, {Label: "LABEL_2", Score: 0.5}},
+		},
+		{
+			name:     "explicit sigmoid",
+			options:  &models.ClassificationOptions{FunctionToApply: models.FunctionSigmoid, TopK: 1},
+			expected: []models.ClassificationResult{{Label: "sports", Score: 0.88079708}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := classifyAll(logits, id2label, tt.problemType, tt.options)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(results) != len(tt.expected) {
+				t.Fatalf("Expected %+v, got %+v", tt.expected, results)
+			}
+			for i, r := range results {
+				if r.Label != tt.expected[i].Label || math.Abs(r.Score-tt.expected[i].Score) > 1e-6 {
+					t.Errorf("Expected %+v, got %+v", tt.expected, results)
+					break
+				}
+			}
+		})
+	}
+
+	if _, err := classifyAll(logits, id2label, "", &models.ClassificationOptions{FunctionToApply: "relu"}); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown function, got %v", err)
+	}
+}
+
+func TestBertModel_PaddingMask(t *testing.T) {
+	m, err := LoadBertModel(writeTestBertModel(t, false))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	enc, err := m.Tokenizer.Encode("the movie was great")
+	if err != nil {
+		t.Fatal(err)
+	}
+	padded := *enc
+	padded.IDs = append(append([]int{}, enc.IDs...), 0, 0)
+	padded.TypeIDs = append(append([]int{}, enc.TypeIDs...), 0, 0)
+	padded.AttentionMask = append(append([]int{}, enc.AttentionMask...), 0, 0)
+
+	want, err := m.forward(context.Background(), enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.forward(context.Background(), &padded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, g := want.Data(), got.Slice(0, 0, enc.Len()).Data()
+	for i := range w {
+		if math.Abs(float64(w[i]-g[i])) > 1e-5 {
+			t.Fatalf("Expected padding to leave hidden states unchanged, got %v at %d, want %v", g[i], i, w[i])
+		}
+	}
+}
+
+// rewriteTestWeights rewrites the weights of a test model, renaming or,
+// when rename returns false, dropping each tensor and then adding extra
+func rewriteTestWeights(t *testing.T, dir string, rename func(name string) (string, bool), extra ...rawTensor) {
+	t.Helper()
+	st, err := OpenSafeTensors(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []rawTensor
+	for _, name := range st.Names() {
+		newName, ok := rename(name)
+		if !ok {
+			continue
+		}
+		raw, info, _ := st.Raw(name)
+		kept = append(kept, rawTensor{newName, info.DType, info.Shape, append([]byte{}, raw...)})
+	}
+	st.Close()
+	writeFile(t, filepath.Join(dir, "model.safetensors"), encodeSafeTensors(t, nil, append(kept, extra...)...))
+}
+
+// writeTestBertEncoder writes the test BERT model without its pooler and
+// classification head, as a sentence-transformers model with the given
+// pooling config
+func writeTestBertEncoder(t *testing.T, pooling string) string {
+	t.Helper()
+	dir := writeTestBertModel(t, false)
+	rewriteTestWeights(t, dir, func(name string) (string, bool) {
+		if strings.HasPrefix(name, "classifier.") || strings.HasPrefix(name, "bert.pooler.") {
+			return "", false
+		}
+		return strings.TrimPrefix(name, "bert."), true
+	})
+
+	writeFile(t, filepath.Join(dir, "modules.json"), []byte(`[
+		{"idx": 0, "name": "0", "path": "", "type": "sentence_transformers.models.Transformer"},
+		{"idx": 1, "name": "1", "path": "1_Pooling", "type": "sentence_transformers.models.Pooling"},
+		{"idx": 2, "name": "2", "path": "2_Normalize", "type": "sentence_transformers.models.Normalize"}
+	]`))
+	if err := os.Mkdir(filepath.Join(dir, "1_Pooling"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "1_Pooling", "config.json"), []byte(pooling))
+	return dir
+}
+
+func TestBertModel_Embed(t *testing.T) {
+	ctx := context.Background()
+	texts := []string{"the movie was great", "not terrible"}
+
+	m, err := LoadBertModel(writeTestBertEncoder(t, `{"pooling_mode_cls_token": false, "pooling_mode_mean_tokens": true}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if m.Pooling != PoolingMean || !m.Normalize {
+		t.Errorf("Expected normalized mean pooling from modules.json, got %q, %v", m.Pooling, m.Normalize)
+	}
+	if info := m.GetModelInfo(); info.Task != models.TaskFeatureExtraction {
+		t.Errorf("Expected task %s, got %s", models.TaskFeatureExtraction, info.Task)
+	}
+	if _, err := m.Classify(ctx, texts[0]); !errors.Is(err, errs.ErrUnsupportedTask) {
+		t.Errorf("Expected ErrUnsupportedTask classifying with an encoder, got %v", err)
+	}
+
+	// The encoder computes the same hidden states as the classifier's base
+	// model, which the embeddings pool
+	classifier, err := LoadBertModel(writeTestBertModel(t, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := classifier.Tokenizer.Encode(texts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	hidden, err := classifier.forward(ctx, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, h := hidden.Dim(0), hidden.Dim(1)
+	mean := make([]float32, h)
+	for i, v := range hidden.Data() {
+		mean[i%h] += v / float32(n)
+	}
+	cls := hidden.Slice(0, 0, 1).Data()
+
+	tests := []struct {
+		pooling   string
+		normalize bool
+		want      []float32
+	}{
+		{PoolingMean, false, mean},
+		{PoolingCLS, false, cls},
+		{PoolingMean, true, mean},
+	}
+	for _, tt := range tests {
+		m.Pooling, m.Normalize = tt.pooling, tt.normalize
+		embeddings, err := m.Embed(ctx, texts)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(embeddings) != len(texts) || len(embeddings[0]) != h {
+			t.Fatalf("Expected %d embeddings of %d dimensions, got %v", len(texts), h, embeddings)
+		}
+		want := append([]float32{}, tt.want...)
+		if tt.normalize {
+			normalizeL2(want)
+			var norm float64
+			for _, v := range embeddings[0] {
+				norm += float64(v) * float64(v)
+			}
+			if math.Abs(norm-1) > 1e-5 {
+				t.Errorf("Expected a unit vector, got squared norm %v", norm)
+			}
+		}
+		for i := range want {
+			if math.Abs(float64(embeddings[0][i]-want[i])) > 1e-5 {
+				t.Errorf("%s pooling: expected %v, got %v", tt.pooling, want, embeddings[0])
+				break
+			}
+		}
+	}
+
+	m.Pooling = "max"
+	if _, err := m.Embed(ctx, texts); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown pooling, got %v", err)
+	}
+
+	m, err = LoadBertModel(writeTestBertEncoder(t, `{"pooling_mode_cls_token": true, "pooling_mode_mean_tokens": false}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if m.Pooling != PoolingCLS {
+		t.Errorf("Expected CLS pooling from the pooling config, got %q", m.Pooling)
+	}
+}
+
+func TestLoadBertModel_Errors(t *testing.T) {
+	dir := writeTestBertModel(t, false)
+	st, err := OpenSafeTensors(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []rawTensor
+	for _, name := range st.Names() {
+		if name == "bert.encoder.layer.1.output.dense.weight" {
+			continue
+		}
+		raw, info, _ := st.Raw(name)
+		kept = append(kept, rawTensor{name, info.DType, info.Shape, append([]byte{}, raw...)})
+	}
+	st.Close()
+	writeFile(t, filepath.Join(dir, "model.safetensors"), encodeSafeTensors(t, nil, kept...))
+
+	if _, err := LoadBertModel(dir); err == nil || !strings.Contains(err.Error(), "encoder.layer.1.output.dense.weight") {
+		t.Errorf("Expected missing weight error, got %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "config.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBertModel(dir); err == nil || !strings.Contains(err.Error(), "config") {
+		t.Errorf("Expected config error, got %v", err)
+	}
+}
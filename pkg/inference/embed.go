@@ -0,0 +1,107 @@
+package inference
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+)
+
+// Pooling strategies that turn the hidden states of a text into a single
+// embedding
+const (
+	PoolingMean = "mean" // average of the token states, ignoring padding
+	PoolingCLS  = "cls"  // state of the first, [CLS], token
+)
+
+// pool reduces hidden states of shape [tokens, hidden] to a single vector
+func pool(hidden *tensor.Tensor, attentionMask []int, pooling string) ([]float32, error) {
+	n, h := hidden.Dim(0), hidden.Dim(1)
+	data := hidden.Contiguous().Data()
+	switch pooling {
+	case PoolingCLS:
+		return append([]float32{}, data[:h]...), nil
+	case PoolingMean, "":
+		sum := make([]float32, h)
+		var count float32
+		for i := 0; i < n; i++ {
+			if i < len(attentionMask) && attentionMask[i] == 0 {
+				continue
+			}
+			for j, v := range data[i*h : (i+1)*h] {
+				sum[j] += v
+			}
+			count++
+		}
+		for j := range sum {
+			sum[j] /= max(count, 1)
+		}
+		return sum, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown pooling %q", errs.ErrInvalidInput, pooling)
+	}
+}
+
+// normalizeL2 scales v in place to unit length, leaving zero vectors alone
+func normalizeL2(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	scale := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= scale
+	}
+}
+
+// sentenceTransformersConfig reads the pooling and normalization of a
+// sentence-transformers model directory from its modules.json and pooling
+// module config. Directories without modules.json get mean pooling without
+// normalization.
+func sentenceTransformersConfig(dir string) (pooling string, normalize bool, err error) {
+	pooling = PoolingMean
+	data, err := os.ReadFile(filepath.Join(dir, "modules.json"))
+	if os.IsNotExist(err) {
+		return pooling, false, nil
+	} else if err != nil {
+		return "", false, fmt.Errorf("failed to read modules.json: %w", err)
+	}
+	var modules []struct {
+		Path string `json:"path"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &modules); err != nil {
+		return "", false, fmt.Errorf("failed to parse modules.json: %w", err)
+	}
+
+	for _, module := range modules {
+		switch {
+		case strings.HasSuffix(module.Type, ".Normalize"):
+			normalize = true
+		case strings.HasSuffix(module.Type, ".Pooling"):
+			data, err := os.ReadFile(filepath.Join(dir, module.Path, "config.json"))
+			if err != nil {
+				return "", false, fmt.Errorf("failed to read pooling config: %w", err)
+			}
+			var cfg struct {
+				CLSToken   bool `json:"pooling_mode_cls_token"`
+				MeanTokens bool `json:"pooling_mode_mean_tokens"`
+			}
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return "", false, fmt.Errorf("failed to parse pooling config: %w", err)
+			}
+			if cfg.CLSToken && !cfg.MeanTokens {
+				pooling = PoolingCLS
+			}
+		}
+	}
+	return pooling, normalize, nil
+}
@@ -0,0 +1,420 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+	"github.com/kelleyblackmore/go-transformer/pkg/tokenizers"
+)
+
+// defaultMaxLength is the total number of tokens, prompt included, generated
+// when GenerationOptions.MaxLength is not set
+const defaultMaxLength = 50
+
+// kvCache holds the attention keys and values of every position processed
+// so far, one [positions, dim] tensor per layer. Tensors are never modified
+// in place, so a cache can be cloned cheaply to branch several sequences
+// from a shared prompt.
+type kvCache struct {
+	keys, values []*tensor.Tensor
+}
+
+func newKVCache(layers int) *kvCache {
+	return &kvCache{keys: make([]*tensor.Tensor, layers), values: make([]*tensor.Tensor, layers)}
+}
+
+// append adds the keys and values of new positions to a layer and returns
+// the keys and values of all positions
+func (c *kvCache) append(layer int, k, v *tensor.Tensor) (*tensor.Tensor, *tensor.Tensor) {
+	if c.keys[layer] != nil {
+		k = tensor.Concat(0, c.keys[layer], k)
+		v = tensor.Concat(0, c.values[layer], v)
+	}
+	c.keys[layer], c.values[layer] = k, v
+	return k, v
+}
+
+// len returns the number of cached positions
+func (c *kvCache) len() int {
+	if len(c.keys) == 0 || c.keys[0] == nil {
+		return 0
+	}
+	return c.keys[0].Dim(0)
+}
+
+func (c *kvCache) clone() *kvCache {
+	return &kvCache{keys: append([]*tensor.Tensor{}, c.keys...), values: append([]*tensor.Tensor{}, c.values...)}
+}
+
+// causalLM is a decoder-only language model
+type causalLM interface {
+	// forward runs ids, which follow the positions already in cache, adds
+	// them to the cache and returns the logits of the last position
+	forward(ctx context.Context, ids []int, cache *kvCache) ([]float32, error)
+
+	newCache() *kvCache
+}
+
+// generator drives autoregressive decoding of a causal language model
+type generator struct {
+	lm           causalLM
+	tokenizer    tokenizers.Tokenizer
+	bos          int // token used for an empty prompt, or -1
+	eos          []int
+	maxPositions int
+}
+
+// decoding holds a prompt that has been run through the model, ready for
+// sequences to be sampled from it
+type decoding struct {
+	prompt    string
+	ids       []int // prompt tokens
+	cache     *kvCache
+	logits    []float32
+	sampler   *sampler
+	maxLength int
+	numReturn int
+	stop      []string
+	fullText  bool // results start with the prompt
+}
+
+// start checks options, tokenizes prompt and runs it through the model
+func (g *generator) start(ctx context.Context, prompt string, options *models.GenerationOptions, rng *rand.Rand) (*decoding, error) {
+	if options == nil {
+		options = &models.GenerationOptions{}
+	}
+	numReturn := max(options.NumReturn, 1)
+	if numReturn > 1 && !options.DoSample {
+		return nil, fmt.Errorf("%w: returning several sequences requires sampling", errs.ErrInvalidInput)
+	}
+
+	s := &sampler{
+		doSample:          options.DoSample,
+		temperature:       options.Temperature,
+		topK:              options.TopK,
+		topP:              options.TopP,
+		repetitionPenalty: options.RepetitionPenalty,
+		rng:               rng,
+	}
+	if s.topK == 0 {
+		s.topK = defaultTopK
+	}
+	if options.Seed != nil {
+		s.rng = rand.New(rand.NewSource(*options.Seed))
+	} else if s.rng == nil {
+		s.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	enc, err := g.tokenizer.Encode(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize prompt: %w", err)
+	}
+	ids := enc.IDs
+	if len(ids) == 0 {
+		if g.bos < 0 {
+			return nil, fmt.Errorf("%w: prompt is empty and the model has no beginning of sequence token", errs.ErrInvalidInput)
+		}
+		ids = []int{g.bos}
+	}
+	if len(ids) > g.maxPositions {
+		return nil, fmt.Errorf("%w: prompt of %d tokens exceeds the model maximum of %d", errs.ErrInvalidInput, len(ids), g.maxPositions)
+	}
+
+	maxLength := options.MaxLength
+	if options.MaxNewTokens > 0 {
+		maxLength = len(ids) + options.MaxNewTokens
+	} else if maxLength <= 0 {
+		maxLength = defaultMaxLength
+	}
+	maxLength = min(maxLength, g.maxPositions)
+
+	cache := g.lm.newCache()
+	logits, err := g.lm.forward(ctx, ids, cache)
+	if err != nil {
+		return nil, err
+	}
+	return &decoding{
+		prompt:    prompt,
+		ids:       ids,
+		cache:     cache,
+		logits:    logits,
+		sampler:   s,
+		maxLength: maxLength,
+		numReturn: numReturn,
+		stop:      options.Stop,
+		fullText:  options.ReturnFullText == nil || *options.ReturnFullText,
+	}, nil
+}
+
+// sample decodes one sequence, calling emit, when not nil, with each sampled
+// token and its log-probability, including a final end of sequence token.
+// It returns the generated tokens without the end of sequence token, their
+// total log-probability and why decoding finished.
+func (g *generator) sample(ctx context.Context, d *decoding, emit func(id int, logprob float64) error) ([]int, float64, string, error) {
+	cache, logits := d.cache.clone(), d.logits
+	var generated []int
+	var score float64
+	for n := len(d.ids); n < d.maxLength; n++ {
+		next := d.sampler.next(d.sampler.penalize(logits, d.ids, generated))
+		logprob := logSoftmax(logits, next)
+		score += logprob
+		if emit != nil {
+			if err := emit(next, logprob); err != nil {
+				return nil, 0, "", err
+			}
+		}
+		if g.isEOS(next) {
+			return generated, score, models.FinishEOSToken, nil
+		}
+		generated = append(generated, next)
+		if stopped, err := g.reachedStop(d, generated); err != nil || stopped {
+			return generated, score, models.FinishStopSequence, err
+		}
+		if n+1 == d.maxLength {
+			break
+		}
+		var err error
+		if logits, err = g.lm.forward(ctx, []int{next}, cache); err != nil {
+			return nil, 0, "", err
+		}
+	}
+	return generated, score, models.FinishLength, nil
+}
+
+// reachedStop reports whether the text of generated contains one of the
+// stop sequences of d
+func (g *generator) reachedStop(d *decoding, generated []int) (bool, error) {
+	if len(d.stop) == 0 {
+		return false, nil
+	}
+	text, err := g.decodeContinuation(d.ids, generated)
+	if err != nil {
+		return false, err
+	}
+	for _, stop := range d.stop {
+		if stop != "" && strings.Contains(text, stop) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// generate produces options.NumReturn continuations of prompt. Each result
+// holds the generated text, after the prompt unless options.ReturnFullText
+// is false, and its score is the log-probability of the generated tokens
+// under the model.
+func (g *generator) generate(ctx context.Context, prompt string, options *models.GenerationOptions, rng *rand.Rand) ([]models.GenerationResult, error) {
+	d, err := g.start(ctx, prompt, options, rng)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.GenerationResult, d.numReturn)
+	for r := range results {
+		generated, score, reason, err := g.sample(ctx, d, nil)
+		if err != nil {
+			return nil, err
+		}
+		text, err := g.decodeContinuation(d.ids, generated)
+		if err != nil {
+			return nil, err
+		}
+		if d.fullText {
+			text = prompt + text
+		}
+		results[r] = models.GenerationResult{GeneratedText: text, Score: score, FinishReason: reason}
+	}
+	return results, nil
+}
+
+// stream generates a single continuation of prompt, sending each token as
+// it is sampled. Errors in the prompt or options are returned directly and
+// later ones as the last token of the stream.
+func (g *generator) stream(ctx context.Context, prompt string, options *models.GenerationOptions, rng *rand.Rand) (<-chan models.Token, error) {
+	if options != nil && options.NumReturn > 1 {
+		return nil, fmt.Errorf("%w: streaming returns a single sequence", errs.ErrInvalidInput)
+	}
+	d, err := g.start(ctx, prompt, options, rng)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make(chan models.Token)
+	send := func(t models.Token) error {
+		select {
+		case tokens <- t:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	go func() {
+		defer close(tokens)
+
+		// Each token's text is what it adds to the decoded continuation.
+		// Tokens ending inside a multi-byte character add nothing until the
+		// character is complete.
+		var generated []int
+		var text string
+		var pending *models.Token
+		emit := func(id int, logprob float64) error {
+			if pending != nil {
+				if err := send(*pending); err != nil {
+					return err
+				}
+			}
+			pending = &models.Token{ID: id, Logprob: logprob}
+			if g.isEOS(id) {
+				pending.Special = true
+				return nil
+			}
+			generated = append(generated, id)
+			full, err := g.decodeContinuation(d.ids, generated)
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(full, text) && !strings.HasSuffix(full, string(utf8.RuneError)) {
+				pending.Text = full[len(text):]
+				text = full
+			}
+			return nil
+		}
+
+		_, _, reason, err := g.sample(ctx, d, emit)
+		var full string
+		if err == nil {
+			full, err = g.decodeContinuation(d.ids, generated)
+		}
+		if err != nil {
+			_ = send(models.Token{Err: err})
+			return
+		}
+
+		// The last token carries any text held back so far
+		last := models.Token{}
+		if pending != nil {
+			last = *pending
+		}
+		if strings.HasPrefix(full, text) {
+			last.Text += full[len(text):]
+		}
+		last.Details = &models.GenerationDetails{GeneratedText: full, FinishReason: reason, GeneratedTokens: len(generated)}
+		if last.Special {
+			last.Details.GeneratedTokens++
+		}
+		_ = send(last)
+	}()
+	return tokens, nil
+}
+
+// decodeContinuation returns the text of generated as it follows the prompt.
+// Like Hugging Face, the whole sequence is decoded and the decoded prompt cut
+// off, so that decoders which treat the first token specially, such as
+// dropping a leading space, do not affect the continuation.
+func (g *generator) decodeContinuation(promptIDs, generated []int) (string, error) {
+	prompt, err := g.tokenizer.Decode(promptIDs)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode prompt: %w", err)
+	}
+	full, err := g.tokenizer.Decode(append(append([]int{}, promptIDs...), generated...))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode generated tokens: %w", err)
+	}
+	if len(prompt) > len(full) {
+		return "", nil
+	}
+	return full[len(prompt):], nil
+}
+
+func (g *generator) isEOS(id int) bool {
+	for _, e := range g.eos {
+		if id == e {
+			return true
+		}
+	}
+	return false
+}
+
+// causalMask returns the [n, past+n] additive mask that stops each of n new
+// positions attending to later ones and, when window is positive, to
+// positions window or more tokens earlier. It returns nil when nothing needs
+// masking.
+func causalMask(n, past, window int) *tensor.Tensor {
+	if n <= 1 && (window <= 0 || past < window) {
+		return nil
+	}
+	mask := tensor.Zeros(n, past+n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < past+n; j++ {
+			if j > past+i || (window > 0 && j <= past+i-window) {
+				mask.Set(float32(negInf), i, j)
+			}
+		}
+	}
+	return mask
+}
+
+// generationEOS returns the end of sequence tokens of a model directory's
+// generation_config.json, which take precedence over those of config.json.
+// It returns nil when there is no such file.
+func generationEOS(dir string) ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "generation_config.json"))
+	if err != nil {
+		return nil, nil
+	}
+	var gc struct {
+		EOSTokenID json.RawMessage `json:"eos_token_id"`
+	}
+	if err := json.Unmarshal(data, &gc); err != nil {
+		return nil, fmt.Errorf("failed to parse generation config: %w", err)
+	}
+	eos, err := tokenIDs(gc.EOSTokenID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid eos_token_id in generation config: %w", err)
+	}
+	return eos, nil
+}
+
+// tokenIDs decodes a config token ID field, which may be null, a single ID
+// or a list of IDs
+func tokenIDs(raw json.RawMessage) ([]int, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var id int
+	if json.Unmarshal(raw, &id) == nil {
+		return []int{id}, nil
+	}
+	var ids []int
+	if err := json.Unmarshal(raw, &ids); err != nil {
+		return nil, fmt.Errorf("%s is neither a token ID nor a list of them", raw)
+	}
+	return ids, nil
+}
+
+// configTokens decodes the bos_token_id and eos_token_id fields of a model
+// config, returning a bos of -1 when there is none
+func configTokens(bosRaw, eosRaw json.RawMessage) (bos int, eos []int, err error) {
+	if eos, err = tokenIDs(eosRaw); err != nil {
+		return 0, nil, fmt.Errorf("invalid eos_token_id in config: %w", err)
+	}
+	ids, err := tokenIDs(bosRaw)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid bos_token_id in config: %w", err)
+	}
+	bos = -1
+	if len(ids) > 0 {
+		bos = ids[0]
+	}
+	return bos, eos, nil
+}
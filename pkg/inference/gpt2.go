@@ -0,0 +1,203 @@
+package inference
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+	"github.com/kelleyblackmore/go-transformer/pkg/tokenizers"
+)
+
+// GPT2Config holds the architecture of a GPT-2 model
+type GPT2Config struct {
+	VocabSize          int     `json:"vocab_size"`
+	NPositions         int     `json:"n_positions"`
+	NEmbd              int     `json:"n_embd"`
+	NLayer             int     `json:"n_layer"`
+	NHead              int     `json:"n_head"`
+	NInner             int     `json:"n_inner"` // 4 * NEmbd when unset
+	ActivationFunction string  `json:"activation_function"`
+	LayerNormEpsilon   float32 `json:"layer_norm_epsilon"`
+	BOSTokenID         int     `json:"bos_token_id"`
+	EOSTokenID         int     `json:"eos_token_id"`
+}
+
+// GPT2Model runs a GPT-2 language model in pure Go. Attention keys and values
+// are cached during generation so each new token costs a single forward step.
+type GPT2Model struct {
+	Config    GPT2Config
+	Tokenizer tokenizers.Tokenizer
+
+	// Rand is the source of randomness for sampling. When nil, each call to
+	// Generate uses a new time-seeded source. A Rand must not be shared by
+	// concurrent calls.
+	Rand *rand.Rand
+
+	name     string
+	act      func(*tensor.Tensor) *tensor.Tensor
+	wte, wpe *tensor.Tensor
+	layers   []gpt2Layer
+	lnF      layerNorm
+	lmHead   *tensor.Tensor
+	gen      *generator
+}
+
+type gpt2Layer struct {
+	ln1, ln2    layerNorm
+	attn, proj  linear
+	fc, mlpProj linear
+}
+
+var (
+	_ models.Model          = (*GPT2Model)(nil)
+	_ models.MultiGenerator = (*GPT2Model)(nil)
+)
+
+// LoadGPT2Model loads a GPT2LMHeadModel from a directory containing
+// config.json, safetensors weights and a tokenizer
+func LoadGPT2Model(dir string) (*GPT2Model, error) {
+	cfg := GPT2Config{ActivationFunction: "gelu_new", LayerNormEpsilon: 1e-5}
+	if err := readConfig(dir, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.NInner == 0 {
+		cfg.NInner = 4 * cfg.NEmbd
+	}
+	if cfg.NEmbd <= 0 || cfg.NHead <= 0 || cfg.NEmbd%cfg.NHead != 0 {
+		return nil, fmt.Errorf("invalid model config: embedding size %d is not divisible into %d heads", cfg.NEmbd, cfg.NHead)
+	}
+	act, err := activation(cfg.ActivationFunction)
+	if err != nil {
+		return nil, fmt.Errorf("invalid model config: %w", err)
+	}
+
+	st, err := OpenSafeTensors(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+
+	m := &GPT2Model{Config: cfg, name: dir, act: act}
+	if err := m.loadWeights(st); err != nil {
+		return nil, fmt.Errorf("failed to load weights from %s: %w", dir, err)
+	}
+	if m.Tokenizer, err = loadTokenizer(dir, 0); err != nil {
+		return nil, err
+	}
+	m.gen = &generator{
+		lm:           m,
+		tokenizer:    m.Tokenizer,
+		bos:          cfg.BOSTokenID,
+		eos:          []int{cfg.EOSTokenID},
+		maxPositions: cfg.NPositions,
+	}
+	return m, nil
+}
+
+// loadWeights reads every weight, accepting checkpoints saved with or
+// without the transformer. prefix. The output projection is tied to the
+// token embeddings unless the checkpoint has a separate lm_head.
+func (m *GPT2Model) loadWeights(st *SafeTensors) error {
+	cfg := m.Config
+	e := cfg.NEmbd
+	w := &weightLoader{st: st}
+	if !w.has("wte.weight") {
+		w.prefix = "transformer."
+	}
+
+	m.wte = w.tensor("wte.weight", cfg.VocabSize, e)
+	m.wpe = w.tensor("wpe.weight", cfg.NPositions, e)
+	m.layers = make([]gpt2Layer, cfg.NLayer)
+	for i := range m.layers {
+		p := fmt.Sprintf("h.%d.", i)
+		m.layers[i] = gpt2Layer{
+			ln1:     w.layerNorm(p+"ln_1", e, cfg.LayerNormEpsilon),
+			attn:    w.conv1D(p+"attn.c_attn", e, 3*e),
+			proj:    w.conv1D(p+"attn.c_proj", e, e),
+			ln2:     w.layerNorm(p+"ln_2", e, cfg.LayerNormEpsilon),
+			fc:      w.conv1D(p+"mlp.c_fc", e, cfg.NInner),
+			mlpProj: w.conv1D(p+"mlp.c_proj", cfg.NInner, e),
+		}
+	}
+	m.lnF = w.layerNorm("ln_f", e, cfg.LayerNormEpsilon)
+
+	m.lmHead = m.wte
+	w.prefix = ""
+	if w.has("lm_head.weight") {
+		m.lmHead = w.tensor("lm_head.weight", cfg.VocabSize, e)
+	}
+	return w.err
+}
+
+func (m *GPT2Model) newCache() *kvCache {
+	return newKVCache(m.Config.NLayer)
+}
+
+// forward implements causalLM
+func (m *GPT2Model) forward(ctx context.Context, ids []int, cache *kvCache) ([]float32, error) {
+	cfg := m.Config
+	past, n := cache.len(), len(ids)
+	if past+n > cfg.NPositions {
+		return nil, fmt.Errorf("%w: sequence of %d tokens exceeds the model maximum of %d", errs.ErrInvalidInput, past+n, cfg.NPositions)
+	}
+
+	positions := make([]int, n)
+	for i := range positions {
+		positions[i] = past + i
+	}
+	x := tensor.Add(tensor.Embedding(m.wte, ids), tensor.Embedding(m.wpe, positions))
+
+	e := cfg.NEmbd
+	mask := causalMask(n, past, 0)
+	for i, l := range m.layers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		qkv := l.attn.forward(l.ln1.forward(x))
+		q := qkv.Slice(1, 0, e)
+		k, v := cache.append(i, qkv.Slice(1, e, 2*e).Contiguous(), qkv.Slice(1, 2*e, 3*e).Contiguous())
+		x = tensor.Add(x, l.proj.forward(attention(q, k, v, cfg.NHead, cfg.NHead, mask)))
+		x = tensor.Add(x, l.mlpProj.forward(m.act(l.fc.forward(l.ln2.forward(x)))))
+	}
+
+	last := m.lnF.forward(x.Slice(0, n-1, n))
+	return tensor.Linear(last, m.lmHead, nil).Data(), nil
+}
+
+// Generate continues prompt. When options.NumReturn sequences are sampled,
+// the first one is returned.
+func (m *GPT2Model) Generate(ctx context.Context, prompt string, options *models.GenerationOptions) (*models.GenerationResult, error) {
+	results, err := m.gen.generate(ctx, prompt, options, m.Rand)
+	if err != nil {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// GenerateAll continues prompt, returning all options.NumReturn sequences in
+// the order they were sampled
+func (m *GPT2Model) GenerateAll(ctx context.Context, prompt string, options *models.GenerationOptions) ([]models.GenerationResult, error) {
+	return m.gen.generate(ctx, prompt, options, m.Rand)
+}
+
+// GenerateStream continues prompt, sending each token as it is sampled
+func (m *GPT2Model) GenerateStream(ctx context.Context, prompt string, options *models.GenerationOptions) (<-chan models.Token, error) {
+	return m.gen.stream(ctx, prompt, options, m.Rand)
+}
+
+// Classify is not supported by language models
+func (m *GPT2Model) Classify(ctx context.Context, text string) (*models.ClassificationResult, error) {
+	return nil, &errs.UnsupportedTaskError{Model: "gpt2", Task: models.TaskTextClassification}
+}
+
+// GetModelInfo returns information about the model
+func (m *GPT2Model) GetModelInfo() *models.ModelInfo {
+	return &models.ModelInfo{
+		Name:     m.name,
+		Task:     models.TaskTextGeneration,
+		Provider: "safetensors",
+	}
+}
@@ -0,0 +1,399 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+)
+
+// testGPT2Vocab is a byte-level vocabulary covering the test prompts
+var testGPT2Vocab = []string{"<|endoftext|>", "h", "e", "l", "o", "Ġ", "w", "r", "d", "he", "ll", "Ġw"}
+
+// writeTestGPT2Model writes a tiny two-layer GPT-2 with a vocab.json and
+// merges.txt tokenizer
+func writeTestGPT2Model(t *testing.T) string {
+	t.Helper()
+	const embd, layers, positions = 8, 2, 16
+	dir := t.TempDir()
+
+	config, err := json.Marshal(map[string]any{
+		"vocab_size": len(testGPT2Vocab), "n_positions": positions, "n_embd": embd,
+		"n_layer": layers, "n_head": 2, "n_inner": nil, "activation_function": "gelu_new",
+		"layer_norm_epsilon": 1e-5, "bos_token_id": 0, "eos_token_id": 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "config.json"), config)
+
+	vocab := make(map[string]int)
+	for i, tok := range testGPT2Vocab {
+		vocab[tok] = i
+	}
+	data, err := json.Marshal(vocab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "vocab.json"), data)
+	writeFile(t, filepath.Join(dir, "merges.txt"), []byte("#version: 0.2\nh e\nl l\nĠ w\n"))
+
+	w := &testWeights{state: 7}
+	w.add("wte.weight", 0, len(testGPT2Vocab), embd)
+	w.add("wpe.weight", 0, positions, embd)
+	for i := 0; i < layers; i++ {
+		p := fmt.Sprintf("h.%d.", i)
+		w.layerNorm(p+"ln_1", embd)
+		w.add(p+"attn.c_attn.weight", 0, embd, 3*embd)
+		w.add(p+"attn.c_attn.bias", 0, 3*embd)
+		w.add(p+"attn.c_proj.weight", 0, embd, embd)
+		w.add(p+"attn.c_proj.bias", 0, embd)
+		w.layerNorm(p+"ln_2", embd)
+		w.add(p+"mlp.c_fc.weight", 0, embd, 4*embd)
+		w.add(p+"mlp.c_fc.bias", 0, 4*embd)
+		w.add(p+"mlp.c_proj.weight", 0, 4*embd, embd)
+		w.add(p+"mlp.c_proj.bias", 0, embd)
+	}
+	w.layerNorm("ln_f", embd)
+
+	writeFile(t, filepath.Join(dir, "model.safetensors"), encodeSafeTensors(t, nil, w.tensors...))
+	return dir
+}
+
+func TestGPT2Model_Generate(t *testing.T) {
+	m, err := LoadGPT2Model(writeTestGPT2Model(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var _ models.Model = m
+
+	// Reference values from an independent implementation that recomputes
+	// the full sequence at every step
+	enc, err := m.Tokenizer.Encode("hello world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logits, err := m.forward(context.Background(), enc.IDs, m.newCache())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []float32{0.24675560, -0.77552019, 0.00026846, -0.17655929, -0.02771586, -0.06875027,
+		-0.22314409, 0.09430810, -0.00276521, 0.45735949, -0.09004627, -0.03621349}
+	for i := range want {
+		if math.Abs(float64(logits[i]-want[i])) > 1e-5 {
+			t.Fatalf("Expected logits %v, got %v", want, logits)
+		}
+	}
+
+	result, err := m.Generate(context.Background(), "hello world", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Greedy decoding fills the 16 positions of the model
+	if result.GeneratedText != "hello worldhehehehehehehehe" {
+		t.Errorf("Expected 'hello worldhehehehehehehehe', got %q", result.GeneratedText)
+	}
+	if math.Abs(result.Score-(-15.0726036)) > 1e-4 {
+		t.Errorf("Expected score -15.0726036, got %v", result.Score)
+	}
+
+	result, err = m.Generate(context.Background(), "hello world", &models.GenerationOptions{MaxLength: 10})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.GeneratedText != "hello worldhehe" {
+		t.Errorf("Expected 'hello worldhehe', got %q", result.GeneratedText)
+	}
+
+	if _, err := m.Generate(context.Background(), "hello hello hello hello hello", nil); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Error("Expected error for a prompt longer than the context")
+	}
+	if _, err := m.Generate(context.Background(), "", &models.GenerationOptions{MaxLength: 3}); err != nil {
+		t.Errorf("Expected an empty prompt to start from the BOS token, got %v", err)
+	}
+}
+
+func TestGPT2Model_GenerateStream(t *testing.T) {
+	m, err := LoadGPT2Model(writeTestGPT2Model(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The same greedy continuation as Generate, one token at a time
+	tokens, err := m.GenerateStream(context.Background(), "hello world", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var text strings.Builder
+	var score float64
+	var last models.Token
+	n := 0
+	for tok := range tokens {
+		if tok.Err != nil {
+			t.Fatalf("Expected no error, got %v", tok.Err)
+		}
+		text.WriteString(tok.Text)
+		score += tok.Logprob
+		last = tok
+		n++
+	}
+	if text.String() != "hehehehehehehehe" {
+		t.Errorf("Expected 'hehehehehehehehe', got %q", text.String())
+	}
+	if math.Abs(score-(-15.0726036)) > 1e-4 {
+		t.Errorf("Expected total logprob -15.0726036, got %v", score)
+	}
+	expected := models.GenerationDetails{GeneratedText: "hehehehehehehehe", FinishReason: models.FinishLength, GeneratedTokens: n}
+	if last.Details == nil || *last.Details != expected {
+		t.Errorf("Expected details %+v on the last token, got %+v", expected, last.Details)
+	}
+
+	// An end of sequence token ends the stream as a special token
+	he, err := m.Tokenizer.Encode("he")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.gen.eos = he.IDs
+	tokens, err = m.GenerateStream(context.Background(), "hello world", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var all []models.Token
+	for tok := range tokens {
+		all = append(all, tok)
+	}
+	if len(all) != 1 || !all[0].Special || all[0].ID != he.IDs[0] || all[0].Text != "" ||
+		all[0].Details == nil || all[0].Details.FinishReason != models.FinishEOSToken || all[0].Details.GeneratedTokens != 1 {
+		t.Errorf("Expected a single special end of sequence token, got %+v", all)
+	}
+
+	if _, err := m.GenerateStream(context.Background(), "hello", &models.GenerationOptions{DoSample: true, NumReturn: 2}); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for several streamed sequences, got %v", err)
+	}
+
+	// Cancelling the context ends the stream early
+	m.gen.eos = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	tokens, err = m.GenerateStream(ctx, "hello world", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	<-tokens
+	cancel()
+	for range tokens {
+	}
+}
+
+func TestGPT2Model_KVCache(t *testing.T) {
+	m, err := LoadGPT2Model(writeTestGPT2Model(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ids := []int{9, 10, 4, 11, 4, 7, 3, 8}
+	full, err := m.forward(context.Background(), ids, m.newCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := m.newCache()
+	if _, err := m.forward(context.Background(), ids[:3], cache); err != nil {
+		t.Fatal(err)
+	}
+	var incremental []float32
+	for _, id := range ids[3:] {
+		if incremental, err = m.forward(context.Background(), []int{id}, cache); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cache.len() != len(ids) {
+		t.Errorf("Expected %d cached positions, got %d", len(ids), cache.len())
+	}
+	for i := range full {
+		if math.Abs(float64(full[i]-incremental[i])) > 1e-5 {
+			t.Fatalf("Expected cached logits %v to match %v", incremental, full)
+		}
+	}
+}
+
+func TestGPT2Model_Sampling(t *testing.T) {
+	m, err := LoadGPT2Model(writeTestGPT2Model(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ctx := context.Background()
+	options := &models.GenerationOptions{DoSample: true, Temperature: 1.5, TopP: 0.9, TopK: 5}
+
+	m.Rand = rand.New(rand.NewSource(1))
+	first, err := m.Generate(ctx, "hello", options)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	m.Rand = rand.New(rand.NewSource(1))
+	second, err := m.Generate(ctx, "hello", options)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if first.GeneratedText != second.GeneratedText {
+		t.Errorf("Expected the same seed to give the same text, got %q and %q", first.GeneratedText, second.GeneratedText)
+	}
+	if !strings.HasPrefix(first.GeneratedText, "hello") {
+		t.Errorf("Expected text to start with the prompt, got %q", first.GeneratedText)
+	}
+
+	// Top-k of one is greedy decoding
+	greedy, _ := m.Generate(ctx, "hello", &models.GenerationOptions{MaxLength: 8})
+	topOne, err := m.Generate(ctx, "hello", &models.GenerationOptions{MaxLength: 8, DoSample: true, TopK: 1})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if topOne.GeneratedText != greedy.GeneratedText {
+		t.Errorf("Expected top-k 1 to match greedy %q, got %q", greedy.GeneratedText, topOne.GeneratedText)
+	}
+
+	results, err := m.gen.generate(ctx, "hello", &models.GenerationOptions{MaxLength: 8, DoSample: true, NumReturn: 3}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 3 {
+		t.Errorf("Expected 3 sequences, got %d", len(results))
+	}
+	if _, err := m.Generate(ctx, "hello", &models.GenerationOptions{NumReturn: 2}); err == nil {
+		t.Error("Expected error returning several greedy sequences")
+	}
+}
+
+func TestGPT2Model_GenerateOptions(t *testing.T) {
+	m, err := LoadGPT2Model(writeTestGPT2Model(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ctx := context.Background()
+	fullText := false
+
+	results, err := m.GenerateAll(ctx, "hello world", &models.GenerationOptions{MaxNewTokens: 2, ReturnFullText: &fullText})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []models.GenerationResult{{GeneratedText: "hehe", Score: results[0].Score, FinishReason: models.FinishLength}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, results)
+	}
+
+	result, err := m.Generate(ctx, "hello world", &models.GenerationOptions{Stop: []string{"heh"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.GeneratedText != "hello worldhehe" || result.FinishReason != models.FinishStopSequence {
+		t.Errorf("Expected 'hello worldhehe' finished by stop_sequence, got %+v", result)
+	}
+
+	// A seed overrides the model's random source
+	seed := int64(7)
+	options := &models.GenerationOptions{DoSample: true, Temperature: 2, Seed: &seed}
+	m.Rand = rand.New(rand.NewSource(1))
+	first, err := m.Generate(ctx, "hello", options)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	m.Rand = rand.New(rand.NewSource(2))
+	second, err := m.Generate(ctx, "hello", options)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if first.GeneratedText != second.GeneratedText {
+		t.Errorf("Expected the same seed to give the same text, got %q and %q", first.GeneratedText, second.GeneratedText)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	logits := []float32{2, 1, 0, -1}
+	rng := rand.New(rand.NewSource(3))
+
+	tests := []struct {
+		name    string
+		s       sampler
+		allowed map[int]bool
+	}{
+		{"greedy", sampler{}, map[int]bool{0: true}},
+		{"top-k", sampler{doSample: true, topK: 2}, map[int]bool{0: true, 1: true}},
+		// softmax gives token 0 a probability of 0.64
+		{"top-p", sampler{doSample: true, topP: 0.6}, map[int]bool{0: true}},
+		{"temperature", sampler{doSample: true, temperature: 0.01}, map[int]bool{0: true}},
+	}
+	for _, tt := range tests {
+		tt.s.rng = rng
+		for i := 0; i < 200; i++ {
+			if id := tt.s.next(logits); !tt.allowed[id] {
+				t.Errorf("%s: sampled disallowed token %d", tt.name, id)
+				break
+			}
+		}
+	}
+
+	// Without filtering every token is eventually sampled
+	s := sampler{doSample: true, rng: rng}
+	seen := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		seen[s.next(logits)] = true
+	}
+	if len(seen) != len(logits) {
+		t.Errorf("Expected all %d tokens to be sampled, got %v", len(logits), seen)
+	}
+
+	// Seen tokens are penalized once, whether their logits are positive or
+	// negative
+	s = sampler{repetitionPenalty: 2}
+	penalized := s.penalize(logits, []int{0}, []int{3, 0})
+	if want := []float32{1, 1, 0, -2}; !reflect.DeepEqual(penalized, want) {
+		t.Errorf("Expected penalized logits %v, got %v", want, penalized)
+	}
+	if logits[0] != 2 {
+		t.Errorf("Expected the logits to be left unchanged, got %v", logits)
+	}
+}
+
+func TestSelectTop(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	candidates := make([]candidate, 1000)
+	for i := range candidates {
+		candidates[i] = candidate{i, float64(rng.Intn(100))}
+	}
+	sorted := append([]candidate{}, candidates...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].before(sorted[j]) })
+
+	top := selectTop(candidates, 40)
+	sort.Slice(top, func(i, j int) bool { return top[i].before(top[j]) })
+	if !reflect.DeepEqual(top, sorted[:40]) {
+		t.Errorf("Expected the 40 best candidates %v, got %v", sorted[:40], top)
+	}
+}
+
+func TestTokenIDs(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected []int
+	}{
+		{"", nil},
+		{"null", nil},
+		{"2", []int{2}},
+		{"[1, 2]", []int{1, 2}},
+	}
+	for _, tt := range tests {
+		if ids, err := tokenIDs(json.RawMessage(tt.raw)); err != nil || !reflect.DeepEqual(ids, tt.expected) {
+			t.Errorf("%q: expected %v, got %v (%v)", tt.raw, tt.expected, ids, err)
+		}
+	}
+	if _, err := tokenIDs(json.RawMessage(`"</s>"`)); err == nil {
+		t.Error("Expected error for a malformed token ID")
+	}
+}
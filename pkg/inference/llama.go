@@ -0,0 +1,244 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+	"github.com/kelleyblackmore/go-transformer/pkg/tokenizers"
+)
+
+// LlamaConfig holds the architecture of a LLaMA-family model. Mistral,
+// Qwen2 and TinyLlama checkpoints use the same layout.
+type LlamaConfig struct {
+	ModelType             string          `json:"model_type"`
+	VocabSize             int             `json:"vocab_size"`
+	HiddenSize            int             `json:"hidden_size"`
+	IntermediateSize      int             `json:"intermediate_size"`
+	NumHiddenLayers       int             `json:"num_hidden_layers"`
+	NumAttentionHeads     int             `json:"num_attention_heads"`
+	NumKeyValueHeads      int             `json:"num_key_value_heads"` // NumAttentionHeads when unset
+	HeadDim               int             `json:"head_dim"`            // HiddenSize / NumAttentionHeads when unset
+	MaxPositionEmbeddings int             `json:"max_position_embeddings"`
+	RMSNormEps            float32         `json:"rms_norm_eps"`
+	RopeTheta             float64         `json:"rope_theta"`
+	RopeScaling           *RopeScaling    `json:"rope_scaling"`
+	TieWordEmbeddings     bool            `json:"tie_word_embeddings"`
+	HiddenAct             string          `json:"hidden_act"`
+	SlidingWindow         int             `json:"sliding_window"`
+	UseSlidingWindow      *bool           `json:"use_sliding_window"` // Qwen2 disables the window by default
+	BOSTokenID            json.RawMessage `json:"bos_token_id"`
+	EOSTokenID            json.RawMessage `json:"eos_token_id"`
+}
+
+// LlamaModel runs a LLaMA-family language model in pure Go: RMSNorm, rotary
+// position embeddings, a SwiGLU feed-forward network and grouped-query
+// attention with a key/value cache
+type LlamaModel struct {
+	Config    LlamaConfig
+	Tokenizer tokenizers.Tokenizer
+
+	// Rand is the source of randomness for sampling. When nil, each call to
+	// Generate uses a new time-seeded source. A Rand must not be shared by
+	// concurrent calls.
+	Rand *rand.Rand
+
+	name   string
+	act    func(*tensor.Tensor) *tensor.Tensor
+	rope   *rotary
+	window int
+	embed  *tensor.Tensor
+	layers []llamaLayer
+	norm   rmsNorm
+	lmHead linear
+	gen    *generator
+}
+
+type llamaLayer struct {
+	inputNorm, postNorm rmsNorm
+	q, k, v, o          linear
+	gate, up, down      linear
+}
+
+var (
+	_ models.Model          = (*LlamaModel)(nil)
+	_ models.MultiGenerator = (*LlamaModel)(nil)
+)
+
+// LoadLlamaModel loads a LlamaForCausalLM, MistralForCausalLM or
+// Qwen2ForCausalLM model from a directory containing config.json,
+// safetensors weights and a tokenizer. End of sequence tokens listed in an
+// optional generation_config.json take precedence over config.json.
+func LoadLlamaModel(dir string) (*LlamaModel, error) {
+	cfg := LlamaConfig{RMSNormEps: 1e-6, RopeTheta: 10000, HiddenAct: "silu"}
+	if err := readConfig(dir, &cfg); err != nil {
+		return nil, err
+	}
+	switch cfg.ModelType {
+	case "", "llama", "mistral", "qwen2":
+	default:
+		return nil, fmt.Errorf("model type %q is %w", cfg.ModelType, errs.ErrNotImplemented)
+	}
+	if cfg.NumAttentionHeads <= 0 {
+		return nil, fmt.Errorf("invalid model config: %d attention heads", cfg.NumAttentionHeads)
+	}
+	if cfg.NumKeyValueHeads == 0 {
+		cfg.NumKeyValueHeads = cfg.NumAttentionHeads
+	}
+	if cfg.HeadDim == 0 {
+		cfg.HeadDim = cfg.HiddenSize / cfg.NumAttentionHeads
+	}
+	if cfg.NumKeyValueHeads <= 0 || cfg.NumAttentionHeads%cfg.NumKeyValueHeads != 0 {
+		return nil, fmt.Errorf("invalid model config: %d attention heads cannot share %d key/value heads", cfg.NumAttentionHeads, cfg.NumKeyValueHeads)
+	}
+
+	act, err := activation(cfg.HiddenAct)
+	if err != nil {
+		return nil, fmt.Errorf("invalid model config: %w", err)
+	}
+	rope, err := newRotary(cfg.HeadDim, cfg.RopeTheta, cfg.RopeScaling)
+	if err != nil {
+		return nil, fmt.Errorf("invalid model config: %w", err)
+	}
+
+	st, err := OpenSafeTensors(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+
+	m := &LlamaModel{Config: cfg, name: dir, act: act, rope: rope}
+	if cfg.UseSlidingWindow == nil || *cfg.UseSlidingWindow {
+		m.window = cfg.SlidingWindow
+	}
+	if err := m.loadWeights(st); err != nil {
+		return nil, fmt.Errorf("failed to load weights from %s: %w", dir, err)
+	}
+	if m.Tokenizer, err = loadTokenizer(dir, 0); err != nil {
+		return nil, err
+	}
+
+	bos, eos, err := configTokens(cfg.BOSTokenID, cfg.EOSTokenID)
+	if err != nil {
+		return nil, err
+	}
+	m.gen = &generator{
+		lm:           m,
+		tokenizer:    m.Tokenizer,
+		bos:          bos,
+		eos:          eos,
+		maxPositions: cfg.MaxPositionEmbeddings,
+	}
+	if eos, err := generationEOS(dir); err != nil {
+		return nil, err
+	} else if len(eos) > 0 {
+		m.gen.eos = eos
+	}
+	return m, nil
+}
+
+// loadWeights reads every weight. Without an lm_head the output projection
+// is tied to the token embeddings.
+func (m *LlamaModel) loadWeights(st *SafeTensors) error {
+	cfg := m.Config
+	h, inter := cfg.HiddenSize, cfg.IntermediateSize
+	qDim, kvDim := cfg.NumAttentionHeads*cfg.HeadDim, cfg.NumKeyValueHeads*cfg.HeadDim
+	w := &weightLoader{st: st, prefix: "model."}
+
+	m.embed = w.tensor("embed_tokens.weight", cfg.VocabSize, h)
+	m.layers = make([]llamaLayer, cfg.NumHiddenLayers)
+	for i := range m.layers {
+		p := fmt.Sprintf("layers.%d.", i)
+		m.layers[i] = llamaLayer{
+			inputNorm: w.rmsNorm(p+"input_layernorm", h, cfg.RMSNormEps),
+			q:         w.linear(p+"self_attn.q_proj", qDim, h),
+			k:         w.linear(p+"self_attn.k_proj", kvDim, h),
+			v:         w.linear(p+"self_attn.v_proj", kvDim, h),
+			o:         w.linear(p+"self_attn.o_proj", h, qDim),
+			postNorm:  w.rmsNorm(p+"post_attention_layernorm", h, cfg.RMSNormEps),
+			gate:      w.linear(p+"mlp.gate_proj", inter, h),
+			up:        w.linear(p+"mlp.up_proj", inter, h),
+			down:      w.linear(p+"mlp.down_proj", h, inter),
+		}
+	}
+	m.norm = w.rmsNorm("norm", h, cfg.RMSNormEps)
+
+	w.prefix = ""
+	if cfg.TieWordEmbeddings && !w.has("lm_head.weight") {
+		m.lmHead = linear{weight: m.embed}
+	} else {
+		m.lmHead = w.linear("lm_head", cfg.VocabSize, h)
+	}
+	return w.err
+}
+
+func (m *LlamaModel) newCache() *kvCache {
+	return newKVCache(m.Config.NumHiddenLayers)
+}
+
+// forward implements causalLM
+func (m *LlamaModel) forward(ctx context.Context, ids []int, cache *kvCache) ([]float32, error) {
+	cfg := m.Config
+	past, n := cache.len(), len(ids)
+	if past+n > cfg.MaxPositionEmbeddings {
+		return nil, fmt.Errorf("%w: sequence of %d tokens exceeds the model maximum of %d", errs.ErrInvalidInput, past+n, cfg.MaxPositionEmbeddings)
+	}
+
+	x := tensor.Embedding(m.embed, ids)
+	angles := m.rope.angles(past, n)
+	mask := causalMask(n, past, m.window)
+	for i, l := range m.layers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		h := l.inputNorm.forward(x)
+		q := angles.apply(l.q.forward(h))
+		k, v := cache.append(i, angles.apply(l.k.forward(h)), l.v.forward(h))
+		x = tensor.Add(x, l.o.forward(attention(q, k, v, cfg.NumAttentionHeads, cfg.NumKeyValueHeads, mask)))
+
+		h = l.postNorm.forward(x)
+		x = tensor.Add(x, l.down.forward(tensor.Mul(m.act(l.gate.forward(h)), l.up.forward(h))))
+	}
+
+	last := m.norm.forward(x.Slice(0, n-1, n))
+	return m.lmHead.forward(last).Data(), nil
+}
+
+// Generate continues prompt. When options.NumReturn sequences are sampled,
+// the first one is returned.
+func (m *LlamaModel) Generate(ctx context.Context, prompt string, options *models.GenerationOptions) (*models.GenerationResult, error) {
+	results, err := m.gen.generate(ctx, prompt, options, m.Rand)
+	if err != nil {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// GenerateAll continues prompt, returning all options.NumReturn sequences in
+// the order they were sampled
+func (m *LlamaModel) GenerateAll(ctx context.Context, prompt string, options *models.GenerationOptions) ([]models.GenerationResult, error) {
+	return m.gen.generate(ctx, prompt, options, m.Rand)
+}
+
+// GenerateStream continues prompt, sending each token as it is sampled
+func (m *LlamaModel) GenerateStream(ctx context.Context, prompt string, options *models.GenerationOptions) (<-chan models.Token, error) {
+	return m.gen.stream(ctx, prompt, options, m.Rand)
+}
+
+// Classify is not supported by language models
+func (m *LlamaModel) Classify(ctx context.Context, text string) (*models.ClassificationResult, error) {
+	return nil, &errs.UnsupportedTaskError{Model: m.Config.ModelType, Task: models.TaskTextClassification}
+}
+
+// GetModelInfo returns information about the model
+func (m *LlamaModel) GetModelInfo() *models.ModelInfo {
+	return &models.ModelInfo{
+		Name:     m.name,
+		Task:     models.TaskTextGeneration,
+		Provider: "safetensors",
+	}
+}
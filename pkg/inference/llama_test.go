@@ -0,0 +1,214 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+)
+
+var testLlamaVocab = []string{"<unk>", "<s>", "</s>", "the", "cat", "sat", "on", "mat", "a", "dog", "ran", "."}
+
+// writeTestLlamaModel writes a tiny two-layer LLaMA with grouped-query
+// attention and a word-level tokenizer.json. The variant adds what Mistral,
+// Qwen2 and LLaMA 3 change: a separate lm_head, attention biases, llama3
+// rope scaling and a sliding window.
+func writeTestLlamaModel(t *testing.T, variant bool) string {
+	t.Helper()
+	const hidden, inter, layers, heads, kvHeads = 8, 12, 2, 4, 2
+	dir := t.TempDir()
+
+	config := map[string]any{
+		"model_type": "llama", "vocab_size": len(testLlamaVocab), "hidden_size": hidden,
+		"intermediate_size": inter, "num_hidden_layers": layers, "num_attention_heads": heads,
+		"num_key_value_heads": kvHeads, "max_position_embeddings": 32, "rms_norm_eps": 1e-6,
+		"rope_theta": 10000.0, "tie_word_embeddings": !variant, "bos_token_id": 1, "eos_token_id": 2,
+	}
+	if variant {
+		config["model_type"] = "mistral"
+		config["sliding_window"] = 3
+		config["rope_theta"] = 500.0
+		config["rope_scaling"] = map[string]any{
+			"rope_type": "llama3", "factor": 8.0, "low_freq_factor": 1.0, "high_freq_factor": 4.0,
+			"original_max_position_embeddings": 8,
+		}
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "config.json"), data)
+
+	vocab := make(map[string]int)
+	for i, tok := range testLlamaVocab {
+		vocab[tok] = i
+	}
+	data, err = json.Marshal(map[string]any{
+		"added_tokens": []map[string]any{
+			{"id": 1, "content": "<s>", "special": true},
+			{"id": 2, "content": "</s>", "special": true},
+		},
+		"pre_tokenizer": map[string]any{"type": "WhitespaceSplit"},
+		"post_processor": map[string]any{
+			"type":           "TemplateProcessing",
+			"single":         []any{map[string]any{"SpecialToken": map[string]any{"id": "<s>", "type_id": 0}}, map[string]any{"Sequence": map[string]any{"id": "A", "type_id": 0}}},
+			"pair":           []any{map[string]any{"Sequence": map[string]any{"id": "A", "type_id": 0}}, map[string]any{"Sequence": map[string]any{"id": "B", "type_id": 1}}},
+			"special_tokens": map[string]any{"<s>": map[string]any{"id": "<s>", "ids": []int{1}, "tokens": []string{"<s>"}}},
+		},
+		"model": map[string]any{"type": "WordLevel", "vocab": vocab, "unk_token": "<unk>"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "tokenizer.json"), data)
+
+	w := &testWeights{state: 11}
+	w.add("model.embed_tokens.weight", 0, len(testLlamaVocab), hidden)
+	for i := 0; i < layers; i++ {
+		p := fmt.Sprintf("model.layers.%d.", i)
+		w.add(p+"input_layernorm.weight", 1, hidden)
+		for _, proj := range []struct {
+			name    string
+			out, in int
+		}{{"q_proj", heads * 2, hidden}, {"k_proj", kvHeads * 2, hidden}, {"v_proj", kvHeads * 2, hidden}, {"o_proj", hidden, heads * 2}} {
+			w.add(p+"self_attn."+proj.name+".weight", 0, proj.out, proj.in)
+			if variant && proj.name != "o_proj" {
+				w.add(p+"self_attn."+proj.name+".bias", 0, proj.out)
+			}
+		}
+		w.add(p+"post_attention_layernorm.weight", 1, hidden)
+		w.add(p+"mlp.gate_proj.weight", 0, inter, hidden)
+		w.add(p+"mlp.up_proj.weight", 0, inter, hidden)
+		w.add(p+"mlp.down_proj.weight", 0, hidden, inter)
+	}
+	w.add("model.norm.weight", 1, hidden)
+	if variant {
+		w.add("lm_head.weight", 0, len(testLlamaVocab), hidden)
+	}
+
+	writeFile(t, filepath.Join(dir, "model.safetensors"), encodeSafeTensors(t, nil, w.tensors...))
+	return dir
+}
+
+func TestLlamaModel_Generate(t *testing.T) {
+	// Reference values from an independent implementation that recomputes
+	// the full sequence at every step
+	tests := []struct {
+		name    string
+		variant bool
+		logits  []float32
+		text    string
+		score   float64
+	}{
+		{
+			"llama", false,
+			[]float32{-0.11726197, 0.49773616, 0.30197574, -0.06885642, -0.47949797, -0.18281990,
+				0.05989141, 0.76854522, -0.57490701, 0.03093047, 0.03277316, 0.63532107},
+			"the cat sat on the mat mat mat mat mat mat mat mat", -13.1434809,
+		},
+		{
+			"mistral", true,
+			[]float32{0.10541085, -0.55128329, -0.45609773, -0.22937085, -0.36833517, 0.43158798,
+				-0.03682104, -0.12727268, 0.23931822, -0.33358432, -0.09522826, -0.11489755},
+			"the cat sat on the mat sat cat . sat cat . sat", -13.7224071,
+		},
+	}
+
+	for _, tt := range tests {
+		m, err := LoadLlamaModel(writeTestLlamaModel(t, tt.variant))
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		var _ models.Model = m
+
+		enc, err := m.Tokenizer.Encode("the cat sat on the mat")
+		if err != nil {
+			t.Fatal(err)
+		}
+		logits, err := m.forward(context.Background(), enc.IDs, m.newCache())
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		for i := range tt.logits {
+			if math.Abs(float64(logits[i]-tt.logits[i])) > 1e-5 {
+				t.Errorf("%s: expected logits %v, got %v", tt.name, tt.logits, logits)
+				break
+			}
+		}
+
+		result, err := m.Generate(context.Background(), "the cat sat on the mat", &models.GenerationOptions{MaxLength: 14})
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		if result.GeneratedText != tt.text {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.text, result.GeneratedText)
+		}
+		if math.Abs(result.Score-tt.score) > 1e-4 {
+			t.Errorf("%s: expected score %v, got %v", tt.name, tt.score, result.Score)
+		}
+	}
+}
+
+func TestLlamaModel_SlidingWindowCache(t *testing.T) {
+	m, err := LoadLlamaModel(writeTestLlamaModel(t, true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if m.window != 3 {
+		t.Fatalf("Expected a sliding window of 3, got %d", m.window)
+	}
+
+	ids := []int{1, 3, 4, 5, 6, 3, 7}
+	full, err := m.forward(context.Background(), ids, m.newCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := m.newCache()
+	var incremental []float32
+	for _, id := range ids {
+		if incremental, err = m.forward(context.Background(), []int{id}, cache); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range full {
+		if math.Abs(float64(full[i]-incremental[i])) > 1e-5 {
+			t.Fatalf("Expected cached logits %v to match %v", incremental, full)
+		}
+	}
+}
+
+func TestLoadLlamaModel_Config(t *testing.T) {
+	dir := writeTestLlamaModel(t, false)
+
+	// End of sequence tokens from generation_config.json take precedence
+	writeFile(t, filepath.Join(dir, "generation_config.json"), []byte(`{"eos_token_id": [2, 7]}`))
+	m, err := LoadLlamaModel(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	result, err := m.Generate(context.Background(), "the cat sat on the mat", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.GeneratedText != "the cat sat on the mat" {
+		t.Errorf("Expected generation to stop at token 7, got %q", result.GeneratedText)
+	}
+
+	writeFile(t, filepath.Join(dir, "config.json"), []byte(`{"model_type": "gpt_neox", "num_attention_heads": 4}`))
+	if _, err := LoadLlamaModel(dir); err == nil || !strings.Contains(err.Error(), "gpt_neox") {
+		t.Errorf("Expected unsupported model type error, got %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "config.json"), []byte(`{"num_attention_heads": 4, "num_key_value_heads": 3, "hidden_size": 8}`))
+	if _, err := LoadLlamaModel(dir); err == nil || !strings.Contains(err.Error(), "key/value heads") {
+		t.Errorf("Expected grouped-query attention error, got %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "config.json"), []byte(`{"num_attention_heads": 4, "hidden_size": 8, "rope_scaling": {"rope_type": "yarn"}}`))
+	if _, err := LoadLlamaModel(dir); err == nil || !strings.Contains(err.Error(), "yarn") {
+		t.Errorf("Expected rope scaling error, got %v", err)
+	}
+}
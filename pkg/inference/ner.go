@@ -0,0 +1,258 @@
+package inference
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+	"github.com/kelleyblackmore/go-transformer/pkg/tokenizers"
+)
+
+// scoredToken is a token of a token classification with the probability of
+// each label
+type scoredToken struct {
+	token      string // as in the vocabulary, such as "##s"
+	start, end int    // byte offsets into the text
+	word       int    // index of the word the token belongs to
+	scores     []float32
+}
+
+func (m *BertModel) hasTokenClassifier() bool {
+	return m.tokenClassifier.weight != nil || m.tokenClassifier.qweight != nil
+}
+
+// ClassifyTokens labels the tokens of text and aggregates them into
+// entities as options ask. Texts longer than the model maximum are
+// classified a window at a time.
+func (m *BertModel) ClassifyTokens(ctx context.Context, text string, options *models.TokenClassificationOptions) ([]models.Entity, error) {
+	if !m.hasTokenClassifier() {
+		return nil, &errs.UnsupportedTaskError{Model: m.Config.ModelType, Task: models.TaskTokenClassification}
+	}
+	if options == nil {
+		options = &models.TokenClassificationOptions{}
+	}
+
+	enc, err := m.Tokenizer.Encode(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize input: %w", err)
+	}
+	tokens, err := m.scoreTokens(ctx, enc)
+	if err != nil {
+		return nil, err
+	}
+	entities, err := aggregate(text, tokens, m.Config.ID2Label, options.AggregationStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	ignore := options.IgnoreLabels
+	if ignore == nil {
+		ignore = []string{"O"}
+	}
+	kept := entities[:0]
+	for _, e := range entities {
+		if !contains(ignore, e.Label) {
+			kept = append(kept, e)
+		}
+	}
+	return kept, nil
+}
+
+// scoreTokens runs the windows of an encoding through the model and returns
+// the tokens of the text in order. Tokens that consecutive windows share are
+// kept once.
+func (m *BertModel) scoreTokens(ctx context.Context, enc *tokenizers.Encoding) ([]scoredToken, error) {
+	windows := append([]*tokenizers.Encoding{enc}, enc.Overflowing...)
+	sort.SliceStable(windows, func(i, j int) bool { return firstOffset(windows[i]) < firstOffset(windows[j]) })
+	stride := 0
+	if tok, ok := m.Tokenizer.(truncatingTokenizer); ok && tok.Truncation() != nil {
+		stride = tok.Truncation().Stride
+	}
+
+	var tokens []scoredToken
+	for w, window := range windows {
+		hidden, err := m.forward(ctx, window)
+		if err != nil {
+			return nil, err
+		}
+		logits := tensor.Softmax(m.tokenClassifier.forward(hidden), -1).Contiguous()
+		labels := logits.Shape()[logits.Dims()-1]
+		probs := logits.Data()
+
+		skip := 0
+		if w > 0 {
+			skip = stride
+		}
+		for i := range window.IDs {
+			if window.SpecialTokensMask[i] == 1 {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			tokens = append(tokens, scoredToken{
+				token:  window.Tokens[i],
+				start:  window.Offsets[i].Start,
+				end:    window.Offsets[i].End,
+				word:   window.WordIDs[i],
+				scores: probs[i*labels : (i+1)*labels],
+			})
+		}
+	}
+	return tokens, nil
+}
+
+// firstOffset returns the start of the first text token of an encoding
+func firstOffset(enc *tokenizers.Encoding) int {
+	for i, special := range enc.SpecialTokensMask {
+		if special == 0 {
+			return enc.Offsets[i].Start
+		}
+	}
+	return 0
+}
+
+// aggregate turns scored tokens into entities with the given strategy, as
+// the Hugging Face token classification pipeline does
+func aggregate(text string, tokens []scoredToken, id2label map[string]string, strategy string) ([]models.Entity, error) {
+	var entities []models.Entity
+	switch strategy {
+	case models.AggregationNone, "", models.AggregationSimple:
+		for _, t := range tokens {
+			label := argmax(t.scores)
+			entities = append(entities, models.Entity{
+				Label: labelName(id2label, label),
+				Score: float64(t.scores[label]),
+				Word:  t.token,
+				Start: t.start,
+				End:   t.end,
+			})
+		}
+		if strategy != models.AggregationSimple {
+			return charOffsets(text, entities), nil
+		}
+	case models.AggregationFirst, models.AggregationAverage, models.AggregationMax:
+		for start := 0; start < len(tokens); {
+			end := start + 1
+			for end < len(tokens) && tokens[end].word == tokens[start].word {
+				end++
+			}
+			entities = append(entities, wordEntity(text, tokens[start:end], id2label, strategy))
+			start = end
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown aggregation strategy %q", errs.ErrInvalidInput, strategy)
+	}
+	return charOffsets(text, groupEntities(text, entities)), nil
+}
+
+// wordEntity labels the tokens of a word as a single entity
+func wordEntity(text string, word []scoredToken, id2label map[string]string, strategy string) models.Entity {
+	scores := word[0].scores
+	switch strategy {
+	case models.AggregationAverage:
+		scores = make([]float32, len(word[0].scores))
+		for _, t := range word {
+			for i, s := range t.scores {
+				scores[i] += s / float32(len(word))
+			}
+		}
+	case models.AggregationMax:
+		for _, t := range word[1:] {
+			if t.scores[argmax(t.scores)] > scores[argmax(scores)] {
+				scores = t.scores
+			}
+		}
+	}
+	label := argmax(scores)
+	start, end := word[0].start, word[len(word)-1].end
+	return models.Entity{
+		Label: labelName(id2label, label),
+		Score: float64(scores[label]),
+		Word:  text[start:end],
+		Start: start,
+		End:   end,
+	}
+}
+
+// groupEntities merges consecutive entities tagged as parts of the same
+// entity in the BIO or BIOES scheme, labelling each group with the entity
+// type and the mean score of its parts
+func groupEntities(text string, entities []models.Entity) []models.Entity {
+	var groups []models.Entity
+	var group []models.Entity
+	closed := false
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+		_, tag := splitTag(group[0].Label)
+		var score float64
+		for _, e := range group {
+			score += e.Score
+		}
+		start, end := group[0].Start, group[len(group)-1].End
+		groups = append(groups, models.Entity{
+			Label: tag,
+			Score: score / float64(len(group)),
+			Word:  text[start:end],
+			Start: start,
+			End:   end,
+		})
+		group = nil
+	}
+
+	for _, e := range entities {
+		position, tag := splitTag(e.Label)
+		if len(group) > 0 {
+			_, lastTag := splitTag(group[len(group)-1].Label)
+			if closed || tag != lastTag || position == "B" || position == "S" {
+				flush()
+			}
+		}
+		group = append(group, e)
+		closed = position == "E" || position == "S"
+	}
+	flush()
+	return groups
+}
+
+// splitTag splits a BIO, BIOES or BILOU tag such as "B-PER" into the
+// position of the token in its entity and the entity type. Labels without
+// a known prefix continue any entity of the same label.
+func splitTag(label string) (position, tag string) {
+	if len(label) > 2 && (label[1] == '-' || label[1] == '_') {
+		switch label[0] {
+		case 'B', 'I', 'E', 'S':
+			return label[:1], label[2:]
+		case 'L':
+			return "E", label[2:]
+		case 'U':
+			return "S", label[2:]
+		}
+	}
+	return "I", label
+}
+
+// charOffsets converts the byte offsets of entities into character offsets
+func charOffsets(text string, entities []models.Entity) []models.Entity {
+	for i := range entities {
+		entities[i].Start = utf8.RuneCountInString(text[:entities[i].Start])
+		entities[i].End = utf8.RuneCountInString(text[:entities[i].End])
+	}
+	return entities
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+)
+
+// writeTestBertTokenModel writes the test BERT model with a three label
+// token classification head in place of its pooler and classifier
+func writeTestBertTokenModel(t *testing.T) string {
+	t.Helper()
+	dir := writeTestBertModel(t, false)
+	w := &testWeights{state: 11}
+	w.linear("classifier", 3, 8)
+	rewriteTestWeights(t, dir, func(name string) (string, bool) {
+		return name, !strings.HasPrefix(name, "classifier.") && !strings.HasPrefix(name, "bert.pooler.")
+	}, w.tensors...)
+
+	path := filepath.Join(dir, "config.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	config["id2label"] = map[string]string{"0": "O", "1": "B-MISC", "2": "I-MISC"}
+	config["architectures"] = []string{"BertForTokenClassification"}
+	if data, err = json.Marshal(config); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, data)
+	return dir
+}
+
+func TestBertModel_ClassifyTokens(t *testing.T) {
+	ctx := context.Background()
+	m, err := LoadBertModel(writeTestBertTokenModel(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var _ models.TokenClassifier = m
+	if info := m.GetModelInfo(); info.Task != models.TaskTokenClassification {
+		t.Errorf("Expected task %s, got %s", models.TaskTokenClassification, info.Task)
+	}
+	if _, err := m.Classify(ctx, "the movie"); !errors.Is(err, errs.ErrUnsupportedTask) {
+		t.Errorf("Expected ErrUnsupportedTask classifying with a token classification model, got %v", err)
+	}
+
+	// Without aggregation every token is returned with its own label
+	text := "the movies — was great"
+	entities, err := m.ClassifyTokens(ctx, text, &models.TokenClassificationOptions{IgnoreLabels: []string{}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var words []string
+	for _, e := range entities {
+		words = append(words, e.Word)
+	}
+	expected := []string{"the", "movie", "##s", "[UNK]", "was", "great"}
+	if !reflect.DeepEqual(words, expected) {
+		t.Errorf("Expected tokens %v, got %v", expected, words)
+	}
+
+	// Aggregated entities carry the character offsets of their words
+	runes := []rune(text)
+	for _, strategy := range []string{models.AggregationSimple, models.AggregationFirst, models.AggregationAverage, models.AggregationMax} {
+		entities, err := m.ClassifyTokens(ctx, text, &models.TokenClassificationOptions{AggregationStrategy: strategy, IgnoreLabels: []string{}})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, e := range entities {
+			if e.Start < 0 || e.End > len(runes) || e.Start >= e.End || string(runes[e.Start:e.End]) != e.Word {
+				t.Errorf("Expected character offsets of %q in %q, got %+v", e.Word, text, e)
+			}
+			if e.Label != "O" && e.Label != "MISC" {
+				t.Errorf("Expected an entity type, got %q", e.Label)
+			}
+			if e.Score <= 0 || e.Score > 1 {
+				t.Errorf("Expected a probability, got %v", e.Score)
+			}
+		}
+	}
+
+	// Texts longer than the model maximum are classified a window at a time
+	long := strings.Repeat("the movie was great ", 6)
+	entities, err = m.ClassifyTokens(ctx, long, &models.TokenClassificationOptions{IgnoreLabels: []string{}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entities) != 24 {
+		t.Errorf("Expected 24 tokens, got %d", len(entities))
+	}
+	for i := 1; i < len(entities); i++ {
+		if entities[i].Start < entities[i-1].End {
+			t.Errorf("Expected tokens in order, got %+v after %+v", entities[i], entities[i-1])
+		}
+	}
+
+	if _, err := m.ClassifyTokens(ctx, text, &models.TokenClassificationOptions{AggregationStrategy: "longest"}); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown aggregation strategy, got %v", err)
+	}
+
+	classifier, err := LoadBertModel(writeTestBertModel(t, false))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := classifier.ClassifyTokens(ctx, text, nil); !errors.Is(err, errs.ErrUnsupportedTask) {
+		t.Errorf("Expected ErrUnsupportedTask for a sequence classifier, got %v", err)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	// "Jür" and "##gen" make a word whose first token says B-PER but whose
+	// other token, and so its average and best score, says O
+	text := "Jürgen lives in Berlin"
+	id2label := map[string]string{"0": "O", "1": "B-PER", "2": "I-PER", "3": "S-LOC"}
+	tokens := []scoredToken{
+		{token: "Jür", start: 0, end: 4, word: 0, scores: []float32{0.1, 0.8, 0.1, 0}},
+		{token: "##gen", start: 4, end: 7, word: 0, scores: []float32{0.95, 0, 0.05, 0}},
+		{token: "lives", start: 8, end: 13, word: 1, scores: []float32{0.9, 0.05, 0.05, 0}},
+		{token: "in", start: 14, end: 16, word: 2, scores: []float32{0.9, 0, 0, 0.1}},
+		{token: "Berlin", start: 17, end: 23, word: 3, scores: []float32{0.1, 0, 0, 0.9}},
+	}
+	// Scores are computed in float32
+	p8, p9 := float64(float32(0.8)), float64(float32(0.9))
+	berlin := models.Entity{Label: "LOC", Score: p9, Word: "Berlin", Start: 16, End: 22}
+
+	tests := []struct {
+		strategy string
+		expected []models.Entity
+	}{
+		{models.AggregationNone, []models.Entity{
+			{Label: "B-PER", Score: p8, Word: "Jür", Start: 0, End: 3},
+			{Label: "S-LOC", Score: p9, Word: "Berlin", Start: 16, End: 22},
+		}},
+		{models.AggregationSimple, []models.Entity{{Label: "PER", Score: p8, Word: "Jür", Start: 0, End: 3}, berlin}},
+		{models.AggregationFirst, []models.Entity{{Label: "PER", Score: p8, Word: "Jürgen", Start: 0, End: 6}, berlin}},
+		{models.AggregationAverage, []models.Entity{berlin}},
+		{models.AggregationMax, []models.Entity{berlin}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			entities, err := aggregate(text, tokens, id2label, tt.strategy)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var kept []models.Entity
+			for _, e := range entities {
+				if e.Label != "O" {
+					kept = append(kept, e)
+				}
+			}
+			if !reflect.DeepEqual(kept, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, kept)
+			}
+		})
+	}
+}
+
+func TestGroupEntities(t *testing.T) {
+	text := "abcdefgh"
+	labels := []string{"B-PER", "I-PER", "E-PER", "I-PER", "S-LOC", "U-LOC", "B-ORG", "L-ORG"}
+	var entities []models.Entity
+	for i, label := range labels {
+		entities = append(entities, models.Entity{Label: label, Score: 0.5, Word: text[i : i+1], Start: i, End: i + 1})
+	}
+
+	var got []string
+	for _, g := range groupEntities(text, entities) {
+		got = append(got, g.Label+":"+g.Word)
+	}
+	expected := []string{"PER:abc", "PER:d", "LOC:e", "LOC:f", "ORG:gh"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
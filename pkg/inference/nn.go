@@ -0,0 +1,300 @@
+package inference
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+	"github.com/kelleyblackmore/go-transformer/pkg/tokenizers"
+)
+
+// linear is a dense layer with a PyTorch [out, in] weight and optional bias
+type linear struct {
+	weight, bias *tensor.Tensor
+
+	// Int8 checkpoints set qweight instead of weight. It keeps the stored
+	// layout, which for GPT-2 Conv1D layers is [in, out].
+	qweight    *tensor.Int8
+	transposed bool
+}
+
+func (l linear) forward(x *tensor.Tensor) *tensor.Tensor {
+	switch {
+	case l.qweight == nil:
+		return tensor.Linear(x, l.weight, l.bias)
+	case l.transposed:
+		y := tensor.Int8MatMul(x, l.qweight)
+		if l.bias != nil {
+			y = tensor.Add(y, l.bias)
+		}
+		return y
+	default:
+		return tensor.Int8Linear(x, l.qweight, l.bias)
+	}
+}
+
+// layerNorm normalizes over the last dimension
+type layerNorm struct {
+	weight, bias *tensor.Tensor
+	eps          float32
+}
+
+func (n layerNorm) forward(x *tensor.Tensor) *tensor.Tensor {
+	return tensor.LayerNorm(x, n.weight, n.bias, n.eps)
+}
+
+// rmsNorm scales by the reciprocal root mean square over the last dimension
+type rmsNorm struct {
+	weight *tensor.Tensor
+	eps    float32
+}
+
+func (n rmsNorm) forward(x *tensor.Tensor) *tensor.Tensor {
+	return tensor.RMSNorm(x, n.weight, n.eps)
+}
+
+// activation returns the function for a Hugging Face hidden_act name
+func activation(name string) (func(*tensor.Tensor) *tensor.Tensor, error) {
+	switch name {
+	case "gelu", "gelu_python":
+		return tensor.GELU, nil
+	case "gelu_new", "gelu_pytorch_tanh", "gelu_fast":
+		return tensor.GELUTanh, nil
+	case "relu":
+		return tensor.ReLU, nil
+	case "silu", "swish":
+		return tensor.SiLU, nil
+	case "tanh":
+		return tensor.Tanh, nil
+	default:
+		return nil, fmt.Errorf("activation %q is %w", name, errs.ErrNotImplemented)
+	}
+}
+
+// negInf masks attention scores
+var negInf = math.Inf(-1)
+
+// attention computes scaled dot-product attention for a single sequence.
+// q has shape [n, heads*headDim] and k and v have shape [m, kvHeads*headDim].
+// With grouped-query attention kvHeads divides heads and each key/value head
+// is shared by heads/kvHeads query heads. mask, which may be nil, is added to
+// the [n, m] attention scores and is typically 0 for visible positions and
+// -Inf for hidden ones.
+func attention(q, k, v *tensor.Tensor, heads, kvHeads int, mask *tensor.Tensor) *tensor.Tensor {
+	n, m := q.Dim(0), k.Dim(0)
+	headDim := q.Dim(1) / heads
+
+	qh := q.Reshape(n, heads, headDim).Transpose(1, 0, 2)
+	kh := k.Reshape(m, kvHeads, headDim).Transpose(1, 0, 2)
+	vh := v.Reshape(m, kvHeads, headDim).Transpose(1, 0, 2)
+	if group := heads / kvHeads; group > 1 {
+		kh = kh.Unsqueeze(1).BroadcastTo(kvHeads, group, m, headDim).Reshape(heads, m, headDim)
+		vh = vh.Unsqueeze(1).BroadcastTo(kvHeads, group, m, headDim).Reshape(heads, m, headDim)
+	}
+
+	scores := tensor.Scale(tensor.MatMul(qh, kh.T()), float32(1/math.Sqrt(float64(headDim))))
+	if mask != nil {
+		scores = tensor.Add(scores, mask)
+	}
+	context := tensor.MatMul(tensor.Softmax(scores, -1), vh)
+	return context.Transpose(1, 0, 2).Reshape(n, heads*headDim)
+}
+
+// paddingMask returns a [1, n] additive mask hiding positions whose
+// attention mask is 0, or nil when every position is visible
+func paddingMask(attentionMask []int) *tensor.Tensor {
+	var mask *tensor.Tensor
+	for i, m := range attentionMask {
+		if m != 0 {
+			continue
+		}
+		if mask == nil {
+			mask = tensor.Zeros(1, len(attentionMask))
+		}
+		mask.Set(float32(negInf), 0, i)
+	}
+	return mask
+}
+
+// weightLoader reads named weights from a checkpoint, checking their shapes.
+// The first error is recorded and later calls become no-ops, so a model can
+// be assembled without checking every call.
+type weightLoader struct {
+	st     *SafeTensors
+	prefix string
+	err    error
+}
+
+// has reports whether the checkpoint contains a weight
+func (w *weightLoader) has(name string) bool {
+	_, ok := w.st.Info(w.prefix + name)
+	return ok
+}
+
+// tensor loads a weight, which must have the given shape. Int8 weights are
+// dequantized.
+func (w *weightLoader) tensor(name string, shape ...int) *tensor.Tensor {
+	if q := w.int8(name, shape...); q != nil {
+		return q.Dequantize()
+	}
+	if w.err != nil {
+		return nil
+	}
+	t, err := w.st.Tensor(w.prefix + name)
+	if err != nil {
+		w.err = err
+		return nil
+	}
+	if !equalInts(t.Shape(), shape) {
+		w.err = fmt.Errorf("weight %q has shape %v, expected %v", w.prefix+name, t.Shape(), shape)
+		return nil
+	}
+	return t
+}
+
+// int8 loads a weight quantized by QuantizeInt8, which is stored as I8
+// alongside a name_scale tensor of per-row scales. It returns nil when the
+// weight is not quantized.
+func (w *weightLoader) int8(name string, shape ...int) *tensor.Int8 {
+	if w.err != nil || len(shape) != 2 || !w.has(name+scaleSuffix) {
+		return nil
+	}
+	raw, info, err := w.st.Raw(w.prefix + name)
+	if err != nil {
+		w.err = err
+		return nil
+	}
+	if info.DType != DTypeI8 || !equalInts(info.Shape, shape) {
+		w.err = fmt.Errorf("quantized weight %q has %s shape %v, expected I8 %v", w.prefix+name, info.DType, info.Shape, shape)
+		return nil
+	}
+	scales := w.tensor(name+scaleSuffix, shape[0])
+	if scales == nil {
+		return nil
+	}
+	values := make([]int8, len(raw))
+	for i, b := range raw {
+		values[i] = int8(b)
+	}
+	return tensor.NewInt8(values, scales.Data(), shape[0], shape[1])
+}
+
+// linear loads name.weight with shape [out, in] and name.bias, if present
+func (w *weightLoader) linear(name string, out, in int) linear {
+	var l linear
+	if l.qweight = w.int8(name+".weight", out, in); l.qweight == nil {
+		l.weight = w.tensor(name+".weight", out, in)
+	}
+	if w.has(name + ".bias") {
+		l.bias = w.tensor(name+".bias", out)
+	}
+	return l
+}
+
+// conv1D loads a GPT-2 style Conv1D layer, whose weight is stored
+// transposed as [in, out]
+func (w *weightLoader) conv1D(name string, in, out int) linear {
+	l := linear{bias: w.tensor(name+".bias", out)}
+	if l.qweight = w.int8(name+".weight", in, out); l.qweight != nil {
+		l.transposed = true
+	} else if weight := w.tensor(name+".weight", in, out); weight != nil {
+		l.weight = weight.T().Contiguous()
+	}
+	return l
+}
+
+// layerNorm loads name.weight and name.bias with shape [n]
+func (w *weightLoader) layerNorm(name string, n int, eps float32) layerNorm {
+	return layerNorm{weight: w.tensor(name+".weight", n), bias: w.tensor(name+".bias", n), eps: eps}
+}
+
+// rmsNorm loads name.weight with shape [n]
+func (w *weightLoader) rmsNorm(name string, n int, eps float32) rmsNorm {
+	return rmsNorm{weight: w.tensor(name+".weight", n), eps: eps}
+}
+
+// readConfig decodes the config.json of a model directory into v
+func readConfig(dir string, v any) error {
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read model config: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse model config: %w", err)
+	}
+	return nil
+}
+
+// truncatingTokenizer is implemented by every tokenizer in pkg/tokenizers
+type truncatingTokenizer interface {
+	tokenizers.Tokenizer
+	Truncation() *tokenizers.TruncationParams
+	SetTruncation(params *tokenizers.TruncationParams) error
+}
+
+// loadTokenizer loads the tokenizer of a model directory, preferring
+// tokenizer.json and falling back to a SentencePiece tokenizer.model, a
+// WordPiece vocab.txt or a byte-level BPE vocab.json and merges.txt. Inputs
+// are truncated to maxLength tokens unless maxLength is 0 or the tokenizer
+// already truncates.
+func loadTokenizer(dir string, maxLength int) (tokenizers.Tokenizer, error) {
+	for _, name := range []string{"tokenizer.json", "tokenizer.model", "vocab.txt", "vocab.json"} {
+		if path := filepath.Join(dir, name); fileExists(path) {
+			return loadTokenizerFile(path, maxLength)
+		}
+	}
+	return nil, fmt.Errorf("no tokenizer.json, tokenizer.model, vocab.txt or vocab.json in %s", dir)
+}
+
+// loadTokenizerFile loads a tokenizer from a single file, choosing the
+// format from its name: a byte-level BPE vocab.json, whose merges.txt must
+// sit next to it, any other .json tokenizer file, a SentencePiece .model or
+// a WordPiece .txt vocabulary. Truncation is set up as in loadTokenizer.
+func loadTokenizerFile(path string, maxLength int) (tokenizers.Tokenizer, error) {
+	var tok truncatingTokenizer
+	var err error
+	switch name := filepath.Base(path); {
+	case name == "vocab.json":
+		tok, err = tokenizers.NewByteLevelBPETokenizer(path, filepath.Join(filepath.Dir(path), "merges.txt"))
+	case strings.HasSuffix(name, ".json"):
+		tok, err = tokenizers.FromFile(path)
+	case strings.HasSuffix(name, ".model"):
+		tok, err = tokenizers.NewSentencePieceTokenizer(path)
+	case strings.HasSuffix(name, ".txt"):
+		tok, err = tokenizers.NewWordPieceTokenizer(path)
+	default:
+		return nil, fmt.Errorf("unrecognized tokenizer file %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+
+	if maxLength > 0 && tok.Truncation() == nil {
+		if err := tok.SetTruncation(&tokenizers.TruncationParams{MaxLength: maxLength}); err != nil {
+			return nil, err
+		}
+	}
+	return tok, nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
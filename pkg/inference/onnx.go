@@ -2,53 +2,438 @@ package inference
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
 	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/kelleyblackmore/go-transformer/pkg/onnx"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+	"github.com/kelleyblackmore/go-transformer/pkg/tokenizers"
 )
 
-// ONNXModel represents an ONNX-based transformer model
-// This is a placeholder for Phase 2 implementation
+// defaultONNXMaxLength is the maximum sequence length assumed when no
+// config.json gives one
+const defaultONNXMaxLength = 512
+
+// ONNXModel runs an ONNX export of a transformer with the pure-Go
+// interpreter in pkg/onnx. Sequence classification exports, such as BERT or
+// DistilBERT from Hugging Face Optimum, support Classify. Decoder exports
+// with past_key_values inputs, such as Optimum's decoder_model_merged.onnx,
+// support Generate and cache attention keys and values between steps.
 type ONNXModel struct {
 	ModelPath     string
 	TokenizerPath string
-	SessionID     string // ONNX Runtime session
+	Tokenizer     tokenizers.Tokenizer
+
+	// Rand is the source of randomness for sampling. When nil, each call to
+	// Generate uses a new time-seeded source. A Rand must not be shared by
+	// concurrent calls.
+	Rand *rand.Rand
+
+	// Deprecated: SessionID is unused. Models are interpreted in Go and no
+	// longer need an ONNX Runtime session.
+	SessionID string
+
+	model  *onnx.Model
+	config onnxConfig
+	logits string     // name of the logits output
+	past   []onnxPast // one per layer for decoders, nil for classifiers
+	gen    *generator
+}
+
+// onnxConfig holds the config.json fields an ONNX export still needs. Both
+// the BERT/LLaMA and the GPT-2 names of each size are accepted.
+type onnxConfig struct {
+	MaxPositionEmbeddings int               `json:"max_position_embeddings"`
+	NPositions            int               `json:"n_positions"`
+	NumAttentionHeads     int               `json:"num_attention_heads"`
+	NHead                 int               `json:"n_head"`
+	NumKeyValueHeads      int               `json:"num_key_value_heads"`
+	HiddenSize            int               `json:"hidden_size"`
+	NEmbd                 int               `json:"n_embd"`
+	BOSTokenID            json.RawMessage   `json:"bos_token_id"`
+	EOSTokenID            json.RawMessage   `json:"eos_token_id"`
+	ID2Label              map[string]string `json:"id2label"`
+	ProblemType           string            `json:"problem_type"`
 }
 
-// NewONNXModel creates a new ONNX model instance
-// TODO: Implement in Phase 2 with onnxruntime-go
+// onnxPast names the cache inputs and outputs of one decoder layer. Keys and
+// values are [batch, heads, positions, headDim] in the graph.
+type onnxPast struct {
+	key, value               string // past_key_values.N.key and .value inputs
+	presentKey, presentValue string // present.N.key and .value outputs
+	heads, headDim           int
+}
+
+// onnxInputs lists the graph inputs ONNXModel knows how to feed besides the
+// past_key_values cache
+var onnxInputs = map[string]bool{
+	"input_ids": true, "attention_mask": true, "token_type_ids": true, "position_ids": true, "use_cache_branch": true,
+}
+
+var (
+	_ models.Model          = (*ONNXModel)(nil)
+	_ models.Classifier     = (*ONNXModel)(nil)
+	_ models.MultiGenerator = (*ONNXModel)(nil)
+)
+
+// NewONNXModel loads an ONNX model and its tokenizer. tokenizerPath is a
+// tokenizer file (tokenizer.json, tokenizer.model, vocab.txt or vocab.json)
+// or a directory holding one; when empty, the model's directory is used.
+// Labels, special tokens, the maximum input length and, for decoders whose
+// export leaves them symbolic, attention sizes are read from a config.json
+// next to the model when there is one.
 func NewONNXModel(modelPath, tokenizerPath string) (*ONNXModel, error) {
-	return &ONNXModel{
-		ModelPath:     modelPath,
-		TokenizerPath: tokenizerPath,
-	}, nil
+	model, err := onnx.Load(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(model.Graph.Outputs) == 0 {
+		return nil, fmt.Errorf("ONNX model %s has no outputs", modelPath)
+	}
+
+	dir := filepath.Dir(modelPath)
+	var cfg onnxConfig
+	if fileExists(filepath.Join(dir, "config.json")) {
+		if err := readConfig(dir, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	maxPositions := cfg.MaxPositionEmbeddings
+	if maxPositions <= 0 {
+		maxPositions = cfg.NPositions
+	}
+	if maxPositions <= 0 {
+		maxPositions = defaultONNXMaxLength
+	}
+
+	om := &ONNXModel{ModelPath: modelPath, model: model, config: cfg, logits: model.Graph.Outputs[0].Name}
+	for _, out := range model.Graph.Outputs {
+		if out.Name == "logits" {
+			om.logits = out.Name
+		}
+	}
+	if om.past, err = onnxPastLayers(model.Graph, cfg); err != nil {
+		return nil, fmt.Errorf("invalid ONNX model %s: %w", modelPath, err)
+	}
+
+	// Classifier inputs are truncated to the model maximum, while the
+	// generator checks prompts against it
+	truncate := maxPositions
+	if om.past != nil {
+		truncate = 0
+	}
+	if tokenizerPath == "" {
+		tokenizerPath = dir
+	}
+	om.TokenizerPath = tokenizerPath
+	if info, err := os.Stat(tokenizerPath); err == nil && info.IsDir() {
+		om.Tokenizer, err = loadTokenizer(tokenizerPath, truncate)
+		if err != nil {
+			return nil, err
+		}
+	} else if om.Tokenizer, err = loadTokenizerFile(tokenizerPath, truncate); err != nil {
+		return nil, err
+	}
+
+	if om.past != nil {
+		bos, eos, err := configTokens(cfg.BOSTokenID, cfg.EOSTokenID)
+		if err != nil {
+			return nil, err
+		}
+		om.gen = &generator{
+			lm:           om,
+			tokenizer:    om.Tokenizer,
+			bos:          bos,
+			eos:          eos,
+			maxPositions: maxPositions,
+		}
+		if eos, err := generationEOS(dir); err != nil {
+			return nil, err
+		} else if len(eos) > 0 {
+			om.gen.eos = eos
+		}
+	}
+	return om, nil
+}
+
+// onnxPastLayers pairs the past_key_values.N.key and .value inputs of a
+// decoder graph with its present.N.key and .value outputs. It returns nil
+// for graphs without a cache.
+func onnxPastLayers(g *onnx.Graph, cfg onnxConfig) ([]onnxPast, error) {
+	outputs := make(map[string]bool)
+	for _, out := range g.Outputs {
+		outputs[out.Name] = true
+	}
+
+	layers := make(map[int]*onnxPast)
+	for _, in := range g.Inputs {
+		rest, ok := strings.CutPrefix(in.Name, "past_key_values.")
+		if !ok {
+			if !onnxInputs[in.Name] {
+				return nil, fmt.Errorf("input %q is %w", in.Name, errs.ErrNotImplemented)
+			}
+			continue
+		}
+		num, kind, _ := strings.Cut(rest, ".")
+		layer, err := strconv.Atoi(num)
+		if err != nil || layer < 0 || (kind != "key" && kind != "value") {
+			return nil, fmt.Errorf("cache input %q is %w", in.Name, errs.ErrNotImplemented)
+		}
+		present := "present." + rest
+		if !outputs[present] {
+			return nil, fmt.Errorf("cache input %q has no %q output", in.Name, present)
+		}
+		heads, headDim, err := onnxCacheShape(in, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		p := layers[layer]
+		if p == nil {
+			p = &onnxPast{heads: heads, headDim: headDim}
+			layers[layer] = p
+		}
+		if kind == "key" {
+			p.key, p.presentKey = in.Name, present
+		} else {
+			p.value, p.presentValue = in.Name, present
+		}
+		if heads != p.heads || headDim != p.headDim {
+			return nil, fmt.Errorf("cache inputs of layer %d differ in shape", layer)
+		}
+	}
+	if len(layers) == 0 {
+		return nil, nil
+	}
+
+	indices := make([]int, 0, len(layers))
+	for i := range layers {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	past := make([]onnxPast, len(indices))
+	for i, layer := range indices {
+		p := layers[layer]
+		if layer != i || p.key == "" || p.value == "" {
+			return nil, fmt.Errorf("missing keys or values in the cache of layer %d", i)
+		}
+		past[i] = *p
+	}
+	return past, nil
+}
+
+// onnxCacheShape returns the heads and head size of a cache input, taken
+// from its declared shape or, where that is symbolic, from the config
+func onnxCacheShape(in onnx.ValueInfo, cfg onnxConfig) (heads, headDim int, err error) {
+	if len(in.Shape) != 4 {
+		return 0, 0, fmt.Errorf("cache input %q must have shape [batch, heads, positions, head size]", in.Name)
+	}
+	heads, headDim = int(in.Shape[1].Value), int(in.Shape[3].Value)
+
+	attnHeads := max(cfg.NumAttentionHeads, cfg.NHead)
+	if heads <= 0 {
+		heads = max(cfg.NumKeyValueHeads, attnHeads)
+	}
+	if headDim <= 0 && attnHeads > 0 {
+		headDim = max(cfg.HiddenSize, cfg.NEmbd) / attnHeads
+	}
+	if heads <= 0 || headDim <= 0 {
+		return 0, 0, fmt.Errorf("cache input %q has a symbolic size and config.json does not give it", in.Name)
+	}
+	return heads, headDim, nil
+}
+
+// inputs builds the token inputs of the graph for ids following past cached
+// positions. typeIDs and mask default to zeros and to ones covering the
+// cached positions too.
+func (om *ONNXModel) inputs(ids, typeIDs, mask []int, past int) map[string]*onnx.Tensor {
+	n := len(ids)
+	feeds := make(map[string]*onnx.Tensor)
+	for _, in := range om.model.Graph.Inputs {
+		var values []int64
+		switch in.Name {
+		case "input_ids":
+			values = make([]int64, n)
+			for i, id := range ids {
+				values[i] = int64(id)
+			}
+		case "token_type_ids":
+			values = make([]int64, n)
+			for i := range typeIDs {
+				values[i] = int64(typeIDs[i])
+			}
+		case "attention_mask":
+			if mask == nil {
+				values = make([]int64, past+n)
+				for i := range values {
+					values[i] = 1
+				}
+			} else {
+				values = make([]int64, len(mask))
+				for i, m := range mask {
+					values[i] = int64(m)
+				}
+			}
+		case "position_ids":
+			values = make([]int64, n)
+			for i := range values {
+				values[i] = int64(past + i)
+			}
+		case "use_cache_branch":
+			feeds[in.Name] = onnx.NewBool([]bool{past > 0}, 1)
+			continue
+		default:
+			continue
+		}
+		feeds[in.Name] = onnx.NewInt(values, 1, len(values))
+	}
+	return feeds
 }
 
-// Classify performs text classification using ONNX Runtime
-// TODO: Implement in Phase 2
+// Logits returns the unnormalized classification scores for text, one per
+// label. They are read from the graph output named logits, or the first
+// output if none is.
+func (om *ONNXModel) Logits(ctx context.Context, text string) ([]float32, error) {
+	if om.past != nil {
+		return nil, &errs.UnsupportedTaskError{Model: "ONNX decoder", Task: models.TaskTextClassification}
+	}
+	enc, err := om.Tokenizer.Encode(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize input: %w", err)
+	}
+
+	outputs, err := om.model.Run(ctx, om.inputs(enc.IDs, enc.TypeIDs, enc.AttentionMask, 0))
+	if err != nil {
+		return nil, fmt.Errorf("ONNX inference failed: %w", err)
+	}
+	logits := outputs[om.logits]
+	if logits.Type != onnx.Float || len(logits.Shape) != 2 || logits.Shape[0] != 1 {
+		return nil, fmt.Errorf("expected float logits of shape [1 labels], got %s", logits)
+	}
+	return logits.Floats, nil
+}
+
+func (om *ONNXModel) newCache() *kvCache {
+	return newKVCache(len(om.past))
+}
+
+// forward implements causalLM. The cache holds each layer's keys and values
+// as [positions, heads, headDim] views of the graph's present outputs.
+func (om *ONNXModel) forward(ctx context.Context, ids []int, cache *kvCache) ([]float32, error) {
+	past, n := cache.len(), len(ids)
+	feeds := om.inputs(ids, nil, nil, past)
+	for i, p := range om.past {
+		feeds[p.key] = p.feed(cache.keys[i])
+		feeds[p.value] = p.feed(cache.values[i])
+	}
+
+	outputs, err := om.model.Run(ctx, feeds)
+	if err != nil {
+		return nil, fmt.Errorf("ONNX inference failed: %w", err)
+	}
+	logits := outputs[om.logits]
+	if logits.Type != onnx.Float || len(logits.Shape) != 3 || logits.Shape[0] != 1 || logits.Shape[1] != n {
+		return nil, fmt.Errorf("expected float logits of shape [1 %d vocab], got %s", n, logits)
+	}
+	for i, p := range om.past {
+		k, err := p.cached(outputs[p.presentKey], past+n)
+		if err != nil {
+			return nil, err
+		}
+		v, err := p.cached(outputs[p.presentValue], past+n)
+		if err != nil {
+			return nil, err
+		}
+		cache.keys[i], cache.values[i] = k, v
+	}
+	vocab := logits.Shape[2]
+	return logits.Floats[(n-1)*vocab:], nil
+}
+
+// feed converts cached [positions, heads, headDim] keys or values, which may
+// be nil before the first step, to a graph input
+func (p onnxPast) feed(t *tensor.Tensor) *onnx.Tensor {
+	if t == nil {
+		return onnx.NewFloat([]float32{}, 1, p.heads, 0, p.headDim)
+	}
+	return onnx.NewFloat(t.Transpose(1, 0, 2).Data(), 1, p.heads, t.Dim(0), p.headDim)
+}
+
+// cached checks a present output and views it as [positions, heads,
+// headDim]
+func (p onnxPast) cached(t *onnx.Tensor, positions int) (*tensor.Tensor, error) {
+	if t.Type != onnx.Float || len(t.Shape) != 4 || t.Shape[0] != 1 || t.Shape[1] != p.heads || t.Shape[2] != positions || t.Shape[3] != p.headDim {
+		return nil, fmt.Errorf("expected a float cache of shape [1 %d %d %d], got %s", p.heads, positions, p.headDim, t)
+	}
+	return tensor.New(t.Floats, p.heads, positions, p.headDim).Transpose(1, 0, 2), nil
+}
+
+// Classify returns the most likely label for text and its softmax score
 func (om *ONNXModel) Classify(ctx context.Context, text string) (*models.ClassificationResult, error) {
-	// TODO:
-	// 1. Load tokenizer
-	// 2. Tokenize input text
-	// 3. Run ONNX inference
-	// 4. Parse logits to classification result
-	return nil, nil
+	logits, err := om.Logits(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return classify(logits, om.config.ID2Label), nil
+}
+
+// ClassifyAll returns the scores of the labels for text, best first
+func (om *ONNXModel) ClassifyAll(ctx context.Context, text string, options *models.ClassificationOptions) ([]models.ClassificationResult, error) {
+	logits, err := om.Logits(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return classifyAll(logits, om.config.ID2Label, om.config.ProblemType, options)
 }
 
-// Generate performs text generation using ONNX Runtime
-// TODO: Implement in Phase 2
+// Generate continues prompt with a decoder export. When options.NumReturn
+// sequences are sampled, the first one is returned.
 func (om *ONNXModel) Generate(ctx context.Context, prompt string, options *models.GenerationOptions) (*models.GenerationResult, error) {
-	// TODO:
-	// 1. Load tokenizer
-	// 2. Tokenize prompt
-	// 3. Run autoregressive generation with ONNX
-	// 4. Decode tokens back to text
-	return nil, nil
+	if om.gen == nil {
+		return nil, &errs.UnsupportedTaskError{Model: "ONNX classification", Task: models.TaskTextGeneration}
+	}
+	results, err := om.gen.generate(ctx, prompt, options, om.Rand)
+	if err != nil {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// GenerateAll continues prompt with a decoder export, returning all
+// options.NumReturn sequences in the order they were sampled
+func (om *ONNXModel) GenerateAll(ctx context.Context, prompt string, options *models.GenerationOptions) ([]models.GenerationResult, error) {
+	if om.gen == nil {
+		return nil, &errs.UnsupportedTaskError{Model: "ONNX classification", Task: models.TaskTextGeneration}
+	}
+	return om.gen.generate(ctx, prompt, options, om.Rand)
+}
+
+// GenerateStream continues prompt with a decoder export, sending each token
+// as it is sampled
+func (om *ONNXModel) GenerateStream(ctx context.Context, prompt string, options *models.GenerationOptions) (<-chan models.Token, error) {
+	if om.gen == nil {
+		return nil, &errs.UnsupportedTaskError{Model: "ONNX classification", Task: models.TaskTextGeneration}
+	}
+	return om.gen.stream(ctx, prompt, options, om.Rand)
 }
 
 // GetModelInfo returns information about the ONNX model
 func (om *ONNXModel) GetModelInfo() *models.ModelInfo {
+	task := models.TaskTextClassification
+	if om.past != nil {
+		task = models.TaskTextGeneration
+	}
 	return &models.ModelInfo{
 		Name:     om.ModelPath,
+		Task:     task,
 		Provider: "onnx",
 	}
 }
@@ -0,0 +1,411 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/kelleyblackmore/go-transformer/pkg/onnx"
+)
+
+// onnxGraphBuilder assembles a graph node by node, naming each output
+// after the node that produces it
+type onnxGraphBuilder struct {
+	t     *testing.T
+	st    *SafeTensors
+	graph *onnx.Graph
+}
+
+func (b *onnxGraphBuilder) node(op string, attrs map[string]*onnx.Attribute, inputs ...string) string {
+	out := fmt.Sprintf("%s_%d", op, len(b.graph.Nodes))
+	b.graph.Nodes = append(b.graph.Nodes, &onnx.Node{Name: out, OpType: op, Inputs: inputs, Outputs: []string{out}, Attributes: attrs})
+	return out
+}
+
+func (b *onnxGraphBuilder) constant(name string, t *onnx.Tensor) string {
+	b.graph.Initializers[name] = t
+	return name
+}
+
+// weight adds a checkpoint tensor as an initializer, transposed when it is
+// a linear layer weight feeding MatMul
+func (b *onnxGraphBuilder) weight(name string, transpose bool) string {
+	w, err := b.st.Tensor(name)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	if transpose {
+		w = w.T()
+	}
+	return b.constant(name, onnx.NewFloat(w.Data(), w.Shape()...))
+}
+
+func (b *onnxGraphBuilder) linear(x, name string) string {
+	return b.node("Add", nil, b.node("MatMul", nil, x, b.weight(name+".weight", true)), b.weight(name+".bias", false))
+}
+
+// outputs gives the last node n named outputs, returning their names
+func (b *onnxGraphBuilder) outputs(n int, names ...string) []string {
+	last := b.graph.Nodes[len(b.graph.Nodes)-1]
+	if len(names) == 0 {
+		for i := 0; i < n; i++ {
+			names = append(names, fmt.Sprintf("%s_%d", last.Name, i))
+		}
+	}
+	last.Outputs = names
+	return names
+}
+
+func (b *onnxGraphBuilder) layerNorm(x, name string, eps float32) string {
+	attrs := map[string]*onnx.Attribute{"epsilon": {Type: onnx.AttributeFloat, Float: eps}}
+	return b.node("LayerNormalization", attrs, x, b.weight(name+".weight", false), b.weight(name+".bias", false))
+}
+
+func onnxInts(v ...int64) *onnx.Attribute {
+	return &onnx.Attribute{Type: onnx.AttributeInts, Ints: v}
+}
+
+func onnxInt(v int64) *onnx.Attribute {
+	return &onnx.Attribute{Type: onnx.AttributeInt, Int: v}
+}
+
+// writeTestONNXModel exports the BERT model written by writeTestBertModel
+// to model.onnx in the same directory, using the operators the Hugging Face
+// exporter emits
+func writeTestONNXModel(t *testing.T) string {
+	t.Helper()
+	const heads, headDim = 2, 4
+	dir := writeTestBertModel(t, false)
+	st, err := OpenSafeTensors(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	ids := onnx.ValueInfo{Name: "input_ids", Type: onnx.Int64, Shape: []onnx.Dim{{Param: "batch"}, {Param: "sequence"}}}
+	mask, types := ids, ids
+	mask.Name, types.Name = "attention_mask", "token_type_ids"
+	b := &onnxGraphBuilder{t: t, st: st, graph: &onnx.Graph{
+		Initializers: map[string]*onnx.Tensor{},
+		Inputs:       []onnx.ValueInfo{ids, mask, types},
+		Outputs:      []onnx.ValueInfo{{Name: "logits", Type: onnx.Float}},
+	}}
+	scalar := func(name string, v float32) string { return b.constant(name, onnx.NewFloat([]float32{v})) }
+	ints := func(name string, v ...int64) string { return b.constant(name, onnx.NewInt(v, len(v))) }
+
+	// Embeddings, with position ids sliced from a buffer to the input length
+	positions := make([]int64, 16)
+	for i := range positions {
+		positions[i] = int64(i)
+	}
+	b.constant("position_ids", onnx.NewInt(positions, 1, 16))
+	length := b.node("Shape", map[string]*onnx.Attribute{"start": onnxInt(1)}, "input_ids")
+	posIDs := b.node("Slice", nil, "position_ids", ints("zero", 0), length, ints("one", 1))
+	x := b.node("Add", nil,
+		b.node("Gather", nil, b.weight("bert.embeddings.word_embeddings.weight", false), "input_ids"),
+		b.node("Gather", nil, b.weight("bert.embeddings.token_type_embeddings.weight", false), "token_type_ids"))
+	x = b.node("Add", nil, x, b.node("Gather", nil, b.weight("bert.embeddings.position_embeddings.weight", false), posIDs))
+	x = b.layerNorm(x, "bert.embeddings.LayerNorm", 1e-12)
+
+	// Additive mask: 0 where attended, the float32 minimum elsewhere
+	m := b.node("Cast", map[string]*onnx.Attribute{"to": onnxInt(int64(onnx.Float))},
+		b.node("Unsqueeze", nil, "attention_mask", ints("mask_axes", 1, 2)))
+	m = b.node("Mul", nil, b.node("Sub", nil, scalar("one_f", 1), m), scalar("min_f", -math.MaxFloat32))
+
+	splitHeads := ints("split_heads", 0, 0, heads, headDim)
+	mergeHeads := ints("merge_heads", 0, 0, heads*headDim)
+	for i := 0; i < 2; i++ {
+		p := fmt.Sprintf("bert.encoder.layer.%d.", i)
+		project := func(name string, perm ...int64) string {
+			h := b.node("Reshape", nil, b.linear(x, p+"attention.self."+name), splitHeads)
+			return b.node("Transpose", map[string]*onnx.Attribute{"perm": onnxInts(perm...)}, h)
+		}
+		q, k, v := project("query", 0, 2, 1, 3), project("key", 0, 2, 3, 1), project("value", 0, 2, 1, 3)
+		scores := b.node("Add", nil, b.node("Div", nil, b.node("MatMul", nil, q, k), scalar("sqrt_head_dim", 2)), m)
+		probs := b.node("Softmax", map[string]*onnx.Attribute{"axis": onnxInt(-1)}, scores)
+		ctx := b.node("Transpose", map[string]*onnx.Attribute{"perm": onnxInts(0, 2, 1, 3)}, b.node("MatMul", nil, probs, v))
+		ctx = b.node("Reshape", nil, ctx, mergeHeads)
+		x = b.layerNorm(b.node("Add", nil, x, b.linear(ctx, p+"attention.output.dense")), p+"attention.output.LayerNorm", 1e-12)
+
+		// Exact GELU: x * 0.5 * (1 + erf(x / sqrt(2)))
+		h := b.linear(x, p+"intermediate.dense")
+		erf := b.node("Erf", nil, b.node("Div", nil, h, scalar("sqrt2", math.Sqrt2)))
+		h = b.node("Mul", nil, b.node("Mul", nil, h, scalar("half", 0.5)), b.node("Add", nil, erf, "one_f"))
+		x = b.layerNorm(b.node("Add", nil, x, b.linear(h, p+"output.dense")), p+"output.LayerNorm", 1e-12)
+	}
+
+	// Pooler and classifier on the [CLS] state
+	cls := b.node("Gather", map[string]*onnx.Attribute{"axis": onnxInt(1)}, x, b.constant("cls", onnx.NewInt([]int64{0})))
+	transB := map[string]*onnx.Attribute{"transB": onnxInt(1)}
+	pooled := b.node("Tanh", nil, b.node("Gemm", transB, cls, b.weight("bert.pooler.dense.weight", false), b.weight("bert.pooler.dense.bias", false)))
+	b.node("Gemm", transB, pooled, b.weight("classifier.weight", false), b.weight("classifier.bias", false))
+	b.outputs(1, "logits")
+
+	model := &onnx.Model{IRVersion: 8, OpsetImports: map[string]int64{"": 17}, Graph: b.graph}
+	path := filepath.Join(dir, "model.onnx")
+	writeFile(t, path, model.Marshal())
+	return path
+}
+
+func TestONNXModel_Classify(t *testing.T) {
+	path := writeTestONNXModel(t)
+	m, err := NewONNXModel(path, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The logits of the equivalent safetensors model in bert_test.go
+	logits, err := m.Logits(context.Background(), "the movie was great")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []float32{0.19678474, 0.03821759}
+	if len(logits) != 2 || maxAbsDiff(logits, want) > 1e-5 {
+		t.Errorf("Expected logits %v, got %v", want, logits)
+	}
+
+	result, err := m.Classify(context.Background(), "the movie was great")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Label != "NEGATIVE" || math.Abs(result.Score-0.53956) > 1e-4 {
+		t.Errorf("Expected NEGATIVE with score 0.53956, got %s with %v", result.Label, result.Score)
+	}
+	all, err := m.ClassifyAll(context.Background(), "the movie was great", &models.ClassificationOptions{FunctionToApply: models.FunctionNone})
+	if err != nil || len(all) != 2 || all[0].Label != "NEGATIVE" || math.Abs(all[1].Score-0.03821759) > 1e-5 {
+		t.Errorf("Expected the raw logits best first, got %+v (%v)", all, err)
+	}
+	if info := m.GetModelInfo(); info.Provider != "onnx" || info.Task != models.TaskTextClassification {
+		t.Errorf("Expected an onnx classification model, got %+v", info)
+	}
+	if _, err := m.Generate(context.Background(), "hello", nil); !errors.Is(err, errs.ErrUnsupportedTask) {
+		t.Errorf("Expected an unsupported task error for text generation, got %v", err)
+	}
+
+	// An explicit tokenizer file gives the same result
+	m, err = NewONNXModel(path, filepath.Join(filepath.Dir(path), "vocab.txt"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got, err := m.Logits(context.Background(), "the movie was great"); err != nil || maxAbsDiff(got, want) > 1e-5 {
+		t.Errorf("Expected logits %v, got %v (%v)", want, got, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Classify(ctx, "the movie was great"); err == nil {
+		t.Error("Expected error for a cancelled context")
+	}
+}
+
+func TestNewONNXModel_Errors(t *testing.T) {
+	path := writeTestONNXModel(t)
+	dir := filepath.Dir(path)
+	if _, err := NewONNXModel(filepath.Join(dir, "missing.onnx"), ""); err == nil {
+		t.Error("Expected error for a missing model")
+	}
+	if _, err := NewONNXModel(path, filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("Expected error for a missing tokenizer")
+	}
+	if err := os.Remove(filepath.Join(dir, "vocab.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewONNXModel(path, ""); err == nil {
+		t.Error("Expected error for a model directory without a tokenizer")
+	}
+
+	model := &onnx.Model{OpsetImports: map[string]int64{"": 17}, Graph: &onnx.Graph{
+		Nodes:   []*onnx.Node{{OpType: "Identity", Inputs: []string{"pixel_values"}, Outputs: []string{"logits"}}},
+		Inputs:  []onnx.ValueInfo{{Name: "pixel_values", Type: onnx.Float}},
+		Outputs: []onnx.ValueInfo{{Name: "logits", Type: onnx.Float}},
+	}}
+	writeFile(t, path, model.Marshal())
+	if _, err := NewONNXModel(path, ""); !errors.Is(err, errs.ErrNotImplemented) {
+		t.Errorf("Expected a not implemented error for an unsupported model input, got %v", err)
+	}
+
+	// A decoder cache needs keys and values with present outputs
+	past := onnx.ValueInfo{Name: "past_key_values.0.key", Type: onnx.Float, Shape: []onnx.Dim{{Param: "batch"}, {Value: 2}, {Param: "past"}, {Value: 4}}}
+	model.Graph.Inputs = []onnx.ValueInfo{{Name: "input_ids", Type: onnx.Int64}, past}
+	model.Graph.Nodes[0].Inputs = []string{"input_ids"}
+	writeFile(t, path, model.Marshal())
+	if _, err := NewONNXModel(path, ""); err == nil {
+		t.Error("Expected error for a cache input without a present output")
+	}
+	model.Graph.Outputs = append(model.Graph.Outputs, onnx.ValueInfo{Name: "present.0.key", Type: onnx.Float})
+	writeFile(t, path, model.Marshal())
+	if _, err := NewONNXModel(path, ""); err == nil {
+		t.Error("Expected error for a cache without values")
+	}
+}
+
+// writeTestONNXGPT2Model exports the GPT-2 model written by
+// writeTestGPT2Model to decoder_model_merged.onnx in the same directory,
+// with the cache inputs and outputs and the use_cache_branch switch of
+// Optimum's merged decoders
+func writeTestONNXGPT2Model(t *testing.T) string {
+	t.Helper()
+	const layers, heads, headDim = 2, 2, 4
+	dir := writeTestGPT2Model(t)
+	st, err := OpenSafeTensors(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	ids := onnx.ValueInfo{Name: "input_ids", Type: onnx.Int64, Shape: []onnx.Dim{{Param: "batch"}, {Param: "sequence"}}}
+	mask, positionIDs := ids, ids
+	mask.Name, positionIDs.Name = "attention_mask", "position_ids"
+	b := &onnxGraphBuilder{t: t, st: st, graph: &onnx.Graph{
+		Initializers: map[string]*onnx.Tensor{},
+		Inputs:       []onnx.ValueInfo{ids, mask, positionIDs, {Name: "use_cache_branch", Type: onnx.Bool, Shape: []onnx.Dim{{Value: 1}}}},
+		Outputs:      []onnx.ValueInfo{{Name: "logits", Type: onnx.Float}},
+	}}
+	scalar := func(name string, v float32) string { return b.constant(name, onnx.NewFloat([]float32{v})) }
+	ints := func(name string, v ...int64) string { return b.constant(name, onnx.NewInt(v, len(v))) }
+	perm := func(p ...int64) map[string]*onnx.Attribute { return map[string]*onnx.Attribute{"perm": onnxInts(p...)} }
+	conv1D := func(x, name string) string {
+		return b.node("Add", nil, b.node("MatMul", nil, x, b.weight(name+".weight", false)), b.weight(name+".bias", false))
+	}
+
+	x := b.node("Add", nil,
+		b.node("Gather", nil, b.weight("wte.weight", false), "input_ids"),
+		b.node("Gather", nil, b.weight("wpe.weight", false), "position_ids"))
+
+	// Causal mask over the cached and new positions: the float32 minimum
+	// where a column lies after the row's own position
+	start := map[string]*onnx.Attribute{"start": onnxInt(1)}
+	total, length := b.node("Shape", start, "attention_mask"), b.node("Shape", start, "input_ids")
+	diagonal := b.node("Add", nil, b.node("Sub", nil, total, length), ints("one", 1))
+	one := &onnx.Attribute{Type: onnx.AttributeTensor, Tensor: onnx.NewFloat([]float32{1}, 1)}
+	ones := b.node("ConstantOfShape", map[string]*onnx.Attribute{"value": one}, b.node("Concat", map[string]*onnx.Attribute{"axis": onnxInt(0)}, length, total))
+	causal := b.node("Mul", nil, b.node("Trilu", nil, ones, diagonal), scalar("min_f", -math.MaxFloat32))
+
+	splitHeads := ints("split_heads", 0, 0, heads, headDim)
+	mergeHeads := ints("merge_heads", 0, 0, heads*headDim)
+	for i := 0; i < layers; i++ {
+		p := fmt.Sprintf("h.%d.", i)
+		h := b.layerNorm(x, p+"ln_1", 1e-5)
+		b.node("Split", map[string]*onnx.Attribute{"axis": onnxInt(2)}, conv1D(h, p+"attn.c_attn"))
+		var qkv [3]string
+		for j, name := range b.outputs(3) {
+			qkv[j] = b.node("Transpose", perm(0, 2, 1, 3), b.node("Reshape", nil, name, splitHeads))
+		}
+
+		// The cache is empty on the first step, which the merged export
+		// handles in the else branch
+		var present [2]string
+		for j, kind := range []string{"key", "value"} {
+			past := fmt.Sprintf("past_key_values.%d.%s", i, kind)
+			b.graph.Inputs = append(b.graph.Inputs, onnx.ValueInfo{Name: past, Type: onnx.Float,
+				Shape: []onnx.Dim{{Param: "batch"}, {Value: heads}, {Param: "past_sequence_length"}, {Value: headDim}}})
+			branch := func(n *onnx.Node, inits map[string]*onnx.Tensor) *onnx.Attribute {
+				n.Outputs = []string{"cached"}
+				return &onnx.Attribute{Type: onnx.AttributeGraph, Graph: &onnx.Graph{
+					Nodes: []*onnx.Node{n}, Initializers: inits, Outputs: []onnx.ValueInfo{{Name: "cached"}},
+				}}
+			}
+			cached := b.node("If", map[string]*onnx.Attribute{
+				"then_branch": branch(&onnx.Node{OpType: "Identity", Inputs: []string{past}}, nil),
+				"else_branch": branch(&onnx.Node{OpType: "Slice", Inputs: []string{past, "zero", "zero", "axis"}},
+					map[string]*onnx.Tensor{"zero": onnx.NewInt([]int64{0}, 1), "axis": onnx.NewInt([]int64{2}, 1)}),
+			}, "use_cache_branch")
+			b.node("Concat", map[string]*onnx.Attribute{"axis": onnxInt(2)}, cached, qkv[j+1])
+			present[j] = b.outputs(1, fmt.Sprintf("present.%d.%s", i, kind))[0]
+			b.graph.Outputs = append(b.graph.Outputs, onnx.ValueInfo{Name: present[j], Type: onnx.Float})
+		}
+
+		scores := b.node("MatMul", nil, qkv[0], b.node("Transpose", perm(0, 1, 3, 2), present[0]))
+		scores = b.node("Add", nil, b.node("Div", nil, scores, scalar("sqrt_head_dim", 2)), causal)
+		probs := b.node("Softmax", map[string]*onnx.Attribute{"axis": onnxInt(-1)}, scores)
+		ctx := b.node("Transpose", perm(0, 2, 1, 3), b.node("MatMul", nil, probs, present[1]))
+		x = b.node("Add", nil, x, conv1D(b.node("Reshape", nil, ctx, mergeHeads), p+"attn.c_proj"))
+
+		// gelu_new: 0.5 * x * (1 + tanh(sqrt(2/pi) * (x + 0.044715 * x^3)))
+		h = conv1D(b.layerNorm(x, p+"ln_2", 1e-5), p+"mlp.c_fc")
+		cube := b.node("Mul", nil, b.node("Pow", nil, h, scalar("three", 3)), scalar("gelu_coef", 0.044715))
+		tanh := b.node("Tanh", nil, b.node("Mul", nil, b.node("Add", nil, h, cube), scalar("sqrt_2_pi", float32(math.Sqrt(2/math.Pi)))))
+		h = b.node("Mul", nil, b.node("Mul", nil, h, scalar("half", 0.5)), b.node("Add", nil, tanh, scalar("one_f", 1)))
+		x = b.node("Add", nil, x, conv1D(h, p+"mlp.c_proj"))
+	}
+
+	// The language model head shares the token embeddings
+	wte, err := st.Tensor("wte.weight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := b.constant("lm_head.weight", onnx.NewFloat(wte.T().Data(), wte.Dim(1), wte.Dim(0)))
+	b.node("MatMul", nil, b.layerNorm(x, "ln_f", 1e-5), head)
+	b.outputs(1, "logits")
+
+	model := &onnx.Model{IRVersion: 8, OpsetImports: map[string]int64{"": 17}, Graph: b.graph}
+	path := filepath.Join(dir, "decoder_model_merged.onnx")
+	writeFile(t, path, model.Marshal())
+	return path
+}
+
+func TestONNXModel_Generate(t *testing.T) {
+	m, err := NewONNXModel(writeTestONNXGPT2Model(t), "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(m.past) != 2 || m.past[1].presentValue != "present.1.value" || m.past[1].heads != 2 || m.past[1].headDim != 4 {
+		t.Fatalf("Expected two cached layers of 2 heads of size 4, got %+v", m.past)
+	}
+
+	// The logits of the equivalent safetensors model in gpt2_test.go, first
+	// in one step and then one token at a time through the cache
+	enc, err := m.Tokenizer.Encode("hello world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float32{0.24675560, -0.77552019, 0.00026846, -0.17655929, -0.02771586, -0.06875027,
+		-0.22314409, 0.09430810, -0.00276521, 0.45735949, -0.09004627, -0.03621349}
+	logits, err := m.forward(context.Background(), enc.IDs, m.newCache())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if maxAbsDiff(logits[:len(want)], want) > 1e-5 {
+		t.Errorf("Expected logits %v, got %v", want, logits[:len(want)])
+	}
+	cache := m.newCache()
+	for _, id := range enc.IDs {
+		if logits, err = m.forward(context.Background(), []int{id}, cache); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if cache.len() != len(enc.IDs) || maxAbsDiff(logits[:len(want)], want) > 1e-5 {
+		t.Errorf("Expected logits %v after %d cached steps, got %v after %d", want, len(enc.IDs), logits[:len(want)], cache.len())
+	}
+
+	result, err := m.Generate(context.Background(), "hello world", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.GeneratedText != "hello worldhehehehehehehehe" {
+		t.Errorf("Expected 'hello worldhehehehehehehehe', got %q", result.GeneratedText)
+	}
+	if math.Abs(result.Score-(-15.0726036)) > 1e-4 {
+		t.Errorf("Expected score -15.0726036, got %v", result.Score)
+	}
+	result, err = m.Generate(context.Background(), "hello world", &models.GenerationOptions{MaxLength: 10})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.GeneratedText != "hello worldhehe" {
+		t.Errorf("Expected 'hello worldhehe', got %q", result.GeneratedText)
+	}
+
+	if info := m.GetModelInfo(); info.Task != models.TaskTextGeneration {
+		t.Errorf("Expected a text generation model, got %+v", info)
+	}
+	if _, err := m.Classify(context.Background(), "hello"); !errors.Is(err, errs.ErrUnsupportedTask) {
+		t.Errorf("Expected an unsupported task error for classification with a decoder, got %v", err)
+	}
+}
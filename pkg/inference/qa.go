@@ -0,0 +1,163 @@
+package inference
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+	"github.com/kelleyblackmore/go-transformer/pkg/tokenizers"
+)
+
+// Question answering defaults, as in the Hugging Face pipeline
+const (
+	defaultMaxAnswerLength = 15
+	defaultMaxSeqLength    = 384
+	defaultDocStride       = 128
+)
+
+// pairTruncatingTokenizer is implemented by every tokenizer in
+// pkg/tokenizers
+type pairTruncatingTokenizer interface {
+	EncodePairTruncated(text, pair string, truncation *tokenizers.TruncationParams) (*tokenizers.Encoding, error)
+}
+
+func (m *BertModel) hasQAHead() bool {
+	return m.qaOutputs.weight != nil || m.qaOutputs.qweight != nil
+}
+
+// Answer returns the span of passage that best answers question. Passages
+// too long for one window are split into overlapping windows, and the best
+// span of any window wins.
+func (m *BertModel) Answer(ctx context.Context, question, passage string, options *models.QuestionAnsweringOptions) (*models.QuestionAnswer, error) {
+	if !m.hasQAHead() {
+		return nil, &errs.UnsupportedTaskError{Model: m.Config.ModelType, Task: models.TaskQuestionAnswering}
+	}
+	tok, ok := m.Tokenizer.(pairTruncatingTokenizer)
+	if !ok {
+		return nil, fmt.Errorf("question answering with a %T tokenizer is %w", m.Tokenizer, errs.ErrNotImplemented)
+	}
+	windows, err := m.qaWindows(tok, question, passage, options)
+	if err != nil {
+		return nil, err
+	}
+
+	maxAnswerLength := defaultMaxAnswerLength
+	if options != nil && options.MaxAnswerLength > 0 {
+		maxAnswerLength = options.MaxAnswerLength
+	}
+	var best *models.QuestionAnswer
+	for _, enc := range windows {
+		hidden, err := m.forward(ctx, enc)
+		if err != nil {
+			return nil, err
+		}
+		logits := m.qaOutputs.forward(hidden)
+		span, score, ok := bestSpan(enc, logits, maxAnswerLength)
+		if !ok || (best != nil && score <= best.Score) {
+			continue
+		}
+		start, end := enc.Offsets[span[0]].Start, enc.Offsets[span[1]].End
+		best = &models.QuestionAnswer{
+			Answer: passage[start:end],
+			Score:  score,
+			Start:  utf8.RuneCountInString(passage[:start]),
+			End:    utf8.RuneCountInString(passage[:end]),
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w: passage has no tokens to answer from", errs.ErrInvalidInput)
+	}
+	return best, nil
+}
+
+// qaWindows encodes question with passage, splitting the passage into
+// windows of options.MaxSeqLength tokens that overlap by options.DocStride
+func (m *BertModel) qaWindows(tok pairTruncatingTokenizer, question, passage string, options *models.QuestionAnsweringOptions) ([]*tokenizers.Encoding, error) {
+	if options == nil {
+		options = &models.QuestionAnsweringOptions{}
+	}
+	maxSeqLength := options.MaxSeqLength
+	if maxSeqLength <= 0 {
+		maxSeqLength = defaultMaxSeqLength
+	}
+	maxSeqLength = min(maxSeqLength, m.Config.MaxPositionEmbeddings)
+	stride := options.DocStride
+	if stride <= 0 {
+		stride = defaultDocStride
+	}
+
+	// Leave room for the question and the [CLS] and two [SEP] tokens
+	q, err := tok.EncodePairTruncated(question, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize question: %w", err)
+	}
+	used := 0
+	for _, attended := range q.AttentionMask {
+		used += attended
+	}
+	room := maxSeqLength - used
+	if room <= 0 {
+		return nil, fmt.Errorf("%w: question of %d tokens leaves no room for the passage in %d", errs.ErrInvalidInput, used, maxSeqLength)
+	}
+	stride = min(stride, room/2)
+
+	enc, err := tok.EncodePairTruncated(question, passage, &tokenizers.TruncationParams{
+		MaxLength: maxSeqLength,
+		Strategy:  tokenizers.TruncateOnlySecond,
+		Stride:    stride,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize input: %w", err)
+	}
+	return append([]*tokenizers.Encoding{enc}, enc.Overflowing...), nil
+}
+
+// bestSpan returns the passage tokens [start, end] with the highest
+// probability of starting and ending the answer, given the [tokens, 2]
+// start and end logits of a window. Like Hugging Face, probabilities are
+// normalized over the passage tokens of the window.
+func bestSpan(enc *tokenizers.Encoding, logits *tensor.Tensor, maxAnswerLength int) ([2]int, float64, bool) {
+	n := enc.Len()
+	data := logits.Contiguous().Data()
+	inPassage := func(i int) bool { return enc.SequenceIDs[i] == 1 }
+
+	probs := func(column int) []float64 {
+		p := make([]float64, n)
+		top := math.Inf(-1)
+		for i := 0; i < n; i++ {
+			if inPassage(i) {
+				top = math.Max(top, float64(data[i*2+column]))
+			}
+		}
+		var sum float64
+		for i := 0; i < n; i++ {
+			if inPassage(i) {
+				p[i] = math.Exp(float64(data[i*2+column]) - top)
+				sum += p[i]
+			}
+		}
+		for i := range p {
+			p[i] /= sum
+		}
+		return p
+	}
+	starts, ends := probs(0), probs(1)
+
+	var span [2]int
+	best, found := 0.0, false
+	for i := 0; i < n; i++ {
+		if !inPassage(i) {
+			continue
+		}
+		for j := i; j < n && j < i+maxAnswerLength && inPassage(j); j++ {
+			if score := starts[i] * ends[j]; !found || score > best {
+				span, best, found = [2]int{i, j}, score, true
+			}
+		}
+	}
+	return span, best, found
+}
@@ -0,0 +1,135 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/models"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+	"github.com/kelleyblackmore/go-transformer/pkg/tokenizers"
+)
+
+// writeTestBertQAModel writes the test BERT model with a question answering
+// head in place of its pooler and classifier
+func writeTestBertQAModel(t *testing.T) string {
+	t.Helper()
+	dir := writeTestBertModel(t, false)
+	w := &testWeights{state: 7}
+	w.linear("qa_outputs", 2, 8)
+	rewriteTestWeights(t, dir, func(name string) (string, bool) {
+		return name, !strings.HasPrefix(name, "classifier.") && !strings.HasPrefix(name, "bert.pooler.")
+	}, w.tensors...)
+	return dir
+}
+
+func TestBertModel_Answer(t *testing.T) {
+	ctx := context.Background()
+	m, err := LoadBertModel(writeTestBertQAModel(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if info := m.GetModelInfo(); info.Task != models.TaskQuestionAnswering {
+		t.Errorf("Expected task %s, got %s", models.TaskQuestionAnswering, info.Task)
+	}
+	if _, err := m.Classify(ctx, "the movie"); !errors.Is(err, errs.ErrUnsupportedTask) {
+		t.Errorf("Expected ErrUnsupportedTask classifying with a question answering model, got %v", err)
+	}
+
+	// The em dash makes character and byte offsets differ
+	passages := []string{
+		"the movie — was great",
+		"the movie — was great not terrible the movies was not great the movie was terrible",
+	}
+	for _, passage := range passages {
+		answer, err := m.Answer(ctx, "was the movie great", passage, &models.QuestionAnsweringOptions{MaxAnswerLength: 3})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		runes := []rune(passage)
+		if answer.Start < 0 || answer.End > len(runes) || answer.Start >= answer.End || string(runes[answer.Start:answer.End]) != answer.Answer {
+			t.Errorf("Expected character offsets of %q in %q, got %+v", answer.Answer, passage, answer)
+		}
+		if answer.Score <= 0 || answer.Score > 1 {
+			t.Errorf("Expected a probability, got %v", answer.Score)
+		}
+	}
+
+	// The long passage is split into overlapping windows that together
+	// cover every passage token
+	tok := m.Tokenizer.(pairTruncatingTokenizer)
+	windows, err := m.qaWindows(tok, "was the movie great", passages[1], nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(windows) < 2 {
+		t.Fatalf("Expected several windows, got %d", len(windows))
+	}
+	covered := make(map[int]bool)
+	for _, w := range windows {
+		if w.Len() > m.Config.MaxPositionEmbeddings {
+			t.Errorf("Expected windows of at most %d tokens, got %d", m.Config.MaxPositionEmbeddings, w.Len())
+		}
+		for i, seq := range w.SequenceIDs {
+			if seq == 1 {
+				covered[w.Offsets[i].Start] = true
+			}
+		}
+	}
+	full, err := tok.EncodePairTruncated("", passages[1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, seq := range full.SequenceIDs {
+		if seq == 1 && !covered[full.Offsets[i].Start] {
+			t.Errorf("Expected the token at %d to be in a window", full.Offsets[i].Start)
+		}
+	}
+
+	classifier, err := LoadBertModel(writeTestBertModel(t, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := classifier.Answer(ctx, "why", "because", nil); !errors.Is(err, errs.ErrUnsupportedTask) {
+		t.Errorf("Expected ErrUnsupportedTask answering with a classifier, got %v", err)
+	}
+	if _, err := m.Answer(ctx, strings.Repeat("the movie was great ", 4), "great", nil); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a question filling the window, got %v", err)
+	}
+}
+
+func TestBestSpan(t *testing.T) {
+	// [CLS] q [SEP] p p p [SEP]
+	enc := &tokenizers.Encoding{
+		IDs:         make([]int, 7),
+		SequenceIDs: []int{-1, 0, -1, 1, 1, 1, -1},
+	}
+	logits := tensor.New([]float32{
+		9, 9, // [CLS] and the question score highest but are not passage tokens
+		9, 9,
+		9, 9,
+		0, 0,
+		2, 0,
+		0, 3,
+		9, 9,
+	}, 7, 2)
+
+	span, score, ok := bestSpan(enc, logits, 15)
+	if !ok || span != [2]int{4, 5} {
+		t.Errorf("Expected span [4 5], got %v (%v)", span, ok)
+	}
+	if score <= 0 || score > 1 {
+		t.Errorf("Expected a probability, got %v", score)
+	}
+
+	// A maximum answer length of one token rules out [4 5]
+	if span, _, _ := bestSpan(enc, logits, 1); span[0] != span[1] {
+		t.Errorf("Expected a single token span, got %v", span)
+	}
+
+	if _, _, ok := bestSpan(&tokenizers.Encoding{IDs: []int{0}, SequenceIDs: []int{-1}}, tensor.New([]float32{1, 1}, 1, 2), 15); ok {
+		t.Error("Expected no span without passage tokens")
+	}
+}
@@ -0,0 +1,131 @@
+package inference
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+)
+
+// scaleSuffix names the per-row scales of an int8 weight: the scales of
+// h.0.mlp.c_fc.weight are stored as h.0.mlp.c_fc.weight_scale
+const scaleSuffix = "_scale"
+
+// QuantizeResult summarizes a QuantizeInt8 conversion
+type QuantizeResult struct {
+	Quantized   int   `json:"quantized"`    // weights converted to int8
+	Copied      int   `json:"copied"`       // tensors copied unchanged
+	InputBytes  int64 `json:"input_bytes"`  // tensor data read
+	OutputBytes int64 `json:"output_bytes"` // tensor data written, including scales
+}
+
+// QuantizeInt8 converts the linear layer weights of a checkpoint to
+// symmetric int8 with one float32 scale per row and writes the result to a
+// single safetensors file. For PyTorch [out, in] weights the scales are per
+// output channel; GPT-2 Conv1D weights, stored as [in, out], get one per
+// input channel. Embeddings, norms, biases and all other tensors are copied
+// unchanged. in may be any path OpenSafeTensors accepts. The models in this
+// package load the output like any other checkpoint.
+func QuantizeInt8(in, out string) (*QuantizeResult, error) {
+	st, err := OpenSafeTensors(in)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+
+	// The input is memory-mapped, so overwriting it would corrupt the data
+	// being read
+	if outInfo, err := os.Stat(out); err == nil {
+		for _, path := range st.paths {
+			if inInfo, err := os.Stat(path); err == nil && os.SameFile(inInfo, outInfo) {
+				return nil, fmt.Errorf("output %s would overwrite the input checkpoint", out)
+			}
+		}
+	}
+
+	result := &QuantizeResult{}
+	var tensors []TensorData
+	for _, name := range st.Names() {
+		raw, info, err := st.Raw(name)
+		if err != nil {
+			return nil, err
+		}
+		result.InputBytes += int64(len(raw))
+		if !quantizable(st, info) {
+			tensors = append(tensors, TensorData{TensorInfo: info, Data: raw})
+			result.Copied++
+			continue
+		}
+
+		t, err := st.Tensor(name)
+		if err != nil {
+			return nil, err
+		}
+		q := tensor.QuantizeInt8(t)
+		values := make([]byte, len(q.Values()))
+		for i, v := range q.Values() {
+			values[i] = byte(v)
+		}
+		scales := make([]byte, 0, 4*len(q.Scales()))
+		for _, s := range q.Scales() {
+			scales = binary.LittleEndian.AppendUint32(scales, math.Float32bits(s))
+		}
+		tensors = append(tensors,
+			TensorData{TensorInfo: TensorInfo{Name: name, DType: DTypeI8, Shape: info.Shape}, Data: values},
+			TensorData{TensorInfo: TensorInfo{Name: name + scaleSuffix, DType: DTypeF32, Shape: info.Shape[:1]}, Data: scales},
+		)
+		result.Quantized++
+	}
+	for _, t := range tensors {
+		result.OutputBytes += int64(len(t.Data))
+	}
+
+	metadata := map[string]string{"quantization": "int8"}
+	for k, v := range st.Metadata {
+		if _, ok := metadata[k]; !ok {
+			metadata[k] = v
+		}
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", out, err)
+	}
+	bw := bufio.NewWriter(f)
+	err = WriteSafeTensors(bw, metadata, tensors)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to write %s: %w", out, err), os.Remove(out))
+	}
+	return result, nil
+}
+
+// quantizable reports whether a tensor is a floating-point linear layer
+// weight. Embedding tables are looked up row by row rather than multiplied,
+// so they are left at full precision.
+func quantizable(st *SafeTensors, info TensorInfo) bool {
+	switch info.DType {
+	case DTypeF32, DTypeF16, DTypeBF16:
+	default:
+		return false
+	}
+	if len(info.Shape) != 2 || !strings.HasSuffix(info.Name, ".weight") {
+		return false
+	}
+	if _, ok := st.Info(info.Name + scaleSuffix); ok {
+		return false
+	}
+	layer := strings.TrimSuffix(info.Name, ".weight")
+	layer = layer[strings.LastIndex(layer, ".")+1:]
+	return !strings.Contains(layer, "embed") && layer != "wte" && layer != "wpe"
+}
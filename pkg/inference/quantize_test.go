@@ -0,0 +1,171 @@
+package inference
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// quantizeTestModel quantizes the checkpoint of a model directory into a new
+// directory holding the same config and tokenizer files
+func quantizeTestModel(t *testing.T, dir string) (string, *QuantizeResult) {
+	t.Helper()
+	out := t.TempDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() == "model.safetensors" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(out, e.Name()), data)
+	}
+
+	result, err := QuantizeInt8(filepath.Join(dir, "model.safetensors"), filepath.Join(out, "model.safetensors"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return out, result
+}
+
+func maxAbsDiff(a, b []float32) float64 {
+	var d float64
+	for i := range a {
+		d = math.Max(d, math.Abs(float64(a[i]-b[i])))
+	}
+	return d
+}
+
+func TestQuantizeInt8_GPT2(t *testing.T) {
+	dir := writeTestGPT2Model(t)
+	qdir, result := quantizeTestModel(t, dir)
+
+	// Four Conv1D weights per layer; embeddings, norms and biases are copied
+	if result.Quantized != 8 || result.Copied != 20 {
+		t.Errorf("Expected 8 quantized and 20 copied tensors, got %d and %d", result.Quantized, result.Copied)
+	}
+	if result.OutputBytes >= result.InputBytes {
+		t.Errorf("Expected output smaller than the %d input bytes, got %d", result.InputBytes, result.OutputBytes)
+	}
+
+	st, err := OpenSafeTensors(qdir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if info, _ := st.Info("h.0.attn.c_attn.weight"); info.DType != DTypeI8 || !equalInts(info.Shape, []int{8, 24}) {
+		t.Errorf("Expected an I8 [8 24] weight, got %s %v", info.DType, info.Shape)
+	}
+	if info, _ := st.Info("h.0.attn.c_attn.weight_scale"); info.DType != DTypeF32 || !equalInts(info.Shape, []int{8}) {
+		t.Errorf("Expected F32 [8] scales, got %s %v", info.DType, info.Shape)
+	}
+	if info, _ := st.Info("wte.weight"); info.DType != DTypeF32 {
+		t.Errorf("Expected embeddings to stay F32, got %s", info.DType)
+	}
+	if st.Metadata["quantization"] != "int8" {
+		t.Errorf("Expected quantization metadata, got %v", st.Metadata)
+	}
+	st.Close()
+
+	m, err := LoadGPT2Model(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qm, err := LoadGPT2Model(qdir)
+	if err != nil {
+		t.Fatalf("Expected quantized model to load, got %v", err)
+	}
+	if qm.layers[0].attn.qweight == nil {
+		t.Error("Expected the quantized model to keep int8 weights")
+	}
+
+	ids := []int{1, 2, 10, 4, 11, 4, 7, 3, 8}
+	want, err := m.forward(context.Background(), ids, m.newCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := qm.forward(context.Background(), ids, qm.newCache())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if d := maxAbsDiff(got, want); d > 0.01 || d == 0 {
+		t.Errorf("Expected quantized logits within 0.01 of %v, got %v", want, got)
+	}
+}
+
+func TestQuantizeInt8_Bert(t *testing.T) {
+	for _, distilled := range []bool{false, true} {
+		dir := writeTestBertModel(t, distilled)
+		qdir, _ := quantizeTestModel(t, dir)
+
+		m, err := LoadBertModel(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		qm, err := LoadBertModel(qdir)
+		if err != nil {
+			t.Fatalf("Expected quantized model to load, got %v", err)
+		}
+		want, err := m.Logits(context.Background(), "the movie was great")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := qm.Logits(context.Background(), "the movie was great")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if d := maxAbsDiff(got, want); d > 0.01 {
+			t.Errorf("distilled=%v: expected quantized logits within 0.01 of %v, got %v", distilled, want, got)
+		}
+	}
+}
+
+func TestQuantizeInt8_Llama(t *testing.T) {
+	// The variant has an untied lm_head, which is quantized too
+	dir := writeTestLlamaModel(t, true)
+	qdir, _ := quantizeTestModel(t, dir)
+
+	m, err := LoadLlamaModel(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qm, err := LoadLlamaModel(qdir)
+	if err != nil {
+		t.Fatalf("Expected quantized model to load, got %v", err)
+	}
+	if qm.lmHead.qweight == nil {
+		t.Error("Expected an int8 lm_head")
+	}
+	ids := []int{1, 5, 6, 7}
+	want, err := m.forward(context.Background(), ids, m.newCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := qm.forward(context.Background(), ids, qm.newCache())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if d := maxAbsDiff(got, want); d > 0.01 {
+		t.Errorf("Expected quantized logits within 0.01 of %v, got %v", want, got)
+	}
+}
+
+func TestQuantizeInt8_Errors(t *testing.T) {
+	dir := writeTestGPT2Model(t)
+	path := filepath.Join(dir, "model.safetensors")
+	if _, err := QuantizeInt8(path, path); err == nil {
+		t.Error("Expected error when the output would overwrite the input")
+	}
+	if _, err := QuantizeInt8(filepath.Join(dir, "missing.safetensors"), filepath.Join(dir, "out.safetensors")); err == nil {
+		t.Error("Expected error for a missing input")
+	}
+	if _, err := QuantizeInt8(path, filepath.Join(dir, "missing", "out.safetensors")); err == nil {
+		t.Error("Expected error for an unwritable output")
+	}
+}
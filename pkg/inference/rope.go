@@ -0,0 +1,115 @@
+package inference
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+)
+
+// RopeScaling configures how rotary embeddings are stretched to support
+// contexts longer than the model was trained on
+type RopeScaling struct {
+	RopeType                      string  `json:"rope_type"`
+	Type                          string  `json:"type"` // older name for RopeType
+	Factor                        float64 `json:"factor"`
+	LowFreqFactor                 float64 `json:"low_freq_factor"`
+	HighFreqFactor                float64 `json:"high_freq_factor"`
+	OriginalMaxPositionEmbeddings int     `json:"original_max_position_embeddings"`
+}
+
+// rotary holds the inverse frequencies of rotary position embeddings
+type rotary struct {
+	headDim int
+	invFreq []float64
+}
+
+// newRotary computes the frequencies for a head size, base theta and
+// optional scaling, following the Hugging Face implementations
+func newRotary(headDim int, theta float64, scaling *RopeScaling) (*rotary, error) {
+	if headDim%2 != 0 {
+		return nil, fmt.Errorf("rotary embeddings need an even head size, got %d", headDim)
+	}
+	r := &rotary{headDim: headDim, invFreq: make([]float64, headDim/2)}
+	for i := range r.invFreq {
+		r.invFreq[i] = 1 / math.Pow(theta, float64(2*i)/float64(headDim))
+	}
+	if scaling == nil {
+		return r, nil
+	}
+
+	kind := scaling.RopeType
+	if kind == "" {
+		kind = scaling.Type
+	}
+	switch kind {
+	case "", "default":
+	case "linear":
+		for i := range r.invFreq {
+			r.invFreq[i] /= scaling.Factor
+		}
+	case "llama3":
+		// Long wavelengths are scaled by factor, short ones are kept and
+		// those in between are interpolated smoothly
+		orig := float64(scaling.OriginalMaxPositionEmbeddings)
+		lowWavelen := orig / scaling.LowFreqFactor
+		highWavelen := orig / scaling.HighFreqFactor
+		for i, freq := range r.invFreq {
+			wavelen := 2 * math.Pi / freq
+			switch {
+			case wavelen < highWavelen:
+			case wavelen > lowWavelen:
+				r.invFreq[i] = freq / scaling.Factor
+			default:
+				smooth := (orig/wavelen - scaling.LowFreqFactor) / (scaling.HighFreqFactor - scaling.LowFreqFactor)
+				r.invFreq[i] = (1-smooth)*freq/scaling.Factor + smooth*freq
+			}
+		}
+	default:
+		return nil, fmt.Errorf("rope scaling type %q is %w", kind, errs.ErrNotImplemented)
+	}
+	return r, nil
+}
+
+// rotaryAngles holds the cosines and sines for a run of positions, one row
+// of headDim/2 values per position
+type rotaryAngles struct {
+	half     int
+	cos, sin []float32
+}
+
+// angles returns the rotation for n positions starting at start
+func (r *rotary) angles(start, n int) *rotaryAngles {
+	half := len(r.invFreq)
+	a := &rotaryAngles{half: half, cos: make([]float32, n*half), sin: make([]float32, n*half)}
+	for p := 0; p < n; p++ {
+		for i, freq := range r.invFreq {
+			angle := float64(start+p) * freq
+			a.cos[p*half+i] = float32(math.Cos(angle))
+			a.sin[p*half+i] = float32(math.Sin(angle))
+		}
+	}
+	return a
+}
+
+// apply rotates every head of x, which has shape [n, heads*headDim].
+// Dimension i of a head is rotated together with dimension i+headDim/2.
+func (a *rotaryAngles) apply(x *tensor.Tensor) *tensor.Tensor {
+	out := x.Clone()
+	data := out.Data()
+	n, width := x.Dim(0), x.Dim(1)
+	headDim := 2 * a.half
+	for p := 0; p < n; p++ {
+		cos, sin := a.cos[p*a.half:(p+1)*a.half], a.sin[p*a.half:(p+1)*a.half]
+		for h := p * width; h < (p+1)*width; h += headDim {
+			head := data[h : h+headDim]
+			for i := 0; i < a.half; i++ {
+				x0, x1 := head[i], head[i+a.half]
+				head[i] = x0*cos[i] - x1*sin[i]
+				head[i+a.half] = x1*cos[i] + x0*sin[i]
+			}
+		}
+	}
+	return out
+}
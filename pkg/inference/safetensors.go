@@ -0,0 +1,398 @@
+package inference
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kelleyblackmore/go-transformer/internal/mmap"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+)
+
+// DType is the element type of a stored tensor
+type DType string
+
+const (
+	DTypeF32  DType = "F32"
+	DTypeF16  DType = "F16"
+	DTypeBF16 DType = "BF16"
+	DTypeI8   DType = "I8"
+)
+
+// dtypeSizes holds the element size of every dtype safetensors defines
+var dtypeSizes = map[DType]int{
+	"BOOL": 1, "U8": 1, "I8": 1, "F8_E5M2": 1, "F8_E4M3": 1,
+	"I16": 2, "U16": 2, "F16": 2, "BF16": 2,
+	"I32": 4, "U32": 4, "F32": 4,
+	"I64": 8, "U64": 8, "F64": 8,
+}
+
+// maxSafeTensorsHeader bounds the JSON header so that a corrupt length
+// cannot trigger a huge allocation
+const maxSafeTensorsHeader = 100 << 20
+
+// TensorInfo describes a tensor stored in a safetensors file
+type TensorInfo struct {
+	Name  string `json:"name"`
+	DType DType  `json:"dtype"`
+	Shape []int  `json:"shape"`
+}
+
+// SafeTensors gives access to the tensors of a safetensors checkpoint,
+// which may be split into several shards. Files are memory-mapped where
+// the platform supports it and must be released with Close.
+type SafeTensors struct {
+	Metadata map[string]string
+
+	tensors map[string]*safeTensor
+	files   []*mmap.File
+	paths   []string
+}
+
+// safeTensor locates the data of a tensor within a file
+type safeTensor struct {
+	TensorInfo
+	begin uint64
+	data  []byte
+}
+
+// OpenSafeTensors opens a checkpoint. path may be a .safetensors file, a
+// model.safetensors.index.json file listing shards, or a directory
+// containing either.
+func OpenSafeTensors(path string) (*SafeTensors, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open safetensors checkpoint: %w", err)
+	}
+	if info.IsDir() {
+		single := filepath.Join(path, "model.safetensors")
+		if _, err := os.Stat(single); err == nil {
+			path = single
+		} else {
+			path = filepath.Join(path, "model.safetensors.index.json")
+		}
+	}
+
+	st := &SafeTensors{Metadata: make(map[string]string), tensors: make(map[string]*safeTensor)}
+	if strings.HasSuffix(path, ".index.json") {
+		err = st.loadIndex(path)
+	} else {
+		err = st.loadFile(path)
+	}
+	if err != nil {
+		st.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// loadIndex opens every shard listed in a model.safetensors.index.json file
+func (st *SafeTensors) loadIndex(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read safetensors index: %w", err)
+	}
+	var index struct {
+		Metadata  map[string]json.RawMessage `json:"metadata"`
+		WeightMap map[string]string          `json:"weight_map"`
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("failed to parse safetensors index %s: %w", path, err)
+	}
+	if len(index.WeightMap) == 0 {
+		return fmt.Errorf("safetensors index %s has an empty weight map", path)
+	}
+	for k, v := range index.Metadata {
+		// Values such as total_size are numbers; keep them as written
+		var s string
+		if json.Unmarshal(v, &s) != nil {
+			s = string(v)
+		}
+		st.Metadata[k] = s
+	}
+
+	shards := make(map[string][]string)
+	for name, shard := range index.WeightMap {
+		if filepath.Base(shard) != shard {
+			return fmt.Errorf("safetensors index %s: shard %q must be a file name", path, shard)
+		}
+		shards[shard] = append(shards[shard], name)
+	}
+	names := make([]string, 0, len(shards))
+	for shard := range shards {
+		names = append(names, shard)
+	}
+	sort.Strings(names)
+
+	dir := filepath.Dir(path)
+	for _, shard := range names {
+		if err := st.loadFile(filepath.Join(dir, shard)); err != nil {
+			return err
+		}
+		for _, name := range shards[shard] {
+			if _, ok := st.tensors[name]; !ok {
+				return fmt.Errorf("safetensors index %s: tensor %q is missing from %s", path, name, shard)
+			}
+		}
+	}
+	return nil
+}
+
+// loadFile maps a single .safetensors file and validates its header
+func (st *SafeTensors) loadFile(path string) error {
+	mf, err := mmap.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open safetensors file: %w", err)
+	}
+	st.files = append(st.files, mf)
+	st.paths = append(st.paths, path)
+
+	tensors, metadata, err := parseSafeTensorsHeader(mf.Data())
+	if err != nil {
+		return fmt.Errorf("invalid safetensors file %s: %w", path, err)
+	}
+	for k, v := range metadata {
+		st.Metadata[k] = v
+	}
+	for _, t := range tensors {
+		if _, exists := st.tensors[t.Name]; exists {
+			return fmt.Errorf("invalid safetensors file %s: tensor %q is defined in several files", path, t.Name)
+		}
+		st.tensors[t.Name] = t
+	}
+	return nil
+}
+
+// headerEntry describes a tensor in a safetensors header
+type headerEntry struct {
+	DType       DType     `json:"dtype"`
+	Shape       []int     `json:"shape"`
+	DataOffsets [2]uint64 `json:"data_offsets"`
+}
+
+// shapeBytes returns the number of bytes of a tensor of the given shape with
+// elements of size bytes, failing when a dimension is negative or the size
+// does not fit in an int
+func shapeBytes(shape []int, size int) (int, error) {
+	n := uint64(size)
+	for _, d := range shape {
+		if d < 0 {
+			return 0, fmt.Errorf("has negative dimension in shape %v", shape)
+		}
+		hi, lo := bits.Mul64(n, uint64(d))
+		if hi != 0 || lo > math.MaxInt {
+			return 0, fmt.Errorf("has shape %v too large to address", shape)
+		}
+		n = lo
+	}
+	return int(n), nil
+}
+
+// parseSafeTensorsHeader decodes the header of a safetensors file: an
+// 8-byte little-endian length followed by a JSON object mapping tensor names
+// to their dtype, shape and byte range within the data that follows
+func parseSafeTensorsHeader(file []byte) ([]*safeTensor, map[string]string, error) {
+	if len(file) < 8 {
+		return nil, nil, errors.New("file is too short to hold a header")
+	}
+	n := binary.LittleEndian.Uint64(file)
+	if n > maxSafeTensorsHeader || n > uint64(len(file)-8) {
+		return nil, nil, fmt.Errorf("header length %d exceeds the file size", n)
+	}
+	data := file[8+n:]
+
+	var header map[string]json.RawMessage
+	if err := json.Unmarshal(file[8:8+n], &header); err != nil {
+		return nil, nil, fmt.Errorf("malformed header: %w", err)
+	}
+
+	var metadata map[string]string
+	var tensors []*safeTensor
+	for name, raw := range header {
+		if name == "__metadata__" {
+			if err := json.Unmarshal(raw, &metadata); err != nil {
+				return nil, nil, fmt.Errorf("malformed metadata: %w", err)
+			}
+			continue
+		}
+
+		var entry headerEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, nil, fmt.Errorf("malformed entry for tensor %q: %w", name, err)
+		}
+		size, ok := dtypeSizes[entry.DType]
+		if !ok {
+			return nil, nil, fmt.Errorf("tensor %q has unknown dtype %q", name, entry.DType)
+		}
+		nbytes, err := shapeBytes(entry.Shape, size)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tensor %q %w", name, err)
+		}
+
+		begin, end := entry.DataOffsets[0], entry.DataOffsets[1]
+		if begin > end || end > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("tensor %q has data offsets [%d, %d] outside the %d data bytes", name, begin, end, len(data))
+		}
+		if end-begin != uint64(nbytes) {
+			return nil, nil, fmt.Errorf("tensor %q has %d bytes but shape %v of %s needs %d", name, end-begin, entry.Shape, entry.DType, nbytes)
+		}
+		tensors = append(tensors, &safeTensor{
+			TensorInfo: TensorInfo{Name: name, DType: entry.DType, Shape: entry.Shape},
+			begin:      begin,
+			data:       data[begin:end:end],
+		})
+	}
+
+	// Tensors must not overlap
+	sort.Slice(tensors, func(i, j int) bool { return tensors[i].begin < tensors[j].begin })
+	for i := 1; i < len(tensors); i++ {
+		prev, cur := tensors[i-1], tensors[i]
+		if prev.begin+uint64(len(prev.data)) > cur.begin {
+			return nil, nil, fmt.Errorf("tensors %q and %q overlap", prev.Name, cur.Name)
+		}
+	}
+	return tensors, metadata, nil
+}
+
+// Names returns the names of all tensors in sorted order
+func (st *SafeTensors) Names() []string {
+	names := make([]string, 0, len(st.tensors))
+	for name := range st.tensors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Info returns the dtype and shape of a tensor
+func (st *SafeTensors) Info(name string) (TensorInfo, bool) {
+	t, ok := st.tensors[name]
+	if !ok {
+		return TensorInfo{}, false
+	}
+	return t.TensorInfo, true
+}
+
+// Raw returns the stored bytes of a tensor. The slice aliases the mapped
+// file and is only valid until Close.
+func (st *SafeTensors) Raw(name string) ([]byte, TensorInfo, error) {
+	t, ok := st.tensors[name]
+	if !ok {
+		return nil, TensorInfo{}, fmt.Errorf("tensor %q not found in checkpoint", name)
+	}
+	return t.data, t.TensorInfo, nil
+}
+
+// Tensor loads a tensor, converting F16, BF16 and I8 values to float32.
+// The result is a copy that remains valid after Close.
+func (st *SafeTensors) Tensor(name string) (*tensor.Tensor, error) {
+	t, ok := st.tensors[name]
+	if !ok {
+		return nil, fmt.Errorf("tensor %q not found in checkpoint", name)
+	}
+
+	src := t.data
+	var values []float32
+	switch t.DType {
+	case DTypeF32:
+		values = make([]float32, len(src)/4)
+		for i := range values {
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(src[4*i:]))
+		}
+	case DTypeF16:
+		values = make([]float32, len(src)/2)
+		for i := range values {
+			values[i] = tensor.Float16ToFloat32(binary.LittleEndian.Uint16(src[2*i:]))
+		}
+	case DTypeBF16:
+		values = make([]float32, len(src)/2)
+		for i := range values {
+			values[i] = tensor.BFloat16ToFloat32(binary.LittleEndian.Uint16(src[2*i:]))
+		}
+	case DTypeI8:
+		values = make([]float32, len(src))
+		for i, b := range src {
+			values[i] = float32(int8(b))
+		}
+	default:
+		return nil, fmt.Errorf("tensor %q has dtype %s, which cannot be converted to float32", name, t.DType)
+	}
+	return tensor.New(values, t.Shape...), nil
+}
+
+// TensorData is a tensor to be written by WriteSafeTensors
+type TensorData struct {
+	TensorInfo
+	Data []byte
+}
+
+// WriteSafeTensors writes tensors in the safetensors format, storing their
+// data in the order given
+func WriteSafeTensors(w io.Writer, metadata map[string]string, tensors []TensorData) error {
+	header := make(map[string]any, len(tensors)+1)
+	if len(metadata) > 0 {
+		header["__metadata__"] = metadata
+	}
+	var offset uint64
+	for _, t := range tensors {
+		size, ok := dtypeSizes[t.DType]
+		if !ok {
+			return fmt.Errorf("tensor %q has unknown dtype %q", t.Name, t.DType)
+		}
+		nbytes, err := shapeBytes(t.Shape, size)
+		if err != nil {
+			return fmt.Errorf("tensor %q %w", t.Name, err)
+		}
+		if len(t.Data) != nbytes {
+			return fmt.Errorf("tensor %q has %d bytes but shape %v of %s needs %d", t.Name, len(t.Data), t.Shape, t.DType, nbytes)
+		}
+		if _, dup := header[t.Name]; dup {
+			return fmt.Errorf("duplicate tensor %q", t.Name)
+		}
+		shape := append([]int{}, t.Shape...)
+		header[t.Name] = headerEntry{DType: t.DType, Shape: shape, DataOffsets: [2]uint64{offset, offset + uint64(len(t.Data))}}
+		offset += uint64(len(t.Data))
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("failed to encode header: %w", err)
+	}
+	// Pad with spaces so that the data starts 8-byte aligned
+	for len(h)%8 != 0 {
+		h = append(h, ' ')
+	}
+	if _, err := w.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(h)))); err != nil {
+		return err
+	}
+	if _, err := w.Write(h); err != nil {
+		return err
+	}
+	for _, t := range tensors {
+		if _, err := w.Write(t.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the mapped files
+func (st *SafeTensors) Close() error {
+	var errs []error
+	for _, f := range st.files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	st.files = nil
+	st.tensors = nil
+	return errors.Join(errs...)
+}
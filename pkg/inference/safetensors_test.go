@@ -0,0 +1,283 @@
+package inference
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+)
+
+// rawTensor is a tensor to store in a test safetensors file
+type rawTensor struct {
+	name  string
+	dtype DType
+	shape []int
+	data  []byte
+}
+
+func f32Bytes(values ...float32) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(v))
+	}
+	return b
+}
+
+func u16Bytes(values ...uint16) []byte {
+	b := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint16(b[2*i:], v)
+	}
+	return b
+}
+
+// encodeSafeTensors lays out tensors back to back after the header
+func encodeSafeTensors(t *testing.T, metadata map[string]string, tensors ...rawTensor) []byte {
+	t.Helper()
+	header := make(map[string]any)
+	if metadata != nil {
+		header["__metadata__"] = metadata
+	}
+	var data []byte
+	for _, rt := range tensors {
+		header[rt.name] = map[string]any{
+			"dtype":        rt.dtype,
+			"shape":        rt.shape,
+			"data_offsets": []int{len(data), len(data) + len(rt.data)},
+		}
+		data = append(data, rt.data...)
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := binary.LittleEndian.AppendUint64(nil, uint64(len(h)))
+	out = append(out, h...)
+	return append(out, data...)
+}
+
+func writeFile(t *testing.T, path string, data []byte) string {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenSafeTensors(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, filepath.Join(dir, "model.safetensors"), encodeSafeTensors(t,
+		map[string]string{"format": "pt"},
+		rawTensor{"f32", DTypeF32, []int{2, 2}, f32Bytes(1, 2, 3, 4)},
+		rawTensor{"f16", DTypeF16, []int{3}, u16Bytes(0x3C00, 0xC000, 0x3800)},
+		rawTensor{"bf16", DTypeBF16, []int{2}, u16Bytes(0x3FC0, 0xBF80)},
+		rawTensor{"i8", DTypeI8, []int{1, 3}, []byte{0x7F, 0x80, 0x05}},
+		rawTensor{"i32", "I32", []int{1}, []byte{1, 0, 0, 0}},
+	))
+
+	// Opening the directory finds model.safetensors
+	for _, p := range []string{path, dir} {
+		st, err := OpenSafeTensors(p)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer st.Close()
+
+		if got := strings.Join(st.Names(), ","); got != "bf16,f16,f32,i32,i8" {
+			t.Errorf("Expected sorted names, got %s", got)
+		}
+		if st.Metadata["format"] != "pt" {
+			t.Errorf("Expected format metadata 'pt', got %q", st.Metadata["format"])
+		}
+	}
+
+	st, err := OpenSafeTensors(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer st.Close()
+
+	tests := []struct {
+		name  string
+		shape []int
+		want  []float32
+	}{
+		{"f32", []int{2, 2}, []float32{1, 2, 3, 4}},
+		{"f16", []int{3}, []float32{1, -2, 0.5}},
+		{"bf16", []int{2}, []float32{1.5, -1}},
+		{"i8", []int{1, 3}, []float32{127, -128, 5}},
+	}
+	for _, tt := range tests {
+		x, err := st.Tensor(tt.name)
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+			continue
+		}
+		if !equalInts(x.Shape(), tt.shape) {
+			t.Errorf("%s: expected shape %v, got %v", tt.name, tt.shape, x.Shape())
+		}
+		for i, v := range x.Data() {
+			if v != tt.want[i] {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, x.Data())
+				break
+			}
+		}
+	}
+
+	if info, ok := st.Info("i8"); !ok || info.DType != DTypeI8 {
+		t.Errorf("Expected I8 info, got %+v", info)
+	}
+	if raw, _, err := st.Raw("i8"); err != nil || len(raw) != 3 {
+		t.Errorf("Expected 3 raw bytes, got %v (%v)", raw, err)
+	}
+	if _, err := st.Tensor("i32"); err == nil || !strings.Contains(err.Error(), "I32") {
+		t.Errorf("Expected dtype conversion error, got %v", err)
+	}
+	if _, err := st.Tensor("missing"); err == nil {
+		t.Error("Expected error for missing tensor")
+	}
+}
+
+func TestWriteSafeTensors(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteSafeTensors(&buf, map[string]string{"format": "pt"}, []TensorData{
+		{TensorInfo{Name: "b", DType: DTypeF32, Shape: []int{2}}, f32Bytes(1, 2)},
+		{TensorInfo{Name: "a", DType: DTypeI8, Shape: []int{1, 3}}, []byte{1, 0xFF, 3}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if n := binary.LittleEndian.Uint64(buf.Bytes()); n%8 != 0 {
+		t.Errorf("Expected the header length to be a multiple of 8, got %d", n)
+	}
+
+	st, err := OpenSafeTensors(writeFile(t, filepath.Join(t.TempDir(), "model.safetensors"), buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer st.Close()
+	if st.Metadata["format"] != "pt" {
+		t.Errorf("Expected format metadata, got %v", st.Metadata)
+	}
+	if a, err := st.Tensor("a"); err != nil || !reflect.DeepEqual(a.Data(), []float32{1, -1, 3}) {
+		t.Errorf("Expected [1 -1 3], got %v (%v)", a, err)
+	}
+	if b, err := st.Tensor("b"); err != nil || !reflect.DeepEqual(b.Data(), []float32{1, 2}) {
+		t.Errorf("Expected [1 2], got %v (%v)", b, err)
+	}
+
+	err = WriteSafeTensors(io.Discard, nil, []TensorData{{TensorInfo{Name: "w", DType: DTypeF32, Shape: []int{3}}, f32Bytes(1)}})
+	if err == nil {
+		t.Error("Expected error for data that does not match the shape")
+	}
+	err = WriteSafeTensors(io.Discard, nil, []TensorData{{TensorInfo{Name: "w", DType: DTypeF32, Shape: []int{1 << 62, 1}}, nil}})
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Expected error for a shape too large to address, got %v", err)
+	}
+}
+
+func TestOpenSafeTensorsSharded(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "model-00001-of-00002.safetensors"), encodeSafeTensors(t, nil,
+		rawTensor{"embed.weight", DTypeF32, []int{2}, f32Bytes(1, 2)},
+	))
+	writeFile(t, filepath.Join(dir, "model-00002-of-00002.safetensors"), encodeSafeTensors(t, nil,
+		rawTensor{"head.weight", DTypeF32, []int{1}, f32Bytes(3)},
+	))
+	writeFile(t, filepath.Join(dir, "model.safetensors.index.json"), []byte(`{
+		"metadata": {"total_size": 12},
+		"weight_map": {
+			"embed.weight": "model-00001-of-00002.safetensors",
+			"head.weight": "model-00002-of-00002.safetensors"
+		}
+	}`))
+
+	st, err := OpenSafeTensors(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer st.Close()
+
+	if st.Metadata["total_size"] != "12" {
+		t.Errorf("Expected total_size 12, got %q", st.Metadata["total_size"])
+	}
+	head, err := st.Tensor("head.weight")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if head.Item() != 3 {
+		t.Errorf("Expected 3, got %v", head.Item())
+	}
+
+	// A weight map entry that its shard does not contain is an error
+	writeFile(t, filepath.Join(dir, "model.safetensors.index.json"), []byte(`{
+		"weight_map": {"lm_head.weight": "model-00002-of-00002.safetensors"}
+	}`))
+	if _, err := OpenSafeTensors(dir); err == nil || !strings.Contains(err.Error(), "lm_head.weight") {
+		t.Errorf("Expected missing tensor error, got %v", err)
+	}
+}
+
+func TestOpenSafeTensorsCorrupt(t *testing.T) {
+	valid := encodeSafeTensors(t, nil, rawTensor{"w", DTypeF32, []int{2}, f32Bytes(1, 2)})
+	header := func(h string, data int) []byte {
+		out := binary.LittleEndian.AppendUint64(nil, uint64(len(h)))
+		out = append(out, h...)
+		return append(out, make([]byte, data)...)
+	}
+
+	tests := []struct {
+		name string
+		file []byte
+		want string
+	}{
+		{"short", []byte{1, 2, 3}, "too short"},
+		{"header length", binary.LittleEndian.AppendUint64(nil, 1<<40), "exceeds the file size"},
+		{"truncated", valid[:len(valid)-1], "outside the 7 data bytes"},
+		{"json", header(`{"w": [}`, 0), "malformed header"},
+		{"dtype", header(`{"w": {"dtype": "F128", "shape": [1], "data_offsets": [0, 16]}}`, 16), "unknown dtype"},
+		{"shape", header(`{"w": {"dtype": "F32", "shape": [3], "data_offsets": [0, 8]}}`, 8), "needs 12"},
+		{"negative", header(`{"w": {"dtype": "F32", "shape": [-1], "data_offsets": [0, 4]}}`, 4), "negative dimension"},
+		{"overflow", header(`{"w": {"dtype": "F32", "shape": [4611686018427387904, 1], "data_offsets": [0, 0]}}`, 0), "too large"},
+		{"reversed", header(`{"w": {"dtype": "F32", "shape": [0], "data_offsets": [4, 0]}}`, 4), "outside"},
+		{"overlap", header(`{"a": {"dtype": "F32", "shape": [2], "data_offsets": [0, 8]},
+			"b": {"dtype": "F32", "shape": [1], "data_offsets": [4, 8]}}`, 8), "overlap"},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := writeFile(t, filepath.Join(dir, tt.name+".safetensors"), tt.file)
+		_, err := OpenSafeTensors(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestSafeTensorsTensorOutlivesClose(t *testing.T) {
+	path := writeFile(t, filepath.Join(t.TempDir(), "w.safetensors"), encodeSafeTensors(t, nil,
+		rawTensor{"w", DTypeF32, []int{2}, f32Bytes(5, 6)},
+	))
+	st, err := OpenSafeTensors(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	w, err := st.Tensor("w")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := st.Close(); err != nil {
+		t.Errorf("Expected no error closing, got %v", err)
+	}
+	if got := tensor.Add(w, w).Data(); got[0] != 10 || got[1] != 12 {
+		t.Errorf("Expected [10 12], got %v", got)
+	}
+}
@@ -0,0 +1,176 @@
+package inference
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// defaultTopK matches the Hugging Face default used when sampling
+const defaultTopK = 50
+
+// sampler chooses the next token from a row of logits. The repetition
+// penalty is applied first. Without sampling the most likely token is then
+// chosen; otherwise temperature, top-k and top-p filtering are applied in
+// that order, as Hugging Face does.
+type sampler struct {
+	doSample          bool
+	temperature       float64
+	topK              int
+	topP              float64
+	repetitionPenalty float64
+	rng               *rand.Rand
+}
+
+// penalize returns logits with the repetition penalty applied to the tokens
+// of the prompt and those generated so far, dividing positive logits by it
+// and multiplying negative ones, as in the CTRL paper. logits is returned
+// unchanged when there is no penalty.
+func (s *sampler) penalize(logits []float32, prompt, generated []int) []float32 {
+	if s.repetitionPenalty <= 0 || s.repetitionPenalty == 1 {
+		return logits
+	}
+	penalized := append([]float32{}, logits...)
+	done := make(map[int]bool, len(prompt)+len(generated))
+	for _, ids := range [][]int{prompt, generated} {
+		for _, id := range ids {
+			if done[id] || id < 0 || id >= len(logits) {
+				continue
+			}
+			done[id] = true
+			if l := penalized[id]; l > 0 {
+				penalized[id] = l / float32(s.repetitionPenalty)
+			} else {
+				penalized[id] = l * float32(s.repetitionPenalty)
+			}
+		}
+	}
+	return penalized
+}
+
+// candidate is a token that may be sampled, with its scaled logit
+type candidate struct {
+	id    int
+	logit float64
+}
+
+// before orders candidates most likely first, breaking ties by token ID
+func (c candidate) before(o candidate) bool {
+	return c.logit > o.logit || c.logit == o.logit && c.id < o.id
+}
+
+// next returns the chosen token
+func (s *sampler) next(logits []float32) int {
+	if !s.doSample {
+		return argmax(logits)
+	}
+
+	temperature := s.temperature
+	if temperature <= 0 {
+		temperature = 1
+	}
+	candidates := make([]candidate, len(logits))
+	for i, l := range logits {
+		candidates[i] = candidate{i, float64(l) / temperature}
+	}
+	// Only the kept candidates need ordering, and only when top-p reads
+	// them in order
+	topP := s.topP > 0 && s.topP < 1
+	if s.topK > 0 && s.topK < len(candidates) {
+		candidates = selectTop(candidates, s.topK)
+	}
+	if topP {
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].before(candidates[j]) })
+	}
+
+	maxLogit := math.Inf(-1)
+	for _, c := range candidates {
+		maxLogit = math.Max(maxLogit, c.logit)
+	}
+	probs := make([]float64, len(candidates))
+	var sum float64
+	for i, c := range candidates {
+		probs[i] = math.Exp(c.logit - maxLogit)
+		sum += probs[i]
+	}
+
+	// Keep the smallest prefix whose probability reaches top-p, always
+	// keeping at least one token
+	if topP {
+		var cum float64
+		for i, p := range probs {
+			cum += p / sum
+			if cum >= s.topP {
+				probs = probs[:i+1]
+				break
+			}
+		}
+		sum = 0
+		for _, p := range probs {
+			sum += p
+		}
+	}
+
+	r := s.rng.Float64() * sum
+	for i, p := range probs {
+		r -= p
+		if r < 0 {
+			return candidates[i].id
+		}
+	}
+	return candidates[len(probs)-1].id
+}
+
+// selectTop returns the k most likely candidates, in no particular order,
+// keeping them in a min-heap so that the vocabulary is scanned only once
+func selectTop(candidates []candidate, k int) []candidate {
+	top := append([]candidate{}, candidates[:k]...)
+	for i := k/2 - 1; i >= 0; i-- {
+		siftDown(top, i)
+	}
+	for _, c := range candidates[k:] {
+		if c.before(top[0]) {
+			top[0] = c
+			siftDown(top, 0)
+		}
+	}
+	return top
+}
+
+// siftDown restores the min-heap order of h, least likely first, below i
+func siftDown(h []candidate, i int) {
+	for {
+		least := i
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(h) && h[least].before(h[child]) {
+				least = child
+			}
+		}
+		if least == i {
+			return
+		}
+		h[i], h[least] = h[least], h[i]
+		i = least
+	}
+}
+
+// argmax returns the index of the largest value
+func argmax(values []float32) int {
+	best := 0
+	for i, v := range values {
+		if v > values[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// logSoftmax returns the log-probability of index i under softmax(logits)
+func logSoftmax(logits []float32, i int) float64 {
+	m := logits[argmax(logits)]
+	var sum float64
+	for _, l := range logits {
+		sum += math.Exp(float64(l - m))
+	}
+	return float64(logits[i]-m) - math.Log(sum)
+}
@@ -13,6 +13,7 @@ const (
 	TaskFillMask            Task = "fill-mask"
 	TaskSummarization       Task = "summarization"
 	TaskTranslation         Task = "translation"
+	TaskFeatureExtraction   Task = "feature-extraction"
 )
 
 // Model represents a transformer model interface
@@ -20,9 +21,17 @@ type Model interface {
 	// Classify performs text classification
 	Classify(ctx context.Context, text string) (*ClassificationResult, error)
 
-	// Generate performs text generation
+	// Generate performs text generation. When options.NumReturn asks for
+	// several sequences, every backend returns the first of them, the one
+	// GenerateAll lists first; use GenerateAll to compare their scores.
 	Generate(ctx context.Context, prompt string, options *GenerationOptions) (*GenerationResult, error)
 
+	// GenerateStream performs text generation, sending each token on the
+	// returned channel as soon as it is generated. The channel is closed
+	// after the last token, which carries the Details of the generation or,
+	// if it failed, an Err. Callers that stop reading early must cancel ctx.
+	GenerateStream(ctx context.Context, prompt string, options *GenerationOptions) (<-chan Token, error)
+
 	// GetModelInfo returns information about the model
 	GetModelInfo() *ModelInfo
 }
@@ -33,6 +42,119 @@ type ClassificationResult struct {
 	Score float64 `json:"score"`
 }
 
+// Score functions turning classification logits into scores
+const (
+	FunctionSoftmax = "softmax" // scores of all labels sum to one
+	FunctionSigmoid = "sigmoid" // each label is scored independently
+	FunctionNone    = "none"    // raw logits
+)
+
+// ClassificationOptions configures ClassifyAll
+type ClassificationOptions struct {
+	// TopK limits the results to the k best labels. Zero returns every
+	// label.
+	TopK int `json:"top_k,omitempty"`
+
+	// FunctionToApply is FunctionSoftmax, FunctionSigmoid or FunctionNone.
+	// When empty, it is sigmoid for multi-label and single-logit models and
+	// softmax otherwise.
+	FunctionToApply string `json:"function_to_apply,omitempty"`
+
+	// Threshold drops labels scoring below it, which turns sigmoid scores
+	// into multi-label predictions. Zero keeps every label.
+	Threshold float64 `json:"threshold,omitempty"`
+}
+
+// Classifier is implemented by models that can score every label of a text
+// classification, not just the most likely one
+type Classifier interface {
+	// ClassifyAll returns the scores of the labels for text, best first
+	ClassifyAll(ctx context.Context, text string, options *ClassificationOptions) ([]ClassificationResult, error)
+}
+
+// Aggregation strategies grouping the tokens of a token classification
+// into entities
+const (
+	AggregationNone    = "none"    // one entity per token, labelled with its full tag
+	AggregationSimple  = "simple"  // merge B-/I-/E-/S- tagged tokens into entities
+	AggregationFirst   = "first"   // label each word by its first token, then merge
+	AggregationAverage = "average" // label each word by its averaged token scores, then merge
+	AggregationMax     = "max"     // label each word by its highest scoring token, then merge
+)
+
+// TokenClassifier is implemented by models that can label the tokens of a
+// text, as in named entity recognition
+type TokenClassifier interface {
+	// ClassifyTokens returns the entities of text in order
+	ClassifyTokens(ctx context.Context, text string, options *TokenClassificationOptions) ([]Entity, error)
+}
+
+// TokenClassificationOptions configures ClassifyTokens
+type TokenClassificationOptions struct {
+	// AggregationStrategy is one of the Aggregation constants. It defaults
+	// to AggregationNone.
+	AggregationStrategy string `json:"aggregation_strategy,omitempty"`
+
+	// IgnoreLabels are left out of the results. When nil, "O" is ignored.
+	IgnoreLabels []string `json:"ignore_labels,omitempty"`
+}
+
+// Entity is a labelled span of a text. Without aggregation it is a single
+// token labelled with its full tag, such as "B-PER"; otherwise it is a
+// merged span labelled with the tag's entity type, such as "PER".
+type Entity struct {
+	Label string  `json:"label"`
+	Score float64 `json:"score"`
+	Word  string  `json:"word"`
+	Start int     `json:"start"` // character offset of the entity in the text
+	End   int     `json:"end"`   // character offset just past the entity
+}
+
+// Embedder is implemented by models that can turn texts into embedding
+// vectors, as used for semantic search and clustering
+type Embedder interface {
+	// Embed returns one vector per text, in the order of texts
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// QuestionAnswerer is implemented by models that can extract the answer to a
+// question from a passage of text
+type QuestionAnswerer interface {
+	// Answer returns the span of passage that best answers question
+	Answer(ctx context.Context, question, passage string, options *QuestionAnsweringOptions) (*QuestionAnswer, error)
+}
+
+// QuestionAnsweringOptions configures question answering. Zero values use
+// the Hugging Face defaults.
+type QuestionAnsweringOptions struct {
+	// MaxAnswerLength limits answers to this many tokens. It defaults to 15.
+	MaxAnswerLength int `json:"max_answer_len,omitempty"`
+
+	// MaxSeqLength is the number of tokens of each window the question and
+	// a piece of a long passage are fed to the model in. It defaults to 384,
+	// or the model maximum if that is smaller.
+	MaxSeqLength int `json:"max_seq_len,omitempty"`
+
+	// DocStride is the number of passage tokens consecutive windows share.
+	// It defaults to 128, or less if the windows are too short for it.
+	DocStride int `json:"doc_stride,omitempty"`
+}
+
+// QuestionAnswer is an answer extracted from a passage
+type QuestionAnswer struct {
+	Answer string  `json:"answer"`
+	Score  float64 `json:"score"`
+	Start  int     `json:"start"` // character offset of the answer in the passage
+	End    int     `json:"end"`   // character offset just past the answer
+}
+
+// MultiGenerator is implemented by models that can return every sequence of
+// a generation, not just the first or most likely one
+type MultiGenerator interface {
+	// GenerateAll returns options.NumReturn sequences for prompt
+	GenerateAll(ctx context.Context, prompt string, options *GenerationOptions) ([]GenerationResult, error)
+}
+
 // GenerationOptions configures text generation parameters
 type GenerationOptions struct {
 	MaxLength   int     `json:"max_length,omitempty"`
@@ -41,13 +163,92 @@ type GenerationOptions struct {
 	TopK        int     `json:"top_k,omitempty"`
 	DoSample    bool    `json:"do_sample,omitempty"`
 	NumReturn   int     `json:"num_return_sequences,omitempty"`
-	Stream      bool    `json:"stream,omitempty"`
+
+	// Deprecated: Stream is ignored by Generate. Use GenerateStream to
+	// receive tokens as they are generated.
+	Stream bool `json:"stream,omitempty"`
+
+	// MaxNewTokens limits the number of generated tokens, not counting the
+	// prompt. It takes precedence over MaxLength.
+	MaxNewTokens int `json:"max_new_tokens,omitempty"`
+
+	// RepetitionPenalty above 1 makes tokens already in the text less
+	// likely to be chosen again
+	RepetitionPenalty float64 `json:"repetition_penalty,omitempty"`
+
+	// ReturnFullText selects whether GeneratedText starts with the prompt.
+	// It does when nil.
+	ReturnFullText *bool `json:"return_full_text,omitempty"`
+
+	// Stop ends generation once the generated text contains any of these
+	// sequences, which are kept in the text
+	Stop []string `json:"stop,omitempty"`
+
+	// Seed makes sampling reproducible when set
+	Seed *int64 `json:"seed,omitempty"`
+
+	// TypicalP restricts sampling to the locally typical tokens whose
+	// probabilities add up to TypicalP. Hugging Face API only.
+	TypicalP float64 `json:"typical_p,omitempty"`
+
+	// Truncate keeps only the last Truncate tokens of the prompt. Hugging
+	// Face API only.
+	Truncate int `json:"truncate,omitempty"`
+
+	// Details asks the Hugging Face API for the reason each sequence
+	// finished and for the other best_of sequences. Only
+	// text-generation-inference deployments accept it. It is implied by
+	// Stop, and local models always report the finish reason.
+	Details bool `json:"details,omitempty"`
+
+	// UseCache lets the Hugging Face API answer from its cache of previous
+	// identical requests. It does when nil.
+	UseCache *bool `json:"use_cache,omitempty"`
+
+	// WaitForModel asks the Hugging Face API to hold the request until a
+	// cold model has loaded instead of answering 503
+	WaitForModel bool `json:"wait_for_model,omitempty"`
 }
 
 // GenerationResult represents the result of text generation
 type GenerationResult struct {
 	GeneratedText string  `json:"generated_text"`
 	Score         float64 `json:"score,omitempty"`
+
+	// FinishReason is one of the Finish constants. The Hugging Face API
+	// only reports it when GenerationOptions.Details or Stop is set, and
+	// leaves it empty otherwise.
+	FinishReason string `json:"finish_reason,omitempty"`
+}
+
+// Reasons a generation finished
+const (
+	FinishLength       = "length"        // the maximum length was reached
+	FinishEOSToken     = "eos_token"     // the model produced an end of sequence token
+	FinishStopSequence = "stop_sequence" // the text reached a stop sequence
+)
+
+// Token is one token of a generation stream
+type Token struct {
+	ID      int     `json:"id"`
+	Text    string  `json:"text"`
+	Logprob float64 `json:"logprob"`
+	Special bool    `json:"special,omitempty"`
+
+	// Details is set on the last token of a stream that completed
+	Details *GenerationDetails `json:"details,omitempty"`
+
+	// Err is set on the last token of a stream that failed, in which case
+	// the other fields are empty
+	Err error `json:"-"`
+}
+
+// GenerationDetails summarizes a finished generation
+type GenerationDetails struct {
+	// GeneratedText is the text generated after the prompt
+	GeneratedText   string `json:"generated_text"`
+	FinishReason    string `json:"finish_reason"`
+	GeneratedTokens int    `json:"generated_tokens"`
 }
 
 // ModelInfo contains metadata about a model
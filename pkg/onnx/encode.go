@@ -0,0 +1,194 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/kelleyblackmore/go-transformer/internal/protowire"
+)
+
+// Marshal encodes the model in the ONNX protobuf format. Tensors are
+// written as raw data in their storage type, so a float16 initializer that
+// was loaded as float32 is saved as float32.
+func (m *Model) Marshal() []byte {
+	var b []byte
+	b = appendInt(b, 1, m.IRVersion)
+	b = appendString(b, 2, m.ProducerName)
+	b = appendString(b, 3, m.ProducerVersion)
+	if m.Graph != nil {
+		b = appendField(b, 7, m.Graph.marshal())
+	}
+	for _, domain := range sortedKeys(m.OpsetImports) {
+		var op []byte
+		op = appendString(op, 1, domain)
+		op = appendInt(op, 2, m.OpsetImports[domain])
+		b = appendField(b, 8, op)
+	}
+	for _, k := range sortedKeys(m.Metadata) {
+		b = appendField(b, 14, appendString(appendString(nil, 1, k), 2, m.Metadata[k]))
+	}
+	return b
+}
+
+func (g *Graph) marshal() []byte {
+	var b []byte
+	for _, n := range g.Nodes {
+		b = appendField(b, 1, n.marshal())
+	}
+	b = appendString(b, 2, g.Name)
+	for _, name := range sortedKeys(g.Initializers) {
+		b = appendField(b, 5, g.Initializers[name].marshal(name))
+	}
+	for _, vi := range g.Inputs {
+		b = appendField(b, 11, vi.marshal())
+	}
+	for _, vi := range g.Outputs {
+		b = appendField(b, 12, vi.marshal())
+	}
+	return b
+}
+
+func (n *Node) marshal() []byte {
+	var b []byte
+	for _, name := range n.Inputs {
+		b = appendField(b, 1, []byte(name))
+	}
+	for _, name := range n.Outputs {
+		b = appendField(b, 2, []byte(name))
+	}
+	b = appendString(b, 3, n.Name)
+	b = appendString(b, 4, n.OpType)
+	for _, name := range sortedKeys(n.Attributes) {
+		a := *n.Attributes[name]
+		a.Name = name
+		b = appendField(b, 5, a.marshal())
+	}
+	return appendString(b, 7, n.Domain)
+}
+
+func (a *Attribute) marshal() []byte {
+	b := appendString(nil, 1, a.Name)
+	switch a.Type {
+	case AttributeFloat:
+		b = protowire.AppendTag(b, 2, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(a.Float))
+	case AttributeInt:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(a.Int))
+	case AttributeString:
+		b = appendField(b, 4, []byte(a.String))
+	case AttributeTensor:
+		b = appendField(b, 5, a.Tensor.marshal(""))
+	case AttributeGraph:
+		b = appendField(b, 6, a.Graph.marshal())
+	case AttributeFloats:
+		var packed []byte
+		for _, f := range a.Floats {
+			packed = protowire.AppendFixed32(packed, math.Float32bits(f))
+		}
+		b = appendField(b, 7, packed)
+	case AttributeInts:
+		b = appendField(b, 8, packVarints(a.Ints))
+	case AttributeStrings:
+		for _, s := range a.Strings {
+			b = appendField(b, 9, []byte(s))
+		}
+	}
+	return appendInt(b, 20, int64(a.Type))
+}
+
+func (vi ValueInfo) marshal() []byte {
+	var shape []byte
+	for _, d := range vi.Shape {
+		var dim []byte
+		if d.Param != "" {
+			dim = appendString(dim, 2, d.Param)
+		} else {
+			dim = protowire.AppendTag(dim, 1, protowire.VarintType)
+			dim = protowire.AppendVarint(dim, uint64(d.Value))
+		}
+		shape = appendField(shape, 1, dim)
+	}
+	tt := appendInt(nil, 1, int64(vi.Type))
+	if vi.Shape != nil {
+		tt = appendField(tt, 2, shape)
+	}
+	b := appendString(nil, 1, vi.Name)
+	return appendField(b, 2, appendField(nil, 1, tt))
+}
+
+func (t *Tensor) marshal(name string) []byte {
+	dims := make([]int64, len(t.Shape))
+	for i, d := range t.Shape {
+		dims[i] = int64(d)
+	}
+	var raw []byte
+	switch t.Type {
+	case Float:
+		for _, v := range t.Floats {
+			raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(v))
+		}
+	case Int64:
+		for _, v := range t.Ints {
+			raw = binary.LittleEndian.AppendUint64(raw, uint64(v))
+		}
+	case Bool:
+		for _, v := range t.Bools {
+			if v {
+				raw = append(raw, 1)
+			} else {
+				raw = append(raw, 0)
+			}
+		}
+	}
+	var b []byte
+	if len(dims) > 0 {
+		b = appendField(b, 1, packVarints(dims))
+	}
+	b = appendInt(b, 2, int64(t.Type))
+	b = appendString(b, 8, name)
+	return appendField(b, 9, raw)
+}
+
+// appendField appends a length-delimited field: bytes, a string or an
+// embedded message. It is written even when empty.
+func appendField(b []byte, field int, v []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// appendString appends a string field, omitting it when empty as proto3
+// does
+func appendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	return appendField(b, field, []byte(s))
+}
+
+// appendInt appends an integer field, omitting it when zero
+func appendInt(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func packVarints(values []int64) []byte {
+	var b []byte
+	for _, v := range values {
+		b = protowire.AppendVarint(b, uint64(v))
+	}
+	return b
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,557 @@
+// Package onnx loads ONNX models and runs them with a pure-Go interpreter.
+//
+// Models are decoded directly from the protobuf wire format. The interpreter
+// executes the graph node by node and supports the operators that PyTorch
+// and Hugging Face Optimum emit for transformer encoders and decoders; Run
+// reports any other operator as unsupported.
+package onnx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/kelleyblackmore/go-transformer/internal/mmap"
+	"github.com/kelleyblackmore/go-transformer/internal/protowire"
+)
+
+// Model is a parsed ONNX model
+type Model struct {
+	IRVersion       int64
+	ProducerName    string
+	ProducerVersion string
+	// OpsetImports maps operator set domains to their versions. The
+	// default ai.onnx domain is stored under "".
+	OpsetImports map[string]int64
+	Metadata     map[string]string
+	Graph        *Graph
+}
+
+// Graph is a computation graph. Nodes are in topological order, as the ONNX
+// specification requires.
+type Graph struct {
+	Name         string
+	Nodes        []*Node
+	Initializers map[string]*Tensor
+	// Inputs lists the values the caller must provide. Graph inputs that
+	// also have an initializer are omitted: the initializer is used.
+	Inputs  []ValueInfo
+	Outputs []ValueInfo
+}
+
+// Node applies an operator to named input values, producing named outputs.
+// An empty input name marks an omitted optional input.
+type Node struct {
+	Name       string
+	OpType     string
+	Domain     string
+	Inputs     []string
+	Outputs    []string
+	Attributes map[string]*Attribute
+}
+
+// AttributeType identifies which field of an Attribute is set
+type AttributeType int
+
+const (
+	AttributeFloat   AttributeType = 1
+	AttributeInt     AttributeType = 2
+	AttributeString  AttributeType = 3
+	AttributeTensor  AttributeType = 4
+	AttributeGraph   AttributeType = 5
+	AttributeFloats  AttributeType = 6
+	AttributeInts    AttributeType = 7
+	AttributeStrings AttributeType = 8
+)
+
+// Attribute is a constant parameter of a node
+type Attribute struct {
+	Name    string
+	Type    AttributeType
+	Float   float32
+	Int     int64
+	String  string
+	Tensor  *Tensor
+	Graph   *Graph
+	Floats  []float32
+	Ints    []int64
+	Strings []string
+}
+
+// ValueInfo describes a graph input or output
+type ValueInfo struct {
+	Name  string
+	Type  DataType // element type as declared in the model
+	Shape []Dim
+}
+
+// Dim is a dimension of a declared shape: a fixed size, or a named symbolic
+// size such as "batch_size", or unknown when neither is set
+type Dim struct {
+	Value int64
+	Param string
+}
+
+// Load reads an ONNX model. Tensors stored as external data are read from
+// files relative to the model's directory.
+func Load(path string) (*Model, error) {
+	f, err := mmap.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ONNX model: %w", err)
+	}
+	defer f.Close()
+
+	p := &parser{dir: filepath.Dir(path)}
+	m, err := p.model(f.Data())
+	if err != nil {
+		return nil, fmt.Errorf("invalid ONNX model %s: %w", path, err)
+	}
+	if m.Graph == nil {
+		return nil, fmt.Errorf("invalid ONNX model %s: no graph", path)
+	}
+	return m, nil
+}
+
+// Opset returns the version of the default operator set
+func (m *Model) Opset() int64 {
+	if v, ok := m.OpsetImports[""]; ok {
+		return v
+	}
+	return m.OpsetImports["ai.onnx"]
+}
+
+// parser decodes ONNX protobuf messages. Field numbers follow onnx.proto.
+type parser struct {
+	dir string // directory holding external data files
+}
+
+// fields calls fn for every field of a message
+func fields(msg []byte, fn func(d *protowire.Decoder, field, wireType int) error) error {
+	d := protowire.NewDecoder(msg)
+	for !d.Done() {
+		field, wt, err := d.Next()
+		if err != nil {
+			return err
+		}
+		if err := fn(d, field, wt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) model(msg []byte) (*Model, error) {
+	m := &Model{OpsetImports: make(map[string]int64), Metadata: make(map[string]string)}
+	err := fields(msg, func(d *protowire.Decoder, field, wt int) error {
+		var err error
+		switch field {
+		case 1:
+			m.IRVersion, err = d.Int64()
+		case 2:
+			m.ProducerName, err = d.String()
+		case 3:
+			m.ProducerVersion, err = d.String()
+		case 7:
+			var b []byte
+			if b, err = d.Bytes(); err == nil {
+				if m.Graph, err = p.graph(b); err != nil {
+					err = fmt.Errorf("graph: %w", err)
+				}
+			}
+		case 8:
+			var b []byte
+			if b, err = d.Bytes(); err == nil {
+				err = opsetImport(b, m.OpsetImports)
+			}
+		case 14:
+			var b []byte
+			if b, err = d.Bytes(); err == nil {
+				var k, v string
+				if k, v, err = stringEntry(b); err == nil {
+					m.Metadata[k] = v
+				}
+			}
+		default:
+			err = d.Skip(wt)
+		}
+		return err
+	})
+	return m, err
+}
+
+func opsetImport(msg []byte, imports map[string]int64) error {
+	var domain string
+	var version int64
+	err := fields(msg, func(d *protowire.Decoder, field, wt int) error {
+		var err error
+		switch field {
+		case 1:
+			domain, err = d.String()
+		case 2:
+			version, err = d.Int64()
+		default:
+			err = d.Skip(wt)
+		}
+		return err
+	})
+	imports[domain] = version
+	return err
+}
+
+func stringEntry(msg []byte) (key, value string, err error) {
+	err = fields(msg, func(d *protowire.Decoder, field, wt int) error {
+		var err error
+		switch field {
+		case 1:
+			key, err = d.String()
+		case 2:
+			value, err = d.String()
+		default:
+			err = d.Skip(wt)
+		}
+		return err
+	})
+	return key, value, err
+}
+
+func (p *parser) graph(msg []byte) (*Graph, error) {
+	g := &Graph{Initializers: make(map[string]*Tensor)}
+	var inputs []ValueInfo
+	err := fields(msg, func(d *protowire.Decoder, field, wt int) error {
+		var err error
+		var b []byte
+		switch field {
+		case 1:
+			if b, err = d.Bytes(); err == nil {
+				var n *Node
+				if n, err = p.node(b); err != nil {
+					return fmt.Errorf("node %d: %w", len(g.Nodes), err)
+				}
+				g.Nodes = append(g.Nodes, n)
+			}
+		case 2:
+			g.Name, err = d.String()
+		case 5:
+			if b, err = d.Bytes(); err == nil {
+				t, name, err := p.tensor(b)
+				if err != nil {
+					return fmt.Errorf("initializer %q: %w", name, err)
+				}
+				g.Initializers[name] = t
+			}
+		case 11, 12:
+			if b, err = d.Bytes(); err == nil {
+				var vi ValueInfo
+				if vi, err = valueInfo(b); err == nil && field == 11 {
+					inputs = append(inputs, vi)
+				} else if err == nil {
+					g.Outputs = append(g.Outputs, vi)
+				}
+			}
+		default:
+			err = d.Skip(wt)
+		}
+		return err
+	})
+	for _, in := range inputs {
+		if _, ok := g.Initializers[in.Name]; !ok {
+			g.Inputs = append(g.Inputs, in)
+		}
+	}
+	return g, err
+}
+
+func (p *parser) node(msg []byte) (*Node, error) {
+	n := &Node{Attributes: make(map[string]*Attribute)}
+	err := fields(msg, func(d *protowire.Decoder, field, wt int) error {
+		var err error
+		var s string
+		switch field {
+		case 1:
+			if s, err = d.String(); err == nil {
+				n.Inputs = append(n.Inputs, s)
+			}
+		case 2:
+			if s, err = d.String(); err == nil {
+				n.Outputs = append(n.Outputs, s)
+			}
+		case 3:
+			n.Name, err = d.String()
+		case 4:
+			n.OpType, err = d.String()
+		case 7:
+			n.Domain, err = d.String()
+		case 5:
+			var b []byte
+			if b, err = d.Bytes(); err == nil {
+				var a *Attribute
+				if a, err = p.attribute(b); err == nil {
+					n.Attributes[a.Name] = a
+				}
+			}
+		default:
+			err = d.Skip(wt)
+		}
+		return err
+	})
+	return n, err
+}
+
+func (p *parser) attribute(msg []byte) (*Attribute, error) {
+	a := &Attribute{}
+	err := fields(msg, func(d *protowire.Decoder, field, wt int) error {
+		var err error
+		var b []byte
+		switch field {
+		case 1:
+			a.Name, err = d.String()
+		case 20:
+			var t int64
+			t, err = d.Int64()
+			a.Type = AttributeType(t)
+		case 2:
+			a.Float, err = d.Float()
+		case 3:
+			a.Int, err = d.Int64()
+		case 4:
+			a.String, err = d.String()
+		case 5:
+			if b, err = d.Bytes(); err == nil {
+				a.Tensor, _, err = p.tensor(b)
+			}
+		case 6:
+			if b, err = d.Bytes(); err == nil {
+				a.Graph, err = p.graph(b)
+			}
+		case 7:
+			a.Floats, err = d.PackedFloats(wt, a.Floats)
+		case 8:
+			a.Ints, err = d.PackedVarints(wt, a.Ints)
+		case 9:
+			var s string
+			if s, err = d.String(); err == nil {
+				a.Strings = append(a.Strings, s)
+			}
+		default:
+			err = d.Skip(wt)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("attribute %q: %w", a.Name, err)
+	}
+	return a, nil
+}
+
+func valueInfo(msg []byte) (ValueInfo, error) {
+	var vi ValueInfo
+	err := fields(msg, func(d *protowire.Decoder, field, wt int) error {
+		switch field {
+		case 1:
+			var err error
+			vi.Name, err = d.String()
+			return err
+		case 2:
+			b, err := d.Bytes()
+			if err != nil {
+				return err
+			}
+			// TypeProto.tensor_type
+			return fields(b, func(d *protowire.Decoder, field, wt int) error {
+				if field != 1 {
+					return d.Skip(wt)
+				}
+				b, err := d.Bytes()
+				if err != nil {
+					return err
+				}
+				return tensorType(b, &vi)
+			})
+		default:
+			return d.Skip(wt)
+		}
+	})
+	if err != nil {
+		return vi, fmt.Errorf("value %q: %w", vi.Name, err)
+	}
+	return vi, nil
+}
+
+// tensorType decodes TypeProto.Tensor: an element type and a shape made of
+// TensorShapeProto.Dimension messages
+func tensorType(msg []byte, vi *ValueInfo) error {
+	return fields(msg, func(d *protowire.Decoder, field, wt int) error {
+		switch field {
+		case 1:
+			t, err := d.Int64()
+			vi.Type = DataType(t)
+			return err
+		case 2:
+			b, err := d.Bytes()
+			if err != nil {
+				return err
+			}
+			return fields(b, func(d *protowire.Decoder, field, wt int) error {
+				if field != 1 {
+					return d.Skip(wt)
+				}
+				b, err := d.Bytes()
+				if err != nil {
+					return err
+				}
+				var dim Dim
+				err = fields(b, func(d *protowire.Decoder, field, wt int) error {
+					var err error
+					switch field {
+					case 1:
+						dim.Value, err = d.Int64()
+					case 2:
+						dim.Param, err = d.String()
+					default:
+						err = d.Skip(wt)
+					}
+					return err
+				})
+				vi.Shape = append(vi.Shape, dim)
+				return err
+			})
+		default:
+			return d.Skip(wt)
+		}
+	})
+}
+
+// tensorProto holds the fields of a TensorProto before conversion
+type tensorProto struct {
+	name       string
+	dims       []int64
+	dataType   DataType
+	raw        []byte
+	floats     []float32
+	int32s     []int64
+	int64s     []int64
+	doubles    []float64
+	uint64s    []int64
+	external   map[string]string
+	isExternal bool
+}
+
+// tensor decodes a TensorProto, returning its name alongside the value
+func (p *parser) tensor(msg []byte) (*Tensor, string, error) {
+	var tp tensorProto
+	err := fields(msg, func(d *protowire.Decoder, field, wt int) error {
+		var err error
+		switch field {
+		case 1:
+			tp.dims, err = d.PackedVarints(wt, tp.dims)
+		case 2:
+			var t int64
+			t, err = d.Int64()
+			tp.dataType = DataType(t)
+		case 4:
+			tp.floats, err = d.PackedFloats(wt, tp.floats)
+		case 5:
+			tp.int32s, err = d.PackedVarints(wt, tp.int32s)
+		case 7:
+			tp.int64s, err = d.PackedVarints(wt, tp.int64s)
+		case 8:
+			tp.name, err = d.String()
+		case 9:
+			tp.raw, err = d.Bytes()
+		case 10:
+			tp.doubles, err = packedDoubles(d, wt, tp.doubles)
+		case 11:
+			tp.uint64s, err = d.PackedVarints(wt, tp.uint64s)
+		case 13:
+			var b []byte
+			if b, err = d.Bytes(); err == nil {
+				var k, v string
+				if k, v, err = stringEntry(b); err == nil {
+					if tp.external == nil {
+						tp.external = make(map[string]string)
+					}
+					tp.external[k] = v
+				}
+			}
+		case 14:
+			var loc int64
+			loc, err = d.Int64()
+			tp.isExternal = loc == 1
+		default:
+			err = d.Skip(wt)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, tp.name, err
+	}
+	if tp.isExternal {
+		if tp.raw, err = p.externalData(tp.external); err != nil {
+			return nil, tp.name, err
+		}
+	}
+	t, err := tp.convert()
+	return t, tp.name, err
+}
+
+func packedDoubles(d *protowire.Decoder, wt int, dst []float64) ([]float64, error) {
+	if wt == protowire.Fixed64Type {
+		v, err := d.Double()
+		return append(dst, v), err
+	}
+	b, err := d.Bytes()
+	if err != nil {
+		return dst, err
+	}
+	inner := protowire.NewDecoder(b)
+	for !inner.Done() {
+		v, err := inner.Double()
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, v)
+	}
+	return dst, nil
+}
+
+// externalData reads tensor bytes stored outside the model file, described
+// by location, offset and length entries
+func (p *parser) externalData(entries map[string]string) ([]byte, error) {
+	location := entries["location"]
+	if !filepath.IsLocal(location) {
+		return nil, fmt.Errorf("invalid external data location %q", location)
+	}
+	f, err := os.Open(filepath.Join(p.dir, location))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open external data: %w", err)
+	}
+	defer f.Close()
+
+	var offset int64
+	if s, ok := entries["offset"]; ok {
+		if offset, err = strconv.ParseInt(s, 10, 64); err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid external data offset %q", s)
+		}
+	}
+	if s, ok := entries["length"]; ok {
+		length, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("invalid external data length %q", s)
+		}
+		data := make([]byte, length)
+		if _, err := f.ReadAt(data, offset); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("external data %s is shorter than offset %d plus length %d", location, offset, length)
+			}
+			return nil, err
+		}
+		return data, nil
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(f)
+}
@@ -0,0 +1,180 @@
+package onnx
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/internal/protowire"
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+)
+
+func writeModel(t *testing.T, m *Model) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "model.onnx")
+	if err := os.WriteFile(path, m.Marshal(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testModel computes y = softmax(x @ w + b) over the last axis
+func testModel() *Model {
+	return &Model{
+		IRVersion:    8,
+		ProducerName: "test",
+		OpsetImports: map[string]int64{"": 17},
+		Metadata:     map[string]string{"task": "classification"},
+		Graph: &Graph{
+			Name: "linear",
+			Nodes: []*Node{
+				{Name: "matmul", OpType: "MatMul", Inputs: []string{"x", "w"}, Outputs: []string{"xw"}},
+				{Name: "add", OpType: "Add", Inputs: []string{"xw", "b"}, Outputs: []string{"logits"}},
+				{Name: "softmax", OpType: "Softmax", Inputs: []string{"logits"}, Outputs: []string{"y"},
+					Attributes: map[string]*Attribute{"axis": intAttr(-1)}},
+			},
+			Initializers: map[string]*Tensor{
+				"w": NewFloat(floats(1, 0, 0, 1, 1, 1), 3, 2),
+				"b": NewFloat(floats(0, -1), 2),
+			},
+			Inputs:  []ValueInfo{{Name: "x", Type: Float, Shape: []Dim{{Param: "batch"}, {Value: 3}}}},
+			Outputs: []ValueInfo{{Name: "y", Type: Float, Shape: []Dim{{Param: "batch"}, {Value: 2}}}},
+		},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	m, err := Load(writeModel(t, testModel()))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if m.IRVersion != 8 || m.ProducerName != "test" || m.Opset() != 17 {
+		t.Errorf("Expected IR 8 from test at opset 17, got %d from %q at %d", m.IRVersion, m.ProducerName, m.Opset())
+	}
+	if m.Metadata["task"] != "classification" {
+		t.Errorf("Expected metadata, got %v", m.Metadata)
+	}
+	g := m.Graph
+	if g.Name != "linear" || len(g.Nodes) != 3 || g.Nodes[2].OpType != "Softmax" {
+		t.Fatalf("Expected three nodes ending in Softmax, got %+v", g.Nodes)
+	}
+	if a := g.Nodes[2].Attributes["axis"]; a == nil || a.Type != AttributeInt || a.Int != -1 {
+		t.Errorf("Expected axis -1, got %+v", a)
+	}
+	if w := g.Initializers["w"]; w == nil || !reflect.DeepEqual(w.Shape, []int{3, 2}) || !reflect.DeepEqual(w.Floats, floats(1, 0, 0, 1, 1, 1)) {
+		t.Errorf("Expected the w initializer, got %+v", w)
+	}
+	expected := []ValueInfo{{Name: "x", Type: Float, Shape: []Dim{{Param: "batch"}, {Value: 3}}}}
+	if !reflect.DeepEqual(g.Inputs, expected) {
+		t.Errorf("Expected inputs %+v, got %+v", expected, g.Inputs)
+	}
+
+	out, err := m.Run(context.Background(), map[string]*Tensor{"x": NewFloat(floats(1, 2, 3, 0, 0, 0), 2, 3)})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	y := out["y"]
+	want := tensor.Softmax(tensor.New([]float32{4, 4, 0, -1}, 2, 2), -1).Data()
+	if !approxEqual(y.Floats, want, 1e-6) {
+		t.Errorf("Expected %v, got %v", want, y.Floats)
+	}
+}
+
+func TestLoad_TensorEncodings(t *testing.T) {
+	dir := t.TempDir()
+	external := make([]byte, 8)
+	for i, v := range []float32{1.5, -2} {
+		binary.LittleEndian.PutUint32(external[4*i:], math.Float32bits(v))
+	}
+	if err := os.WriteFile(filepath.Join(dir, "weights.bin"), append([]byte{0, 0, 0, 0}, external...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := func(k, v string) []byte {
+		return appendField(appendString(nil, 1, k), 2, []byte(v))
+	}
+	tensors := [][]byte{
+		// float16 values in int32_data
+		appendField(appendInt(appendString(appendField(nil, 1, packVarints([]int64{2})), 8, "half"), 2, int64(Float16)),
+			5, packVarints([]int64{0x3c00, 0xc000})),
+		// int32 values in int32_data, including a negative one
+		appendField(appendInt(appendString(appendField(nil, 1, packVarints([]int64{2})), 8, "narrow"), 2, int64(Int32)), 5, packVarints([]int64{-3, 4})),
+		// float32 values stored in an external file at offset 4
+		appendInt(appendField(appendField(appendField(appendInt(appendString(appendField(nil, 1, packVarints([]int64{2})),
+			8, "ext"), 2, int64(Float)), 13, entry("location", "weights.bin")), 13, entry("offset", "4")), 13, entry("length", "8")), 14, 1),
+	}
+	var graph []byte
+	for _, tp := range tensors {
+		graph = appendField(graph, 5, tp)
+	}
+	model := appendField(appendInt(nil, 1, 8), 7, graph)
+	path := filepath.Join(dir, "model.onnx")
+	if err := os.WriteFile(path, model, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Load(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	inits := m.Graph.Initializers
+	if got := inits["half"]; got == nil || got.Type != Float || !reflect.DeepEqual(got.Floats, floats(1, -2)) {
+		t.Errorf("Expected float16 [1 -2], got %+v", got)
+	}
+	if got := inits["narrow"]; got == nil || got.Type != Int64 || !reflect.DeepEqual(got.Ints, []int64{-3, 4}) {
+		t.Errorf("Expected int [-3 4], got %+v", got)
+	}
+	if got := inits["ext"]; got == nil || !reflect.DeepEqual(got.Floats, floats(1.5, -2)) {
+		t.Errorf("Expected external [1.5 -2], got %+v", got)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Load(filepath.Join(dir, "missing.onnx")); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+
+	write := func(data []byte) string {
+		path := filepath.Join(dir, "bad.onnx")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	if _, err := Load(write(appendInt(nil, 1, 8))); err == nil {
+		t.Error("Expected error for a model without a graph")
+	}
+	full := testModel().Marshal()
+	if _, err := Load(write(full[:len(full)-3])); err == nil {
+		t.Error("Expected error for a truncated model")
+	}
+
+	// Raw data that does not match the shape
+	tp := appendField(appendInt(appendString(appendField(nil, 1, packVarints([]int64{3})), 8, "w"), 2, int64(Float)), 9, make([]byte, 8))
+	if _, err := Load(write(appendField(nil, 7, appendField(nil, 5, tp)))); err == nil {
+		t.Error("Expected error for a raw data size mismatch")
+	}
+
+	// A shape whose byte size wraps around must not pass for empty raw data
+	tp = appendField(appendInt(appendString(appendField(nil, 1, packVarints([]int64{1 << 30, 1 << 30, 4})), 8, "w"), 2, int64(Float)), 9, []byte{})
+	if _, err := Load(write(appendField(nil, 7, appendField(nil, 5, tp)))); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Expected error for a shape too large, got %v", err)
+	}
+
+	// External data must stay inside the model directory
+	loc := appendField(appendString(nil, 1, "location"), 2, []byte("../secret.bin"))
+	tp = appendInt(appendField(appendInt(appendString(nil, 8, "w"), 2, int64(Float)), 13, loc), 14, 1)
+	if _, err := Load(write(appendField(nil, 7, appendField(nil, 5, tp)))); err == nil {
+		t.Error("Expected error for external data outside the model directory")
+	}
+
+	if _, err := Load(write(protowire.AppendTag(nil, 7, protowire.BytesType))); err == nil {
+		t.Error("Expected error for a field without its length")
+	}
+}
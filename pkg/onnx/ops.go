@@ -0,0 +1,1223 @@
+package onnx
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+)
+
+// operators maps op types to their implementations
+var operators map[string]opFunc
+
+func init() {
+	operators = map[string]opFunc{
+		"Identity": identity,
+		"Dropout":  dropout,
+		"Constant": constant,
+
+		"Add": binaryOp(func(a, b float32) float32 { return a + b }, func(a, b int64) int64 { return a + b }),
+		"Sub": binaryOp(func(a, b float32) float32 { return a - b }, func(a, b int64) int64 { return a - b }),
+		"Mul": binaryOp(func(a, b float32) float32 { return a * b }, func(a, b int64) int64 { return a * b }),
+		"Div": binaryOp(func(a, b float32) float32 { return a / b }, func(a, b int64) int64 { return a / b }),
+		"Pow": binaryOp(func(a, b float32) float32 { return float32(math.Pow(float64(a), float64(b))) }, powInt),
+		"Max": variadicOp(func(a, b float32) float32 { return max(a, b) }, func(a, b int64) int64 { return max(a, b) }),
+		"Min": variadicOp(func(a, b float32) float32 { return min(a, b) }, func(a, b int64) int64 { return min(a, b) }),
+
+		"Equal":          compareOp(func(a, b float32) bool { return a == b }, func(a, b int64) bool { return a == b }),
+		"Less":           compareOp(func(a, b float32) bool { return a < b }, func(a, b int64) bool { return a < b }),
+		"LessOrEqual":    compareOp(func(a, b float32) bool { return a <= b }, func(a, b int64) bool { return a <= b }),
+		"Greater":        compareOp(func(a, b float32) bool { return a > b }, func(a, b int64) bool { return a > b }),
+		"GreaterOrEqual": compareOp(func(a, b float32) bool { return a >= b }, func(a, b int64) bool { return a >= b }),
+		"And":            logicalOp(func(a, b bool) bool { return a && b }),
+		"Or":             logicalOp(func(a, b bool) bool { return a || b }),
+		"Xor":            logicalOp(func(a, b bool) bool { return a != b }),
+		"Not":            not,
+		"Where":          where,
+
+		"Neg":        unaryOp(func(x float32) float32 { return -x }, func(x int64) int64 { return -x }),
+		"Abs":        unaryOp(func(x float32) float32 { return float32(math.Abs(float64(x))) }, absInt),
+		"Sqrt":       floatOp(func(x float32) float32 { return float32(math.Sqrt(float64(x))) }),
+		"Exp":        floatOp(func(x float32) float32 { return float32(math.Exp(float64(x))) }),
+		"Log":        floatOp(func(x float32) float32 { return float32(math.Log(float64(x))) }),
+		"Erf":        floatOp(func(x float32) float32 { return float32(math.Erf(float64(x))) }),
+		"Tanh":       floatOp(func(x float32) float32 { return float32(math.Tanh(float64(x))) }),
+		"Reciprocal": floatOp(func(x float32) float32 { return 1 / x }),
+		"Relu":       floatOp(func(x float32) float32 { return max(x, 0) }),
+		"Sigmoid":    floatOp(func(x float32) float32 { return float32(1 / (1 + math.Exp(-float64(x)))) }),
+		"Gelu":       gelu,
+		"FastGelu":   fastGelu,
+
+		"Cast":            cast,
+		"CastLike":        castLike,
+		"Shape":           shapeOp,
+		"Size":            size,
+		"Reshape":         reshape,
+		"Flatten":         flatten,
+		"Unsqueeze":       unsqueeze,
+		"Squeeze":         squeeze,
+		"Transpose":       transpose,
+		"Concat":          concat,
+		"Split":           split,
+		"Slice":           slice,
+		"Gather":          gather,
+		"Expand":          expand,
+		"ConstantOfShape": constantOfShape,
+		"Range":           rangeOp,
+		"Trilu":           trilu,
+
+		"MatMul":             matMul,
+		"Gemm":               gemm,
+		"Softmax":            softmax,
+		"LayerNormalization": layerNormalization,
+		"ReduceMean":         reduceOp(func(sum float64, n int) float64 { return sum / float64(n) }),
+		"ReduceSum":          reduceOp(func(sum float64, _ int) float64 { return sum }),
+	}
+}
+
+// Attribute accessors returning a default when the attribute is absent
+
+func (n *Node) attrInt(name string, def int64) int64 {
+	if a, ok := n.Attributes[name]; ok {
+		return a.Int
+	}
+	return def
+}
+
+func (n *Node) attrFloat(name string, def float32) float32 {
+	if a, ok := n.Attributes[name]; ok {
+		return a.Float
+	}
+	return def
+}
+
+func (n *Node) attrString(name, def string) string {
+	if a, ok := n.Attributes[name]; ok {
+		return a.String
+	}
+	return def
+}
+
+func (n *Node) attrInts(name string) ([]int64, bool) {
+	if a, ok := n.Attributes[name]; ok {
+		return a.Ints, true
+	}
+	return nil, false
+}
+
+func one(t *Tensor) ([]*Tensor, error) {
+	return []*Tensor{t}, nil
+}
+
+// input returns input i, or nil when it is omitted
+func input(in []*Tensor, i int) *Tensor {
+	if i < len(in) {
+		return in[i]
+	}
+	return nil
+}
+
+// requireInputs checks that the first n inputs are present
+func requireInputs(in []*Tensor, n int) error {
+	if len(in) < n {
+		return fmt.Errorf("expected %d inputs, got %d", n, len(in))
+	}
+	for i := 0; i < n; i++ {
+		if in[i] == nil {
+			return fmt.Errorf("input %d is required", i)
+		}
+	}
+	return nil
+}
+
+// axisOf resolves a possibly negative axis against a rank
+func axisOf(axis int64, rank int) (int, error) {
+	if axis < -int64(rank) || axis >= int64(rank) {
+		return 0, fmt.Errorf("axis %d out of range for rank %d", axis, rank)
+	}
+	if axis < 0 {
+		axis += int64(rank)
+	}
+	return int(axis), nil
+}
+
+// intsArg returns the values of an integer input such as a shape or axes
+func intsArg(t *Tensor, what string) ([]int64, error) {
+	if t.Type != Int64 {
+		return nil, fmt.Errorf("%s must be an integer tensor, got %s", what, t.Type)
+	}
+	return t.Ints, nil
+}
+
+// scalarArg returns the single value of a tensor
+func scalarArg(t *Tensor, what string) (*Tensor, error) {
+	if t.Len() != 1 {
+		return nil, fmt.Errorf("%s must have one element, got shape %v", what, t.Shape)
+	}
+	return t, nil
+}
+
+// toFloat converts a tensor of any type to float
+func toFloat(t *Tensor) *Tensor {
+	if t.Type == Float {
+		return t
+	}
+	return &Tensor{Type: Float, Shape: t.Shape, Floats: t.asFloats()}
+}
+
+func identity(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	return one(in[0])
+}
+
+// dropout is the identity at inference time; the optional mask output is
+// all true
+func dropout(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	out := []*Tensor{in[0]}
+	if len(n.Outputs) > 1 {
+		mask := make([]bool, in[0].Len())
+		for i := range mask {
+			mask[i] = true
+		}
+		out = append(out, NewBool(mask, in[0].Shape...))
+	}
+	return out, nil
+}
+
+func constant(n *Node, _ []*Tensor, _ int64) ([]*Tensor, error) {
+	for name, a := range n.Attributes {
+		switch name {
+		case "value":
+			if a.Tensor == nil {
+				return nil, fmt.Errorf("value attribute holds no tensor")
+			}
+			return one(a.Tensor)
+		case "value_float":
+			return one(NewFloat([]float32{a.Float}))
+		case "value_floats":
+			return one(NewFloat(a.Floats, len(a.Floats)))
+		case "value_int":
+			return one(NewInt([]int64{a.Int}))
+		case "value_ints":
+			return one(NewInt(a.Ints, len(a.Ints)))
+		}
+	}
+	return nil, fmt.Errorf("unsupported constant attributes")
+}
+
+// binaryOp returns an elementwise operator with broadcasting. Operands are
+// computed as floats when either is a float and as integers otherwise.
+func binaryOp(ff func(a, b float32) float32, fi func(a, b int64) int64) opFunc {
+	return func(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+		if err := requireInputs(in, 2); err != nil {
+			return nil, err
+		}
+		return one(apply2(in[0], in[1], ff, fi))
+	}
+}
+
+func apply2(a, b *Tensor, ff func(a, b float32) float32, fi func(a, b int64) int64) *Tensor {
+	if a.Type == Float || b.Type == Float {
+		return fromFloat(tensor.Binary(toFloat(a).float(), toFloat(b).float(), ff))
+	}
+	shape, ia, ib := broadcast2(a.Shape, b.Shape)
+	av, bv := a.asInts(), b.asInts()
+	out := make([]int64, len(ia))
+	for i := range out {
+		out[i] = fi(av[ia[i]], bv[ib[i]])
+	}
+	return NewInt(out, shape...)
+}
+
+// broadcast2 returns the shape two operands broadcast to and, for every
+// output element, the element of each operand it reads
+func broadcast2(a, b []int) ([]int, []int, []int) {
+	shape, err := broadcastShapes(a, b)
+	if err != nil {
+		panic(err.Error())
+	}
+	return shape, broadcastIndex(a, shape), broadcastIndex(b, shape)
+}
+
+// variadicOp folds an elementwise operator over any number of inputs
+func variadicOp(ff func(a, b float32) float32, fi func(a, b int64) int64) opFunc {
+	return func(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+		if err := requireInputs(in, 1); err != nil {
+			return nil, err
+		}
+		out := in[0]
+		for _, t := range in[1:] {
+			out = apply2(out, t, ff, fi)
+		}
+		return one(out)
+	}
+}
+
+func powInt(a, b int64) int64 {
+	r := int64(1)
+	for ; b > 0; b-- {
+		r *= a
+	}
+	return r
+}
+
+func absInt(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func compareOp(ff func(a, b float32) bool, fi func(a, b int64) bool) opFunc {
+	return func(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+		if err := requireInputs(in, 2); err != nil {
+			return nil, err
+		}
+		a, b := in[0], in[1]
+		shape, ia, ib := broadcast2(a.Shape, b.Shape)
+		out := make([]bool, len(ia))
+		if a.Type == Float || b.Type == Float {
+			av, bv := a.asFloats(), b.asFloats()
+			for i := range out {
+				out[i] = ff(av[ia[i]], bv[ib[i]])
+			}
+		} else {
+			av, bv := a.asInts(), b.asInts()
+			for i := range out {
+				out[i] = fi(av[ia[i]], bv[ib[i]])
+			}
+		}
+		return one(NewBool(out, shape...))
+	}
+}
+
+func logicalOp(fn func(a, b bool) bool) opFunc {
+	return func(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+		if err := requireInputs(in, 2); err != nil {
+			return nil, err
+		}
+		a, b := in[0], in[1]
+		if a.Type != Bool || b.Type != Bool {
+			return nil, fmt.Errorf("expected bool operands, got %s and %s", a.Type, b.Type)
+		}
+		shape, ia, ib := broadcast2(a.Shape, b.Shape)
+		out := make([]bool, len(ia))
+		for i := range out {
+			out[i] = fn(a.Bools[ia[i]], b.Bools[ib[i]])
+		}
+		return one(NewBool(out, shape...))
+	}
+}
+
+func not(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	if in[0].Type != Bool {
+		return nil, fmt.Errorf("expected a bool operand, got %s", in[0].Type)
+	}
+	out := make([]bool, len(in[0].Bools))
+	for i, v := range in[0].Bools {
+		out[i] = !v
+	}
+	return one(NewBool(out, in[0].Shape...))
+}
+
+// where selects from x where cond is true and from y elsewhere
+func where(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 3); err != nil {
+		return nil, err
+	}
+	cond, x, y := in[0], in[1], in[2]
+	if cond.Type != Bool {
+		return nil, fmt.Errorf("condition must be bool, got %s", cond.Type)
+	}
+	if x.Type != y.Type {
+		x, y = toFloat(x), toFloat(y)
+	}
+	shape, err := broadcastShapes(cond.Shape, x.Shape, y.Shape)
+	if err != nil {
+		return nil, err
+	}
+	ic, ix, iy := broadcastIndex(cond.Shape, shape), broadcastIndex(x.Shape, shape), broadcastIndex(y.Shape, shape)
+	// Build the index into the concatenation of x and y, then take from it
+	both := &Tensor{Type: x.Type, Shape: []int{x.Len() + y.Len()}}
+	switch x.Type {
+	case Float:
+		both.Floats = append(append(make([]float32, 0, x.Len()+y.Len()), x.Floats...), y.Floats...)
+	case Int64:
+		both.Ints = append(append(make([]int64, 0, x.Len()+y.Len()), x.Ints...), y.Ints...)
+	case Bool:
+		both.Bools = append(append(make([]bool, 0, x.Len()+y.Len()), x.Bools...), y.Bools...)
+	}
+	idx := make([]int, len(ic))
+	for i := range idx {
+		if cond.Bools[ic[i]] {
+			idx[i] = ix[i]
+		} else {
+			idx[i] = x.Len() + iy[i]
+		}
+	}
+	return one(both.take(shape, idx))
+}
+
+func unaryOp(ff func(float32) float32, fi func(int64) int64) opFunc {
+	return func(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+		if err := requireInputs(in, 1); err != nil {
+			return nil, err
+		}
+		x := in[0]
+		switch x.Type {
+		case Float:
+			return one(fromFloat(tensor.Map(x.float(), ff)))
+		case Int64:
+			out := make([]int64, len(x.Ints))
+			for i, v := range x.Ints {
+				out[i] = fi(v)
+			}
+			return one(NewInt(out, x.Shape...))
+		}
+		return nil, fmt.Errorf("unsupported operand type %s", x.Type)
+	}
+}
+
+// floatOp returns an elementwise operator defined on floats only
+func floatOp(ff func(float32) float32) opFunc {
+	return func(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+		if err := requireInputs(in, 1); err != nil {
+			return nil, err
+		}
+		if in[0].Type != Float {
+			return nil, fmt.Errorf("expected a float operand, got %s", in[0].Type)
+		}
+		return one(fromFloat(tensor.Map(in[0].float(), ff)))
+	}
+}
+
+// gelu implements both the ai.onnx operator, whose approximate attribute
+// selects the tanh form, and the exact com.microsoft one
+func gelu(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := toFloat(in[0]).float()
+	switch n.attrString("approximate", "none") {
+	case "none":
+		return one(fromFloat(tensor.GELU(x)))
+	case "tanh":
+		return one(fromFloat(tensor.GELUTanh(x)))
+	default:
+		return nil, fmt.Errorf("unsupported approximation %q", n.attrString("approximate", ""))
+	}
+}
+
+// fastGelu is the com.microsoft tanh approximation with an optional bias
+// added first
+func fastGelu(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := toFloat(in[0]).float()
+	if b := input(in, 1); b != nil {
+		x = tensor.Add(x, toFloat(b).float())
+	}
+	return one(fromFloat(tensor.GELUTanh(x)))
+}
+
+func cast(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	to := DataType(n.attrInt("to", 0))
+	out, err := castTo(in[0], to)
+	if err != nil {
+		return nil, err
+	}
+	return one(out)
+}
+
+func castLike(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	out, err := castTo(in[0], in[1].Type)
+	if err != nil {
+		return nil, err
+	}
+	return one(out)
+}
+
+func castTo(t *Tensor, to DataType) (*Tensor, error) {
+	storage, ok := to.storage()
+	if !ok {
+		return nil, fmt.Errorf("unsupported target type %s", to)
+	}
+	if storage == t.Type {
+		return t, nil
+	}
+	switch storage {
+	case Float:
+		return NewFloat(t.asFloats(), t.Shape...), nil
+	case Int64:
+		return NewInt(t.asInts(), t.Shape...), nil
+	default:
+		values := t.asFloats()
+		out := make([]bool, len(values))
+		for i, v := range values {
+			out[i] = v != 0
+		}
+		return NewBool(out, t.Shape...), nil
+	}
+}
+
+// shapeOp returns the shape of its input, optionally limited to the
+// dimensions [start, end)
+func shapeOp(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	rank := int64(len(in[0].Shape))
+	clamp := func(v int64) int64 {
+		if v < 0 {
+			v += rank
+		}
+		return min(max(v, 0), rank)
+	}
+	start, end := clamp(n.attrInt("start", 0)), clamp(n.attrInt("end", rank))
+	out := []int64{}
+	for _, d := range in[0].Shape[start:max(start, end)] {
+		out = append(out, int64(d))
+	}
+	return one(NewInt(out, len(out)))
+}
+
+func size(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	return one(NewInt([]int64{int64(in[0].Len())}))
+}
+
+func reshape(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	dims, err := intsArg(in[1], "shape")
+	if err != nil {
+		return nil, err
+	}
+	allowZero := n.attrInt("allowzero", 0) != 0
+	shape := make([]int, len(dims))
+	infer, known := -1, 1
+	for i, d := range dims {
+		switch {
+		case d == -1:
+			if infer >= 0 {
+				return nil, fmt.Errorf("shape %v has more than one -1", dims)
+			}
+			infer = i
+			continue
+		case d == 0 && !allowZero:
+			if i >= len(x.Shape) {
+				return nil, fmt.Errorf("shape %v copies a dimension missing from %v", dims, x.Shape)
+			}
+			shape[i] = x.Shape[i]
+		case d < 0:
+			return nil, fmt.Errorf("invalid shape %v", dims)
+		default:
+			shape[i] = int(d)
+		}
+		known *= shape[i]
+	}
+	if infer >= 0 {
+		if known == 0 || x.Len()%known != 0 {
+			return nil, fmt.Errorf("cannot reshape %v to %v", x.Shape, dims)
+		}
+		shape[infer] = x.Len() / known
+	}
+	if numel(shape) != x.Len() {
+		return nil, fmt.Errorf("cannot reshape %v to %v", x.Shape, dims)
+	}
+	return one(x.withShape(shape))
+}
+
+func flatten(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	axis := n.attrInt("axis", 1)
+	// Unlike other axes, axis may equal the rank here
+	if axis < 0 {
+		axis += int64(len(x.Shape))
+	}
+	if axis < 0 || axis > int64(len(x.Shape)) {
+		return nil, fmt.Errorf("axis %d out of range for shape %v", n.attrInt("axis", 1), x.Shape)
+	}
+	return one(x.withShape([]int{numel(x.Shape[:axis]), numel(x.Shape[axis:])}))
+}
+
+// axesArg reads the axes of Squeeze, Unsqueeze and the reductions, which
+// moved from an attribute to an optional input at opset version since
+func axesArg(n *Node, in []*Tensor, opset, since int64) ([]int64, bool, error) {
+	if opset < since {
+		axes, ok := n.attrInts("axes")
+		return axes, ok, nil
+	}
+	t := input(in, 1)
+	if t == nil {
+		return nil, false, nil
+	}
+	axes, err := intsArg(t, "axes")
+	return axes, true, err
+}
+
+func unsqueeze(n *Node, in []*Tensor, opset int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	axes, ok, err := axesArg(n, in, opset, 13)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("axes are required")
+	}
+	rank := len(x.Shape) + len(axes)
+	insert := make([]bool, rank)
+	for _, a := range axes {
+		axis, err := axisOf(a, rank)
+		if err != nil {
+			return nil, err
+		}
+		if insert[axis] {
+			return nil, fmt.Errorf("repeated axis %d", a)
+		}
+		insert[axis] = true
+	}
+	shape := make([]int, 0, rank)
+	j := 0
+	for _, ins := range insert {
+		if ins {
+			shape = append(shape, 1)
+		} else {
+			shape = append(shape, x.Shape[j])
+			j++
+		}
+	}
+	return one(x.withShape(shape))
+}
+
+func squeeze(n *Node, in []*Tensor, opset int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	axes, ok, err := axesArg(n, in, opset, 13)
+	if err != nil {
+		return nil, err
+	}
+	remove := make([]bool, len(x.Shape))
+	for d, size := range x.Shape {
+		remove[d] = !ok && size == 1
+	}
+	for _, a := range axes {
+		axis, err := axisOf(a, len(x.Shape))
+		if err != nil {
+			return nil, err
+		}
+		if x.Shape[axis] != 1 {
+			return nil, fmt.Errorf("cannot squeeze dimension %d of shape %v", a, x.Shape)
+		}
+		remove[axis] = true
+	}
+	shape := []int{}
+	for d, size := range x.Shape {
+		if !remove[d] {
+			shape = append(shape, size)
+		}
+	}
+	return one(x.withShape(shape))
+}
+
+func transpose(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	rank := len(x.Shape)
+	perm, ok := n.attrInts("perm")
+	if !ok {
+		perm = make([]int64, rank)
+		for i := range perm {
+			perm[i] = int64(rank - 1 - i)
+		}
+	}
+	if len(perm) != rank {
+		return nil, fmt.Errorf("permutation %v does not match shape %v", perm, x.Shape)
+	}
+	src := stridesOf(x.Shape)
+	shape, strides := make([]int, rank), make([]int, rank)
+	seen := make([]bool, rank)
+	for i, p := range perm {
+		axis, err := axisOf(p, rank)
+		if err != nil || seen[axis] {
+			return nil, fmt.Errorf("invalid permutation %v", perm)
+		}
+		seen[axis] = true
+		shape[i], strides[i] = x.Shape[axis], src[axis]
+	}
+	return one(x.take(shape, stridedIndex(shape, strides, 0)))
+}
+
+func concat(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	first := in[0]
+	axis, err := axisOf(n.attrInt("axis", 0), len(first.Shape))
+	if err != nil {
+		return nil, err
+	}
+	typ := first.Type
+	shape := append([]int{}, first.Shape...)
+	shape[axis] = 0
+	for _, t := range in {
+		if t.Type != first.Type {
+			typ = Float
+		}
+		if len(t.Shape) != len(first.Shape) {
+			return nil, fmt.Errorf("cannot concatenate %v and %v", first.Shape, t.Shape)
+		}
+		for d := range t.Shape {
+			if d != axis && t.Shape[d] != first.Shape[d] {
+				return nil, fmt.Errorf("cannot concatenate %v and %v along axis %d", first.Shape, t.Shape, axis)
+			}
+		}
+		shape[axis] += t.Shape[axis]
+	}
+
+	// Gather the inputs side by side, then read them in output order
+	outer := numel(shape[:axis])
+	inner := numel(shape[axis+1:])
+	all := &Tensor{Type: typ, Shape: []int{numel(shape)}}
+	idx := make([]int, 0, numel(shape))
+	offsets := make([]int, len(in))
+	for i, t := range in {
+		if typ == Float {
+			t = toFloat(t)
+		}
+		offsets[i] = all.appendValues(t)
+	}
+	for o := 0; o < outer; o++ {
+		for i, t := range in {
+			chunk := t.Shape[axis] * inner
+			for k := 0; k < chunk; k++ {
+				idx = append(idx, offsets[i]+o*chunk+k)
+			}
+		}
+	}
+	return one(all.take(shape, idx))
+}
+
+// appendValues appends the values of u, which has t's type, to t and
+// returns the index of the first one
+func (t *Tensor) appendValues(u *Tensor) int {
+	switch t.Type {
+	case Float:
+		n := len(t.Floats)
+		t.Floats = append(t.Floats, u.Floats...)
+		return n
+	case Int64:
+		n := len(t.Ints)
+		t.Ints = append(t.Ints, u.Ints...)
+		return n
+	default:
+		n := len(t.Bools)
+		t.Bools = append(t.Bools, u.Bools...)
+		return n
+	}
+}
+
+// split divides its input along an axis into parts whose sizes come from
+// the split input (an attribute before opset 13), or into num_outputs
+// (otherwise the number of outputs) equal parts
+func split(n *Node, in []*Tensor, opset int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	axis, err := axisOf(n.attrInt("axis", 0), len(x.Shape))
+	if err != nil {
+		return nil, err
+	}
+	var sizes []int64
+	if opset < 13 {
+		sizes, _ = n.attrInts("split")
+	} else if t := input(in, 1); t != nil {
+		if sizes, err = intsArg(t, "split"); err != nil {
+			return nil, err
+		}
+	}
+	if sizes == nil {
+		parts := int(n.attrInt("num_outputs", int64(len(n.Outputs))))
+		if parts <= 0 {
+			return nil, fmt.Errorf("invalid number of outputs %d", parts)
+		}
+		// The last part is smaller when the dimension does not divide evenly
+		chunk := (x.Shape[axis] + parts - 1) / parts
+		for rest := x.Shape[axis]; rest > 0; rest -= chunk {
+			sizes = append(sizes, int64(min(chunk, rest)))
+		}
+	}
+
+	var total int64
+	for _, s := range sizes {
+		if s < 0 {
+			return nil, fmt.Errorf("invalid split %v", sizes)
+		}
+		total += s
+	}
+	if total != int64(x.Shape[axis]) {
+		return nil, fmt.Errorf("split %v does not cover dimension %d of shape %v", sizes, axis, x.Shape)
+	}
+	strides := stridesOf(x.Shape)
+	out := make([]*Tensor, len(sizes))
+	start := 0
+	for i, s := range sizes {
+		shape := append([]int{}, x.Shape...)
+		shape[axis] = int(s)
+		out[i] = x.take(shape, stridedIndex(shape, strides, start*strides[axis]))
+		start += int(s)
+	}
+	return out, nil
+}
+
+// slice takes the elements [start, end) with a step along some axes. The
+// bounds are inputs from opset 10 and attributes before that.
+func slice(n *Node, in []*Tensor, opset int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	var starts, ends, axes, steps []int64
+	if opset < 10 {
+		starts, _ = n.attrInts("starts")
+		ends, _ = n.attrInts("ends")
+		axes, _ = n.attrInts("axes")
+	} else {
+		if err := requireInputs(in, 3); err != nil {
+			return nil, err
+		}
+		args := []*[]int64{&starts, &ends, &axes, &steps}
+		names := []string{"starts", "ends", "axes", "steps"}
+		for i := 1; i < len(in) && i <= 4; i++ {
+			if in[i] == nil {
+				continue
+			}
+			values, err := intsArg(in[i], names[i-1])
+			if err != nil {
+				return nil, err
+			}
+			*args[i-1] = values
+		}
+	}
+	if len(ends) != len(starts) || (axes != nil && len(axes) != len(starts)) || (steps != nil && len(steps) != len(starts)) {
+		return nil, fmt.Errorf("starts, ends, axes and steps differ in length")
+	}
+
+	rank := len(x.Shape)
+	shape := append([]int{}, x.Shape...)
+	src := stridesOf(x.Shape)
+	strides := append([]int{}, src...)
+	offset := 0
+	for i := range starts {
+		axis := i
+		if axes != nil {
+			a, err := axisOf(axes[i], rank)
+			if err != nil {
+				return nil, err
+			}
+			axis = a
+		}
+		step := int64(1)
+		if steps != nil {
+			step = steps[i]
+		}
+		if step == 0 {
+			return nil, fmt.Errorf("slice step cannot be 0")
+		}
+		dim := int64(x.Shape[axis])
+		start, end := sliceBound(starts[i], dim, step), sliceBound(ends[i], dim, step)
+		count := int64(0)
+		if step > 0 && end > start {
+			count = (end - start + step - 1) / step
+		} else if step < 0 && start > end {
+			count = (start - end - step - 1) / -step
+		}
+		shape[axis] = int(count)
+		strides[axis] = src[axis] * int(step)
+		if count > 0 {
+			offset += int(start) * src[axis]
+		}
+	}
+	return one(x.take(shape, stridedIndex(shape, strides, offset)))
+}
+
+// sliceBound resolves a Slice start or end: negative values count from the
+// end and the result is clamped to [0, dim] for positive steps and to
+// [-1, dim-1] for negative ones
+func sliceBound(v, dim, step int64) int64 {
+	if v < 0 {
+		v += dim
+	}
+	if step > 0 {
+		return min(max(v, 0), dim)
+	}
+	return min(max(v, -1), dim-1)
+}
+
+// gather indexes data along an axis, replacing that dimension with the
+// shape of the indices
+func gather(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	data, indices := in[0], in[1]
+	axis, err := axisOf(n.attrInt("axis", 0), len(data.Shape))
+	if err != nil {
+		return nil, err
+	}
+	ids, err := intsArg(indices, "indices")
+	if err != nil {
+		return nil, err
+	}
+	dim := data.Shape[axis]
+	outer, inner := numel(data.Shape[:axis]), numel(data.Shape[axis+1:])
+	shape := append(append(append([]int{}, data.Shape[:axis]...), indices.Shape...), data.Shape[axis+1:]...)
+	idx := make([]int, 0, numel(shape))
+	for o := 0; o < outer; o++ {
+		for _, id := range ids {
+			if id < 0 {
+				id += int64(dim)
+			}
+			if id < 0 || id >= int64(dim) {
+				return nil, fmt.Errorf("index %d out of range for dimension of size %d", id, dim)
+			}
+			base := (o*dim + int(id)) * inner
+			for k := 0; k < inner; k++ {
+				idx = append(idx, base+k)
+			}
+		}
+	}
+	return one(data.take(shape, idx))
+}
+
+func expand(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	dims, err := intsArg(in[1], "shape")
+	if err != nil {
+		return nil, err
+	}
+	target := make([]int, len(dims))
+	for i, d := range dims {
+		target[i] = int(d)
+	}
+	shape, err := broadcastShapes(x.Shape, target)
+	if err != nil {
+		return nil, err
+	}
+	return one(x.take(shape, broadcastIndex(x.Shape, shape)))
+}
+
+func constantOfShape(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	dims, err := intsArg(in[0], "shape")
+	if err != nil {
+		return nil, err
+	}
+	shape := make([]int, len(dims))
+	for i, d := range dims {
+		if d < 0 {
+			return nil, fmt.Errorf("invalid shape %v", dims)
+		}
+		shape[i] = int(d)
+	}
+	value := NewFloat([]float32{0}, 1)
+	if a, ok := n.Attributes["value"]; ok && a.Tensor != nil {
+		if value, err = scalarArg(a.Tensor, "value"); err != nil {
+			return nil, err
+		}
+	}
+	return one(value.take(shape, make([]int, numel(shape))))
+}
+
+// rangeOp returns the sequence start, start+delta, ... up to but excluding
+// limit
+func rangeOp(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 3); err != nil {
+		return nil, err
+	}
+	for i, name := range []string{"start", "limit", "delta"} {
+		if _, err := scalarArg(in[i], name); err != nil {
+			return nil, err
+		}
+	}
+	if in[0].Type == Float {
+		start, limit, delta := in[0].asFloats()[0], in[1].asFloats()[0], in[2].asFloats()[0]
+		if delta == 0 {
+			return nil, fmt.Errorf("delta cannot be 0")
+		}
+		count := max(int(math.Ceil(float64((limit-start)/delta))), 0)
+		out := make([]float32, count)
+		for i := range out {
+			out[i] = start + float32(i)*delta
+		}
+		return one(NewFloat(out, count))
+	}
+	start, limit, delta := in[0].asInts()[0], in[1].asInts()[0], in[2].asInts()[0]
+	if delta == 0 {
+		return nil, fmt.Errorf("delta cannot be 0")
+	}
+	count := int64(0)
+	if delta > 0 && limit > start {
+		count = (limit - start + delta - 1) / delta
+	} else if delta < 0 && start > limit {
+		count = (start - limit - delta - 1) / -delta
+	}
+	out := make([]int64, count)
+	for i := range out {
+		out[i] = start + int64(i)*delta
+	}
+	return one(NewInt(out, int(count)))
+}
+
+// trilu keeps the upper or lower triangle of the last two dimensions,
+// shifted by the optional diagonal offset k, and zeroes the rest
+func trilu(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	if len(x.Shape) < 2 {
+		return nil, fmt.Errorf("expected at least 2 dimensions, got shape %v", x.Shape)
+	}
+	var k int64
+	if t := input(in, 1); t != nil {
+		if _, err := scalarArg(t, "k"); err != nil {
+			return nil, err
+		}
+		ks, err := intsArg(t, "k")
+		if err != nil {
+			return nil, err
+		}
+		k = ks[0]
+	}
+	upper := n.attrInt("upper", 1) != 0
+
+	rows, cols := x.Shape[len(x.Shape)-2], x.Shape[len(x.Shape)-1]
+	keep := make([]bool, x.Len())
+	for i := range keep {
+		r, c := int64(i/cols%rows), int64(i%cols)
+		if upper {
+			keep[i] = c-r >= k
+		} else {
+			keep[i] = c-r <= k
+		}
+	}
+	zero := &Tensor{Type: x.Type, Shape: []int{1}, Floats: []float32{0}, Ints: []int64{0}, Bools: []bool{false}}
+	idx := make([]int, len(keep))
+	src := &Tensor{Type: x.Type, Shape: []int{x.Len() + 1}}
+	src.appendValues(x)
+	src.appendValues(zero)
+	for i, ok := range keep {
+		idx[i] = i
+		if !ok {
+			idx[i] = x.Len()
+		}
+	}
+	return one(src.take(x.Shape, idx))
+}
+
+func matMul(_ *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	return one(fromFloat(tensor.MatMul(toFloat(in[0]).float(), toFloat(in[1]).float())))
+}
+
+// gemm computes alpha * A' * B' + beta * C for matrices, where A' and B'
+// are optionally transposed
+func gemm(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	a, b := toFloat(in[0]).float(), toFloat(in[1]).float()
+	if a.Dims() != 2 || b.Dims() != 2 {
+		return nil, fmt.Errorf("expected matrices, got %v and %v", a.Shape(), b.Shape())
+	}
+	if n.attrInt("transA", 0) != 0 {
+		a = a.T()
+	}
+	var y *tensor.Tensor
+	if n.attrInt("transB", 0) != 0 {
+		y = tensor.Linear(a, b, nil)
+	} else {
+		y = tensor.MatMul(a, b)
+	}
+	if alpha := n.attrFloat("alpha", 1); alpha != 1 {
+		y = tensor.Scale(y, alpha)
+	}
+	if c := input(in, 2); c != nil {
+		ct := toFloat(c).float()
+		if beta := n.attrFloat("beta", 1); beta != 1 {
+			ct = tensor.Scale(ct, beta)
+		}
+		y = tensor.Add(y, ct)
+	}
+	return one(fromFloat(y))
+}
+
+// softmax normalizes along an axis. Before opset 13 the input is instead
+// flattened to a matrix at axis, default 1, and each row normalized.
+func softmax(n *Node, in []*Tensor, opset int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := toFloat(in[0])
+	if opset >= 13 {
+		axis, err := axisOf(n.attrInt("axis", -1), len(x.Shape))
+		if err != nil {
+			return nil, err
+		}
+		return one(fromFloat(tensor.Softmax(x.float(), axis)))
+	}
+	axis, err := axisOf(n.attrInt("axis", 1), len(x.Shape))
+	if err != nil {
+		return nil, err
+	}
+	rows := tensor.New(x.Floats, numel(x.Shape[:axis]), numel(x.Shape[axis:]))
+	return one(&Tensor{Type: Float, Shape: x.Shape, Floats: tensor.Softmax(rows, -1).Data()})
+}
+
+// layerNormalization normalizes over the dimensions from axis onward. Only
+// the first output, Y, is computed.
+func layerNormalization(n *Node, in []*Tensor, _ int64) ([]*Tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	x := toFloat(in[0])
+	axis, err := axisOf(n.attrInt("axis", -1), len(x.Shape))
+	if err != nil {
+		return nil, err
+	}
+	norm := x.Shape[axis:]
+	inner := numel(norm)
+	// Scale and bias broadcast to the normalized dimensions
+	params := func(t *Tensor) (*tensor.Tensor, error) {
+		t = toFloat(t)
+		shape, err := broadcastShapes(t.Shape, norm)
+		if err != nil || len(shape) != len(norm) {
+			return nil, fmt.Errorf("parameter shape %v does not match %v", t.Shape, norm)
+		}
+		return tensor.New(t.take(shape, broadcastIndex(t.Shape, shape)).Floats, inner), nil
+	}
+	scale, err := params(in[1])
+	if err != nil {
+		return nil, err
+	}
+	var bias *tensor.Tensor
+	if b := input(in, 2); b != nil {
+		if bias, err = params(b); err != nil {
+			return nil, err
+		}
+	}
+	rows := tensor.New(x.Floats, x.Len()/max(inner, 1), inner)
+	y := tensor.LayerNorm(rows, scale, bias, n.attrFloat("epsilon", 1e-5))
+	return one(&Tensor{Type: Float, Shape: x.Shape, Floats: y.Data()})
+}
+
+// reduceOp returns a reduction computing finish(sum, count) over the
+// reduced axes. Axes moved from an attribute to an input at opset 18 for
+// ReduceMean and at opset 13 for ReduceSum.
+func reduceOp(finish func(sum float64, n int) float64) opFunc {
+	return func(n *Node, in []*Tensor, opset int64) ([]*Tensor, error) {
+		if err := requireInputs(in, 1); err != nil {
+			return nil, err
+		}
+		x := toFloat(in[0])
+		since := int64(18)
+		if n.OpType == "ReduceSum" {
+			since = 13
+		}
+		axes, _, err := axesArg(n, in, opset, since)
+		if err != nil {
+			return nil, err
+		}
+		rank := len(x.Shape)
+		reduce := make([]bool, rank)
+		if len(axes) == 0 {
+			if n.attrInt("noop_with_empty_axes", 0) != 0 {
+				return one(x)
+			}
+			for d := range reduce {
+				reduce[d] = true
+			}
+		}
+		for _, a := range axes {
+			axis, err := axisOf(a, rank)
+			if err != nil {
+				return nil, err
+			}
+			reduce[axis] = true
+		}
+
+		// Map every input element to its output element by giving the
+		// reduced dimensions a stride of zero
+		kept := make([]int, rank)
+		for d, size := range x.Shape {
+			kept[d] = size
+			if reduce[d] {
+				kept[d] = 1
+			}
+		}
+		outStrides := stridesOf(kept)
+		for d := range outStrides {
+			if reduce[d] {
+				outStrides[d] = 0
+			}
+		}
+		count := x.Len() / max(numel(kept), 1)
+		sums := make([]float64, numel(kept))
+		for i, j := range stridedIndex(x.Shape, outStrides, 0) {
+			sums[j] += float64(x.Floats[i])
+		}
+		out := make([]float32, len(sums))
+		for i, s := range sums {
+			out[i] = float32(finish(s, count))
+		}
+
+		shape := kept
+		if n.attrInt("keepdims", 1) == 0 {
+			shape = []int{}
+			for d, size := range x.Shape {
+				if !reduce[d] {
+					shape = append(shape, size)
+				}
+			}
+		}
+		return one(NewFloat(out, shape...))
+	}
+}
@@ -0,0 +1,359 @@
+package onnx
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+func intsAttr(v ...int64) *Attribute {
+	return &Attribute{Type: AttributeInts, Ints: v}
+}
+
+func intAttr(v int64) *Attribute {
+	return &Attribute{Type: AttributeInt, Int: v}
+}
+
+func floatAttr(v float32) *Attribute {
+	return &Attribute{Type: AttributeFloat, Float: v}
+}
+
+func floats(v ...float32) []float32 { return v }
+
+// runOp runs a graph holding a single node. Nil inputs are passed as
+// omitted optional inputs.
+func runOp(opset int64, op string, attrs map[string]*Attribute, outputs int, inputs ...*Tensor) ([]*Tensor, error) {
+	n := &Node{OpType: op, Attributes: attrs}
+	g := &Graph{Initializers: map[string]*Tensor{}}
+	feeds := map[string]*Tensor{}
+	for i, in := range inputs {
+		name := ""
+		if in != nil {
+			name = string(rune('a' + i))
+			g.Inputs = append(g.Inputs, ValueInfo{Name: name})
+			feeds[name] = in
+		}
+		n.Inputs = append(n.Inputs, name)
+	}
+	for i := 0; i < outputs; i++ {
+		name := string(rune('y' - i))
+		n.Outputs = append(n.Outputs, name)
+		g.Outputs = append(g.Outputs, ValueInfo{Name: name})
+	}
+	g.Nodes = []*Node{n}
+	m := &Model{OpsetImports: map[string]int64{"": opset}, Graph: g}
+	result, err := m.Run(context.Background(), feeds)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Tensor, outputs)
+	for i, name := range n.Outputs {
+		out[i] = result[name]
+	}
+	return out, nil
+}
+
+func run1(t *testing.T, opset int64, op string, attrs map[string]*Attribute, inputs ...*Tensor) *Tensor {
+	t.Helper()
+	out, err := runOp(opset, op, attrs, 1, inputs...)
+	if err != nil {
+		t.Fatalf("%s: expected no error, got %v", op, err)
+	}
+	return out[0]
+}
+
+func approxEqual(a, b []float32, tol float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > tol {
+			return false
+		}
+	}
+	return true
+}
+
+func TestElementwise(t *testing.T) {
+	a := NewFloat(floats(1, 2, 3, 4, 5, 6), 2, 3)
+	b := NewFloat(floats(10, 20, 30), 3)
+	if got := run1(t, 17, "Add", nil, a, b); !reflect.DeepEqual(got.Floats, floats(11, 22, 33, 14, 25, 36)) {
+		t.Errorf("Expected broadcast sum, got %v", got.Floats)
+	}
+
+	// Integer arithmetic stays integer; mixed operands are promoted
+	i := NewInt([]int64{7, -7}, 2)
+	got := run1(t, 17, "Div", nil, i, NewInt([]int64{2}))
+	if got.Type != Int64 || !reflect.DeepEqual(got.Ints, []int64{3, -3}) {
+		t.Errorf("Expected int64 [3 -3], got %v %v", got, got.Ints)
+	}
+	if got := run1(t, 17, "Mul", nil, i, NewFloat(floats(0.5))); got.Type != Float || !reflect.DeepEqual(got.Floats, floats(3.5, -3.5)) {
+		t.Errorf("Expected float [3.5 -3.5], got %v %v", got, got.Floats)
+	}
+
+	if got := run1(t, 17, "Less", nil, a, NewFloat(floats(3))); !reflect.DeepEqual(got.Bools, []bool{true, true, false, false, false, false}) {
+		t.Errorf("Expected comparison mask, got %v", got.Bools)
+	}
+	cond := NewBool([]bool{true, false, true}, 3)
+	if got := run1(t, 17, "Where", nil, cond, a, NewFloat(floats(-1))); !reflect.DeepEqual(got.Floats, floats(1, -1, 3, 4, -1, 6)) {
+		t.Errorf("Expected selection, got %v", got.Floats)
+	}
+	if got := run1(t, 17, "Max", nil, a, b, NewFloat(floats(25))); !reflect.DeepEqual(got.Floats, floats(25, 25, 30, 25, 25, 30)) {
+		t.Errorf("Expected elementwise maximum, got %v", got.Floats)
+	}
+
+	erf := run1(t, 17, "Erf", nil, NewFloat(floats(0, 1), 2))
+	if !approxEqual(erf.Floats, floats(0, 0.84270079), 1e-6) {
+		t.Errorf("Expected erf values, got %v", erf.Floats)
+	}
+
+	cast := run1(t, 17, "Cast", map[string]*Attribute{"to": intAttr(int64(Int64))}, NewFloat(floats(1.7, -1.7), 2))
+	if cast.Type != Int64 || !reflect.DeepEqual(cast.Ints, []int64{1, -1}) {
+		t.Errorf("Expected truncated int64 values, got %v %v", cast, cast.Ints)
+	}
+
+	if _, err := runOp(17, "Add", nil, 1, a, NewFloat(floats(1, 2), 2)); err == nil || !strings.Contains(err.Error(), "Add") {
+		t.Errorf("Expected an error naming the operator for incompatible shapes, got %v", err)
+	}
+}
+
+func TestShapeOps(t *testing.T) {
+	x := NewFloat(floats(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11), 2, 3, 2)
+
+	shape := run1(t, 17, "Shape", nil, x)
+	if !reflect.DeepEqual(shape.Ints, []int64{2, 3, 2}) || !reflect.DeepEqual(shape.Shape, []int{3}) {
+		t.Errorf("Expected [2 3 2], got %v", shape.Ints)
+	}
+	dim := run1(t, 17, "Gather", nil, shape, NewInt([]int64{-1}))
+	if !reflect.DeepEqual(dim.Ints, []int64{2}) || len(dim.Shape) != 0 {
+		t.Errorf("Expected scalar 2, got %v %v", dim, dim.Ints)
+	}
+
+	// The dynamic reshape Hugging Face exports build for attention heads
+	newShape := run1(t, 17, "Concat", map[string]*Attribute{"axis": intAttr(0)},
+		NewInt([]int64{0}, 1), NewInt([]int64{-1}, 1), NewInt([]int64{3, 2}, 2))
+	r := run1(t, 17, "Reshape", nil, x, newShape)
+	if !reflect.DeepEqual(r.Shape, []int{2, 1, 3, 2}) {
+		t.Errorf("Expected shape [2 1 3 2], got %v", r.Shape)
+	}
+
+	tr := run1(t, 17, "Transpose", map[string]*Attribute{"perm": intsAttr(1, 0, 2)}, x)
+	if !reflect.DeepEqual(tr.Shape, []int{3, 2, 2}) || !reflect.DeepEqual(tr.Floats, floats(0, 1, 6, 7, 2, 3, 8, 9, 4, 5, 10, 11)) {
+		t.Errorf("Expected transposed values, got %v %v", tr.Shape, tr.Floats)
+	}
+
+	// Axes are an attribute before opset 13 and an input from then on
+	u := run1(t, 11, "Unsqueeze", map[string]*Attribute{"axes": intsAttr(0, -1)}, x)
+	if !reflect.DeepEqual(u.Shape, []int{1, 2, 3, 2, 1}) {
+		t.Errorf("Expected shape [1 2 3 2 1], got %v", u.Shape)
+	}
+	u = run1(t, 13, "Unsqueeze", nil, x, NewInt([]int64{1}, 1))
+	if !reflect.DeepEqual(u.Shape, []int{2, 1, 3, 2}) {
+		t.Errorf("Expected shape [2 1 3 2], got %v", u.Shape)
+	}
+	if s := run1(t, 13, "Squeeze", nil, u); !reflect.DeepEqual(s.Shape, []int{2, 3, 2}) {
+		t.Errorf("Expected shape [2 3 2], got %v", s.Shape)
+	}
+	if f := run1(t, 13, "Flatten", nil, x); !reflect.DeepEqual(f.Shape, []int{2, 6}) {
+		t.Errorf("Expected shape [2 6], got %v", f.Shape)
+	}
+
+	e := run1(t, 13, "Expand", nil, NewFloat(floats(1, 2), 2, 1), NewInt([]int64{2, 3}, 2))
+	if !reflect.DeepEqual(e.Floats, floats(1, 1, 1, 2, 2, 2)) {
+		t.Errorf("Expected expanded values, got %v", e.Floats)
+	}
+
+	c := run1(t, 13, "ConstantOfShape", map[string]*Attribute{"value": {Type: AttributeTensor, Tensor: NewInt([]int64{7}, 1)}}, NewInt([]int64{2, 2}, 2))
+	if c.Type != Int64 || !reflect.DeepEqual(c.Ints, []int64{7, 7, 7, 7}) {
+		t.Errorf("Expected four sevens, got %v %v", c, c.Ints)
+	}
+
+	rng := run1(t, 13, "Range", nil, NewInt([]int64{5}), NewInt([]int64{0}), NewInt([]int64{-2}))
+	if !reflect.DeepEqual(rng.Ints, []int64{5, 3, 1}) {
+		t.Errorf("Expected [5 3 1], got %v", rng.Ints)
+	}
+
+	if _, err := runOp(17, "Reshape", nil, 1, x, NewInt([]int64{5, -1}, 2)); err == nil {
+		t.Error("Expected error reshaping 12 elements to [5 -1]")
+	}
+}
+
+func TestSlice(t *testing.T) {
+	x := NewFloat(floats(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11), 3, 4)
+	tests := []struct {
+		starts, ends, axes, steps []int64
+		shape                     []int
+		expected                  []float32
+	}{
+		{[]int64{1}, []int64{math.MaxInt64}, []int64{1}, nil, []int{3, 3}, floats(1, 2, 3, 5, 6, 7, 9, 10, 11)},
+		{[]int64{0, -1}, []int64{2, -5}, nil, []int64{1, -2}, []int{2, 2}, floats(3, 1, 7, 5)},
+		{[]int64{-1}, []int64{math.MinInt64}, []int64{0}, []int64{-1}, []int{3, 4}, floats(8, 9, 10, 11, 4, 5, 6, 7, 0, 1, 2, 3)},
+		{[]int64{2}, []int64{1}, []int64{0}, nil, []int{0, 4}, []float32{}},
+	}
+	for _, tt := range tests {
+		inputs := []*Tensor{x, NewInt(tt.starts, len(tt.starts)), NewInt(tt.ends, len(tt.ends)), nil, nil}
+		if tt.axes != nil {
+			inputs[3] = NewInt(tt.axes, len(tt.axes))
+		}
+		if tt.steps != nil {
+			inputs[4] = NewInt(tt.steps, len(tt.steps))
+		}
+		got := run1(t, 13, "Slice", nil, inputs...)
+		if !reflect.DeepEqual(got.Shape, tt.shape) || !reflect.DeepEqual(got.Floats, tt.expected) {
+			t.Errorf("Slice %v:%v axes %v steps %v: expected %v %v, got %v %v", tt.starts, tt.ends, tt.axes, tt.steps, tt.shape, tt.expected, got.Shape, got.Floats)
+		}
+	}
+
+	old := run1(t, 9, "Slice", map[string]*Attribute{"starts": intsAttr(1), "ends": intsAttr(3), "axes": intsAttr(1)}, x)
+	if !reflect.DeepEqual(old.Floats, floats(1, 2, 5, 6, 9, 10)) {
+		t.Errorf("Expected attribute-form slice, got %v", old.Floats)
+	}
+
+	parts, err := runOp(13, "Split", map[string]*Attribute{"axis": intAttr(1)}, 2, x)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(parts[0].Floats, floats(0, 1, 4, 5, 8, 9)) || !reflect.DeepEqual(parts[1].Floats, floats(2, 3, 6, 7, 10, 11)) {
+		t.Errorf("Expected two column halves, got %v and %v", parts[0].Floats, parts[1].Floats)
+	}
+}
+
+func TestMathOps(t *testing.T) {
+	a := NewFloat(floats(1, 2, 3, 4, 5, 6), 2, 3)
+	b := NewFloat(floats(1, 0, 0, 1, 1, 1), 2, 3)
+	c := NewFloat(floats(10, 20), 2)
+
+	// alpha * a * b^T + beta * c
+	attrs := map[string]*Attribute{"transB": intAttr(1), "alpha": floatAttr(2), "beta": floatAttr(0.5)}
+	got := run1(t, 13, "Gemm", attrs, a, b, c)
+	if !reflect.DeepEqual(got.Shape, []int{2, 2}) || !reflect.DeepEqual(got.Floats, floats(7, 22, 13, 40)) {
+		t.Errorf("Expected [7 22 13 40], got %v %v", got.Shape, got.Floats)
+	}
+	mm := run1(t, 13, "MatMul", nil, a, NewFloat(floats(1, 1, 1), 3))
+	if !reflect.DeepEqual(mm.Floats, floats(6, 15)) {
+		t.Errorf("Expected row sums, got %v", mm.Floats)
+	}
+
+	// Softmax before opset 13 normalizes over all trailing dimensions
+	x := NewFloat(floats(0, 0, 0, 0), 2, 2)
+	if got := run1(t, 11, "Softmax", map[string]*Attribute{"axis": intAttr(0)}, x); !approxEqual(got.Floats, floats(0.25, 0.25, 0.25, 0.25), 1e-6) {
+		t.Errorf("Expected uniform values over the whole tensor, got %v", got.Floats)
+	}
+	if got := run1(t, 13, "Softmax", map[string]*Attribute{"axis": intAttr(0)}, x); !approxEqual(got.Floats, floats(0.5, 0.5, 0.5, 0.5), 1e-6) {
+		t.Errorf("Expected uniform values per column, got %v", got.Floats)
+	}
+
+	ln := run1(t, 17, "LayerNormalization", nil, a, NewFloat(floats(1, 2, 1), 3), NewFloat(floats(0, 0, 1), 3))
+	expected := floats(-1.2247357, 0, 2.2247357, -1.2247357, 0, 2.2247357)
+	if !approxEqual(ln.Floats, expected, 1e-4) {
+		t.Errorf("Expected %v, got %v", expected, ln.Floats)
+	}
+
+	mean := run1(t, 13, "ReduceMean", map[string]*Attribute{"axes": intsAttr(-1)}, a)
+	if !reflect.DeepEqual(mean.Shape, []int{2, 1}) || !reflect.DeepEqual(mean.Floats, floats(2, 5)) {
+		t.Errorf("Expected [[2] [5]], got %v %v", mean.Shape, mean.Floats)
+	}
+	sum := run1(t, 13, "ReduceSum", map[string]*Attribute{"keepdims": intAttr(0)}, a, NewInt([]int64{0}, 1))
+	if !reflect.DeepEqual(sum.Shape, []int{3}) || !reflect.DeepEqual(sum.Floats, floats(5, 7, 9)) {
+		t.Errorf("Expected [5 7 9], got %v %v", sum.Shape, sum.Floats)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	x := NewFloat(floats(1), 1)
+	if _, err := runOp(17, "NonMaxSuppression", nil, 1, x); !errors.Is(err, errs.ErrNotImplemented) || !strings.Contains(err.Error(), "NonMaxSuppression") {
+		t.Errorf("Expected a not implemented error for NonMaxSuppression, got %v", err)
+	}
+	if _, err := runOp(17, "Gather", nil, 1, x, NewInt([]int64{3}, 1)); err == nil {
+		t.Error("Expected error for an out of range index")
+	}
+
+	m := &Model{
+		OpsetImports: map[string]int64{"": 17},
+		Graph: &Graph{
+			Nodes:   []*Node{{OpType: "Relu", Inputs: []string{"x"}, Outputs: []string{"y"}}},
+			Inputs:  []ValueInfo{{Name: "x", Type: Float, Shape: []Dim{{Param: "n"}}}},
+			Outputs: []ValueInfo{{Name: "y"}},
+		},
+	}
+	if _, err := m.Run(context.Background(), nil); err == nil {
+		t.Error("Expected error for a missing input")
+	}
+	if _, err := m.Run(context.Background(), map[string]*Tensor{"x": NewInt([]int64{1}, 1)}); err == nil {
+		t.Error("Expected error for an input of the wrong type")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Run(ctx, map[string]*Tensor{"x": x}); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	out, err := m.Run(context.Background(), map[string]*Tensor{"x": NewFloat(floats(-1, 2), 2)})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(out["y"].Floats, floats(0, 2)) {
+		t.Errorf("Expected [0 2], got %v", out["y"].Floats)
+	}
+
+	m.Graph.Nodes[0].Domain = "ai.onnx.ml"
+	if _, err := m.Run(context.Background(), map[string]*Tensor{"x": x}); err == nil {
+		t.Error("Expected error for an unsupported domain")
+	}
+}
+
+func TestTrilu(t *testing.T) {
+	x := NewFloat(floats(1, 2, 3, 4, 5, 6, 7, 8, 9), 3, 3)
+	upper := run1(t, 14, "Trilu", nil, x, NewInt([]int64{1}))
+	if !reflect.DeepEqual(upper.Floats, floats(0, 2, 3, 0, 0, 6, 0, 0, 0)) {
+		t.Errorf("Expected the triangle above the diagonal, got %v", upper.Floats)
+	}
+	lower := run1(t, 14, "Trilu", map[string]*Attribute{"upper": intAttr(0)}, NewInt([]int64{1, 2, 3, 4}, 1, 2, 2))
+	if !reflect.DeepEqual(lower.Ints, []int64{1, 0, 3, 4}) {
+		t.Errorf("Expected the lower triangle, got %v", lower.Ints)
+	}
+}
+
+func TestIf(t *testing.T) {
+	branch := func(op string) *Attribute {
+		return &Attribute{Type: AttributeGraph, Graph: &Graph{
+			Nodes:        []*Node{{OpType: op, Inputs: []string{"r", "c"}, Outputs: []string{"out"}}},
+			Initializers: map[string]*Tensor{"c": NewFloat(floats(10))},
+			Outputs:      []ValueInfo{{Name: "out"}},
+		}}
+	}
+	// r is an intermediate value read only inside the branches, so it must
+	// outlive the node that computes it
+	m := &Model{
+		OpsetImports: map[string]int64{"": 17},
+		Graph: &Graph{
+			Nodes: []*Node{
+				{OpType: "Relu", Inputs: []string{"x"}, Outputs: []string{"r"}},
+				{OpType: "If", Inputs: []string{"cond"}, Outputs: []string{"y"},
+					Attributes: map[string]*Attribute{"then_branch": branch("Add"), "else_branch": branch("Sub")}},
+			},
+			Inputs:  []ValueInfo{{Name: "x"}, {Name: "cond"}},
+			Outputs: []ValueInfo{{Name: "y"}},
+		},
+	}
+	x := NewFloat(floats(-1, 2), 2)
+	for _, tt := range []struct {
+		cond     bool
+		expected []float32
+	}{{true, floats(10, 12)}, {false, floats(-10, -8)}} {
+		out, err := m.Run(context.Background(), map[string]*Tensor{"x": x, "cond": NewBool([]bool{tt.cond}, 1)})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(out["y"].Floats, tt.expected) {
+			t.Errorf("cond=%v: expected %v, got %v", tt.cond, tt.expected, out["y"].Floats)
+		}
+	}
+	if _, err := m.Run(context.Background(), map[string]*Tensor{"x": x, "cond": NewBool([]bool{true, false}, 2)}); err == nil {
+		t.Error("Expected error for a condition with two values")
+	}
+}
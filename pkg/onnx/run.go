@@ -0,0 +1,218 @@
+package onnx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+// opFunc computes the outputs of a node. Omitted optional inputs are nil.
+// opset is the version of the operator set the node's domain was imported
+// at, which selects between the attribute and input forms of operators that
+// changed over time.
+type opFunc func(n *Node, in []*Tensor, opset int64) ([]*Tensor, error)
+
+// domains lists the operator domains the interpreter implements. Microsoft
+// contrib operators appear in graphs optimized by ONNX Runtime tooling.
+var domains = map[string]bool{"": true, "ai.onnx": true, "com.microsoft": true}
+
+// scope holds the values visible while running a graph. Subgraphs, such as
+// the branches of If, see the values of the graphs enclosing them.
+type scope struct {
+	values map[string]*Tensor
+	parent *scope
+}
+
+func (s *scope) lookup(name string) (*Tensor, bool) {
+	for ; s != nil; s = s.parent {
+		if t, ok := s.values[name]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Run executes the graph with the given inputs, keyed by graph input name,
+// and returns every graph output keyed by name. Run may be called
+// concurrently; initializers are shared and never modified.
+func (m *Model) Run(ctx context.Context, inputs map[string]*Tensor) (map[string]*Tensor, error) {
+	g := m.Graph
+	s := &scope{values: make(map[string]*Tensor, len(g.Initializers)+len(inputs))}
+	for name, t := range g.Initializers {
+		s.values[name] = t
+	}
+	for _, vi := range g.Inputs {
+		t, ok := inputs[vi.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing input %q", vi.Name)
+		}
+		if want, ok := vi.Type.storage(); ok && t.Type != want {
+			return nil, fmt.Errorf("input %q: expected %s tensor, got %s", vi.Name, vi.Type, t.Type)
+		}
+		if vi.Shape != nil && len(vi.Shape) != len(t.Shape) {
+			return nil, fmt.Errorf("input %q: expected %d dimensions, got shape %v", vi.Name, len(vi.Shape), t.Shape)
+		}
+		s.values[vi.Name] = t
+	}
+	return m.runGraph(ctx, g, s)
+}
+
+// runGraph executes the nodes of g in s and returns g's outputs
+func (m *Model) runGraph(ctx context.Context, g *Graph, s *scope) (map[string]*Tensor, error) {
+	lastUse := lastUses(g)
+	for i, n := range g.Nodes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		outputs, err := m.runNode(ctx, n, s)
+		if err != nil {
+			name := n.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i)
+			}
+			return nil, fmt.Errorf("node %s (%s): %w", name, n.OpType, err)
+		}
+		for j, name := range n.Outputs {
+			if name != "" && j < len(outputs) {
+				s.values[name] = outputs[j]
+			}
+		}
+		// Release intermediate values nothing reads any more
+		for name, last := range lastUse[i] {
+			if last {
+				delete(s.values, name)
+			}
+		}
+	}
+
+	result := make(map[string]*Tensor, len(g.Outputs))
+	for _, vi := range g.Outputs {
+		t, ok := s.lookup(vi.Name)
+		if !ok {
+			return nil, fmt.Errorf("graph output %q was not computed", vi.Name)
+		}
+		result[vi.Name] = t
+	}
+	return result, nil
+}
+
+// runNode gathers a node's inputs and applies its operator, turning the
+// panics pkg/tensor raises on bad shapes into errors
+func (m *Model) runNode(ctx context.Context, n *Node, s *scope) (outputs []*Tensor, err error) {
+	if !domains[n.Domain] {
+		return nil, fmt.Errorf("operator domain %q is %w", n.Domain, errs.ErrNotImplemented)
+	}
+	op, ok := operators[n.OpType]
+	if !ok && n.OpType != "If" {
+		return nil, fmt.Errorf("operator %w", errs.ErrNotImplemented)
+	}
+	in := make([]*Tensor, len(n.Inputs))
+	for i, name := range n.Inputs {
+		if name == "" {
+			continue
+		}
+		t, ok := s.lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("input %q is not defined", name)
+		}
+		in[i] = t
+	}
+	if n.OpType == "If" {
+		return m.runIf(ctx, n, in, s)
+	}
+
+	opset := m.Opset()
+	if n.Domain == "com.microsoft" {
+		opset = m.OpsetImports[n.Domain]
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			outputs, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return op(n, in, opset)
+}
+
+// runIf runs the then_branch or else_branch subgraph of an If node
+// depending on its single boolean input
+func (m *Model) runIf(ctx context.Context, n *Node, in []*Tensor, s *scope) ([]*Tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	cond := in[0]
+	if cond.Type != Bool || cond.Len() != 1 {
+		return nil, fmt.Errorf("condition must be a single bool, got %s", cond)
+	}
+	branch := "else_branch"
+	if cond.Bools[0] {
+		branch = "then_branch"
+	}
+	a, ok := n.Attributes[branch]
+	if !ok || a.Graph == nil {
+		return nil, fmt.Errorf("missing %s", branch)
+	}
+	g := a.Graph
+
+	local := &scope{values: make(map[string]*Tensor, len(g.Initializers)), parent: s}
+	for name, t := range g.Initializers {
+		local.values[name] = t
+	}
+	result, err := m.runGraph(ctx, g, local)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", branch, err)
+	}
+	outputs := make([]*Tensor, len(g.Outputs))
+	for i, vi := range g.Outputs {
+		outputs[i] = result[vi.Name]
+	}
+	return outputs, nil
+}
+
+// lastUses returns, for every node, the values computed by g's nodes that
+// the node is the last to read. Graph outputs are kept, and a value read
+// inside a subgraph counts as read by the node holding the subgraph.
+func lastUses(g *Graph) []map[string]bool {
+	produced := make(map[string]bool)
+	for _, n := range g.Nodes {
+		for _, name := range n.Outputs {
+			produced[name] = true
+		}
+	}
+	for _, vi := range g.Outputs {
+		delete(produced, vi.Name)
+	}
+
+	last := make(map[string]int)
+	for i, n := range g.Nodes {
+		for _, name := range reads(n) {
+			if produced[name] {
+				last[name] = i
+			}
+		}
+	}
+	uses := make([]map[string]bool, len(g.Nodes))
+	for name, i := range last {
+		if uses[i] == nil {
+			uses[i] = make(map[string]bool)
+		}
+		uses[i][name] = true
+	}
+	return uses
+}
+
+// reads returns the names a node reads, including those read by the nodes
+// of its subgraphs
+func reads(n *Node) []string {
+	names := n.Inputs
+	for _, a := range n.Attributes {
+		if a.Graph == nil {
+			continue
+		}
+		names = append([]string{}, names...)
+		for _, sub := range a.Graph.Nodes {
+			names = append(names, reads(sub)...)
+		}
+	}
+	return names
+}
@@ -0,0 +1,410 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/tensor"
+)
+
+// DataType is an ONNX tensor element type
+type DataType int32
+
+const (
+	Undefined DataType = 0
+	Float     DataType = 1
+	Uint8     DataType = 2
+	Int8      DataType = 3
+	Uint16    DataType = 4
+	Int16     DataType = 5
+	Int32     DataType = 6
+	Int64     DataType = 7
+	String    DataType = 8
+	Bool      DataType = 9
+	Float16   DataType = 10
+	Double    DataType = 11
+	Uint32    DataType = 12
+	Uint64    DataType = 13
+	BFloat16  DataType = 16
+)
+
+var dataTypeNames = map[DataType]string{
+	Undefined: "undefined", Float: "float", Uint8: "uint8", Int8: "int8", Uint16: "uint16",
+	Int16: "int16", Int32: "int32", Int64: "int64", String: "string", Bool: "bool",
+	Float16: "float16", Double: "double", Uint32: "uint32", Uint64: "uint64", BFloat16: "bfloat16",
+}
+
+// dataTypeSizes holds the size in bytes of the numeric types in raw data
+var dataTypeSizes = map[DataType]int{
+	Float: 4, Uint8: 1, Int8: 1, Uint16: 2, Int16: 2, Int32: 4, Int64: 8, Bool: 1,
+	Float16: 2, Double: 8, Uint32: 4, Uint64: 8, BFloat16: 2,
+}
+
+func (t DataType) String() string {
+	if name, ok := dataTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("DataType(%d)", int32(t))
+}
+
+// storage returns the type a value of type t is held as: Float for every
+// floating-point type, Int64 for every integer type and Bool for booleans
+func (t DataType) storage() (DataType, bool) {
+	switch t {
+	case Float, Float16, BFloat16, Double:
+		return Float, true
+	case Uint8, Int8, Uint16, Int16, Int32, Int64, Uint32, Uint64:
+		return Int64, true
+	case Bool:
+		return Bool, true
+	}
+	return Undefined, false
+}
+
+// Tensor is a value in an ONNX graph. Floating-point tensors hold float32
+// values in Floats, integer tensors of every width hold int64 values in Ints
+// and boolean tensors hold Bools; Type is Float, Int64 or Bool accordingly.
+// A tensor with an empty shape is a scalar.
+type Tensor struct {
+	Type   DataType
+	Shape  []int
+	Floats []float32
+	Ints   []int64
+	Bools  []bool
+}
+
+// NewFloat returns a float tensor backed by data
+func NewFloat(data []float32, shape ...int) *Tensor {
+	checkLen(len(data), shape)
+	return &Tensor{Type: Float, Shape: shape, Floats: data}
+}
+
+// NewInt returns an integer tensor backed by data
+func NewInt(data []int64, shape ...int) *Tensor {
+	checkLen(len(data), shape)
+	return &Tensor{Type: Int64, Shape: shape, Ints: data}
+}
+
+// NewBool returns a boolean tensor backed by data
+func NewBool(data []bool, shape ...int) *Tensor {
+	checkLen(len(data), shape)
+	return &Tensor{Type: Bool, Shape: shape, Bools: data}
+}
+
+func checkLen(n int, shape []int) {
+	if numel(shape) != n {
+		panic(fmt.Sprintf("onnx: %d values do not fit shape %v", n, shape))
+	}
+}
+
+// Len returns the number of elements
+func (t *Tensor) Len() int {
+	return numel(t.Shape)
+}
+
+func (t *Tensor) String() string {
+	return fmt.Sprintf("%s%v", t.Type, t.Shape)
+}
+
+// float returns a float tensor as a pkg/tensor view sharing its data
+func (t *Tensor) float() *tensor.Tensor {
+	return tensor.New(t.Floats, t.Shape...)
+}
+
+// fromFloat wraps the result of a pkg/tensor operation
+func fromFloat(t *tensor.Tensor) *Tensor {
+	return &Tensor{Type: Float, Shape: t.Shape(), Floats: t.Data()}
+}
+
+// withShape returns a tensor sharing t's data with a new shape
+func (t *Tensor) withShape(shape []int) *Tensor {
+	out := *t
+	out.Shape = shape
+	return &out
+}
+
+// take returns a tensor of the given shape whose element i is element
+// idx[i] of t. Layout operations such as Transpose, Slice, Gather and
+// Expand are all expressed this way.
+func (t *Tensor) take(shape []int, idx []int) *Tensor {
+	out := &Tensor{Type: t.Type, Shape: shape}
+	switch t.Type {
+	case Float:
+		out.Floats = takeSlice(t.Floats, idx)
+	case Int64:
+		out.Ints = takeSlice(t.Ints, idx)
+	case Bool:
+		out.Bools = takeSlice(t.Bools, idx)
+	}
+	return out
+}
+
+func takeSlice[T any](src []T, idx []int) []T {
+	out := make([]T, len(idx))
+	for i, j := range idx {
+		out[i] = src[j]
+	}
+	return out
+}
+
+// asFloats returns the values of a tensor of any type as float32
+func (t *Tensor) asFloats() []float32 {
+	switch t.Type {
+	case Int64:
+		out := make([]float32, len(t.Ints))
+		for i, v := range t.Ints {
+			out[i] = float32(v)
+		}
+		return out
+	case Bool:
+		out := make([]float32, len(t.Bools))
+		for i, v := range t.Bools {
+			if v {
+				out[i] = 1
+			}
+		}
+		return out
+	}
+	return t.Floats
+}
+
+// asInts returns the values of a tensor of any type as int64, truncating
+// floats toward zero
+func (t *Tensor) asInts() []int64 {
+	switch t.Type {
+	case Float:
+		out := make([]int64, len(t.Floats))
+		for i, v := range t.Floats {
+			out[i] = int64(v)
+		}
+		return out
+	case Bool:
+		out := make([]int64, len(t.Bools))
+		for i, v := range t.Bools {
+			if v {
+				out[i] = 1
+			}
+		}
+		return out
+	}
+	return t.Ints
+}
+
+// numel returns the number of elements of a shape
+func numel(shape []int) int {
+	n := 1
+	for _, d := range shape {
+		n *= d
+	}
+	return n
+}
+
+// checkedNumel returns the number of values in shape times size, and false
+// when it does not fit in an int
+func checkedNumel(shape []int, size int) (int, bool) {
+	n := uint64(size)
+	for _, d := range shape {
+		hi, lo := bits.Mul64(n, uint64(d))
+		if hi != 0 || lo > math.MaxInt {
+			return 0, false
+		}
+		n = lo
+	}
+	return int(n), true
+}
+
+// stridesOf returns the row-major strides of a shape
+func stridesOf(shape []int) []int {
+	strides := make([]int, len(shape))
+	s := 1
+	for d := len(shape) - 1; d >= 0; d-- {
+		strides[d] = s
+		s *= shape[d]
+	}
+	return strides
+}
+
+// stridedIndex returns the source index of every element of a tensor of the
+// given shape, in row-major order, when element [i0, i1, ...] is read from
+// offset + i0*strides[0] + i1*strides[1] + ...
+func stridedIndex(shape, strides []int, offset int) []int {
+	n := numel(shape)
+	idx := make([]int, n)
+	counter := make([]int, len(shape))
+	pos := offset
+	for i := 0; i < n; i++ {
+		idx[i] = pos
+		for d := len(shape) - 1; d >= 0; d-- {
+			counter[d]++
+			pos += strides[d]
+			if counter[d] < shape[d] {
+				break
+			}
+			pos -= strides[d] * counter[d]
+			counter[d] = 0
+		}
+	}
+	return idx
+}
+
+// broadcastIndex maps every element of shape out to the element of shape in
+// that broadcasts to it
+func broadcastIndex(in, out []int) []int {
+	strides := make([]int, len(out))
+	inStrides := stridesOf(in)
+	for d := range in {
+		if in[d] != 1 {
+			strides[len(out)-len(in)+d] = inStrides[d]
+		}
+	}
+	return stridedIndex(out, strides, 0)
+}
+
+// broadcastShapes returns the shape that shapes broadcast to under NumPy
+// rules
+func broadcastShapes(shapes ...[]int) ([]int, error) {
+	rank := 0
+	for _, s := range shapes {
+		rank = max(rank, len(s))
+	}
+	out := make([]int, rank)
+	for i := range out {
+		out[i] = 1
+	}
+	for _, s := range shapes {
+		off := rank - len(s)
+		for d, n := range s {
+			switch {
+			case out[off+d] == 1:
+				out[off+d] = n
+			case n != 1 && n != out[off+d]:
+				return nil, fmt.Errorf("shapes %v cannot be broadcast together", shapes)
+			}
+		}
+	}
+	return out, nil
+}
+
+// convert turns a decoded TensorProto into a Tensor, widening integer
+// types to int64 and floating-point types to float32
+func (tp *tensorProto) convert() (*Tensor, error) {
+	shape := make([]int, len(tp.dims))
+	for i, d := range tp.dims {
+		if d < 0 || d > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid dimension %d", d)
+		}
+		shape[i] = int(d)
+	}
+	storage, ok := tp.dataType.storage()
+	if !ok {
+		return nil, fmt.Errorf("unsupported data type %s", tp.dataType)
+	}
+	n, ok := checkedNumel(shape, 1)
+	if !ok {
+		return nil, fmt.Errorf("%s shape %v is too large", tp.dataType, shape)
+	}
+	t := &Tensor{Type: storage, Shape: shape}
+
+	if tp.raw != nil || tp.isExternal {
+		size, ok := checkedNumel(shape, dataTypeSizes[tp.dataType])
+		if !ok {
+			return nil, fmt.Errorf("%s shape %v is too large", tp.dataType, shape)
+		}
+		if len(tp.raw) != size {
+			return nil, fmt.Errorf("%d bytes of raw data do not fit %s shape %v", len(tp.raw), tp.dataType, shape)
+		}
+		t.decodeRaw(tp.dataType, tp.raw, n)
+		return t, nil
+	}
+
+	// Typed fields: int32_data also carries the narrower integer types,
+	// booleans and the bit patterns of float16 and bfloat16
+	var count int
+	switch tp.dataType {
+	case Float:
+		t.Floats, count = tp.floats, len(tp.floats)
+	case Double:
+		t.Floats = make([]float32, len(tp.doubles))
+		for i, v := range tp.doubles {
+			t.Floats[i] = float32(v)
+		}
+		count = len(tp.doubles)
+	case Int64:
+		t.Ints, count = tp.int64s, len(tp.int64s)
+	case Uint32, Uint64:
+		t.Ints, count = tp.uint64s, len(tp.uint64s)
+	case Float16, BFloat16:
+		t.Floats = make([]float32, len(tp.int32s))
+		for i, v := range tp.int32s {
+			t.Floats[i] = halfToFloat32(tp.dataType, uint16(v))
+		}
+		count = len(tp.int32s)
+	case Bool:
+		t.Bools = make([]bool, len(tp.int32s))
+		for i, v := range tp.int32s {
+			t.Bools[i] = v != 0
+		}
+		count = len(tp.int32s)
+	default:
+		t.Ints, count = tp.int32s, len(tp.int32s)
+	}
+	if count != n {
+		return nil, fmt.Errorf("%d values do not fit %s shape %v", count, tp.dataType, shape)
+	}
+	if t.Type == Float && t.Floats == nil {
+		t.Floats = []float32{}
+	}
+	return t, nil
+}
+
+func halfToFloat32(typ DataType, bits uint16) float32 {
+	if typ == BFloat16 {
+		return tensor.BFloat16ToFloat32(bits)
+	}
+	return tensor.Float16ToFloat32(bits)
+}
+
+// decodeRaw fills t from little-endian raw_data
+func (t *Tensor) decodeRaw(typ DataType, raw []byte, n int) {
+	switch t.Type {
+	case Float:
+		t.Floats = make([]float32, n)
+		for i := range t.Floats {
+			switch typ {
+			case Float:
+				t.Floats[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+			case Double:
+				t.Floats[i] = float32(math.Float64frombits(binary.LittleEndian.Uint64(raw[8*i:])))
+			default:
+				t.Floats[i] = halfToFloat32(typ, binary.LittleEndian.Uint16(raw[2*i:]))
+			}
+		}
+	case Bool:
+		t.Bools = make([]bool, n)
+		for i := range t.Bools {
+			t.Bools[i] = raw[i] != 0
+		}
+	case Int64:
+		t.Ints = make([]int64, n)
+		for i := range t.Ints {
+			switch typ {
+			case Uint8:
+				t.Ints[i] = int64(raw[i])
+			case Int8:
+				t.Ints[i] = int64(int8(raw[i]))
+			case Uint16:
+				t.Ints[i] = int64(binary.LittleEndian.Uint16(raw[2*i:]))
+			case Int16:
+				t.Ints[i] = int64(int16(binary.LittleEndian.Uint16(raw[2*i:])))
+			case Uint32:
+				t.Ints[i] = int64(binary.LittleEndian.Uint32(raw[4*i:]))
+			case Int32:
+				t.Ints[i] = int64(int32(binary.LittleEndian.Uint32(raw[4*i:])))
+			default:
+				t.Ints[i] = int64(binary.LittleEndian.Uint64(raw[8*i:]))
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package tensor
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloat16(t *testing.T) {
+	tests := []struct {
+		half  uint16
+		value float32
+	}{
+		{0x0000, 0},
+		{0x3C00, 1},
+		{0xC000, -2},
+		{0x3555, 0.33325195},
+		{0x7BFF, 65504},
+		{0x0001, 5.9604645e-08},
+		{0x7C00, float32(math.Inf(1))},
+	}
+
+	for _, tt := range tests {
+		if got := Float16ToFloat32(tt.half); got != tt.value {
+			t.Errorf("Float16ToFloat32(%#04x): expected %v, got %v", tt.half, tt.value, got)
+		}
+		if got := Float32ToFloat16(tt.value); got != tt.half {
+			t.Errorf("Float32ToFloat16(%v): expected %#04x, got %#04x", tt.value, tt.half, got)
+		}
+	}
+
+	if got := Float16ToFloat32(Float32ToFloat16(float32(math.NaN()))); !math.IsNaN(float64(got)) {
+		t.Errorf("Expected NaN to round-trip, got %v", got)
+	}
+	if got := BFloat16ToFloat32(0x3FC0); got != 1.5 {
+		t.Errorf("Expected 1.5, got %v", got)
+	}
+}
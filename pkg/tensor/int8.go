@@ -0,0 +1,152 @@
+package tensor
+
+import "fmt"
+
+// Int8 is a matrix of shape [rows, cols] quantized symmetrically per row:
+// element [i, j] is Scales[i] * Values[i*cols+j]. Applied to a PyTorch
+// [out, in] weight this is per-output-channel int8 quantization.
+type Int8 struct {
+	rows, cols int
+	values     []int8
+	scales     []float32
+}
+
+// NewInt8 returns a quantized matrix backed by values and scales, which are
+// used without copying
+func NewInt8(values []int8, scales []float32, rows, cols int) *Int8 {
+	if len(values) != rows*cols || len(scales) != rows {
+		panic(fmt.Sprintf("tensor: %d values and %d scales do not fit an int8 matrix of shape [%d %d]", len(values), len(scales), rows, cols))
+	}
+	return &Int8{rows: rows, cols: cols, values: values, scales: scales}
+}
+
+// QuantizeInt8 quantizes a 2-D tensor with one scale per row, mapping the
+// largest magnitude in each row to ±127
+func QuantizeInt8(t *Tensor) *Int8 {
+	if t.Dims() != 2 {
+		panic(fmt.Sprintf("tensor: can only quantize matrices, got shape %v", t.shape))
+	}
+	rows, cols := t.shape[0], t.shape[1]
+	src := t.Data()
+	q := &Int8{rows: rows, cols: cols, values: make([]int8, rows*cols), scales: make([]float32, rows)}
+	parallelFor(rows, cols, func(start, end int) {
+		for i := start; i < end; i++ {
+			row := src[i*cols : (i+1)*cols]
+			scale := abs32(absMax(row)) / 127
+			q.scales[i] = scale
+			inv := reciprocal(scale)
+			for j, v := range row {
+				q.values[i*cols+j] = int8(clampInt(roundInt(v*inv), -127, 127))
+			}
+		}
+	})
+	return q
+}
+
+// Shape returns the matrix dimensions [rows, cols]
+func (q *Int8) Shape() []int {
+	return []int{q.rows, q.cols}
+}
+
+// Values returns the quantized values in row-major order
+func (q *Int8) Values() []int8 {
+	return q.values
+}
+
+// Scales returns the scale of each row
+func (q *Int8) Scales() []float32 {
+	return q.scales
+}
+
+// Dequantize expands the matrix to float32
+func (q *Int8) Dequantize() *Tensor {
+	out := Zeros(q.rows, q.cols)
+	for i, s := range q.scales {
+		for j, v := range q.values[i*q.cols : (i+1)*q.cols] {
+			out.data[i*q.cols+j] = s * float32(v)
+		}
+	}
+	return out
+}
+
+// Int8Linear applies a dense layer with a quantized [out, in] weight:
+// x @ weightᵀ + bias. Rows of x are processed in parallel.
+func Int8Linear(x *Tensor, weight *Int8, bias *Tensor) *Tensor {
+	in, outDim := weight.cols, weight.rows
+	if x.Dim(-1) != in {
+		panic(fmt.Sprintf("tensor: Int8Linear weight %v does not match input %v", weight.Shape(), x.shape))
+	}
+	xd := x.Data()
+	var bd []float32
+	if bias != nil {
+		bd = bias.Data()
+		if len(bd) != outDim {
+			panic(fmt.Sprintf("tensor: Int8Linear bias %v does not match weight %v", bias.shape, weight.Shape()))
+		}
+	}
+
+	rows := len(xd) / in
+	shape := append(x.Shape()[:x.Dims()-1], outDim)
+	out := Zeros(shape...)
+	parallelFor(rows*outDim, in, func(start, end int) {
+		for idx := start; idx < end; idx++ {
+			r, o := idx/outDim, idx%outDim
+			v := weight.scales[o] * dotInt8(xd[r*in:(r+1)*in], weight.values[o*in:(o+1)*in])
+			if bd != nil {
+				v += bd[o]
+			}
+			out.data[idx] = v
+		}
+	})
+	return out
+}
+
+// Int8MatMul multiplies x of shape [..., in] by a quantized [in, out]
+// matrix. Since the scales belong to rows of weight, they are applied to
+// the matching columns of x before the int8 product.
+func Int8MatMul(x *Tensor, weight *Int8) *Tensor {
+	in, outDim := weight.rows, weight.cols
+	if x.Dim(-1) != in {
+		panic(fmt.Sprintf("tensor: Int8MatMul weight %v does not match input %v", weight.Shape(), x.shape))
+	}
+	xd := x.Data()
+	rows := len(xd) / in
+	shape := append(x.Shape()[:x.Dims()-1], outDim)
+	out := Zeros(shape...)
+	parallelFor(rows, in*outDim, func(start, end int) {
+		for r := start; r < end; r++ {
+			dst := out.data[r*outDim : (r+1)*outDim]
+			for i, v := range xd[r*in : (r+1)*in] {
+				if v != 0 {
+					axpyInt8(v*weight.scales[i], weight.values[i*outDim:(i+1)*outDim], dst)
+				}
+			}
+		}
+	})
+	return out
+}
+
+// dotInt8 returns the inner product of a float32 and an int8 vector
+func dotInt8(a []float32, b []int8) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * float32(b[i])
+		s1 += a[i+1] * float32(b[i+1])
+		s2 += a[i+2] * float32(b[i+2])
+		s3 += a[i+3] * float32(b[i+3])
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * float32(b[i])
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// axpyInt8 adds alpha * x to y
+func axpyInt8(alpha float32, x []int8, y []float32) {
+	y = y[:len(x)]
+	for i, v := range x {
+		y[i] += alpha * float32(v)
+	}
+}
@@ -0,0 +1,61 @@
+package tensor
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestQuantizeInt8(t *testing.T) {
+	q := QuantizeInt8(New([]float32{1, -0.5, 0.25, 0, 0, 0}, 2, 3))
+	if !reflect.DeepEqual(q.Values(), []int8{127, -64, 32, 0, 0, 0}) {
+		t.Errorf("Expected [127 -64 32 0 0 0], got %v", q.Values())
+	}
+	if !reflect.DeepEqual(q.Scales(), []float32{1.0 / 127, 0}) {
+		t.Errorf("Expected scales [1/127 0], got %v", q.Scales())
+	}
+
+	rng := rand.New(rand.NewSource(3))
+	x := random(rng, 6, 40)
+	for i, v := range QuantizeInt8(x).Dequantize().Data() {
+		if math.Abs(float64(v-x.data[i])) > 0.5/127 {
+			t.Fatalf("Expected round-trip error within half a step at %d, got %v for %v", i, v, x.data[i])
+		}
+	}
+}
+
+func TestInt8Linear(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	x := random(rng, 2, 3, 20)
+	w := QuantizeInt8(random(rng, 7, 20))
+	b := random(rng, 7)
+
+	got := Int8Linear(x, w, b)
+	expected := Linear(x, w.Dequantize(), b)
+	if !reflect.DeepEqual(got.Shape(), []int{2, 3, 7}) {
+		t.Fatalf("Expected shape [2 3 7], got %v", got.Shape())
+	}
+	for i, v := range got.Data() {
+		if math.Abs(float64(v-expected.data[i])) > 1e-5 {
+			t.Errorf("Expected %v at %d, got %v", expected.data[i], i, v)
+		}
+	}
+}
+
+func TestInt8MatMul(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	x := random(rng, 3, 20)
+	w := QuantizeInt8(random(rng, 20, 9))
+
+	got := Int8MatMul(x, w)
+	expected := MatMul(x, w.Dequantize())
+	if !reflect.DeepEqual(got.Shape(), []int{3, 9}) {
+		t.Fatalf("Expected shape [3 9], got %v", got.Shape())
+	}
+	for i, v := range got.Data() {
+		if math.Abs(float64(v-expected.data[i])) > 1e-5 {
+			t.Errorf("Expected %v at %d, got %v", expected.data[i], i, v)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package tensor
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// minParallelWork is the number of multiply-adds below which work is not
+// worth splitting across goroutines
+const minParallelWork = 1 << 15
+
+// MatMul returns the matrix product of a and b following NumPy semantics:
+// the last two dimensions are multiplied and leading batch dimensions are
+// broadcast. A 1-D operand is treated as a row (a) or column (b) vector and
+// the corresponding dimension is removed from the result.
+func MatMul(a, b *Tensor) *Tensor {
+	vecA, vecB := a.Dims() == 1, b.Dims() == 1
+	if vecA {
+		a = a.Unsqueeze(0)
+	}
+	if vecB {
+		b = b.Unsqueeze(1)
+	}
+	if a.Dims() < 2 || b.Dims() < 2 {
+		panic(fmt.Sprintf("tensor: cannot multiply %v and %v", a.shape, b.shape))
+	}
+
+	m, k := a.Dim(-2), a.Dim(-1)
+	k2, n := b.Dim(-2), b.Dim(-1)
+	if k != k2 {
+		panic(fmt.Sprintf("tensor: cannot multiply %v and %v", a.shape, b.shape))
+	}
+
+	batch := BroadcastShapes(a.shape[:a.Dims()-2], b.shape[:b.Dims()-2])
+	batches := numel(batch)
+	ad := a.BroadcastTo(append(append([]int{}, batch...), m, k)...).Contiguous().data
+	bd := b.BroadcastTo(append(append([]int{}, batch...), k, n)...).Contiguous().data
+
+	out := Zeros(append(append([]int{}, batch...), m, n)...)
+	parallelFor(batches*m, k*n, func(start, end int) {
+		for r := start; r < end; r++ {
+			bi, i := r/m, r%m
+			row := ad[(bi*m+i)*k : (bi*m+i+1)*k]
+			dst := out.data[(bi*m+i)*n : (bi*m+i+1)*n]
+			bm := bd[bi*k*n : (bi+1)*k*n]
+			for p, x := range row {
+				axpy(x, bm[p*n:(p+1)*n], dst)
+			}
+		}
+	})
+
+	shape := out.Shape()
+	if vecB {
+		shape = shape[:len(shape)-1]
+	}
+	if vecA {
+		// The m dimension is last once n has been dropped
+		i := len(shape) - 2
+		if vecB {
+			i = len(shape) - 1
+		}
+		shape = append(shape[:i], shape[i+1:]...)
+	}
+	return out.Reshape(shape...)
+}
+
+// Linear applies a dense layer: x @ weightᵀ + bias. x has shape [..., in],
+// weight has the PyTorch layout [out, in] and bias, which may be nil, has
+// shape [out]. Rows of x are processed in parallel.
+func Linear(x, weight, bias *Tensor) *Tensor {
+	if weight.Dims() != 2 || x.Dim(-1) != weight.shape[1] {
+		panic(fmt.Sprintf("tensor: Linear weight %v does not match input %v", weight.shape, x.shape))
+	}
+	in, outDim := weight.shape[1], weight.shape[0]
+	xd := x.Data()
+	wd := weight.Data()
+	var bd []float32
+	if bias != nil {
+		bd = bias.Data()
+		if len(bd) != outDim {
+			panic(fmt.Sprintf("tensor: Linear bias %v does not match weight %v", bias.shape, weight.shape))
+		}
+	}
+
+	rows := len(xd) / in
+	shape := append(x.Shape()[:x.Dims()-1], outDim)
+	out := Zeros(shape...)
+	parallelFor(rows*outDim, in, func(start, end int) {
+		for idx := start; idx < end; idx++ {
+			r, o := idx/outDim, idx%outDim
+			v := dot(xd[r*in:(r+1)*in], wd[o*in:(o+1)*in])
+			if bd != nil {
+				v += bd[o]
+			}
+			out.data[idx] = v
+		}
+	})
+	return out
+}
+
+// dot returns the inner product of two equally long vectors
+func dot(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// axpy adds alpha * x to y
+func axpy(alpha float32, x, y []float32) {
+	y = y[:len(x)]
+	for i, v := range x {
+		y[i] += alpha * v
+	}
+}
+
+// parallelFor calls fn over [0, n) split into contiguous chunks, one per
+// goroutine. cost is the work per item; small workloads run inline.
+func parallelFor(n, cost int, fn func(start, end int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if limit := n * max(cost, 1) / minParallelWork; limit < workers {
+		workers = limit
+	}
+	workers = min(workers, n)
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
+
+	var wg sync.WaitGroup
+	chunk := (n + workers - 1) / workers
+	for start := 0; start < n; start += chunk {
+		end := min(start+chunk, n)
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			fn(start, end)
+		}(start, end)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,85 @@
+package tensor
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// naiveMatMul multiplies two contiguous 2-D tensors
+func naiveMatMul(a, b *Tensor) []float32 {
+	m, k, n := a.Dim(0), a.Dim(1), b.Dim(1)
+	out := make([]float32, m*n)
+	for i := 0; i < m; i++ {
+		for j := 0; j < n; j++ {
+			var s float32
+			for p := 0; p < k; p++ {
+				s += a.At(i, p) * b.At(p, j)
+			}
+			out[i*n+j] = s
+		}
+	}
+	return out
+}
+
+func random(rng *rand.Rand, shape ...int) *Tensor {
+	t := Zeros(shape...)
+	for i := range t.data {
+		t.data[i] = rng.Float32()*2 - 1
+	}
+	return t
+}
+
+func TestMatMul(t *testing.T) {
+	a := New([]float32{1, 2, 3, 4, 5, 6}, 2, 3)
+	b := New([]float32{7, 8, 9, 10, 11, 12}, 3, 2)
+	c := MatMul(a, b)
+	expected := []float32{58, 64, 139, 154}
+	if !reflect.DeepEqual(c.Data(), expected) {
+		t.Errorf("Expected %v, got %v", expected, c.Data())
+	}
+
+	// Vectors follow NumPy semantics
+	v := New([]float32{1, 1, 1}, 3)
+	if got := MatMul(a, v); !reflect.DeepEqual(got.Shape(), []int{2}) || !reflect.DeepEqual(got.Data(), []float32{6, 15}) {
+		t.Errorf("Expected matrix-vector product [6 15], got %v %v", got.Shape(), got.Data())
+	}
+	if got := MatMul(v, b); !reflect.DeepEqual(got.Shape(), []int{2}) || !reflect.DeepEqual(got.Data(), []float32{27, 30}) {
+		t.Errorf("Expected vector-matrix product [27 30], got %v %v", got.Shape(), got.Data())
+	}
+}
+
+func TestMatMul_BatchedAndParallel(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	a := random(rng, 2, 3, 64, 96)
+	b := random(rng, 3, 96, 80).Transpose(0, 2, 1).Contiguous().Transpose(0, 2, 1)
+
+	c := MatMul(a, b)
+	if !reflect.DeepEqual(c.Shape(), []int{2, 3, 64, 80}) {
+		t.Fatalf("Expected shape [2 3 64 80], got %v", c.Shape())
+	}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			expected := naiveMatMul(a.Index(i).Index(j), b.Index(j))
+			if !approxEqual(c.Index(i).Index(j).Data(), expected, 1e-4) {
+				t.Fatalf("Batch (%d, %d) does not match the naive product", i, j)
+			}
+		}
+	}
+}
+
+func TestLinear(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	x := random(rng, 2, 5, 48)
+	weight := random(rng, 32, 48)
+	bias := random(rng, 32)
+
+	y := Linear(x, weight, bias)
+	if !reflect.DeepEqual(y.Shape(), []int{2, 5, 32}) {
+		t.Fatalf("Expected shape [2 5 32], got %v", y.Shape())
+	}
+	expected := Add(MatMul(x, weight.T()), bias)
+	if !approxEqual(y.Data(), expected.Data(), 1e-4) {
+		t.Error("Linear does not match x @ weightᵀ + bias")
+	}
+}
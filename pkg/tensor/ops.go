@@ -0,0 +1,273 @@
+package tensor
+
+import (
+	"fmt"
+	"math"
+)
+
+// Add returns a + b with broadcasting
+func Add(a, b *Tensor) *Tensor {
+	return Binary(a, b, func(x, y float32) float32 { return x + y })
+}
+
+// Sub returns a - b with broadcasting
+func Sub(a, b *Tensor) *Tensor {
+	return Binary(a, b, func(x, y float32) float32 { return x - y })
+}
+
+// Mul returns the elementwise product of a and b with broadcasting
+func Mul(a, b *Tensor) *Tensor {
+	return Binary(a, b, func(x, y float32) float32 { return x * y })
+}
+
+// Div returns the elementwise quotient of a and b with broadcasting
+func Div(a, b *Tensor) *Tensor {
+	return Binary(a, b, func(x, y float32) float32 { return x / y })
+}
+
+// Scale returns every element of t multiplied by s
+func Scale(t *Tensor, s float32) *Tensor {
+	return Map(t, func(x float32) float32 { return x * s })
+}
+
+// Binary applies op elementwise to a and b, broadcasting them to a common
+// shape following NumPy rules
+func Binary(a, b *Tensor, op func(x, y float32) float32) *Tensor {
+	shape := BroadcastShapes(a.shape, b.shape)
+	out := Zeros(shape...)
+
+	if a.IsContiguous() && b.IsContiguous() && equalShapes(a.shape, shape) && equalShapes(b.shape, shape) {
+		ad, bd := a.data[a.offset:], b.data[b.offset:]
+		for i := range out.data {
+			out.data[i] = op(ad[i], bd[i])
+		}
+		return out
+	}
+
+	av, bv := a.BroadcastTo(shape...), b.BroadcastTo(shape...)
+	as, bs := av.innerStride(), bv.innerStride()
+	i := 0
+	eachRow(shape, []*Tensor{av, bv}, func(offsets []int, n int) {
+		ao, bo := offsets[0], offsets[1]
+		for j := 0; j < n; j++ {
+			out.data[i+j] = op(av.data[ao+j*as], bv.data[bo+j*bs])
+		}
+		i += n
+	})
+	return out
+}
+
+// Map applies fn to every element of t
+func Map(t *Tensor, fn func(x float32) float32) *Tensor {
+	out := t.Clone()
+	for i, x := range out.data {
+		out.data[i] = fn(x)
+	}
+	return out
+}
+
+// BroadcastShapes returns the shape two tensors broadcast to
+func BroadcastShapes(a, b []int) []int {
+	n := max(len(a), len(b))
+	shape := make([]int, n)
+	for i := 0; i < n; i++ {
+		da, db := 1, 1
+		if j := i - (n - len(a)); j >= 0 {
+			da = a[j]
+		}
+		if j := i - (n - len(b)); j >= 0 {
+			db = b[j]
+		}
+		switch {
+		case da == db || db == 1:
+			shape[i] = da
+		case da == 1:
+			shape[i] = db
+		default:
+			panic(fmt.Sprintf("tensor: shapes %v and %v cannot be broadcast", a, b))
+		}
+	}
+	return shape
+}
+
+// GELU applies the Gaussian error linear unit, x * Φ(x)
+func GELU(t *Tensor) *Tensor {
+	return Map(t, func(x float32) float32 {
+		return 0.5 * x * (1 + float32(math.Erf(float64(x)/math.Sqrt2)))
+	})
+}
+
+// GELUTanh applies the tanh approximation of GELU used by GPT-2
+func GELUTanh(t *Tensor) *Tensor {
+	const c = 0.7978845608028654 // sqrt(2/pi)
+	return Map(t, func(x float32) float32 {
+		return 0.5 * x * (1 + float32(math.Tanh(c*(float64(x)+0.044715*float64(x)*float64(x)*float64(x)))))
+	})
+}
+
+// SiLU applies the sigmoid linear unit x * sigmoid(x), also known as swish
+func SiLU(t *Tensor) *Tensor {
+	return Map(t, func(x float32) float32 {
+		return x / (1 + float32(math.Exp(float64(-x))))
+	})
+}
+
+// ReLU replaces negative elements with zero
+func ReLU(t *Tensor) *Tensor {
+	return Map(t, func(x float32) float32 { return max(x, 0) })
+}
+
+// Tanh applies the hyperbolic tangent
+func Tanh(t *Tensor) *Tensor {
+	return Map(t, func(x float32) float32 { return float32(math.Tanh(float64(x))) })
+}
+
+// Softmax normalizes t along axis so that the values sum to one. Negative
+// axes count from the end.
+func Softmax(t *Tensor, axis int) *Tensor {
+	axis = t.axis(axis)
+	last := len(t.shape) - 1
+	if axis != last {
+		perm := make([]int, len(t.shape))
+		for i := range perm {
+			perm[i] = i
+		}
+		perm[axis], perm[last] = last, axis
+		return Softmax(t.Transpose(perm...), -1).Transpose(perm...).Contiguous()
+	}
+
+	out := t.Clone()
+	n := t.shape[last]
+	for start := 0; start < len(out.data); start += n {
+		softmaxRow(out.data[start : start+n])
+	}
+	return out
+}
+
+// softmaxRow normalizes a row in place, subtracting the maximum first for
+// numerical stability
+func softmaxRow(row []float32) {
+	if len(row) == 0 {
+		return
+	}
+	m := row[0]
+	for _, x := range row[1:] {
+		m = max(m, x)
+	}
+	var sum float64
+	for i, x := range row {
+		e := math.Exp(float64(x - m))
+		row[i] = float32(e)
+		sum += e
+	}
+	for i := range row {
+		row[i] = float32(float64(row[i]) / sum)
+	}
+}
+
+// LayerNorm normalizes t over its last dimension to zero mean and unit
+// variance, then applies the optional elementwise weight and bias
+func LayerNorm(t, weight, bias *Tensor, eps float32) *Tensor {
+	out := t.Clone()
+	n := t.Dim(-1)
+	var w, b []float32
+	if weight != nil {
+		w = weight.Data()
+		if len(w) != n {
+			panic(fmt.Sprintf("tensor: LayerNorm weight %v does not match %v", weight.shape, t.shape))
+		}
+	}
+	if bias != nil {
+		b = bias.Data()
+		if len(b) != n {
+			panic(fmt.Sprintf("tensor: LayerNorm bias %v does not match %v", bias.shape, t.shape))
+		}
+	}
+
+	for start := 0; start < len(out.data); start += n {
+		row := out.data[start : start+n]
+		var mean, variance float64
+		for _, x := range row {
+			mean += float64(x)
+		}
+		mean /= float64(n)
+		for _, x := range row {
+			d := float64(x) - mean
+			variance += d * d
+		}
+		variance /= float64(n)
+		inv := 1 / math.Sqrt(variance+float64(eps))
+
+		for i, x := range row {
+			y := float32((float64(x) - mean) * inv)
+			if w != nil {
+				y *= w[i]
+			}
+			if b != nil {
+				y += b[i]
+			}
+			row[i] = y
+		}
+	}
+	return out
+}
+
+// RMSNorm scales t over its last dimension by the reciprocal of its root
+// mean square, then applies the optional elementwise weight
+func RMSNorm(t, weight *Tensor, eps float32) *Tensor {
+	out := t.Clone()
+	n := t.Dim(-1)
+	var w []float32
+	if weight != nil {
+		w = weight.Data()
+		if len(w) != n {
+			panic(fmt.Sprintf("tensor: RMSNorm weight %v does not match %v", weight.shape, t.shape))
+		}
+	}
+
+	for start := 0; start < len(out.data); start += n {
+		row := out.data[start : start+n]
+		var sum float64
+		for _, x := range row {
+			sum += float64(x) * float64(x)
+		}
+		inv := float32(1 / math.Sqrt(sum/float64(n)+float64(eps)))
+		for i, x := range row {
+			y := x * inv
+			if w != nil {
+				y *= w[i]
+			}
+			row[i] = y
+		}
+	}
+	return out
+}
+
+// Embedding gathers the rows of a [vocab, dim] weight matrix for each ID,
+// returning a [len(ids), dim] tensor
+func Embedding(weight *Tensor, ids []int) *Tensor {
+	if weight.Dims() != 2 {
+		panic(fmt.Sprintf("tensor: embedding weight must have 2 dimensions, got %v", weight.shape))
+	}
+	vocab, dim := weight.shape[0], weight.shape[1]
+	out := Zeros(len(ids), dim)
+	for i, id := range ids {
+		if id < 0 || id >= vocab {
+			panic(fmt.Sprintf("tensor: token ID %d out of range for vocabulary of %d", id, vocab))
+		}
+		copy(out.data[i*dim:(i+1)*dim], weight.Index(id).Data())
+	}
+	return out
+}
+
+func equalShapes(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package tensor
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func approxEqual(a, b []float32, tol float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > tol {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBinaryBroadcasting(t *testing.T) {
+	a := New(seq(6), 2, 3)
+	bias := New([]float32{10, 20, 30}, 3)
+
+	sum := Add(a, bias)
+	expected := []float32{10, 21, 32, 13, 24, 35}
+	if !reflect.DeepEqual(sum.Data(), expected) {
+		t.Errorf("Expected %v, got %v", expected, sum.Data())
+	}
+
+	col := New([]float32{1, 2}, 2, 1)
+	prod := Mul(a.T(), col.T())
+	if !reflect.DeepEqual(prod.Shape(), []int{3, 2}) {
+		t.Fatalf("Expected shape [3 2], got %v", prod.Shape())
+	}
+	expected = []float32{0, 6, 1, 8, 2, 10}
+	if !reflect.DeepEqual(prod.Data(), expected) {
+		t.Errorf("Expected %v, got %v", expected, prod.Data())
+	}
+
+	if got := Sub(a, Scalar(1)).At(0, 0); got != -1 {
+		t.Errorf("Expected -1, got %v", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for incompatible shapes")
+		}
+	}()
+	Add(a, New(seq(2), 2))
+}
+
+func TestSoftmax(t *testing.T) {
+	x := New([]float32{1, 2, 3, 1000, 1000, 1000}, 2, 3)
+	y := Softmax(x, -1)
+	expected := []float32{0.09003057, 0.24472847, 0.66524096, 1. / 3, 1. / 3, 1. / 3}
+	if !approxEqual(y.Data(), expected, 1e-6) {
+		t.Errorf("Expected %v, got %v", expected, y.Data())
+	}
+
+	cols := Softmax(New([]float32{1, 2, 3, 4}, 2, 2), 0)
+	expected = []float32{0.11920292, 0.11920292, 0.880797, 0.880797}
+	if !approxEqual(cols.Data(), expected, 1e-6) {
+		t.Errorf("Expected softmax over the first axis %v, got %v", expected, cols.Data())
+	}
+}
+
+func TestLayerNorm(t *testing.T) {
+	x := New([]float32{1, 2, 3, 4}, 1, 4)
+	weight := New([]float32{1, 1, 2, 2}, 4)
+	bias := New([]float32{0, 0, 0, 1}, 4)
+
+	y := LayerNorm(x, weight, bias, 1e-5)
+	expected := []float32{-1.3416355, -0.4472118, 0.8944236, 3.6832709}
+	if !approxEqual(y.Data(), expected, 1e-5) {
+		t.Errorf("Expected %v, got %v", expected, y.Data())
+	}
+}
+
+func TestRMSNorm(t *testing.T) {
+	x := New([]float32{1, 2, 3, 4}, 1, 4)
+	weight := New([]float32{1, 1, 2, 2}, 4)
+
+	y := RMSNorm(x, weight, 1e-6)
+	expected := []float32{0.36514813, 0.73029626, 2.1908889, 2.9211850}
+	if !approxEqual(y.Data(), expected, 1e-5) {
+		t.Errorf("Expected %v, got %v", expected, y.Data())
+	}
+}
+
+func TestActivations(t *testing.T) {
+	x := New([]float32{-1, 0, 1}, 3)
+
+	tests := []struct {
+		name     string
+		got      *Tensor
+		expected []float32
+	}{
+		{"GELU", GELU(x), []float32{-0.15865526, 0, 0.8413447}},
+		{"GELUTanh", GELUTanh(x), []float32{-0.15880801, 0, 0.841192}},
+		{"SiLU", SiLU(x), []float32{-0.26894143, 0, 0.7310586}},
+		{"ReLU", ReLU(x), []float32{0, 0, 1}},
+	}
+	for _, tt := range tests {
+		if !approxEqual(tt.got.Data(), tt.expected, 1e-6) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, tt.got.Data())
+		}
+	}
+}
+
+func TestEmbedding(t *testing.T) {
+	weight := New(seq(8), 4, 2)
+	y := Embedding(weight, []int{3, 0, 3})
+	expected := []float32{6, 7, 0, 1, 6, 7}
+	if !reflect.DeepEqual(y.Data(), expected) {
+		t.Errorf("Expected %v, got %v", expected, y.Data())
+	}
+}
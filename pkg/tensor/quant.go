@@ -0,0 +1,445 @@
+package tensor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// QuantType is a block-quantized storage format. Values are stored in blocks
+// of BlockSize elements taking TypeSize bytes, with the same byte layout as
+// the ggml format of the same name, so tensor data from GGUF files can be
+// used as is.
+type QuantType int
+
+const (
+	// Q8_0 stores 32 int8 values with a float16 scale
+	Q8_0 QuantType = iota
+	// Q4_0 stores 32 4-bit values offset by 8 with a float16 scale
+	Q4_0
+	// Q4_1 stores 32 4-bit values with a float16 scale and minimum
+	Q4_1
+	// Q4_K stores 256 4-bit values in 8 sub-blocks, each with a 6-bit scale
+	// and minimum relative to float16 super-block values
+	Q4_K
+	// Q6_K stores 256 6-bit values in 16 sub-blocks, each with an int8 scale
+	// relative to a float16 super-block scale
+	Q6_K
+)
+
+type quantFormat struct {
+	name                string
+	blockSize, typeSize int
+	dequantize          func(block []byte, dst []float32)
+	quantize            func(src []float32, block []byte)
+}
+
+var quantFormats = [...]quantFormat{
+	Q8_0: {"Q8_0", 32, 34, dequantizeQ8_0, quantizeQ8_0},
+	Q4_0: {"Q4_0", 32, 18, dequantizeQ4_0, quantizeQ4_0},
+	Q4_1: {"Q4_1", 32, 20, dequantizeQ4_1, quantizeQ4_1},
+	Q4_K: {"Q4_K", 256, 144, dequantizeQ4_K, quantizeQ4_K},
+	Q6_K: {"Q6_K", 256, 210, dequantizeQ6_K, quantizeQ6_K},
+}
+
+func (q QuantType) format() quantFormat {
+	if q < 0 || int(q) >= len(quantFormats) {
+		panic(fmt.Sprintf("tensor: unknown quantization type %d", int(q)))
+	}
+	return quantFormats[q]
+}
+
+func (q QuantType) String() string {
+	if q < 0 || int(q) >= len(quantFormats) {
+		return fmt.Sprintf("QuantType(%d)", int(q))
+	}
+	return quantFormats[q].name
+}
+
+// BlockSize returns the number of values in a block
+func (q QuantType) BlockSize() int {
+	return q.format().blockSize
+}
+
+// TypeSize returns the number of bytes in a block
+func (q QuantType) TypeSize() int {
+	return q.format().typeSize
+}
+
+// Quantized is a block-quantized matrix of shape [rows, cols]. Each row is
+// stored as cols/BlockSize consecutive blocks, so cols must be a multiple of
+// the block size.
+type Quantized struct {
+	typ        QuantType
+	rows, cols int
+	data       []byte
+}
+
+// NewQuantized returns a quantized matrix backed by data, which is used
+// without copying
+func NewQuantized(typ QuantType, data []byte, rows, cols int) *Quantized {
+	f := typ.format()
+	if rows < 0 || cols < 0 || cols%f.blockSize != 0 {
+		panic(fmt.Sprintf("tensor: shape [%d %d] does not fit %s blocks of %d values", rows, cols, typ, f.blockSize))
+	}
+	if n := rows * cols / f.blockSize * f.typeSize; len(data) != n {
+		panic(fmt.Sprintf("tensor: %d bytes do not fit a %s matrix of shape [%d %d], which needs %d", len(data), typ, rows, cols, n))
+	}
+	return &Quantized{typ: typ, rows: rows, cols: cols, data: data}
+}
+
+// Quantize converts a 2-D tensor to a quantized matrix. Each block is
+// quantized independently by rounding to the nearest representable value.
+func Quantize(t *Tensor, typ QuantType) *Quantized {
+	if t.Dims() != 2 {
+		panic(fmt.Sprintf("tensor: can only quantize matrices, got shape %v", t.shape))
+	}
+	f := typ.format()
+	rows, cols := t.shape[0], t.shape[1]
+	if cols%f.blockSize != 0 {
+		panic(fmt.Sprintf("tensor: %d columns are not a multiple of the %s block size %d", cols, typ, f.blockSize))
+	}
+	src := t.Data()
+	blocks := rows * cols / f.blockSize
+	data := make([]byte, blocks*f.typeSize)
+	parallelFor(blocks, f.blockSize, func(start, end int) {
+		for b := start; b < end; b++ {
+			f.quantize(src[b*f.blockSize:(b+1)*f.blockSize], data[b*f.typeSize:(b+1)*f.typeSize])
+		}
+	})
+	return &Quantized{typ: typ, rows: rows, cols: cols, data: data}
+}
+
+// Type returns the quantization format
+func (q *Quantized) Type() QuantType {
+	return q.typ
+}
+
+// Shape returns the matrix dimensions [rows, cols]
+func (q *Quantized) Shape() []int {
+	return []int{q.rows, q.cols}
+}
+
+// Bytes returns the underlying block data
+func (q *Quantized) Bytes() []byte {
+	return q.data
+}
+
+// DequantizeRow writes row i to dst, which must hold cols values
+func (q *Quantized) DequantizeRow(i int, dst []float32) {
+	if i < 0 || i >= q.rows {
+		panic(fmt.Sprintf("tensor: row %d out of range for %d rows", i, q.rows))
+	}
+	f := q.typ.format()
+	dst = dst[:q.cols]
+	rowBytes := q.cols / f.blockSize * f.typeSize
+	row := q.data[i*rowBytes : (i+1)*rowBytes]
+	for b := 0; b < q.cols/f.blockSize; b++ {
+		f.dequantize(row[b*f.typeSize:(b+1)*f.typeSize], dst[b*f.blockSize:(b+1)*f.blockSize])
+	}
+}
+
+// Dequantize expands the matrix to float32
+func (q *Quantized) Dequantize() *Tensor {
+	out := Zeros(q.rows, q.cols)
+	parallelFor(q.rows, q.cols, func(start, end int) {
+		for i := start; i < end; i++ {
+			q.DequantizeRow(i, out.data[i*q.cols:(i+1)*q.cols])
+		}
+	})
+	return out
+}
+
+// QuantizedLinear applies a dense layer with a quantized [out, in] weight:
+// x @ weightᵀ + bias. Weight rows are dequantized one at a time as they are
+// used, so the full float32 weight is never materialized.
+func QuantizedLinear(x *Tensor, weight *Quantized, bias *Tensor) *Tensor {
+	in, outDim := weight.cols, weight.rows
+	if x.Dim(-1) != in {
+		panic(fmt.Sprintf("tensor: QuantizedLinear weight %v does not match input %v", weight.Shape(), x.shape))
+	}
+	xd := x.Data()
+	var bd []float32
+	if bias != nil {
+		bd = bias.Data()
+		if len(bd) != outDim {
+			panic(fmt.Sprintf("tensor: QuantizedLinear bias %v does not match weight %v", bias.shape, weight.Shape()))
+		}
+	}
+
+	rows := len(xd) / in
+	shape := append(x.Shape()[:x.Dims()-1], outDim)
+	out := Zeros(shape...)
+	parallelFor(outDim, rows*in, func(start, end int) {
+		w := make([]float32, in)
+		for o := start; o < end; o++ {
+			weight.DequantizeRow(o, w)
+			for r := 0; r < rows; r++ {
+				v := dot(xd[r*in:(r+1)*in], w)
+				if bd != nil {
+					v += bd[o]
+				}
+				out.data[r*outDim+o] = v
+			}
+		}
+	})
+	return out
+}
+
+// QuantizedEmbedding looks up rows of a quantized [vocab, dim] embedding
+// table, returning a tensor of shape [len(ids), dim]
+func QuantizedEmbedding(weight *Quantized, ids []int) *Tensor {
+	out := Zeros(len(ids), weight.cols)
+	for i, id := range ids {
+		if id < 0 || id >= weight.rows {
+			panic(fmt.Sprintf("tensor: token ID %d out of range for vocabulary of %d", id, weight.rows))
+		}
+		weight.DequantizeRow(id, out.data[i*weight.cols:(i+1)*weight.cols])
+	}
+	return out
+}
+
+func f16(b []byte) float32 {
+	return Float16ToFloat32(binary.LittleEndian.Uint16(b))
+}
+
+func putF16(b []byte, v float32) {
+	binary.LittleEndian.PutUint16(b, Float32ToFloat16(v))
+}
+
+// roundInt rounds to the nearest integer, halves away from zero
+func roundInt(v float32) int {
+	return int(math.Round(float64(v)))
+}
+
+func clampInt(v, lo, hi int) int {
+	return min(max(v, lo), hi)
+}
+
+// absMax returns the value of largest magnitude, keeping its sign
+func absMax(src []float32) float32 {
+	var m float32
+	for _, v := range src {
+		if abs32(v) > abs32(m) {
+			m = v
+		}
+	}
+	return m
+}
+
+func abs32(v float32) float32 {
+	return math.Float32frombits(math.Float32bits(v) &^ (1 << 31))
+}
+
+func reciprocal(d float32) float32 {
+	if d == 0 {
+		return 0
+	}
+	return 1 / d
+}
+
+// Q8_0: d float16, qs [32]int8
+
+func dequantizeQ8_0(block []byte, dst []float32) {
+	d := f16(block)
+	for i, q := range block[2:34] {
+		dst[i] = d * float32(int8(q))
+	}
+}
+
+func quantizeQ8_0(src []float32, block []byte) {
+	d := abs32(absMax(src)) / 127
+	id := reciprocal(d)
+	putF16(block, d)
+	for i, v := range src {
+		block[2+i] = byte(int8(roundInt(v * id)))
+	}
+}
+
+// Q4_0: d float16, qs [16]byte holding values 0-15 offset by 8. Element j
+// is in the low nibble of qs[j] and element j+16 in the high nibble.
+
+func dequantizeQ4_0(block []byte, dst []float32) {
+	d := f16(block)
+	for j, q := range block[2:18] {
+		dst[j] = d * float32(int(q&0xF)-8)
+		dst[j+16] = d * float32(int(q>>4)-8)
+	}
+}
+
+func quantizeQ4_0(src []float32, block []byte) {
+	d := absMax(src) / -8
+	id := reciprocal(d)
+	putF16(block, d)
+	for j := 0; j < 16; j++ {
+		lo := clampInt(int(src[j]*id+8.5), 0, 15)
+		hi := clampInt(int(src[j+16]*id+8.5), 0, 15)
+		block[2+j] = byte(lo | hi<<4)
+	}
+}
+
+// Q4_1: d float16, m float16, qs [16]byte holding values 0-15 scaled by d
+// and offset by m, packed like Q4_0
+
+func dequantizeQ4_1(block []byte, dst []float32) {
+	d, m := f16(block), f16(block[2:])
+	for j, q := range block[4:20] {
+		dst[j] = d*float32(q&0xF) + m
+		dst[j+16] = d*float32(q>>4) + m
+	}
+}
+
+func quantizeQ4_1(src []float32, block []byte) {
+	lo, hi := src[0], src[0]
+	for _, v := range src {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	d := (hi - lo) / 15
+	id := reciprocal(d)
+	putF16(block, d)
+	putF16(block[2:], lo)
+	for j := 0; j < 16; j++ {
+		a := clampInt(int((src[j]-lo)*id+0.5), 0, 15)
+		b := clampInt(int((src[j+16]-lo)*id+0.5), 0, 15)
+		block[4+j] = byte(a | b<<4)
+	}
+}
+
+// Q4_K: d float16, dmin float16, scales [12]byte, qs [128]byte. The 256
+// values form 8 sub-blocks of 32, each with a 6-bit scale and minimum packed
+// into scales. Sub-blocks 2i and 2i+1 share the bytes qs[32i:32i+32], in the
+// low and high nibbles. A value is d*scale*q - dmin*min.
+
+// scaleMinK4 unpacks the scale and minimum of sub-block j
+func scaleMinK4(j int, scales []byte) (sc, m byte) {
+	if j < 4 {
+		return scales[j] & 63, scales[j+4] & 63
+	}
+	return scales[j+4]&0xF | (scales[j-4]>>6)<<4, scales[j+4]>>4 | (scales[j]>>6)<<4
+}
+
+func dequantizeQ4_K(block []byte, dst []float32) {
+	d, dmin := f16(block), f16(block[2:])
+	scales, qs := block[4:16], block[16:144]
+	for j := 0; j < 4; j++ {
+		sc1, m1 := scaleMinK4(2*j, scales)
+		sc2, m2 := scaleMinK4(2*j+1, scales)
+		d1, min1 := d*float32(sc1), dmin*float32(m1)
+		d2, min2 := d*float32(sc2), dmin*float32(m2)
+		q, y := qs[32*j:32*j+32], dst[64*j:64*j+64]
+		for l, b := range q {
+			y[l] = d1*float32(b&0xF) - min1
+			y[l+32] = d2*float32(b>>4) - min2
+		}
+	}
+}
+
+func quantizeQ4_K(src []float32, block []byte) {
+	// Each sub-block maps [-min, -min + 15*scale] onto 0-15. The minimum is
+	// stored as a positive offset, so it is clamped to at most zero.
+	var subScales, subMins [8]float32
+	var maxScale, maxMin float32
+	for j := range subScales {
+		lo, hi := float32(0), src[32*j]
+		for _, v := range src[32*j : 32*j+32] {
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		subScales[j], subMins[j] = (hi-lo)/15, -lo
+		maxScale, maxMin = max(maxScale, subScales[j]), max(maxMin, subMins[j])
+	}
+
+	d, dmin := maxScale/63, maxMin/63
+	putF16(block, d)
+	putF16(block[2:], dmin)
+	d, dmin = f16(block), f16(block[2:])
+
+	var sc, m [8]byte
+	for j := range sc {
+		sc[j] = byte(clampInt(roundInt(subScales[j]*reciprocal(d)), 0, 63))
+		m[j] = byte(clampInt(roundInt(subMins[j]*reciprocal(dmin)), 0, 63))
+	}
+	scales := block[4:16]
+	for j := 0; j < 8; j++ {
+		if j < 4 {
+			scales[j], scales[j+4] = sc[j], m[j]
+		} else {
+			scales[j+4] = sc[j]&0xF | (m[j]&0xF)<<4
+			scales[j-4] |= (sc[j] >> 4) << 6
+			scales[j] |= (m[j] >> 4) << 6
+		}
+	}
+
+	qs := block[16:144]
+	for j := 0; j < 8; j++ {
+		scale, offset := d*float32(sc[j]), dmin*float32(m[j])
+		for l := 0; l < 32; l++ {
+			q := byte(clampInt(roundInt((src[32*j+l]+offset)*reciprocal(scale)), 0, 15))
+			if j%2 == 0 {
+				qs[16*j+l] = q
+			} else {
+				qs[16*(j-1)+l] |= q << 4
+			}
+		}
+	}
+}
+
+// Q6_K: ql [128]byte, qh [64]byte, scales [16]int8, d float16. The 256
+// values form 16 sub-blocks of 16, each with an int8 scale. A value's low 4
+// bits are in ql and its high 2 bits in qh; the 6-bit result is offset by
+// 32 and multiplied by d*scale. Each half of 128 values uses 64 bytes of ql,
+// holding values l and l+64 in the low and high nibbles of byte l, and 32
+// bytes of qh, holding values l, l+32, l+64 and l+96 in byte l.
+
+func dequantizeQ6_K(block []byte, dst []float32) {
+	d := f16(block[208:])
+	for n := 0; n < 2; n++ {
+		ql, qh, sc := block[64*n:64*n+64], block[128+32*n:128+32*n+32], block[192+8*n:192+8*n+8]
+		y := dst[128*n : 128*n+128]
+		for l := 0; l < 32; l++ {
+			is := l / 16
+			q1 := int(ql[l]&0xF|(qh[l]&3)<<4) - 32
+			q2 := int(ql[l+32]&0xF|(qh[l]>>2&3)<<4) - 32
+			q3 := int(ql[l]>>4|(qh[l]>>4&3)<<4) - 32
+			q4 := int(ql[l+32]>>4|(qh[l]>>6&3)<<4) - 32
+			y[l] = d * float32(int8(sc[is])) * float32(q1)
+			y[l+32] = d * float32(int8(sc[is+2])) * float32(q2)
+			y[l+64] = d * float32(int8(sc[is+4])) * float32(q3)
+			y[l+96] = d * float32(int8(sc[is+6])) * float32(q4)
+		}
+	}
+}
+
+func quantizeQ6_K(src []float32, block []byte) {
+	// Like Q4_0, each sub-block scale maps its value of largest magnitude to
+	// -32, and the scales are in turn quantized to int8 the same way
+	var subScales [16]float32
+	var maxScale float32
+	for j := range subScales {
+		subScales[j] = absMax(src[16*j:16*j+16]) / -32
+		if abs32(subScales[j]) > abs32(maxScale) {
+			maxScale = subScales[j]
+		}
+	}
+	d := maxScale / -128
+	putF16(block[208:], d)
+	d = f16(block[208:])
+
+	var q [256]int
+	for j, s := range subScales {
+		sc := int8(clampInt(roundInt(s*reciprocal(d)), -128, 127))
+		block[192+j] = byte(sc)
+		scale := d * float32(sc)
+		for l := 0; l < 16; l++ {
+			q[16*j+l] = clampInt(roundInt(src[16*j+l]*reciprocal(scale)), -32, 31) + 32
+		}
+	}
+
+	for n := 0; n < 2; n++ {
+		ql, qh, v := block[64*n:64*n+64], block[128+32*n:128+32*n+32], q[128*n:128*n+128]
+		for l := 0; l < 32; l++ {
+			ql[l] = byte(v[l]&0xF | (v[l+64]&0xF)<<4)
+			ql[l+32] = byte(v[l+32]&0xF | (v[l+96]&0xF)<<4)
+			qh[l] = byte(v[l]>>4 | (v[l+32]>>4)<<2 | (v[l+64]>>4)<<4 | (v[l+96]>>4)<<6)
+		}
+	}
+}
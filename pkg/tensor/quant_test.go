@@ -0,0 +1,121 @@
+package tensor
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testBlock returns a block of pseudo-random bytes with its float16 fields
+// set to the given values
+func testBlock(typ QuantType, f16Fields map[int]float32) []byte {
+	block := make([]byte, typ.TypeSize())
+	state := uint32(7)
+	for i := range block {
+		state = (state*1103515245 + 12345) % (1 << 31)
+		block[i] = byte(state >> 16)
+	}
+	for offset, v := range f16Fields {
+		putF16(block[offset:], v)
+	}
+	return block
+}
+
+func TestDequantize(t *testing.T) {
+	// Expected values come from a port of the ggml reference
+	// dequantize_row_* functions
+	tests := []struct {
+		typ      QuantType
+		fields   map[int]float32
+		sum      float32
+		expected map[int]float32
+	}{
+		{Q8_0, map[int]float32{0: 0.5}, 26, map[int]float32{0: 58, 1: -55, 17: 18, 31: -59}},
+		{Q4_0, map[int]float32{0: 0.5}, -35.5, map[int]float32{0: -2, 1: -3, 17: 0.5, 31: -1}},
+		{Q4_1, map[int]float32{0: 0.5, 2: -1.25}, 57.5, map[int]float32{0: 0.25, 1: 1.25, 17: -0.25, 31: -0.25}},
+		{Q4_K, map[int]float32{0: 0.5, 2: 0.25}, 17627, map[int]float32{0: 73.25, 1: 44.75, 33: 102.75, 100: 110.25, 130: 74.25, 255: 1}},
+		{Q6_K, map[int]float32{208: 0.0625}, -1619.875, map[int]float32{0: -196, 1: -210, 33: -51.875, 100: -1.375, 130: 45, 255: 15.75}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ.String(), func(t *testing.T) {
+			q := NewQuantized(tt.typ, testBlock(tt.typ, tt.fields), 1, tt.typ.BlockSize())
+			values := q.Dequantize().Data()
+			var sum float32
+			for _, v := range values {
+				sum += v
+			}
+			if sum != tt.sum {
+				t.Errorf("Expected values summing to %v, got %v", tt.sum, sum)
+			}
+			for i, want := range tt.expected {
+				if values[i] != want {
+					t.Errorf("Expected value %d to be %v, got %v", i, want, values[i])
+				}
+			}
+		})
+	}
+}
+
+func TestQuantizeRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	x := random(rng, 4, 512)
+	// Values lie in [-1, 1). The symmetric formats map the value of largest
+	// magnitude to the most negative level, so values of the other sign can
+	// be off by a full step.
+	tolerances := map[QuantType]float64{Q8_0: 0.005, Q4_0: 0.13, Q4_1: 0.07, Q4_K: 0.08, Q6_K: 0.035}
+	for typ, tol := range tolerances {
+		q := Quantize(x, typ)
+		if len(q.Bytes()) != 4*512/typ.BlockSize()*typ.TypeSize() {
+			t.Errorf("%s: Expected %d bytes, got %d", typ, 4*512/typ.BlockSize()*typ.TypeSize(), len(q.Bytes()))
+		}
+		var maxErr float64
+		for i, v := range q.Dequantize().Data() {
+			maxErr = math.Max(maxErr, math.Abs(float64(v-x.data[i])))
+		}
+		if maxErr > tol {
+			t.Errorf("%s: Expected round-trip error below %v, got %v", typ, tol, maxErr)
+		}
+	}
+
+	// Constant and zero blocks must not divide by zero
+	for _, typ := range []QuantType{Q8_0, Q4_0, Q4_1, Q4_K, Q6_K} {
+		for _, v := range Quantize(Zeros(1, 256), typ).Dequantize().Data() {
+			if v != 0 {
+				t.Errorf("%s: Expected zeros to round-trip, got %v", typ, v)
+				break
+			}
+		}
+	}
+}
+
+func TestQuantizedLinear(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	x := random(rng, 3, 256)
+	w := Quantize(random(rng, 5, 256), Q4_K)
+	b := random(rng, 5)
+
+	got := QuantizedLinear(x, w, b)
+	expected := Linear(x, w.Dequantize(), b)
+	if got.Dim(0) != 3 || got.Dim(1) != 5 {
+		t.Fatalf("Expected shape [3 5], got %v", got.Shape())
+	}
+	for i, v := range got.Data() {
+		if math.Abs(float64(v-expected.data[i])) > 1e-4 {
+			t.Errorf("Expected %v at %d, got %v", expected.data[i], i, v)
+		}
+	}
+
+	emb := QuantizedEmbedding(w, []int{4, 0})
+	row := make([]float32, 256)
+	w.DequantizeRow(4, row)
+	if emb.At(0, 10) != row[10] {
+		t.Errorf("Expected embedding row to match dequantized row, got %v and %v", emb.At(0, 10), row[10])
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for a block size mismatch")
+		}
+	}()
+	NewQuantized(Q8_0, make([]byte, 34), 1, 16)
+}
@@ -0,0 +1,435 @@
+// Package tensor provides a float32 N-dimensional array and the operations
+// needed to run transformer models in pure Go.
+//
+// Tensors are views over a flat slice of data described by a shape, strides
+// and an offset, so reshaping, transposing, slicing and broadcasting do not
+// copy. Operations always return new tensors and never modify their inputs.
+//
+// Like index expressions on slices, operations panic when shapes are
+// incompatible: a mismatch is a programming error rather than bad input.
+package tensor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tensor is a float32 N-dimensional array
+type Tensor struct {
+	data    []float32
+	shape   []int
+	strides []int
+	offset  int
+}
+
+// New returns a tensor of the given shape backed by data, which is used
+// without copying. A tensor with no dimensions is a scalar.
+func New(data []float32, shape ...int) *Tensor {
+	if n := numel(shape); len(data) != n {
+		panic(fmt.Sprintf("tensor: %d values do not fit shape %v", len(data), shape))
+	}
+	return &Tensor{data: data, shape: append([]int{}, shape...), strides: contiguousStrides(shape)}
+}
+
+// Zeros returns a tensor of the given shape filled with zeros
+func Zeros(shape ...int) *Tensor {
+	return New(make([]float32, numel(shape)), shape...)
+}
+
+// Full returns a tensor of the given shape filled with value
+func Full(value float32, shape ...int) *Tensor {
+	t := Zeros(shape...)
+	for i := range t.data {
+		t.data[i] = value
+	}
+	return t
+}
+
+// Scalar returns a tensor with no dimensions holding a single value
+func Scalar(value float32) *Tensor {
+	return New([]float32{value})
+}
+
+// Shape returns the size of each dimension
+func (t *Tensor) Shape() []int {
+	return append([]int{}, t.shape...)
+}
+
+// Strides returns the distance in elements between consecutive indices of
+// each dimension
+func (t *Tensor) Strides() []int {
+	return append([]int{}, t.strides...)
+}
+
+// Dims returns the number of dimensions
+func (t *Tensor) Dims() int {
+	return len(t.shape)
+}
+
+// Dim returns the size of dimension d. Negative dimensions count from the end.
+func (t *Tensor) Dim(d int) int {
+	return t.shape[t.axis(d)]
+}
+
+// Size returns the number of elements
+func (t *Tensor) Size() int {
+	return numel(t.shape)
+}
+
+// At returns the element at the given index
+func (t *Tensor) At(index ...int) float32 {
+	return t.data[t.offsetOf(index)]
+}
+
+// Set stores value at the given index
+func (t *Tensor) Set(value float32, index ...int) {
+	t.data[t.offsetOf(index)] = value
+}
+
+// Item returns the value of a tensor holding a single element
+func (t *Tensor) Item() float32 {
+	if t.Size() != 1 {
+		panic(fmt.Sprintf("tensor: Item called on a tensor of shape %v", t.shape))
+	}
+	return t.data[t.offset]
+}
+
+// Data returns the elements in row-major order. The slice shares memory with
+// the tensor when it is contiguous and is a copy otherwise.
+func (t *Tensor) Data() []float32 {
+	c := t.Contiguous()
+	return c.data[c.offset : c.offset+c.Size()]
+}
+
+// IsContiguous reports whether the elements are laid out densely in
+// row-major order
+func (t *Tensor) IsContiguous() bool {
+	expected := 1
+	for d := len(t.shape) - 1; d >= 0; d-- {
+		if t.shape[d] != 1 && t.strides[d] != expected {
+			return false
+		}
+		expected *= t.shape[d]
+	}
+	return true
+}
+
+// Contiguous returns t if it is contiguous and a contiguous copy otherwise
+func (t *Tensor) Contiguous() *Tensor {
+	if t.IsContiguous() {
+		return t
+	}
+	return t.Clone()
+}
+
+// Clone returns a contiguous copy of t
+func (t *Tensor) Clone() *Tensor {
+	out := Zeros(t.shape...)
+	if t.IsContiguous() {
+		copy(out.data, t.data[t.offset:t.offset+t.Size()])
+		return out
+	}
+	i := 0
+	eachRow(t.shape, []*Tensor{t}, func(offsets []int, n int) {
+		stride := t.innerStride()
+		for j, off := 0, offsets[0]; j < n; j, off = j+1, off+stride {
+			out.data[i+j] = t.data[off]
+		}
+		i += n
+	})
+	return out
+}
+
+// Reshape returns a tensor with the same elements and a new shape. One
+// dimension may be -1, in which case it is inferred. The result shares
+// memory with t when t is contiguous.
+func (t *Tensor) Reshape(shape ...int) *Tensor {
+	shape = append([]int{}, shape...)
+	infer, known := -1, 1
+	for i, s := range shape {
+		if s == -1 {
+			if infer >= 0 {
+				panic("tensor: Reshape accepts at most one -1 dimension")
+			}
+			infer = i
+			continue
+		}
+		known *= s
+	}
+	if infer >= 0 && known > 0 {
+		shape[infer] = t.Size() / known
+	}
+	if numel(shape) != t.Size() {
+		panic(fmt.Sprintf("tensor: cannot reshape %v into %v", t.shape, shape))
+	}
+
+	c := t.Contiguous()
+	return &Tensor{data: c.data, shape: shape, strides: contiguousStrides(shape), offset: c.offset}
+}
+
+// Transpose returns a view with the dimensions permuted. Without arguments
+// the dimensions are reversed.
+func (t *Tensor) Transpose(perm ...int) *Tensor {
+	n := len(t.shape)
+	if len(perm) == 0 {
+		perm = make([]int, n)
+		for i := range perm {
+			perm[i] = n - 1 - i
+		}
+	}
+	if len(perm) != n {
+		panic(fmt.Sprintf("tensor: permutation %v does not match %d dimensions", perm, n))
+	}
+
+	seen := make([]bool, n)
+	out := &Tensor{data: t.data, shape: make([]int, n), strides: make([]int, n), offset: t.offset}
+	for i, p := range perm {
+		p = t.axis(p)
+		if seen[p] {
+			panic(fmt.Sprintf("tensor: invalid permutation %v", perm))
+		}
+		seen[p] = true
+		out.shape[i] = t.shape[p]
+		out.strides[i] = t.strides[p]
+	}
+	return out
+}
+
+// T returns a view with the last two dimensions swapped
+func (t *Tensor) T() *Tensor {
+	n := len(t.shape)
+	if n < 2 {
+		panic(fmt.Sprintf("tensor: T requires at least 2 dimensions, got %v", t.shape))
+	}
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	perm[n-2], perm[n-1] = n-1, n-2
+	return t.Transpose(perm...)
+}
+
+// Slice returns a view of the indices [start, end) of dimension dim
+func (t *Tensor) Slice(dim, start, end int) *Tensor {
+	dim = t.axis(dim)
+	if start < 0 || end > t.shape[dim] || start > end {
+		panic(fmt.Sprintf("tensor: slice [%d:%d] out of range for dimension %d of %v", start, end, dim, t.shape))
+	}
+	out := t.view()
+	out.shape[dim] = end - start
+	out.offset += start * t.strides[dim]
+	return out
+}
+
+// Index returns a view of index i of the first dimension, which is removed
+func (t *Tensor) Index(i int) *Tensor {
+	if len(t.shape) == 0 || i < 0 || i >= t.shape[0] {
+		panic(fmt.Sprintf("tensor: index %d out of range for %v", i, t.shape))
+	}
+	return &Tensor{
+		data:    t.data,
+		shape:   append([]int{}, t.shape[1:]...),
+		strides: append([]int{}, t.strides[1:]...),
+		offset:  t.offset + i*t.strides[0],
+	}
+}
+
+// Unsqueeze returns a view with a dimension of size 1 inserted at dim
+func (t *Tensor) Unsqueeze(dim int) *Tensor {
+	if dim < 0 {
+		dim += len(t.shape) + 1
+	}
+	if dim < 0 || dim > len(t.shape) {
+		panic(fmt.Sprintf("tensor: cannot unsqueeze dimension %d of %v", dim, t.shape))
+	}
+	out := t.view()
+	out.shape = append(out.shape[:dim], append([]int{1}, out.shape[dim:]...)...)
+	out.strides = append(out.strides[:dim], append([]int{0}, out.strides[dim:]...)...)
+	return out
+}
+
+// Squeeze returns a view with dimension dim, which must have size 1, removed
+func (t *Tensor) Squeeze(dim int) *Tensor {
+	dim = t.axis(dim)
+	if t.shape[dim] != 1 {
+		panic(fmt.Sprintf("tensor: cannot squeeze dimension %d of %v", dim, t.shape))
+	}
+	out := t.view()
+	out.shape = append(out.shape[:dim], out.shape[dim+1:]...)
+	out.strides = append(out.strides[:dim], out.strides[dim+1:]...)
+	return out
+}
+
+// BroadcastTo returns a view of t expanded to shape following NumPy
+// broadcasting rules. Broadcast dimensions have a stride of 0.
+func (t *Tensor) BroadcastTo(shape ...int) *Tensor {
+	if len(shape) < len(t.shape) {
+		panic(fmt.Sprintf("tensor: cannot broadcast %v to %v", t.shape, shape))
+	}
+	out := &Tensor{data: t.data, shape: append([]int{}, shape...), strides: make([]int, len(shape)), offset: t.offset}
+	lead := len(shape) - len(t.shape)
+	for i := range t.shape {
+		switch {
+		case t.shape[i] == shape[lead+i]:
+			out.strides[lead+i] = t.strides[i]
+		case t.shape[i] == 1:
+			out.strides[lead+i] = 0
+		default:
+			panic(fmt.Sprintf("tensor: cannot broadcast %v to %v", t.shape, shape))
+		}
+	}
+	return out
+}
+
+// Concat joins tensors along dimension dim. All other dimensions must
+// match. The result is a new contiguous tensor.
+func Concat(dim int, tensors ...*Tensor) *Tensor {
+	if len(tensors) == 0 {
+		panic("tensor: Concat requires at least one tensor")
+	}
+	first := tensors[0]
+	dim = first.axis(dim)
+	shape := first.Shape()
+	shape[dim] = 0
+	for _, t := range tensors {
+		if len(t.shape) != len(shape) {
+			panic(fmt.Sprintf("tensor: cannot concatenate %v and %v", first.shape, t.shape))
+		}
+		for d := range shape {
+			if d != dim && t.shape[d] != first.shape[d] {
+				panic(fmt.Sprintf("tensor: cannot concatenate %v and %v along dimension %d", first.shape, t.shape, dim))
+			}
+		}
+		shape[dim] += t.shape[dim]
+	}
+
+	// Copy each tensor's block of inner elements for every outer index
+	out := Zeros(shape...)
+	outer := numel(shape[:dim])
+	inner := numel(shape[dim+1:])
+	pos := 0
+	for _, t := range tensors {
+		block := t.shape[dim] * inner
+		data := t.Data()
+		for o := 0; o < outer; o++ {
+			copy(out.data[o*shape[dim]*inner+pos:], data[o*block:(o+1)*block])
+		}
+		pos += block
+	}
+	return out
+}
+
+// String describes the tensor's shape
+func (t *Tensor) String() string {
+	parts := make([]string, len(t.shape))
+	for i, s := range t.shape {
+		parts[i] = fmt.Sprint(s)
+	}
+	return "Tensor[" + strings.Join(parts, ", ") + "]"
+}
+
+// view returns a shallow copy of t that can be modified independently
+func (t *Tensor) view() *Tensor {
+	return &Tensor{
+		data:    t.data,
+		shape:   append([]int{}, t.shape...),
+		strides: append([]int{}, t.strides...),
+		offset:  t.offset,
+	}
+}
+
+// axis resolves a possibly negative dimension index
+func (t *Tensor) axis(d int) int {
+	if d < 0 {
+		d += len(t.shape)
+	}
+	if d < 0 || d >= len(t.shape) {
+		panic(fmt.Sprintf("tensor: dimension %d out of range for %v", d, t.shape))
+	}
+	return d
+}
+
+// offsetOf returns the position in data of an element
+func (t *Tensor) offsetOf(index []int) int {
+	if len(index) != len(t.shape) {
+		panic(fmt.Sprintf("tensor: index %v does not match shape %v", index, t.shape))
+	}
+	off := t.offset
+	for d, i := range index {
+		if i < 0 || i >= t.shape[d] {
+			panic(fmt.Sprintf("tensor: index %v out of range for shape %v", index, t.shape))
+		}
+		off += i * t.strides[d]
+	}
+	return off
+}
+
+// innerStride returns the stride of the last dimension, or 1 for scalars
+func (t *Tensor) innerStride() int {
+	if len(t.strides) == 0 {
+		return 1
+	}
+	return t.strides[len(t.strides)-1]
+}
+
+// eachRow walks shape one innermost row at a time, calling fn with the
+// offset of the row's first element in each tensor and the row length. The
+// tensors must all have the given shape.
+func eachRow(shape []int, tensors []*Tensor, fn func(offsets []int, n int)) {
+	if numel(shape) == 0 {
+		return
+	}
+	offsets := make([]int, len(tensors))
+	for i, t := range tensors {
+		offsets[i] = t.offset
+	}
+	if len(shape) == 0 {
+		fn(offsets, 1)
+		return
+	}
+
+	outer := len(shape) - 1
+	index := make([]int, outer)
+	for {
+		fn(offsets, shape[outer])
+
+		d := outer - 1
+		for ; d >= 0; d-- {
+			index[d]++
+			for i, t := range tensors {
+				offsets[i] += t.strides[d]
+			}
+			if index[d] < shape[d] {
+				break
+			}
+			for i, t := range tensors {
+				offsets[i] -= shape[d] * t.strides[d]
+			}
+			index[d] = 0
+		}
+		if d < 0 {
+			return
+		}
+	}
+}
+
+func numel(shape []int) int {
+	n := 1
+	for _, s := range shape {
+		if s < 0 {
+			panic(fmt.Sprintf("tensor: negative dimension in shape %v", shape))
+		}
+		n *= s
+	}
+	return n
+}
+
+func contiguousStrides(shape []int) []int {
+	strides := make([]int, len(shape))
+	stride := 1
+	for d := len(shape) - 1; d >= 0; d-- {
+		strides[d] = stride
+		stride *= shape[d]
+	}
+	return strides
+}
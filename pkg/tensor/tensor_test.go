@@ -0,0 +1,134 @@
+package tensor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func seq(n int) []float32 {
+	data := make([]float32, n)
+	for i := range data {
+		data[i] = float32(i)
+	}
+	return data
+}
+
+func TestNew(t *testing.T) {
+	x := New(seq(6), 2, 3)
+	if !reflect.DeepEqual(x.Shape(), []int{2, 3}) {
+		t.Errorf("Expected shape [2 3], got %v", x.Shape())
+	}
+	if !reflect.DeepEqual(x.Strides(), []int{3, 1}) {
+		t.Errorf("Expected strides [3 1], got %v", x.Strides())
+	}
+	if x.At(1, 2) != 5 {
+		t.Errorf("Expected 5, got %v", x.At(1, 2))
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for data that does not fit the shape")
+		}
+	}()
+	New(seq(5), 2, 3)
+}
+
+func TestReshape(t *testing.T) {
+	x := New(seq(24), 2, 3, 4)
+	y := x.Reshape(4, -1)
+	if !reflect.DeepEqual(y.Shape(), []int{4, 6}) {
+		t.Fatalf("Expected shape [4 6], got %v", y.Shape())
+	}
+
+	// Reshaping a contiguous tensor shares memory
+	y.Set(100, 0, 0)
+	if x.At(0, 0, 0) != 100 {
+		t.Error("Expected reshape of a contiguous tensor to be a view")
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	x := New(seq(6), 2, 3)
+	y := x.T()
+	if !reflect.DeepEqual(y.Shape(), []int{3, 2}) {
+		t.Fatalf("Expected shape [3 2], got %v", y.Shape())
+	}
+	if y.IsContiguous() {
+		t.Error("Expected a transposed view not to be contiguous")
+	}
+	expected := []float32{0, 3, 1, 4, 2, 5}
+	if !reflect.DeepEqual(y.Data(), expected) {
+		t.Errorf("Expected %v, got %v", expected, y.Data())
+	}
+
+	z := New(seq(24), 2, 3, 4).Transpose(2, 0, 1)
+	if !reflect.DeepEqual(z.Shape(), []int{4, 2, 3}) || z.At(3, 1, 2) != 23 {
+		t.Errorf("Unexpected permutation result %v with At(3,1,2)=%v", z.Shape(), z.At(3, 1, 2))
+	}
+	if got := z.Reshape(-1).At(1); got != 4 {
+		t.Errorf("Expected reshape of a permuted tensor to copy in row-major order, got %v", got)
+	}
+}
+
+func TestSliceAndIndex(t *testing.T) {
+	x := New(seq(12), 3, 4)
+
+	s := x.Slice(1, 1, 3)
+	expected := []float32{1, 2, 5, 6, 9, 10}
+	if !reflect.DeepEqual(s.Data(), expected) {
+		t.Errorf("Expected %v, got %v", expected, s.Data())
+	}
+
+	row := x.Index(2)
+	if !reflect.DeepEqual(row.Data(), []float32{8, 9, 10, 11}) {
+		t.Errorf("Expected the last row, got %v", row.Data())
+	}
+
+	u := x.Unsqueeze(0)
+	if !reflect.DeepEqual(u.Shape(), []int{1, 3, 4}) {
+		t.Errorf("Expected shape [1 3 4], got %v", u.Shape())
+	}
+	if !reflect.DeepEqual(u.Squeeze(0).Shape(), []int{3, 4}) {
+		t.Errorf("Expected shape [3 4], got %v", u.Squeeze(0).Shape())
+	}
+}
+
+func TestBroadcastTo(t *testing.T) {
+	x := New([]float32{1, 2, 3}, 3)
+	b := x.BroadcastTo(2, 3)
+	expected := []float32{1, 2, 3, 1, 2, 3}
+	if !reflect.DeepEqual(b.Data(), expected) {
+		t.Errorf("Expected %v, got %v", expected, b.Data())
+	}
+
+	col := New([]float32{1, 2}, 2, 1).BroadcastTo(2, 3)
+	expected = []float32{1, 1, 1, 2, 2, 2}
+	if !reflect.DeepEqual(col.Data(), expected) {
+		t.Errorf("Expected %v, got %v", expected, col.Data())
+	}
+}
+
+func TestConcat(t *testing.T) {
+	a := New(seq(6), 2, 3)
+	b := Full(9, 2, 1)
+	c := Concat(1, a, b)
+	if !reflect.DeepEqual(c.Shape(), []int{2, 4}) {
+		t.Fatalf("Expected shape [2 4], got %v", c.Shape())
+	}
+	if want := []float32{0, 1, 2, 9, 3, 4, 5, 9}; !reflect.DeepEqual(c.Data(), want) {
+		t.Errorf("Expected %v, got %v", want, c.Data())
+	}
+
+	// Non-contiguous inputs along the first dimension
+	d := Concat(0, a.T(), Zeros(1, 2))
+	if want := []float32{0, 3, 1, 4, 2, 5, 0, 0}; !reflect.DeepEqual(d.Data(), want) {
+		t.Errorf("Expected %v, got %v", want, d.Data())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for mismatched shapes")
+		}
+	}()
+	Concat(0, a, b)
+}
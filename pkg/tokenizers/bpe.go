@@ -0,0 +1,538 @@
+package tokenizers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+var _ Tokenizer = (*ByteLevelBPETokenizer)(nil)
+
+// ByteLevelBPETokenizer implements the byte-level byte-pair encoding used by
+// GPT-2 family models. Text is split with the GPT-2 pre-tokenization rules,
+// mapped byte-by-byte onto printable characters and merged by rank.
+type ByteLevelBPETokenizer struct {
+	Vocab    map[string]int `json:"vocab"`
+	UNKToken string         `json:"unk_token,omitempty"` // GPT-2 vocabularies cover every byte and need none
+
+	// SpecialTokens are matched verbatim in the input before pre-tokenization
+	SpecialTokens []string `json:"special_tokens,omitempty"`
+
+	processing
+	merges    map[[2]string]int
+	idToToken []string
+
+	cacheMu sync.RWMutex
+	cache   map[string][]string
+}
+
+// NewByteLevelBPETokenizer creates a new byte-level BPE tokenizer. It loads
+// either a vocab.json and merges.txt pair, or a Hugging Face tokenizer.json
+// when mergesPath is empty.
+func NewByteLevelBPETokenizer(vocabPath, mergesPath string) (*ByteLevelBPETokenizer, error) {
+	bpe := &ByteLevelBPETokenizer{}
+
+	if mergesPath == "" {
+		tj, err := readTokenizerJSON(vocabPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := bpe.loadTokenizerJSON(tj); err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", vocabPath, err)
+		}
+		if err := bpe.loadProcessing(tj); err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", vocabPath, err)
+		}
+	} else {
+		data, err := os.ReadFile(vocabPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vocab file: %w", err)
+		}
+		if err := json.Unmarshal(data, &bpe.Vocab); err != nil {
+			return nil, fmt.Errorf("failed to parse vocab file %s: %w", vocabPath, err)
+		}
+		merges, err := readMergesTxt(mergesPath)
+		if err != nil {
+			return nil, err
+		}
+		bpe.merges = merges
+		if _, ok := bpe.Vocab["<|endoftext|>"]; ok {
+			bpe.SpecialTokens = []string{"<|endoftext|>"}
+		}
+	}
+
+	if len(bpe.Vocab) == 0 {
+		return nil, fmt.Errorf("vocabulary is empty")
+	}
+	bpe.idToToken = reverseVocab(bpe.Vocab)
+	bpe.cache = make(map[string][]string)
+	return bpe, nil
+}
+
+// loadTokenizerJSON configures the tokenizer from the model and added_tokens
+// sections of a tokenizer.json file
+func (bpe *ByteLevelBPETokenizer) loadTokenizerJSON(tj *tokenizerJSON) error {
+	var model struct {
+		Type     string            `json:"type"`
+		UNKToken *string           `json:"unk_token"`
+		Vocab    map[string]int    `json:"vocab"`
+		Merges   []json.RawMessage `json:"merges"`
+	}
+	if err := json.Unmarshal(tj.Model, &model); err != nil {
+		return fmt.Errorf("invalid model section: %w", err)
+	}
+	if model.Type != "" && model.Type != "BPE" {
+		return fmt.Errorf("expected a BPE model, got %s", model.Type)
+	}
+
+	merges, err := parseMerges(model.Merges)
+	if err != nil {
+		return err
+	}
+
+	bpe.Vocab = model.Vocab
+	bpe.merges = merges
+	if model.UNKToken != nil {
+		bpe.UNKToken = *model.UNKToken
+	}
+	for _, at := range tj.AddedTokens {
+		bpe.SpecialTokens = append(bpe.SpecialTokens, at.Content)
+		if _, ok := bpe.Vocab[at.Content]; !ok {
+			bpe.Vocab[at.Content] = at.ID
+		}
+	}
+	return nil
+}
+
+// parseMerges decodes tokenizer.json merges, which are stored either as
+// "a b" strings or as ["a", "b"] pairs depending on the library version
+func parseMerges(raw []json.RawMessage) (map[[2]string]int, error) {
+	merges := make(map[[2]string]int, len(raw))
+	for rank, m := range raw {
+		var pair [2]string
+		var s string
+		if err := json.Unmarshal(m, &s); err == nil {
+			left, right, ok := strings.Cut(s, " ")
+			if !ok {
+				return nil, fmt.Errorf("invalid merge %q", s)
+			}
+			pair = [2]string{left, right}
+		} else if err := json.Unmarshal(m, &pair); err != nil {
+			return nil, fmt.Errorf("invalid merge %s", m)
+		}
+		if _, exists := merges[pair]; !exists {
+			merges[pair] = rank
+		}
+	}
+	return merges, nil
+}
+
+// readMergesTxt loads a merges.txt file with one space-separated pair per
+// line, ordered by rank
+func readMergesTxt(path string) (map[[2]string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open merges file: %w", err)
+	}
+	defer f.Close()
+
+	merges := make(map[[2]string]int)
+	scanner := bufio.NewScanner(f)
+	rank := 0
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "#version") || line == "" {
+			continue
+		}
+		left, right, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid merge %q in %s", line, path)
+		}
+		pair := [2]string{left, right}
+		if _, exists := merges[pair]; !exists {
+			merges[pair] = rank
+		}
+		rank++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read merges file: %w", err)
+	}
+	return merges, nil
+}
+
+// Encode tokenizes text into an encoding. GPT-2 style models add no special
+// tokens around the input unless tokenizer.json configures a post-processor.
+func (bpe *ByteLevelBPETokenizer) Encode(text string) (*Encoding, error) {
+	return bpe.encode(bpe.encodeSequence, text, nil)
+}
+
+// EncodePair tokenizes a pair of sequences into a single encoding
+func (bpe *ByteLevelBPETokenizer) EncodePair(text, pair string) (*Encoding, error) {
+	return bpe.encode(bpe.encodeSequence, text, &pair)
+}
+
+// EncodePairTruncated is EncodePair with the given truncation settings in
+// place of the tokenizer's own
+func (bpe *ByteLevelBPETokenizer) EncodePairTruncated(text, pair string, truncation *TruncationParams) (*Encoding, error) {
+	truncation, err := checkTruncation(truncation)
+	if err != nil {
+		return nil, err
+	}
+	return bpe.encodeTruncated(bpe.encodeSequence, text, &pair, truncation)
+}
+
+// EncodeBatch tokenizes several inputs, padding them to a common length
+// when padding is enabled
+func (bpe *ByteLevelBPETokenizer) EncodeBatch(texts []string) ([]*Encoding, error) {
+	return bpe.encodeBatch(bpe.encodeSequence, texts)
+}
+
+// encodeSequence tokenizes a single sequence without special tokens
+func (bpe *ByteLevelBPETokenizer) encodeSequence(text string) (*Encoding, error) {
+	pieces, err := bpe.tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	enc := &Encoding{}
+	for _, p := range pieces {
+		enc.appendToken(p, 0)
+	}
+	return enc, nil
+}
+
+// Tokenize converts text to token IDs
+func (bpe *ByteLevelBPETokenizer) Tokenize(text string) ([]int, error) {
+	enc, err := bpe.Encode(text)
+	if err != nil {
+		return nil, err
+	}
+	return enc.IDs, nil
+}
+
+// Decode converts token IDs back to text, reversing the byte-to-unicode
+// mapping so that any UTF-8 input round-trips exactly
+func (bpe *ByteLevelBPETokenizer) Decode(tokenIDs []int) (string, error) {
+	var buf []byte
+	for _, id := range tokenIDs {
+		token, ok := bpe.IDToToken(id)
+		if !ok {
+			return "", fmt.Errorf("%w: token ID %d is not in the vocabulary", errs.ErrInvalidInput, id)
+		}
+		if bpe.isSpecial(token) {
+			buf = append(buf, token...)
+			continue
+		}
+		for _, r := range token {
+			b, ok := unicodeToBytes[r]
+			if !ok {
+				// Not a byte-level symbol; keep the character as is
+				buf = utf8.AppendRune(buf, r)
+				continue
+			}
+			buf = append(buf, b)
+		}
+	}
+	return string(buf), nil
+}
+
+// TokenToID returns the ID of a token in the vocabulary
+func (bpe *ByteLevelBPETokenizer) TokenToID(token string) (int, bool) {
+	return lookupID(bpe.Vocab, token)
+}
+
+// IDToToken returns the token for an ID in the vocabulary
+func (bpe *ByteLevelBPETokenizer) IDToToken(id int) (string, bool) {
+	return lookupToken(bpe.idToToken, id)
+}
+
+// VocabSize returns the number of IDs in the vocabulary
+func (bpe *ByteLevelBPETokenizer) VocabSize() int {
+	return len(bpe.idToToken)
+}
+
+// tokenize splits text into BPE pieces
+func (bpe *ByteLevelBPETokenizer) tokenize(text string) ([]wordPiece, error) {
+	var pieces []wordPiece
+	word := 0
+	for _, seg := range splitSpecialTokens(text, bpe.SpecialTokens) {
+		if seg.special {
+			pieces = append(pieces, wordPiece{
+				token: text[seg.start:seg.end],
+				id:    bpe.Vocab[text[seg.start:seg.end]],
+				start: seg.start,
+				end:   seg.end,
+				word:  word,
+			})
+			word++
+			continue
+		}
+
+		for _, span := range gpt2PreTokenize(text[seg.start:seg.end]) {
+			start, end := seg.start+span[0], seg.start+span[1]
+			symbols, spans := byteLevelSymbols(text[start:end])
+			for _, merged := range bpe.merge(symbols) {
+				id, ok := bpe.Vocab[merged.token]
+				if !ok {
+					if bpe.UNKToken == "" {
+						return nil, fmt.Errorf("token %q is not in the vocabulary", merged.token)
+					}
+					id = bpe.Vocab[bpe.UNKToken]
+				}
+				pieces = append(pieces, wordPiece{
+					token: merged.token,
+					id:    id,
+					start: start + spans[merged.first].Start,
+					end:   start + spans[merged.last].End,
+					word:  word,
+				})
+			}
+			word++
+		}
+	}
+	return pieces, nil
+}
+
+// bpeCacheCapacity bounds the number of words whose merges are cached
+const bpeCacheCapacity = 10000
+
+// mergedSymbol is the result of merging the symbols first..last of a word
+type mergedSymbol struct {
+	token       string
+	first, last int
+}
+
+// merge applies BPE merges by rank to a word's symbols. Results are cached
+// per word since natural text repeats words heavily.
+func (bpe *ByteLevelBPETokenizer) merge(symbols []string) []mergedSymbol {
+	key := strings.Join(symbols, "")
+
+	bpe.cacheMu.RLock()
+	tokens, ok := bpe.cache[key]
+	bpe.cacheMu.RUnlock()
+	if !ok {
+		tokens = bpeMerge(symbols, bpe.merges)
+		bpe.cacheMu.Lock()
+		if len(bpe.cache) < bpeCacheCapacity {
+			bpe.cache[key] = tokens
+		}
+		bpe.cacheMu.Unlock()
+	}
+
+	result := make([]mergedSymbol, len(tokens))
+	pos := 0
+	for i, token := range tokens {
+		n := utf8.RuneCountInString(token)
+		result[i] = mergedSymbol{token: token, first: pos, last: pos + n - 1}
+		pos += n
+	}
+	return result
+}
+
+// bpeMerge repeatedly merges the adjacent pair with the lowest rank until no
+// ranked pair remains
+func bpeMerge(symbols []string, ranks map[[2]string]int) []string {
+	return bpeMergePrefix(symbols, ranks, "")
+}
+
+// bpeMergePrefix is bpeMerge for vocabularies that mark continuing subwords
+// with a prefix, which is dropped from the right-hand side of a merge
+func bpeMergePrefix(symbols []string, ranks map[[2]string]int, prefix string) []string {
+	word := append([]string(nil), symbols...)
+	for len(word) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i < len(word)-1; i++ {
+			if rank, ok := ranks[[2]string{word[i], word[i+1]}]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		pair := [2]string{word[best], word[best+1]}
+		merged := make([]string, 0, len(word))
+		for i := 0; i < len(word); i++ {
+			if i < len(word)-1 && word[i] == pair[0] && word[i+1] == pair[1] {
+				merged = append(merged, pair[0]+strings.TrimPrefix(pair[1], prefix))
+				i++
+				continue
+			}
+			merged = append(merged, word[i])
+		}
+		word = merged
+	}
+	return word
+}
+
+// byteLevelSymbols maps every byte of s to its printable unicode symbol.
+// It also returns, for each byte, the span of the character containing it,
+// so that offsets of partial characters widen to whole characters.
+func byteLevelSymbols(s string) ([]string, []Offset) {
+	symbols := make([]string, len(s))
+	spans := make([]Offset, len(s))
+	for i, r := range s {
+		size := utf8.RuneLen(r)
+		if r == utf8.RuneError {
+			size = 1
+		}
+		for j := i; j < i+size && j < len(s); j++ {
+			spans[j] = Offset{i, i + size}
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		symbols[i] = string(bytesToUnicode[s[i]])
+	}
+	return symbols, spans
+}
+
+// bytesToUnicode maps each byte to a printable character, avoiding
+// whitespace and control characters that BPE vocabularies cannot contain
+var bytesToUnicode, unicodeToBytes = buildByteLevelTables()
+
+func buildByteLevelTables() ([256]rune, map[rune]byte) {
+	var b2u [256]rune
+	u2b := make(map[rune]byte, 256)
+	n := 0
+	for b := 0; b < 256; b++ {
+		printable := (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF)
+		r := rune(b)
+		if !printable {
+			r = rune(256 + n)
+			n++
+		}
+		b2u[b] = r
+		u2b[r] = byte(b)
+	}
+	return b2u, u2b
+}
+
+// gpt2PreTokenize splits text following the GPT-2 pattern
+//
+//	's|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+
+//
+// and returns the byte span of each piece. The negative lookahead is not
+// supported by Go's regexp package, hence the hand-written scanner.
+func gpt2PreTokenize(text string) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(text); {
+		end := gpt2NextPiece(text, i)
+		spans = append(spans, [2]int{i, end})
+		i = end
+	}
+	return spans
+}
+
+// gpt2NextPiece returns the end of the piece starting at i
+func gpt2NextPiece(text string, i int) int {
+	if text[i] == '\'' {
+		rest := text[i+1:]
+		for _, suffix := range []string{"re", "ve", "ll", "s", "t", "m", "d"} {
+			if strings.HasPrefix(rest, suffix) {
+				return i + 1 + len(suffix)
+			}
+		}
+	}
+
+	// Letters, numbers and other symbols may be preceded by a single space
+	start := i
+	if text[i] == ' ' && i+1 < len(text) {
+		if r, _ := utf8.DecodeRuneInString(text[i+1:]); !unicode.IsSpace(r) {
+			start = i + 1
+		}
+	}
+	r, _ := utf8.DecodeRuneInString(text[start:])
+	switch {
+	case unicode.IsLetter(r):
+		return scanWhile(text, start, unicode.IsLetter)
+	case unicode.IsNumber(r):
+		return scanWhile(text, start, unicode.IsNumber)
+	case !unicode.IsSpace(r):
+		return scanWhile(text, start, func(r rune) bool {
+			return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+	}
+
+	// Whitespace: leave the last character for the following piece unless
+	// the run is a single character or reaches the end of the text
+	end := scanWhile(text, i, unicode.IsSpace)
+	if end == len(text) {
+		return end
+	}
+	_, last := utf8.DecodeLastRuneInString(text[i:end])
+	if end-last > i {
+		return end - last
+	}
+	return end
+}
+
+// scanWhile returns the end of the run of runes starting at i matching fn
+func scanWhile(text string, i int, fn func(rune) bool) int {
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !fn(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// segment is a span of input that is either a special token or ordinary text
+type segment struct {
+	start, end int
+	special    bool
+}
+
+// splitSpecialTokens splits text around occurrences of special tokens,
+// preferring the longest token when several match at the same position
+func splitSpecialTokens(text string, specials []string) []segment {
+	if len(specials) == 0 {
+		return []segment{{0, len(text), false}}
+	}
+	sorted := append([]string(nil), specials...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	var segments []segment
+	last := 0
+	for i := 0; i < len(text); {
+		matched := ""
+		for _, s := range sorted {
+			if s != "" && strings.HasPrefix(text[i:], s) {
+				matched = s
+				break
+			}
+		}
+		if matched == "" {
+			i++
+			continue
+		}
+		if i > last {
+			segments = append(segments, segment{last, i, false})
+		}
+		segments = append(segments, segment{i, i + len(matched), true})
+		i += len(matched)
+		last = i
+	}
+	if last < len(text) {
+		segments = append(segments, segment{last, len(text), false})
+	}
+	return segments
+}
+
+// isSpecial reports whether token is one of the special tokens
+func (bpe *ByteLevelBPETokenizer) isSpecial(token string) bool {
+	for _, s := range bpe.SpecialTokens {
+		if s == token {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package tokenizers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+func newTestBPETokenizer(t *testing.T) *ByteLevelBPETokenizer {
+	t.Helper()
+	bpe, err := NewByteLevelBPETokenizer("testdata/gpt2-vocab.json", "testdata/gpt2-merges.txt")
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+	return bpe
+}
+
+func TestByteLevelBPETokenizer_Tokenize(t *testing.T) {
+	bpe := newTestBPETokenizer(t)
+
+	tests := []struct {
+		text string
+		ids  []int
+	}{
+		{"Hello world", []int{264, 260}},
+		{"Hello the world<|endoftext|>", []int{264, 267, 260, 269}},
+		{"!", []int{0}},
+	}
+
+	for _, tt := range tests {
+		ids, err := bpe.Tokenize(tt.text)
+		if err != nil {
+			t.Fatalf("Tokenize(%q) failed: %v", tt.text, err)
+		}
+		if !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("Tokenize(%q): expected %v, got %v", tt.text, tt.ids, ids)
+		}
+	}
+}
+
+func TestByteLevelBPETokenizer_RoundTrip(t *testing.T) {
+	bpe := newTestBPETokenizer(t)
+
+	for _, text := range []string{
+		"Hello world",
+		"  leading and trailing spaces  ",
+		"Ünïcödé, 世界 and emoji 🙂🚀",
+		"tabs\tnewlines\n\n\r\nand nbsp",
+		"I'm sure they'll say it's 42.5%",
+		"<|endoftext|>after special",
+		"",
+	} {
+		ids, err := bpe.Tokenize(text)
+		if err != nil {
+			t.Fatalf("Tokenize(%q) failed: %v", text, err)
+		}
+		decoded, err := bpe.Decode(ids)
+		if err != nil {
+			t.Fatalf("Decode failed for %q: %v", text, err)
+		}
+		if decoded != text {
+			t.Errorf("Round trip mismatch: expected %q, got %q", text, decoded)
+		}
+	}
+}
+
+func TestGPT2PreTokenize(t *testing.T) {
+	tests := []struct {
+		text   string
+		pieces []string
+	}{
+		{"Hello world", []string{"Hello", " world"}},
+		{"I'm here", []string{"I", "'m", " here"}},
+		{"they'll", []string{"they", "'ll"}},
+		{"Hello  world", []string{"Hello", " ", " world"}},
+		{"a\n\nb", []string{"a", "\n", "\n", "b"}},
+		{"end  ", []string{"end", "  "}},
+		{"x 123 !?", []string{"x", " 123", " !?"}},
+		{"'quoted'", []string{"'", "quoted", "'"}},
+	}
+
+	for _, tt := range tests {
+		var pieces []string
+		for _, span := range gpt2PreTokenize(tt.text) {
+			pieces = append(pieces, tt.text[span[0]:span[1]])
+		}
+		if !reflect.DeepEqual(pieces, tt.pieces) {
+			t.Errorf("gpt2PreTokenize(%q): expected %q, got %q", tt.text, tt.pieces, pieces)
+		}
+	}
+}
+
+func TestByteLevelBPETokenizer_DecodeUnknownID(t *testing.T) {
+	bpe := newTestBPETokenizer(t)
+	if _, err := bpe.Decode([]int{100000}); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Error("Expected an error for an out-of-vocabulary ID")
+	}
+}
+
+func TestByteLevelBPETokenizer_EncodeOffsets(t *testing.T) {
+	bpe := newTestBPETokenizer(t)
+
+	text := "Héllo the world"
+	enc, err := bpe.Encode(text)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var spans []string
+	for _, o := range enc.Offsets {
+		spans = append(spans, text[o.Start:o.End])
+	}
+	// "é" is two bytes and therefore two byte-level tokens, each of which
+	// maps back to the whole character
+	expected := []string{"H", "é", "é", "ll", "o", " the", " world"}
+	if !reflect.DeepEqual(spans, expected) {
+		t.Errorf("Expected spans %q, got %q", expected, spans)
+	}
+
+	expectedWordIDs := []int{0, 0, 0, 0, 0, 1, 2}
+	if !reflect.DeepEqual(enc.WordIDs, expectedWordIDs) {
+		t.Errorf("Expected word IDs %v, got %v", expectedWordIDs, enc.WordIDs)
+	}
+}
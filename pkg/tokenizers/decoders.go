@@ -0,0 +1,283 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// decoder turns tokens back into text. Like Hugging Face decoders, each one
+// transforms the list of token strings and the results are concatenated.
+type decoder interface {
+	decode(tokens []string) []string
+}
+
+// decoderSequence applies several decoders in order
+type decoderSequence []decoder
+
+func (seq decoderSequence) decode(tokens []string) []string {
+	for _, d := range seq {
+		tokens = d.decode(tokens)
+	}
+	return tokens
+}
+
+// byteLevelDecoder reverses the byte-to-unicode mapping of byte-level BPE
+type byteLevelDecoder struct{}
+
+func (byteLevelDecoder) decode(tokens []string) []string {
+	var buf []byte
+	for _, token := range tokens {
+		for _, r := range token {
+			if b, ok := unicodeToBytes[r]; ok {
+				buf = append(buf, b)
+			} else {
+				buf = utf8.AppendRune(buf, r)
+			}
+		}
+	}
+	return []string{strings.ToValidUTF8(string(buf), string(utf8.RuneError))}
+}
+
+// wordPieceDecoder joins continuation pieces to the preceding token and
+// separates words with spaces
+type wordPieceDecoder struct {
+	prefix  string
+	cleanup bool
+}
+
+func (wd wordPieceDecoder) decode(tokens []string) []string {
+	result := make([]string, len(tokens))
+	for i, token := range tokens {
+		switch {
+		case i > 0 && wd.prefix != "" && strings.HasPrefix(token, wd.prefix):
+			token = strings.TrimPrefix(token, wd.prefix)
+		case i > 0:
+			token = " " + token
+		}
+		result[i] = token
+	}
+	if wd.cleanup {
+		// Cleanup patterns such as " ' " span several tokens
+		return []string{cleanUpTokenization(strings.Join(result, ""))}
+	}
+	return result
+}
+
+// metaspaceDecoder turns meta symbols back into spaces, dropping the one
+// prepended to the first word
+type metaspaceDecoder struct {
+	replacement   rune
+	prependScheme string
+}
+
+func (md metaspaceDecoder) decode(tokens []string) []string {
+	result := make([]string, len(tokens))
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, string(md.replacement), " ")
+		if i == 0 && md.prependScheme != "never" {
+			token = strings.TrimPrefix(token, " ")
+		}
+		result[i] = token
+	}
+	return result
+}
+
+// bpeDecoder replaces the end-of-word suffix of classic BPE vocabularies
+// with a space
+type bpeDecoder struct {
+	suffix string
+}
+
+func (bd bpeDecoder) decode(tokens []string) []string {
+	result := make([]string, len(tokens))
+	for i, token := range tokens {
+		replacement := " "
+		if i == len(tokens)-1 {
+			replacement = ""
+		}
+		result[i] = strings.ReplaceAll(token, bd.suffix, replacement)
+	}
+	return result
+}
+
+// byteFallbackDecoder converts runs of <0xXX> byte tokens back into text.
+// Invalid UTF-8 becomes one replacement character per byte.
+type byteFallbackDecoder struct{}
+
+func (byteFallbackDecoder) decode(tokens []string) []string {
+	var result []string
+	var pending []byte
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if utf8.Valid(pending) {
+			result = append(result, string(pending))
+		} else {
+			for range pending {
+				result = append(result, string(utf8.RuneError))
+			}
+		}
+		pending = pending[:0]
+	}
+	for _, token := range tokens {
+		if b, ok := parseBytePiece(token); ok {
+			pending = append(pending, b)
+			continue
+		}
+		flush()
+		result = append(result, token)
+	}
+	flush()
+	return result
+}
+
+// fuseDecoder joins all tokens into one
+type fuseDecoder struct{}
+
+func (fuseDecoder) decode(tokens []string) []string {
+	return []string{strings.Join(tokens, "")}
+}
+
+// stripDecoder removes up to start leading and stop trailing occurrences of
+// content from every token
+type stripDecoder struct {
+	content     string
+	start, stop int
+}
+
+func (sd stripDecoder) decode(tokens []string) []string {
+	result := make([]string, len(tokens))
+	for i, token := range tokens {
+		for n := 0; n < sd.start && strings.HasPrefix(token, sd.content); n++ {
+			token = token[len(sd.content):]
+		}
+		for n := 0; n < sd.stop && strings.HasSuffix(token, sd.content); n++ {
+			token = token[:len(token)-len(sd.content)]
+		}
+		result[i] = token
+	}
+	return result
+}
+
+// replaceDecoder replaces every match of a pattern in each token
+type replaceDecoder struct {
+	pattern *regexp.Regexp
+	content string
+}
+
+func (rd replaceDecoder) decode(tokens []string) []string {
+	result := make([]string, len(tokens))
+	for i, token := range tokens {
+		result[i] = rd.pattern.ReplaceAllLiteralString(token, rd.content)
+	}
+	return result
+}
+
+// parseDecoder decodes the decoder section of tokenizer.json
+func (l *pipelineLoader) parseDecoder(raw json.RawMessage) (decoder, error) {
+	kind, err := componentType(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decoder: %w", err)
+	}
+
+	switch kind {
+	case "":
+		return nil, nil
+	case "Sequence":
+		var seq struct {
+			Decoders []json.RawMessage `json:"decoders"`
+		}
+		if err := json.Unmarshal(raw, &seq); err != nil {
+			return nil, fmt.Errorf("invalid Sequence decoder: %w", err)
+		}
+		var result decoderSequence
+		for _, c := range seq.Decoders {
+			d, err := l.parseDecoder(c)
+			if err != nil {
+				return nil, err
+			}
+			if d != nil {
+				result = append(result, d)
+			}
+		}
+		return result, nil
+	case "ByteLevel":
+		return byteLevelDecoder{}, nil
+	case "WordPiece":
+		var wd struct {
+			Prefix  *string `json:"prefix"`
+			Cleanup *bool   `json:"cleanup"`
+		}
+		if err := json.Unmarshal(raw, &wd); err != nil {
+			return nil, fmt.Errorf("invalid WordPiece decoder: %w", err)
+		}
+		result := wordPieceDecoder{prefix: "##", cleanup: true}
+		if wd.Prefix != nil {
+			result.prefix = *wd.Prefix
+		}
+		if wd.Cleanup != nil {
+			result.cleanup = *wd.Cleanup
+		}
+		return result, nil
+	case "Metaspace":
+		var md struct {
+			Replacement    string  `json:"replacement"`
+			AddPrefixSpace *bool   `json:"add_prefix_space"`
+			PrependScheme  *string `json:"prepend_scheme"`
+		}
+		if err := json.Unmarshal(raw, &md); err != nil {
+			return nil, fmt.Errorf("invalid Metaspace decoder: %w", err)
+		}
+		mp, err := newMetaspace(md.Replacement, md.AddPrefixSpace, md.PrependScheme, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Metaspace decoder: %w", err)
+		}
+		return metaspaceDecoder{replacement: mp.replacement, prependScheme: mp.prependScheme}, nil
+	case "BPEDecoder":
+		var bd struct {
+			Suffix *string `json:"suffix"`
+		}
+		if err := json.Unmarshal(raw, &bd); err != nil {
+			return nil, fmt.Errorf("invalid BPEDecoder: %w", err)
+		}
+		result := bpeDecoder{suffix: "</w>"}
+		if bd.Suffix != nil {
+			result.suffix = *bd.Suffix
+		}
+		return result, nil
+	case "ByteFallback":
+		return byteFallbackDecoder{}, nil
+	case "Fuse":
+		return fuseDecoder{}, nil
+	case "Strip":
+		var sd struct {
+			Content string `json:"content"`
+			Start   int    `json:"start"`
+			Stop    int    `json:"stop"`
+		}
+		if err := json.Unmarshal(raw, &sd); err != nil {
+			return nil, fmt.Errorf("invalid Strip decoder: %w", err)
+		}
+		return stripDecoder{content: sd.Content, start: sd.Start, stop: sd.Stop}, nil
+	case "Replace":
+		var rd struct {
+			Pattern json.RawMessage `json:"pattern"`
+			Content string          `json:"content"`
+		}
+		if err := json.Unmarshal(raw, &rd); err != nil {
+			return nil, fmt.Errorf("invalid Replace decoder: %w", err)
+		}
+		re, err := parsePattern(rd.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Replace decoder: %w", err)
+		}
+		return replaceDecoder{pattern: re, content: rd.Content}, nil
+	default:
+		l.unsupported = append(l.unsupported, "decoder "+kind)
+		return nil, nil
+	}
+}
@@ -0,0 +1,210 @@
+//go:build ignore
+
+// gen_unicode generates unicode_tables.go from the Unicode Character Database.
+// The tables drive canonical and compatibility normalization (NFC, NFD, NFKC
+// and NFKD).
+//
+// Usage:
+//
+//	go run gen_unicode.go [-ucd https://www.unicode.org/Public/14.0.0/ucd]
+//
+// The -ucd flag accepts either a URL or a local directory containing
+// UnicodeData.txt and CompositionExclusions.txt.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const unicodeVersion = "14.0.0"
+
+var ucd = flag.String("ucd", "https://www.unicode.org/Public/"+unicodeVersion+"/ucd", "URL or directory of the Unicode Character Database")
+
+func main() {
+	flag.Parse()
+
+	data, err := open("UnicodeData.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer data.Close()
+
+	canonical := map[rune][]rune{}
+	compat := map[rune][]rune{}
+	combining := map[rune]int{}
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ";")
+		if len(fields) < 6 {
+			continue
+		}
+		cp, err := strconv.ParseUint(fields[0], 16, 32)
+		if err != nil {
+			log.Fatalf("bad code point %q: %v", fields[0], err)
+		}
+		if ccc, _ := strconv.Atoi(fields[3]); ccc != 0 {
+			combining[rune(cp)] = ccc
+		}
+		switch {
+		case fields[5] == "":
+		case strings.HasPrefix(fields[5], "<"):
+			// Compatibility decompositions carry a <tag> prefix
+			_, decomposition, _ := strings.Cut(fields[5], " ")
+			compat[rune(cp)] = parseRunes(decomposition)
+		default:
+			canonical[rune(cp)] = parseRunes(fields[5])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	exclusions, err := readExclusions()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Primary composites are canonical pairs of starters that are not
+	// explicitly excluded from composition
+	compositions := map[[2]rune]rune{}
+	for r, d := range canonical {
+		if len(d) != 2 || exclusions[r] || combining[r] != 0 || combining[d[0]] != 0 {
+			continue
+		}
+		compositions[[2]rune{d[0], d[1]}] = r
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by gen_unicode.go from UnicodeData.txt (Unicode %s); DO NOT EDIT.\n\n", unicodeVersion)
+	buf.WriteString("package tokenizers\n\n")
+	buf.WriteString("// canonicalDecompositions maps a code point to its single-level canonical\n// decomposition.\n")
+	writeTable(&buf, "canonicalDecompositions", canonical)
+	buf.WriteString("// compatDecompositions maps a code point to its single-level compatibility\n// decomposition.\n")
+	writeTable(&buf, "compatDecompositions", compat)
+	buf.WriteString("// combiningClasses holds the non-zero canonical combining classes.\n")
+	writeCombining(&buf, combining)
+	buf.WriteString("// canonicalCompositions maps a starter and a following character to their\n// primary composite.\n")
+	writeCompositions(&buf, compositions)
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("unicode_tables.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readExclusions loads the code points listed in CompositionExclusions.txt
+func readExclusions() (map[rune]bool, error) {
+	data, err := open("CompositionExclusions.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	exclusions := map[rune]bool{}
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		cp, err := strconv.ParseUint(line, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad exclusion %q: %v", line, err)
+		}
+		exclusions[rune(cp)] = true
+	}
+	return exclusions, scanner.Err()
+}
+
+func writeCombining(w io.Writer, table map[rune]int) {
+	keys := make([]rune, 0, len(table))
+	for r := range table {
+		keys = append(keys, r)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	fmt.Fprint(w, "var combiningClasses = map[rune]uint8{\n")
+	for _, r := range keys {
+		fmt.Fprintf(w, "\t0x%04X: %d,\n", r, table[r])
+	}
+	fmt.Fprint(w, "}\n\n")
+}
+
+func writeCompositions(w io.Writer, table map[[2]rune]rune) {
+	keys := make([][2]rune, 0, len(table))
+	for pair := range table {
+		keys = append(keys, pair)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	fmt.Fprint(w, "var canonicalCompositions = map[[2]rune]rune{\n")
+	for _, pair := range keys {
+		fmt.Fprintf(w, "\t{0x%04X, 0x%04X}: 0x%04X,\n", pair[0], pair[1], table[pair])
+	}
+	fmt.Fprint(w, "}\n\n")
+}
+
+func writeTable(w io.Writer, name string, table map[rune][]rune) {
+	keys := make([]rune, 0, len(table))
+	for r := range table {
+		keys = append(keys, r)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	fmt.Fprintf(w, "var %s = map[rune][]rune{\n", name)
+	for _, r := range keys {
+		parts := make([]string, len(table[r]))
+		for i, d := range table[r] {
+			parts[i] = fmt.Sprintf("0x%04X", d)
+		}
+		fmt.Fprintf(w, "\t0x%04X: {%s},\n", r, strings.Join(parts, ", "))
+	}
+	fmt.Fprint(w, "}\n\n")
+}
+
+func parseRunes(s string) []rune {
+	var runes []rune
+	for _, f := range strings.Fields(s) {
+		cp, err := strconv.ParseUint(f, 16, 32)
+		if err != nil {
+			log.Fatalf("bad decomposition %q: %v", s, err)
+		}
+		runes = append(runes, rune(cp))
+	}
+	return runes
+}
+
+func open(name string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(*ucd, "http://") && !strings.HasPrefix(*ucd, "https://") {
+		return os.Open(filepath.Join(*ucd, name))
+	}
+	resp, err := http.Get(*ucd + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: %s", name, resp.Status)
+	}
+	return resp.Body, nil
+}
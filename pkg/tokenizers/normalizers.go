@@ -0,0 +1,355 @@
+package tokenizers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// normalizer transforms text before pre-tokenization. Every character keeps
+// the span of the original input it was produced from, so offsets survive
+// any number of normalization steps.
+type normalizer interface {
+	normalize(text []normRune) []normRune
+}
+
+// normalizerSequence applies several normalizers in order
+type normalizerSequence []normalizer
+
+func (seq normalizerSequence) normalize(text []normRune) []normRune {
+	for _, n := range seq {
+		text = n.normalize(text)
+	}
+	return text
+}
+
+// unicodeNormalizer applies NFD, NFC, NFKD or NFKC
+type unicodeNormalizer struct {
+	compat  bool
+	compose bool
+}
+
+func (un unicodeNormalizer) normalize(text []normRune) []normRune {
+	return unicodeNormalize(text, un.compat, un.compose)
+}
+
+// lowercaseNormalizer lowercases every character
+type lowercaseNormalizer struct{}
+
+func (lowercaseNormalizer) normalize(text []normRune) []normRune {
+	for i := range text {
+		text[i].r = unicode.ToLower(text[i].r)
+	}
+	return text
+}
+
+// stripAccentsNormalizer removes combining marks. It is usually preceded by
+// NFD so that accented characters are decomposed first.
+type stripAccentsNormalizer struct{}
+
+func (stripAccentsNormalizer) normalize(text []normRune) []normRune {
+	out := text[:0]
+	for _, nr := range text {
+		if !unicode.Is(unicode.Mn, nr.r) {
+			out = append(out, nr)
+		}
+	}
+	return out
+}
+
+// replaceNormalizer replaces every match of a pattern with fixed content
+type replaceNormalizer struct {
+	pattern *regexp.Regexp
+	content string
+}
+
+func (rn replaceNormalizer) normalize(text []normRune) []normRune {
+	s, offsets := runeString(text)
+	matches := rn.pattern.FindAllStringIndex(s, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var out []normRune
+	last := 0
+	for _, m := range matches {
+		first, end := runeIndex(offsets, m[0]), runeIndex(offsets, m[1])
+		if first == end {
+			continue
+		}
+		out = append(out, text[last:first]...)
+		// The replacement covers the whole span of the matched characters
+		start, stop := text[first].start, text[end-1].end
+		for _, r := range rn.content {
+			out = append(out, normRune{r, start, stop})
+		}
+		last = end
+	}
+	return append(out, text[last:]...)
+}
+
+// prependNormalizer adds a prefix to non-empty text
+type prependNormalizer struct {
+	prefix string
+}
+
+func (pn prependNormalizer) normalize(text []normRune) []normRune {
+	if len(text) == 0 {
+		return text
+	}
+	var out []normRune
+	for _, r := range pn.prefix {
+		out = append(out, normRune{r, text[0].start, text[0].start})
+	}
+	return append(out, text...)
+}
+
+// stripNormalizer removes leading and trailing whitespace
+type stripNormalizer struct {
+	left, right bool
+}
+
+func (sn stripNormalizer) normalize(text []normRune) []normRune {
+	for sn.left && len(text) > 0 && unicode.IsSpace(text[0].r) {
+		text = text[1:]
+	}
+	for sn.right && len(text) > 0 && unicode.IsSpace(text[len(text)-1].r) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// precompiledNormalizer applies a SentencePiece precompiled character map
+type precompiledNormalizer struct {
+	charsmap *precompiledCharsmap
+}
+
+func (pn precompiledNormalizer) normalize(text []normRune) []normRune {
+	s, offsets := runeString(text)
+	var out []normRune
+	for i := 0; i < len(s); {
+		replacement, n := pn.charsmap.normalize(s[i:])
+		first, end := runeIndex(offsets, i), runeIndex(offsets, i+n)
+		start, stop := text[first].start, text[max(end-1, first)].end
+		for _, r := range replacement {
+			out = append(out, normRune{r, start, stop})
+		}
+		i += n
+	}
+	return out
+}
+
+// bertNormalizer performs the cleanup of BERT's basic tokenizer: control
+// characters are removed, whitespace becomes a space, CJK characters are
+// surrounded by spaces and the text is optionally lowercased and stripped of
+// accents
+type bertNormalizer struct {
+	cleanText          bool
+	handleChineseChars bool
+	stripAccents       bool
+	lowercase          bool
+}
+
+func (bn bertNormalizer) normalize(text []normRune) []normRune {
+	var out []normRune
+	for _, nr := range text {
+		if bn.cleanText {
+			if nr.r == 0 || nr.r == unicode.ReplacementChar || isControl(nr.r) {
+				continue
+			}
+			if isWhitespace(nr.r) {
+				nr.r = ' '
+			}
+		}
+		if bn.handleChineseChars && isChineseChar(nr.r) {
+			out = append(out, normRune{' ', nr.start, nr.end}, nr, normRune{' ', nr.start, nr.end})
+			continue
+		}
+		out = append(out, nr)
+	}
+	if bn.stripAccents {
+		out = stripAccentsNormalizer{}.normalize(unicodeNormalize(out, false, false))
+	}
+	if bn.lowercase {
+		out = lowercaseNormalizer{}.normalize(out)
+	}
+	return out
+}
+
+// runeString returns the text of normalized characters together with the
+// byte offset of each character in it. The final entry holds the length of
+// the string.
+func runeString(text []normRune) (string, []int) {
+	var sb strings.Builder
+	offsets := make([]int, len(text)+1)
+	for i, nr := range text {
+		offsets[i] = sb.Len()
+		sb.WriteRune(nr.r)
+	}
+	offsets[len(text)] = sb.Len()
+	return sb.String(), offsets
+}
+
+// runeIndex converts a byte offset of a runeString back to a character index
+func runeIndex(offsets []int, pos int) int {
+	lo, hi := 0, len(offsets)-1
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if offsets[mid] < pos {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// parsePattern decodes a {"String": ...} or {"Regex": ...} pattern into a
+// regular expression
+func parsePattern(raw json.RawMessage) (*regexp.Regexp, error) {
+	var pattern struct {
+		String *string `json:"String"`
+		Regex  *string `json:"Regex"`
+	}
+	if err := json.Unmarshal(raw, &pattern); err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	switch {
+	case pattern.String != nil:
+		return regexp.MustCompile(regexp.QuoteMeta(*pattern.String)), nil
+	case pattern.Regex != nil:
+		re, err := regexp.Compile(*pattern.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported regular expression %q: %w", *pattern.Regex, err)
+		}
+		return re, nil
+	}
+	return nil, fmt.Errorf("pattern must be a String or a Regex")
+}
+
+// parseNormalizer decodes the normalizer section of tokenizer.json
+func (l *pipelineLoader) parseNormalizer(raw json.RawMessage) (normalizer, error) {
+	kind, err := componentType(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid normalizer: %w", err)
+	}
+
+	switch kind {
+	case "":
+		return nil, nil
+	case "Sequence":
+		var seq struct {
+			Normalizers []json.RawMessage `json:"normalizers"`
+		}
+		if err := json.Unmarshal(raw, &seq); err != nil {
+			return nil, fmt.Errorf("invalid Sequence normalizer: %w", err)
+		}
+		var result normalizerSequence
+		for _, c := range seq.Normalizers {
+			n, err := l.parseNormalizer(c)
+			if err != nil {
+				return nil, err
+			}
+			if n != nil {
+				result = append(result, n)
+			}
+		}
+		return result, nil
+	case "NFD":
+		return unicodeNormalizer{}, nil
+	case "NFC":
+		return unicodeNormalizer{compose: true}, nil
+	case "NFKD":
+		return unicodeNormalizer{compat: true}, nil
+	case "NFKC":
+		return unicodeNormalizer{compat: true, compose: true}, nil
+	case "Lowercase":
+		return lowercaseNormalizer{}, nil
+	case "StripAccents":
+		return stripAccentsNormalizer{}, nil
+	case "Replace":
+		var r struct {
+			Pattern json.RawMessage `json:"pattern"`
+			Content string          `json:"content"`
+		}
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, fmt.Errorf("invalid Replace normalizer: %w", err)
+		}
+		re, err := parsePattern(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Replace normalizer: %w", err)
+		}
+		return replaceNormalizer{pattern: re, content: r.Content}, nil
+	case "Prepend":
+		var p struct {
+			Prepend string `json:"prepend"`
+		}
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, fmt.Errorf("invalid Prepend normalizer: %w", err)
+		}
+		return prependNormalizer{prefix: p.Prepend}, nil
+	case "Strip":
+		var s struct {
+			Left  bool `json:"strip_left"`
+			Right bool `json:"strip_right"`
+		}
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("invalid Strip normalizer: %w", err)
+		}
+		return stripNormalizer{left: s.Left, right: s.Right}, nil
+	case "Precompiled":
+		var pc struct {
+			Charsmap *string `json:"precompiled_charsmap"`
+		}
+		if err := json.Unmarshal(raw, &pc); err != nil {
+			return nil, fmt.Errorf("invalid Precompiled normalizer: %w", err)
+		}
+		if pc.Charsmap == nil || *pc.Charsmap == "" {
+			return nil, nil
+		}
+		blob, err := base64.StdEncoding.DecodeString(*pc.Charsmap)
+		if err != nil {
+			return nil, fmt.Errorf("invalid precompiled charsmap: %w", err)
+		}
+		charsmap, err := parsePrecompiledCharsmap(blob)
+		if err != nil {
+			return nil, err
+		}
+		return precompiledNormalizer{charsmap: charsmap}, nil
+	case "BertNormalizer":
+		var bn struct {
+			CleanText          *bool `json:"clean_text"`
+			HandleChineseChars *bool `json:"handle_chinese_chars"`
+			StripAccents       *bool `json:"strip_accents"`
+			Lowercase          *bool `json:"lowercase"`
+		}
+		if err := json.Unmarshal(raw, &bn); err != nil {
+			return nil, fmt.Errorf("invalid BertNormalizer: %w", err)
+		}
+		result := bertNormalizer{cleanText: true, handleChineseChars: true, lowercase: true}
+		for _, field := range []struct {
+			dst *bool
+			src *bool
+		}{
+			{&result.cleanText, bn.CleanText},
+			{&result.handleChineseChars, bn.HandleChineseChars},
+			{&result.lowercase, bn.Lowercase},
+		} {
+			if field.src != nil {
+				*field.dst = *field.src
+			}
+		}
+		// A null strip_accents follows the lowercase setting
+		result.stripAccents = result.lowercase
+		if bn.StripAccents != nil {
+			result.stripAccents = *bn.StripAccents
+		}
+		return result, nil
+	default:
+		l.unsupported = append(l.unsupported, "normalizer "+kind)
+		return nil, nil
+	}
+}
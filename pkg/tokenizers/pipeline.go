@@ -0,0 +1,526 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+var _ Tokenizer = (*PipelineTokenizer)(nil)
+
+// PipelineTokenizer runs the complete pipeline described by a Hugging Face
+// tokenizer.json file. Added tokens are matched in the raw input first; the
+// remaining text is normalized, split into words by the pre-tokenizer and
+// tokenized by the model, then post-processed. Decoding runs the decoder.
+type PipelineTokenizer struct {
+	processing
+	normalizer   normalizer
+	preTokenizer preTokenizer
+	model        pipelineModel
+	decoder      decoder
+
+	addedTokens []string
+	addedVocab  map[string]int
+	addedIDs    map[int]addedToken
+}
+
+// pipelineModel is the tokenization model at the core of a pipeline
+type pipelineModel interface {
+	// tokenize splits one pre-tokenized word into pieces
+	tokenize(word []normRune) ([]wordPiece, error)
+
+	TokenToID(token string) (int, bool)
+	IDToToken(id int) (string, bool)
+	VocabSize() int
+}
+
+// pipelineLoader decodes the components of a tokenizer.json file, collecting
+// every component type that is not supported so they can be reported at once
+type pipelineLoader struct {
+	unsupported []string
+}
+
+// FromFile builds a tokenizer from a Hugging Face tokenizer.json file. The
+// normalizer, pre-tokenizer, model, post-processor and decoder sections are
+// all honored; files using components that are not implemented are rejected
+// with an error listing them.
+func FromFile(path string) (*PipelineTokenizer, error) {
+	tj, err := readTokenizerJSON(path)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := newPipelineTokenizer(tj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return pt, nil
+}
+
+// newPipelineTokenizer assembles the pipeline of a decoded tokenizer.json
+func newPipelineTokenizer(tj *tokenizerJSON) (*PipelineTokenizer, error) {
+	pt := &PipelineTokenizer{
+		addedVocab: make(map[string]int),
+		addedIDs:   make(map[int]addedToken),
+	}
+	for _, at := range tj.AddedTokens {
+		pt.addedTokens = append(pt.addedTokens, at.Content)
+		pt.addedVocab[at.Content] = at.ID
+		pt.addedIDs[at.ID] = at
+	}
+
+	l := &pipelineLoader{}
+	var err error
+	if pt.normalizer, err = l.parseNormalizer(tj.Normalizer); err != nil {
+		return nil, err
+	}
+	if pt.preTokenizer, err = l.parsePreTokenizer(tj.PreTokenizer); err != nil {
+		return nil, err
+	}
+	if pt.model, err = l.parseModel(tj); err != nil {
+		return nil, err
+	}
+	if pt.decoder, err = l.parseDecoder(tj.Decoder); err != nil {
+		return nil, err
+	}
+	if err := pt.loadProcessing(tj); err != nil {
+		var unsupported *unsupportedError
+		if !errors.As(err, &unsupported) {
+			return nil, err
+		}
+		l.unsupported = append(l.unsupported, unsupported.section+" "+unsupported.kind)
+	}
+
+	if len(l.unsupported) > 0 {
+		return nil, fmt.Errorf("tokenizer.json components %w: %s", errs.ErrNotImplemented, strings.Join(l.unsupported, ", "))
+	}
+	return pt, nil
+}
+
+// Encode tokenizes text into an encoding, applying the post-processor,
+// truncation and padding configured in tokenizer.json
+func (pt *PipelineTokenizer) Encode(text string) (*Encoding, error) {
+	return pt.encode(pt.encodeSequence, text, nil)
+}
+
+// EncodePair tokenizes a pair of sequences into a single encoding
+func (pt *PipelineTokenizer) EncodePair(text, pair string) (*Encoding, error) {
+	return pt.encode(pt.encodeSequence, text, &pair)
+}
+
+// EncodePairTruncated is EncodePair with the given truncation settings in
+// place of the tokenizer's own
+func (pt *PipelineTokenizer) EncodePairTruncated(text, pair string, truncation *TruncationParams) (*Encoding, error) {
+	truncation, err := checkTruncation(truncation)
+	if err != nil {
+		return nil, err
+	}
+	return pt.encodeTruncated(pt.encodeSequence, text, &pair, truncation)
+}
+
+// EncodeBatch tokenizes several inputs, padding them to a common length
+// when padding is enabled
+func (pt *PipelineTokenizer) EncodeBatch(texts []string) ([]*Encoding, error) {
+	return pt.encodeBatch(pt.encodeSequence, texts)
+}
+
+// Tokenize converts text to token IDs, including special tokens
+func (pt *PipelineTokenizer) Tokenize(text string) ([]int, error) {
+	enc, err := pt.Encode(text)
+	if err != nil {
+		return nil, err
+	}
+	return enc.IDs, nil
+}
+
+// Decode converts token IDs back to text with the configured decoder.
+// Special tokens are skipped.
+func (pt *PipelineTokenizer) Decode(ids []int) (string, error) {
+	tokens := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if at, ok := pt.addedIDs[id]; ok && at.Special {
+			continue
+		}
+		token, ok := pt.IDToToken(id)
+		if !ok {
+			return "", fmt.Errorf("%w: token ID %d is not in the vocabulary", errs.ErrInvalidInput, id)
+		}
+		tokens = append(tokens, token)
+	}
+	if pt.decoder == nil {
+		return strings.Join(tokens, " "), nil
+	}
+	return strings.Join(pt.decoder.decode(tokens), ""), nil
+}
+
+// TokenToID returns the ID of a token in the vocabulary
+func (pt *PipelineTokenizer) TokenToID(token string) (int, bool) {
+	if id, ok := pt.addedVocab[token]; ok {
+		return id, true
+	}
+	return pt.model.TokenToID(token)
+}
+
+// IDToToken returns the token for an ID in the vocabulary
+func (pt *PipelineTokenizer) IDToToken(id int) (string, bool) {
+	if at, ok := pt.addedIDs[id]; ok {
+		return at.Content, true
+	}
+	return pt.model.IDToToken(id)
+}
+
+// VocabSize returns the number of IDs in the vocabulary, including added
+// tokens
+func (pt *PipelineTokenizer) VocabSize() int {
+	size := pt.model.VocabSize()
+	for id := range pt.addedIDs {
+		size = max(size, id+1)
+	}
+	return size
+}
+
+// encodeSequence tokenizes a single sequence without special tokens
+func (pt *PipelineTokenizer) encodeSequence(text string) (*Encoding, error) {
+	enc := &Encoding{}
+	word := 0
+	for _, seg := range splitSpecialTokens(text, pt.addedTokens) {
+		if seg.special {
+			token := text[seg.start:seg.end]
+			enc.appendToken(wordPiece{token: token, id: pt.addedVocab[token], start: seg.start, end: seg.end, word: word}, 0)
+			word++
+			continue
+		}
+
+		normalized := toNormRunes(text, seg.start, seg.end)
+		if pt.normalizer != nil {
+			normalized = pt.normalizer.normalize(normalized)
+		}
+		if len(normalized) == 0 {
+			continue
+		}
+		words := [][]normRune{normalized}
+		if pt.preTokenizer != nil {
+			words = pt.preTokenizer.preTokenize(words)
+		}
+
+		for _, w := range words {
+			pieces, err := pt.model.tokenize(w)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range pieces {
+				p.word = word
+				enc.appendToken(p, 0)
+			}
+			word++
+		}
+	}
+	return enc, nil
+}
+
+// toNormRunes converts text[start:end] into characters spanning themselves
+func toNormRunes(text string, start, end int) []normRune {
+	runes := make([]normRune, 0, end-start)
+	for i := start; i < end; {
+		r, size := utf8.DecodeRuneInString(text[i:end])
+		runes = append(runes, normRune{r, i, i + size})
+		i += size
+	}
+	return runes
+}
+
+// parseModel decodes the model section of tokenizer.json
+func (l *pipelineLoader) parseModel(tj *tokenizerJSON) (pipelineModel, error) {
+	kind, err := componentType(tj.Model)
+	if err != nil {
+		return nil, fmt.Errorf("invalid model section: %w", err)
+	}
+
+	switch kind {
+	case "WordPiece":
+		wpt := &WordPieceTokenizer{UNKToken: "[UNK]", MaxInputLength: 100, ContinuingSubwordPrefix: "##"}
+		if err := wpt.loadTokenizerJSON(&tokenizerJSON{Model: tj.Model}); err != nil {
+			return nil, err
+		}
+		if _, ok := wpt.Vocab[wpt.UNKToken]; !ok {
+			return nil, fmt.Errorf("vocabulary does not contain unknown token %q", wpt.UNKToken)
+		}
+		wpt.idToToken = reverseVocab(wpt.Vocab)
+		return wordPieceModel{wpt}, nil
+	case "BPE":
+		return newBPEModel(tj.Model)
+	case "Unigram":
+		return newUnigramModel(tj)
+	case "WordLevel":
+		var model struct {
+			Vocab    map[string]int `json:"vocab"`
+			UNKToken string         `json:"unk_token"`
+		}
+		if err := json.Unmarshal(tj.Model, &model); err != nil {
+			return nil, fmt.Errorf("invalid model section: %w", err)
+		}
+		if len(model.Vocab) == 0 {
+			return nil, fmt.Errorf("model section has an empty vocabulary")
+		}
+		return &wordLevelModel{vocab: model.Vocab, idToToken: reverseVocab(model.Vocab), unkToken: model.UNKToken}, nil
+	default:
+		l.unsupported = append(l.unsupported, "model "+kind)
+		return nil, nil
+	}
+}
+
+// wordPieceModel tokenizes words with greedy longest-match WordPiece
+type wordPieceModel struct {
+	*WordPieceTokenizer
+}
+
+func (m wordPieceModel) tokenize(word []normRune) ([]wordPiece, error) {
+	return m.wordPieces(word, 0), nil
+}
+
+// unigramModel tokenizes words with the Viterbi segmentation of a Unigram
+// language model
+type unigramModel struct {
+	*SentencePieceTokenizer
+}
+
+// newUnigramModel decodes a Unigram model section
+func newUnigramModel(tj *tokenizerJSON) (unigramModel, error) {
+	var model struct {
+		UNKID        *int              `json:"unk_id"`
+		Vocab        []json.RawMessage `json:"vocab"`
+		ByteFallback bool              `json:"byte_fallback"`
+	}
+	if err := json.Unmarshal(tj.Model, &model); err != nil {
+		return unigramModel{}, fmt.Errorf("invalid model section: %w", err)
+	}
+
+	spt := &SentencePieceTokenizer{ModelType: SentencePieceUnigram, ByteFallback: model.ByteFallback}
+	for i, raw := range model.Vocab {
+		piece, score, err := parseUnigramEntry(raw)
+		if err != nil {
+			return unigramModel{}, fmt.Errorf("invalid vocab entry %d: %w", i, err)
+		}
+		pieceType := PieceNormal
+		if model.ByteFallback && isBytePiece(piece) {
+			pieceType = PieceByte
+		}
+		spt.Pieces = append(spt.Pieces, SentencePiece{Piece: piece, Score: score, Type: pieceType})
+	}
+	if model.UNKID == nil {
+		return unigramModel{}, fmt.Errorf("Unigram models without an unknown token are %w", errs.ErrNotImplemented)
+	}
+	spt.UNKID = *model.UNKID
+	if spt.UNKID >= 0 && spt.UNKID < len(spt.Pieces) {
+		spt.Pieces[spt.UNKID].Type = PieceUnknown
+	}
+	// Added tokens are split out before the model runs
+	for _, at := range tj.AddedTokens {
+		if at.ID >= 0 && at.ID < len(spt.Pieces) && at.ID != spt.UNKID {
+			spt.Pieces[at.ID].Type = PieceControl
+		}
+	}
+	if err := spt.init(); err != nil {
+		return unigramModel{}, err
+	}
+	return unigramModel{spt}, nil
+}
+
+func (m unigramModel) tokenize(word []normRune) ([]wordPiece, error) {
+	return m.segment(word), nil
+}
+
+// bpeModel is a general byte-pair encoding model. Byte-level BPE is this
+// model behind a ByteLevel pre-tokenizer.
+type bpeModel struct {
+	vocab     map[string]int
+	idToToken []string
+	merges    map[[2]string]int
+
+	unkToken                string
+	continuingSubwordPrefix string
+	endOfWordSuffix         string
+	fuseUNK                 bool
+	byteFallback            bool
+	ignoreMerges            bool
+}
+
+// newBPEModel decodes a BPE model section
+func newBPEModel(raw json.RawMessage) (*bpeModel, error) {
+	var model struct {
+		Vocab                   map[string]int    `json:"vocab"`
+		Merges                  []json.RawMessage `json:"merges"`
+		UNKToken                *string           `json:"unk_token"`
+		ContinuingSubwordPrefix *string           `json:"continuing_subword_prefix"`
+		EndOfWordSuffix         *string           `json:"end_of_word_suffix"`
+		FuseUNK                 bool              `json:"fuse_unk"`
+		ByteFallback            bool              `json:"byte_fallback"`
+		IgnoreMerges            bool              `json:"ignore_merges"`
+	}
+	if err := json.Unmarshal(raw, &model); err != nil {
+		return nil, fmt.Errorf("invalid model section: %w", err)
+	}
+	if len(model.Vocab) == 0 {
+		return nil, fmt.Errorf("model section has an empty vocabulary")
+	}
+	merges, err := parseMerges(model.Merges)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &bpeModel{
+		vocab:        model.Vocab,
+		idToToken:    reverseVocab(model.Vocab),
+		merges:       merges,
+		fuseUNK:      model.FuseUNK,
+		byteFallback: model.ByteFallback,
+		ignoreMerges: model.IgnoreMerges,
+	}
+	for _, field := range []struct {
+		dst *string
+		src *string
+	}{
+		{&m.unkToken, model.UNKToken},
+		{&m.continuingSubwordPrefix, model.ContinuingSubwordPrefix},
+		{&m.endOfWordSuffix, model.EndOfWordSuffix},
+	} {
+		if field.src != nil {
+			*field.dst = *field.src
+		}
+	}
+	if m.unkToken != "" {
+		if _, ok := m.vocab[m.unkToken]; !ok {
+			return nil, fmt.Errorf("unknown token %q is not in the vocabulary", m.unkToken)
+		}
+	}
+	return m, nil
+}
+
+func (m *bpeModel) tokenize(word []normRune) ([]wordPiece, error) {
+	if m.ignoreMerges {
+		s, _ := runeString(word)
+		if id, ok := m.vocab[s]; ok {
+			return []wordPiece{{token: s, id: id, start: word[0].start, end: word[len(word)-1].end}}, nil
+		}
+	}
+
+	symbols := make([]string, len(word))
+	for i, nr := range word {
+		symbols[i] = string(nr.r)
+		if i > 0 {
+			symbols[i] = m.continuingSubwordPrefix + symbols[i]
+		}
+		if i == len(word)-1 {
+			symbols[i] += m.endOfWordSuffix
+		}
+	}
+	merged := bpeMergePrefix(symbols, m.merges, m.continuingSubwordPrefix)
+
+	prefixRunes := utf8.RuneCountInString(m.continuingSubwordPrefix)
+	suffixRunes := utf8.RuneCountInString(m.endOfWordSuffix)
+	var pieces []wordPiece
+	pos := 0
+	for i, sym := range merged {
+		// Recover the number of characters of the word the symbol covers
+		n := utf8.RuneCountInString(sym)
+		if i > 0 {
+			n -= prefixRunes
+		}
+		if i == len(merged)-1 {
+			n -= suffixRunes
+		}
+		chars := word[pos : pos+n]
+		start, end := chars[0].start, chars[n-1].end
+		pos += n
+
+		if id, ok := m.vocab[sym]; ok {
+			pieces = append(pieces, wordPiece{token: sym, id: id, start: start, end: end})
+			continue
+		}
+		if m.byteFallback {
+			if bytePieces, ok := m.bytePieces(chars); ok {
+				pieces = append(pieces, bytePieces...)
+				continue
+			}
+		}
+		if m.unkToken == "" {
+			return nil, fmt.Errorf("token %q is not in the vocabulary", sym)
+		}
+		if k := len(pieces) - 1; m.fuseUNK && k >= 0 && pieces[k].token == m.unkToken {
+			pieces[k].end = end
+			continue
+		}
+		pieces = append(pieces, wordPiece{token: m.unkToken, id: m.vocab[m.unkToken], start: start, end: end})
+	}
+	return pieces, nil
+}
+
+// bytePieces spells characters missing from the vocabulary as <0xXX> byte
+// tokens, if the vocabulary has all of them
+func (m *bpeModel) bytePieces(chars []normRune) ([]wordPiece, bool) {
+	s, _ := runeString(chars)
+	start, end := chars[0].start, chars[len(chars)-1].end
+	var pieces []wordPiece
+	for i := 0; i < len(s); i++ {
+		token := fmt.Sprintf("<0x%02X>", s[i])
+		id, ok := m.vocab[token]
+		if !ok {
+			return nil, false
+		}
+		pieces = append(pieces, wordPiece{token: token, id: id, start: start, end: end})
+	}
+	return pieces, true
+}
+
+// TokenToID returns the ID of a token in the vocabulary
+func (m *bpeModel) TokenToID(token string) (int, bool) {
+	return lookupID(m.vocab, token)
+}
+
+// IDToToken returns the token for an ID in the vocabulary
+func (m *bpeModel) IDToToken(id int) (string, bool) {
+	return lookupToken(m.idToToken, id)
+}
+
+// VocabSize returns the number of IDs in the vocabulary
+func (m *bpeModel) VocabSize() int {
+	return len(m.idToToken)
+}
+
+// wordLevelModel maps every word to a single token
+type wordLevelModel struct {
+	vocab     map[string]int
+	idToToken []string
+	unkToken  string
+}
+
+func (m *wordLevelModel) tokenize(word []normRune) ([]wordPiece, error) {
+	s, _ := runeString(word)
+	start, end := word[0].start, word[len(word)-1].end
+	if id, ok := m.vocab[s]; ok {
+		return []wordPiece{{token: s, id: id, start: start, end: end}}, nil
+	}
+	id, ok := m.vocab[m.unkToken]
+	if !ok {
+		return nil, fmt.Errorf("%w: word %q is not in the vocabulary and there is no unknown token", errs.ErrInvalidInput, s)
+	}
+	return []wordPiece{{token: m.unkToken, id: id, start: start, end: end}}, nil
+}
+
+// TokenToID returns the ID of a token in the vocabulary
+func (m *wordLevelModel) TokenToID(token string) (int, bool) {
+	return lookupID(m.vocab, token)
+}
+
+// IDToToken returns the token for an ID in the vocabulary
+func (m *wordLevelModel) IDToToken(id int) (string, bool) {
+	return lookupToken(m.idToToken, id)
+}
+
+// VocabSize returns the number of IDs in the vocabulary
+func (m *wordLevelModel) VocabSize() int {
+	return len(m.idToToken)
+}
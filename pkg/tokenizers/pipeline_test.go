@@ -0,0 +1,271 @@
+package tokenizers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+// writeTokenizerJSON writes a tokenizer.json built from sections
+func writeTokenizerJSON(t *testing.T, sections map[string]any) string {
+	t.Helper()
+	data, err := json.Marshal(sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "tokenizer.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// gpt2TokenizerJSON converts the GPT-2 test vocabulary and merges into the
+// sections of a byte-level BPE tokenizer.json
+func gpt2TokenizerJSON(t *testing.T) map[string]any {
+	t.Helper()
+	data, err := os.ReadFile("testdata/gpt2-vocab.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vocab map[string]int
+	if err := json.Unmarshal(data, &vocab); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("testdata/gpt2-merges.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var merges []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" && !strings.HasPrefix(line, "#") {
+			merges = append(merges, line)
+		}
+	}
+
+	return map[string]any{
+		"added_tokens":   []map[string]any{{"id": vocab["<|endoftext|>"], "content": "<|endoftext|>", "special": true}},
+		"normalizer":     nil,
+		"pre_tokenizer":  map[string]any{"type": "ByteLevel", "add_prefix_space": false, "trim_offsets": true, "use_regex": true},
+		"post_processor": map[string]any{"type": "ByteLevel", "trim_offsets": false},
+		"decoder":        map[string]any{"type": "ByteLevel"},
+		"model":          map[string]any{"type": "BPE", "vocab": vocab, "merges": merges},
+	}
+}
+
+func TestFromFile_WordPiece(t *testing.T) {
+	pt, err := FromFile("testdata/bert-base-uncased-subset.json")
+	if err != nil {
+		t.Fatalf("FromFile failed: %v", err)
+	}
+	wpt := newTestBertTokenizer(t)
+
+	for _, text := range []string{
+		"I've been waiting for a HuggingFace course my whole life.",
+		"Héllo, WÖRLD!  I hate this so much",
+		"你好 hello\tworld",
+	} {
+		got, err := pt.Encode(text)
+		if err != nil {
+			t.Fatalf("Encode(%q) failed: %v", text, err)
+		}
+		want, err := wpt.Encode(text)
+		if err != nil {
+			t.Fatalf("Encode(%q) failed: %v", text, err)
+		}
+		if !reflect.DeepEqual(got.IDs, want.IDs) {
+			t.Errorf("Encode(%q): expected IDs %v, got %v", text, want.IDs, got.IDs)
+		}
+		if !reflect.DeepEqual(got.Offsets, want.Offsets) {
+			t.Errorf("Encode(%q): expected offsets %v, got %v", text, want.Offsets, got.Offsets)
+		}
+	}
+
+	ids := []int{101, 1045, 1005, 2310, 2042, 3403, 2005, 1037, 17662, 12172, 2607, 2026, 2878, 2166, 1012, 102}
+	decoded, err := pt.Decode(ids)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	expected := "i've been waiting for a huggingface course my whole life."
+	if decoded != expected {
+		t.Errorf("Expected %q, got %q", expected, decoded)
+	}
+}
+
+func TestFromFile_ByteLevelBPE(t *testing.T) {
+	pt, err := FromFile(writeTokenizerJSON(t, gpt2TokenizerJSON(t)))
+	if err != nil {
+		t.Fatalf("FromFile failed: %v", err)
+	}
+	bpe := newTestBPETokenizer(t)
+
+	for _, text := range []string{
+		"Hello the world<|endoftext|>",
+		"  leading and trailing spaces  ",
+		"Ünïcödé, 世界 and emoji 🙂🚀",
+		"I'm sure they'll say it's 42.5%",
+	} {
+		got, err := pt.Encode(text)
+		if err != nil {
+			t.Fatalf("Encode(%q) failed: %v", text, err)
+		}
+		want, err := bpe.Encode(text)
+		if err != nil {
+			t.Fatalf("Encode(%q) failed: %v", text, err)
+		}
+		if !reflect.DeepEqual(got.Tokens, want.Tokens) {
+			t.Errorf("Encode(%q): expected tokens %v, got %v", text, want.Tokens, got.Tokens)
+		}
+		if !reflect.DeepEqual(got.Offsets, want.Offsets) {
+			t.Errorf("Encode(%q): expected offsets %v, got %v", text, want.Offsets, got.Offsets)
+		}
+
+		decoded, err := pt.Decode(got.IDs)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		if want := strings.ReplaceAll(text, "<|endoftext|>", ""); decoded != want {
+			t.Errorf("Expected %q, got %q", want, decoded)
+		}
+	}
+}
+
+func TestFromFile_Unigram(t *testing.T) {
+	var vocab [][2]any
+	for _, p := range unigramTestPieces {
+		vocab = append(vocab, [2]any{p.Piece, p.Score})
+	}
+	path := writeTokenizerJSON(t, map[string]any{
+		"added_tokens": []map[string]any{{"id": 2, "content": "</s>", "special": true}},
+		"normalizer": map[string]any{"type": "Sequence", "normalizers": []any{
+			map[string]any{"type": "NFKC"},
+			map[string]any{"type": "Replace", "pattern": map[string]any{"Regex": " {2,}"}, "content": " "},
+		}},
+		"pre_tokenizer": map[string]any{"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always", "split": true},
+		"post_processor": map[string]any{
+			"type":           "TemplateProcessing",
+			"single":         []any{map[string]any{"Sequence": map[string]any{"id": "A", "type_id": 0}}, map[string]any{"SpecialToken": map[string]any{"id": "</s>", "type_id": 0}}},
+			"pair":           []any{},
+			"special_tokens": map[string]any{"</s>": map[string]any{"id": "</s>", "ids": []int{2}, "tokens": []string{"</s>"}}},
+		},
+		"decoder": map[string]any{"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always"},
+		"model":   map[string]any{"type": "Unigram", "unk_id": 0, "vocab": vocab},
+	})
+
+	pt, err := FromFile(path)
+	if err != nil {
+		t.Fatalf("FromFile failed: %v", err)
+	}
+
+	// The full-width letters are folded by NFKC
+	text := "ｈｅｌｌｏ  world"
+	enc, err := pt.Encode(text)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	expected := []string{"▁hello", "▁world", "</s>"}
+	if !reflect.DeepEqual(enc.Tokens, expected) {
+		t.Errorf("Expected tokens %v, got %v", expected, enc.Tokens)
+	}
+	if o := enc.Offsets[0]; text[o.Start:o.End] != "ｈｅｌｌｏ" {
+		t.Errorf("Expected offsets of the first token to cover the full-width word, got %q", text[o.Start:o.End])
+	}
+
+	decoded, err := pt.Decode(enc.IDs)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded != "hello world" {
+		t.Errorf("Expected %q, got %q", "hello world", decoded)
+	}
+}
+
+func TestFromFile_Unsupported(t *testing.T) {
+	sections := gpt2TokenizerJSON(t)
+	sections["normalizer"] = map[string]any{"type": "Sequence", "normalizers": []any{map[string]any{"type": "Nmt"}}}
+	sections["decoder"] = map[string]any{"type": "CTC"}
+
+	_, err := FromFile(writeTokenizerJSON(t, sections))
+	if !errors.Is(err, errs.ErrNotImplemented) {
+		t.Fatalf("Expected a not implemented error for unsupported components, got %v", err)
+	}
+	for _, want := range []string{"normalizer Nmt", "decoder CTC"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestSplitPreTokenizer(t *testing.T) {
+	gpt2 := `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+	re, err := compileSplitPattern(gpt2)
+	if err != nil {
+		t.Fatalf("Failed to compile the GPT-2 pattern: %v", err)
+	}
+
+	text := "Hello   world!! It's  42\n\n"
+	var got [][2]int
+	for _, m := range re.findAll(text) {
+		got = append(got, m)
+	}
+	if want := gpt2PreTokenize(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected spans %v, got %v", want, got)
+	}
+
+	if _, err := compileSplitPattern(`(?<=a)b`); err == nil {
+		t.Error("Expected an error for a lookbehind pattern")
+	}
+
+	sp := splitPreTokenizer{pattern: &splitRegexp{re: regexpMustCompile(t, `-`), ws: -1}, behavior: splitMergedWithPrevious}
+	var words []string
+	for _, w := range sp.preTokenize([][]normRune{toNormRunes("a-b--c", 0, 6)}) {
+		s, _ := runeString(w)
+		words = append(words, s)
+	}
+	if expected := []string{"a-", "b-", "-", "c"}; !reflect.DeepEqual(words, expected) {
+		t.Errorf("Expected %v, got %v", expected, words)
+	}
+}
+
+func TestUnicodeNormalize(t *testing.T) {
+	tests := []struct {
+		input           string
+		compat, compose bool
+		expected        string
+	}{
+		{"e\u0301", false, true, "\u00E9"},
+		{"\u212B", false, true, "\u00C5"},
+		{"a\u0302\u0323", false, true, "\u1EAD"},
+		{"\uD55C", false, false, "\u1112\u1161\u11AB"},
+		{"\u1112\u1161\u11AB", false, true, "\uD55C"},
+		{"\uFB01x", true, true, "fix"},
+		{"\u2460\u00BD", true, true, "11\u20442"},
+		{"\u2460", false, true, "\u2460"},
+	}
+
+	for _, tt := range tests {
+		out, _ := runeString(unicodeNormalize(toNormRunes(tt.input, 0, len(tt.input)), tt.compat, tt.compose))
+		if out != tt.expected {
+			t.Errorf("unicodeNormalize(%q, %v, %v): expected %q, got %q", tt.input, tt.compat, tt.compose, tt.expected, out)
+		}
+	}
+}
+
+func regexpMustCompile(t *testing.T, pattern string) *regexp.Regexp {
+	t.Helper()
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return re
+}
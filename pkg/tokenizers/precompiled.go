@@ -0,0 +1,89 @@
+package tokenizers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+)
+
+// precompiledCharsmap applies the normalization rules SentencePiece compiles
+// into its models (e.g. nmt_nfkc). The blob holds a Darts-clone double-array
+// trie mapping input byte sequences to offsets into a pool of NUL-terminated
+// replacement strings.
+type precompiledCharsmap struct {
+	trie       []uint32
+	normalized []byte
+}
+
+// parsePrecompiledCharsmap decodes a precompiled_charsmap blob
+func parsePrecompiledCharsmap(blob []byte) (*precompiledCharsmap, error) {
+	if len(blob) < 4 {
+		return nil, fmt.Errorf("precompiled charsmap is truncated")
+	}
+	trieSize := int(binary.LittleEndian.Uint32(blob))
+	if trieSize%4 != 0 || 4+trieSize > len(blob) {
+		return nil, fmt.Errorf("precompiled charsmap has invalid trie size %d", trieSize)
+	}
+	trie := make([]uint32, trieSize/4)
+	for i := range trie {
+		trie[i] = binary.LittleEndian.Uint32(blob[4+4*i:])
+	}
+	return &precompiledCharsmap{trie: trie, normalized: blob[4+trieSize:]}, nil
+}
+
+// longestMatch returns the replacement for the longest rule matching a
+// prefix of s and the number of bytes it consumes
+func (pc *precompiledCharsmap) longestMatch(s string) (string, int, bool) {
+	if len(pc.trie) == 0 {
+		return "", 0, false
+	}
+	matchLen, matchValue := 0, -1
+
+	node := dartsOffset(pc.trie[0])
+	for i := 0; i < len(s); i++ {
+		c := uint32(s[i])
+		if c == 0 {
+			break
+		}
+		node ^= c
+		if int(node) >= len(pc.trie) {
+			break
+		}
+		unit := pc.trie[node]
+		if dartsLabel(unit) != c {
+			break
+		}
+		node ^= dartsOffset(unit)
+		if dartsHasLeaf(unit) && int(node) < len(pc.trie) {
+			matchLen, matchValue = i+1, int(dartsValue(pc.trie[node]))
+		}
+	}
+	if matchValue < 0 || matchValue >= len(pc.normalized) {
+		return "", 0, false
+	}
+
+	end := matchValue
+	for end < len(pc.normalized) && pc.normalized[end] != 0 {
+		end++
+	}
+	return string(pc.normalized[matchValue:end]), matchLen, true
+}
+
+// normalize applies the rules to one character, returning its replacement
+func (pc *precompiledCharsmap) normalize(s string) (string, int) {
+	if replacement, n, ok := pc.longestMatch(s); ok {
+		return replacement, n
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError && size <= 1 {
+		return string(utf8.RuneError), 1
+	}
+	return s[:size], size
+}
+
+func dartsHasLeaf(unit uint32) bool { return (unit>>8)&1 == 1 }
+func dartsValue(unit uint32) uint32 { return unit & (1<<31 - 1) }
+func dartsLabel(unit uint32) uint32 { return unit & (1<<31 | 0xFF) }
+func dartsOffset(unit uint32) uint32 {
+	return (unit >> 10) << ((unit & (1 << 9)) >> 6)
+}
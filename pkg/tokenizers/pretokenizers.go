@@ -0,0 +1,535 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// preTokenizer splits normalized text into words. The model tokenizes each
+// word independently.
+type preTokenizer interface {
+	preTokenize(words [][]normRune) [][]normRune
+}
+
+// splitEach applies fn to every word and concatenates the results
+func splitEach(words [][]normRune, fn func([]normRune) [][]normRune) [][]normRune {
+	var result [][]normRune
+	for _, w := range words {
+		for _, piece := range fn(w) {
+			if len(piece) > 0 {
+				result = append(result, piece)
+			}
+		}
+	}
+	return result
+}
+
+// splitBehavior decides what happens to the delimiters a pre-tokenizer finds
+type splitBehavior string
+
+const (
+	splitRemoved            splitBehavior = "Removed"
+	splitIsolated           splitBehavior = "Isolated"
+	splitMergedWithPrevious splitBehavior = "MergedWithPrevious"
+	splitMergedWithNext     splitBehavior = "MergedWithNext"
+	splitContiguous         splitBehavior = "Contiguous"
+)
+
+// splitSpan is a run of characters [start, end) of a word that either
+// matched the delimiter or lies between two matches
+type splitSpan struct {
+	start, end int
+	match      bool
+}
+
+// splitMatches cuts word around the matched character ranges according to
+// behavior
+func splitMatches(word []normRune, matches [][2]int, behavior splitBehavior, invert bool) [][]normRune {
+	var spans []splitSpan
+	last := 0
+	for _, m := range matches {
+		if m[0] == m[1] {
+			continue
+		}
+		if m[0] > last {
+			spans = append(spans, splitSpan{last, m[0], invert})
+		}
+		spans = append(spans, splitSpan{m[0], m[1], !invert})
+		last = m[1]
+	}
+	if last < len(word) {
+		spans = append(spans, splitSpan{last, len(word), invert})
+	}
+
+	var merged []splitSpan
+	switch behavior {
+	case splitRemoved:
+		for _, s := range spans {
+			if !s.match {
+				merged = append(merged, s)
+			}
+		}
+	case splitMergedWithPrevious:
+		previousMatch := false
+		for _, s := range spans {
+			if s.match && !previousMatch && len(merged) > 0 {
+				merged[len(merged)-1].end = s.end
+			} else {
+				merged = append(merged, s)
+			}
+			previousMatch = s.match
+		}
+	case splitMergedWithNext:
+		previousMatch := false
+		for i := len(spans) - 1; i >= 0; i-- {
+			s := spans[i]
+			if s.match && !previousMatch && len(merged) > 0 {
+				merged[len(merged)-1].start = s.start
+			} else {
+				merged = append(merged, s)
+			}
+			previousMatch = s.match
+		}
+		for i, j := 0, len(merged)-1; i < j; i, j = i+1, j-1 {
+			merged[i], merged[j] = merged[j], merged[i]
+		}
+	case splitContiguous:
+		for _, s := range spans {
+			if k := len(merged) - 1; s.match && k >= 0 && merged[k].match {
+				merged[k].end = s.end
+			} else {
+				merged = append(merged, s)
+			}
+		}
+	default:
+		merged = spans
+	}
+
+	pieces := make([][]normRune, len(merged))
+	for i, s := range merged {
+		pieces[i] = word[s.start:s.end]
+	}
+	return pieces
+}
+
+// matchRunes returns the character ranges of word for which fn is true,
+// with consecutive characters grouped when contiguous is set
+func matchRunes(word []normRune, fn func(rune) bool, contiguous bool) [][2]int {
+	var matches [][2]int
+	for i, nr := range word {
+		if !fn(nr.r) {
+			continue
+		}
+		if k := len(matches) - 1; contiguous && k >= 0 && matches[k][1] == i {
+			matches[k][1] = i + 1
+			continue
+		}
+		matches = append(matches, [2]int{i, i + 1})
+	}
+	return matches
+}
+
+// preTokenizerSequence applies several pre-tokenizers in order
+type preTokenizerSequence []preTokenizer
+
+func (seq preTokenizerSequence) preTokenize(words [][]normRune) [][]normRune {
+	for _, p := range seq {
+		words = p.preTokenize(words)
+	}
+	return words
+}
+
+// whitespacePreTokenizer splits text like the regular expression
+// \w+|[^\w\s]+, dropping whitespace
+type whitespacePreTokenizer struct{}
+
+func (whitespacePreTokenizer) preTokenize(words [][]normRune) [][]normRune {
+	return splitEach(words, func(word []normRune) [][]normRune {
+		class := func(r rune) int {
+			switch {
+			case unicode.IsSpace(r):
+				return 0
+			case r == '_' || unicode.In(r, unicode.L, unicode.M, unicode.Nd, unicode.Pc):
+				return 1
+			}
+			return 2
+		}
+		var pieces [][]normRune
+		for i := 0; i < len(word); {
+			c := class(word[i].r)
+			j := i + 1
+			for j < len(word) && class(word[j].r) == c {
+				j++
+			}
+			if c != 0 {
+				pieces = append(pieces, word[i:j])
+			}
+			i = j
+		}
+		return pieces
+	})
+}
+
+// whitespaceSplitPreTokenizer splits text on whitespace
+type whitespaceSplitPreTokenizer struct{}
+
+func (whitespaceSplitPreTokenizer) preTokenize(words [][]normRune) [][]normRune {
+	return splitEach(words, func(word []normRune) [][]normRune {
+		return splitMatches(word, matchRunes(word, unicode.IsSpace, false), splitRemoved, false)
+	})
+}
+
+// bertPreTokenizer splits text on whitespace and isolates punctuation
+type bertPreTokenizer struct{}
+
+func (bertPreTokenizer) preTokenize(words [][]normRune) [][]normRune {
+	words = whitespaceSplitPreTokenizer{}.preTokenize(words)
+	return punctuationPreTokenizer{behavior: splitIsolated}.preTokenize(words)
+}
+
+// punctuationPreTokenizer splits text on punctuation characters
+type punctuationPreTokenizer struct {
+	behavior splitBehavior
+}
+
+func (pp punctuationPreTokenizer) preTokenize(words [][]normRune) [][]normRune {
+	return splitEach(words, func(word []normRune) [][]normRune {
+		return splitMatches(word, matchRunes(word, isPunctuation, false), pp.behavior, false)
+	})
+}
+
+// digitsPreTokenizer isolates numbers, or every single digit when
+// individualDigits is set
+type digitsPreTokenizer struct {
+	individualDigits bool
+}
+
+func (dp digitsPreTokenizer) preTokenize(words [][]normRune) [][]normRune {
+	return splitEach(words, func(word []normRune) [][]normRune {
+		return splitMatches(word, matchRunes(word, unicode.IsDigit, !dp.individualDigits), splitIsolated, false)
+	})
+}
+
+// charDelimiterPreTokenizer splits text on a single delimiter character
+type charDelimiterPreTokenizer struct {
+	delimiter rune
+}
+
+func (cp charDelimiterPreTokenizer) preTokenize(words [][]normRune) [][]normRune {
+	return splitEach(words, func(word []normRune) [][]normRune {
+		isDelimiter := func(r rune) bool { return r == cp.delimiter }
+		return splitMatches(word, matchRunes(word, isDelimiter, false), splitRemoved, false)
+	})
+}
+
+// metaspacePreTokenizer replaces spaces with a meta symbol, optionally
+// prepends one, and splits before each meta symbol
+type metaspacePreTokenizer struct {
+	replacement   rune
+	prependScheme string // "always", "first" or "never"
+	split         bool
+}
+
+func (mp metaspacePreTokenizer) preTokenize(words [][]normRune) [][]normRune {
+	return splitEach(words, func(word []normRune) [][]normRune {
+		text := make([]normRune, 0, len(word)+1)
+		// "first" only prepends at the very beginning of the input, not
+		// after added tokens
+		prepend := mp.prependScheme == "always" || (mp.prependScheme == "first" && word[0].start == 0)
+		if prepend && word[0].r != ' ' && word[0].r != mp.replacement {
+			text = append(text, normRune{mp.replacement, word[0].start, word[0].start})
+		}
+		for _, nr := range word {
+			if nr.r == ' ' {
+				nr.r = mp.replacement
+			}
+			text = append(text, nr)
+		}
+		if !mp.split {
+			return [][]normRune{text}
+		}
+		isReplacement := func(r rune) bool { return r == mp.replacement }
+		return splitMatches(text, matchRunes(text, isReplacement, false), splitMergedWithNext, false)
+	})
+}
+
+// byteLevelPreTokenizer splits text with the GPT-2 pattern and maps every
+// byte onto its printable byte-level symbol
+type byteLevelPreTokenizer struct {
+	addPrefixSpace bool
+	useRegex       bool
+}
+
+func (bp byteLevelPreTokenizer) preTokenize(words [][]normRune) [][]normRune {
+	return splitEach(words, func(word []normRune) [][]normRune {
+		if bp.addPrefixSpace && word[0].r != ' ' {
+			word = append([]normRune{{' ', word[0].start, word[0].start}}, word...)
+		}
+		pieces := [][]normRune{word}
+		if bp.useRegex {
+			s, offsets := runeString(word)
+			pieces = pieces[:0]
+			for _, span := range gpt2PreTokenize(s) {
+				pieces = append(pieces, word[runeIndex(offsets, span[0]):runeIndex(offsets, span[1])])
+			}
+		}
+
+		for i, piece := range pieces {
+			var symbols []normRune
+			var buf [4]byte
+			for _, nr := range piece {
+				n := utf8.EncodeRune(buf[:], nr.r)
+				for _, b := range buf[:n] {
+					symbols = append(symbols, normRune{bytesToUnicode[b], nr.start, nr.end})
+				}
+			}
+			pieces[i] = symbols
+		}
+		return pieces
+	})
+}
+
+// splitPreTokenizer splits text on the matches of a pattern
+type splitPreTokenizer struct {
+	pattern  *splitRegexp
+	behavior splitBehavior
+	invert   bool
+}
+
+func (sp splitPreTokenizer) preTokenize(words [][]normRune) [][]normRune {
+	return splitEach(words, func(word []normRune) [][]normRune {
+		s, offsets := runeString(word)
+		var matches [][2]int
+		for _, m := range sp.pattern.findAll(s) {
+			matches = append(matches, [2]int{runeIndex(offsets, m[0]), runeIndex(offsets, m[1])})
+		}
+		return splitMatches(word, matches, sp.behavior, sp.invert)
+	})
+}
+
+// lookaheadWhitespace is the alternation GPT-2 style patterns use to leave
+// the last whitespace character of a run for the following word. Go's
+// regexp package does not support the negative lookahead, so splitRegexp
+// emulates it.
+const lookaheadWhitespace = `\s+(?!\S)|\s+`
+
+// splitRegexp is a split pattern compiled for Go's regexp package
+type splitRegexp struct {
+	re *regexp.Regexp
+	ws int // index of the emulated whitespace group, or -1
+}
+
+// compileSplitPattern compiles a split pattern. Patterns that rely on
+// unsupported syntax other than the GPT-2 whitespace lookahead are rejected.
+func compileSplitPattern(pattern string) (*splitRegexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err == nil {
+		return &splitRegexp{re: re, ws: -1}, nil
+	}
+	if !strings.Contains(pattern, lookaheadWhitespace) {
+		return nil, fmt.Errorf("unsupported split pattern %q: %w", pattern, err)
+	}
+	rewritten := strings.Replace(pattern, lookaheadWhitespace, `(?P<lookahead_ws>\s+)`, 1)
+	re, rerr := regexp.Compile(rewritten)
+	if rerr != nil {
+		return nil, fmt.Errorf("unsupported split pattern %q: %w", pattern, err)
+	}
+	return &splitRegexp{re: re, ws: re.SubexpIndex("lookahead_ws")}, nil
+}
+
+// findAll returns the byte ranges of all matches in s
+func (sr *splitRegexp) findAll(s string) [][2]int {
+	var matches [][2]int
+	if sr.ws < 0 {
+		for _, m := range sr.re.FindAllStringIndex(s, -1) {
+			matches = append(matches, [2]int{m[0], m[1]})
+		}
+		return matches
+	}
+
+	for pos := 0; pos < len(s); {
+		m := sr.re.FindStringSubmatchIndex(s[pos:])
+		if m == nil {
+			break
+		}
+		start, end := pos+m[0], pos+m[1]
+		// \s+(?!\S) backtracks by one character when the run is followed by
+		// a non-space character; \s+ then only matches single characters
+		if m[2*sr.ws] >= 0 && end < len(s) {
+			if trimmed := lastRuneStart(s, start, end); trimmed > start {
+				end = trimmed
+			}
+		}
+		if end == start {
+			_, size := utf8.DecodeRuneInString(s[start:])
+			pos = start + size
+			continue
+		}
+		matches = append(matches, [2]int{start, end})
+		pos = end
+	}
+	return matches
+}
+
+// lastRuneStart returns the offset of the last character of s[start:end]
+func lastRuneStart(s string, start, end int) int {
+	for i := end - 1; i > start; i-- {
+		if s[i]&0xC0 != 0x80 {
+			return i
+		}
+	}
+	return start
+}
+
+// parsePreTokenizer decodes the pre_tokenizer section of tokenizer.json
+func (l *pipelineLoader) parsePreTokenizer(raw json.RawMessage) (preTokenizer, error) {
+	kind, err := componentType(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pre_tokenizer: %w", err)
+	}
+
+	switch kind {
+	case "":
+		return nil, nil
+	case "Sequence":
+		var seq struct {
+			PreTokenizers []json.RawMessage `json:"pretokenizers"`
+		}
+		if err := json.Unmarshal(raw, &seq); err != nil {
+			return nil, fmt.Errorf("invalid Sequence pre-tokenizer: %w", err)
+		}
+		var result preTokenizerSequence
+		for _, c := range seq.PreTokenizers {
+			p, err := l.parsePreTokenizer(c)
+			if err != nil {
+				return nil, err
+			}
+			if p != nil {
+				result = append(result, p)
+			}
+		}
+		return result, nil
+	case "Whitespace":
+		return whitespacePreTokenizer{}, nil
+	case "WhitespaceSplit":
+		return whitespaceSplitPreTokenizer{}, nil
+	case "BertPreTokenizer":
+		return bertPreTokenizer{}, nil
+	case "Punctuation":
+		var pp struct {
+			Behavior splitBehavior `json:"behavior"`
+		}
+		if err := json.Unmarshal(raw, &pp); err != nil {
+			return nil, fmt.Errorf("invalid Punctuation pre-tokenizer: %w", err)
+		}
+		if pp.Behavior == "" {
+			pp.Behavior = splitIsolated
+		}
+		return punctuationPreTokenizer{behavior: pp.Behavior}, nil
+	case "Digits":
+		var dp struct {
+			IndividualDigits bool `json:"individual_digits"`
+		}
+		if err := json.Unmarshal(raw, &dp); err != nil {
+			return nil, fmt.Errorf("invalid Digits pre-tokenizer: %w", err)
+		}
+		return digitsPreTokenizer{individualDigits: dp.IndividualDigits}, nil
+	case "CharDelimiterSplit":
+		var cp struct {
+			Delimiter string `json:"delimiter"`
+		}
+		if err := json.Unmarshal(raw, &cp); err != nil {
+			return nil, fmt.Errorf("invalid CharDelimiterSplit pre-tokenizer: %w", err)
+		}
+		runes := []rune(cp.Delimiter)
+		if len(runes) != 1 {
+			return nil, fmt.Errorf("CharDelimiterSplit delimiter must be a single character, got %q", cp.Delimiter)
+		}
+		return charDelimiterPreTokenizer{delimiter: runes[0]}, nil
+	case "Metaspace":
+		var mp struct {
+			Replacement    string  `json:"replacement"`
+			AddPrefixSpace *bool   `json:"add_prefix_space"`
+			PrependScheme  *string `json:"prepend_scheme"`
+			Split          *bool   `json:"split"`
+		}
+		if err := json.Unmarshal(raw, &mp); err != nil {
+			return nil, fmt.Errorf("invalid Metaspace pre-tokenizer: %w", err)
+		}
+		return newMetaspace(mp.Replacement, mp.AddPrefixSpace, mp.PrependScheme, mp.Split)
+	case "ByteLevel":
+		var bp struct {
+			AddPrefixSpace bool  `json:"add_prefix_space"`
+			UseRegex       *bool `json:"use_regex"`
+		}
+		if err := json.Unmarshal(raw, &bp); err != nil {
+			return nil, fmt.Errorf("invalid ByteLevel pre-tokenizer: %w", err)
+		}
+		return byteLevelPreTokenizer{addPrefixSpace: bp.AddPrefixSpace, useRegex: bp.UseRegex == nil || *bp.UseRegex}, nil
+	case "Split":
+		var sp struct {
+			Pattern  json.RawMessage `json:"pattern"`
+			Behavior splitBehavior   `json:"behavior"`
+			Invert   bool            `json:"invert"`
+		}
+		if err := json.Unmarshal(raw, &sp); err != nil {
+			return nil, fmt.Errorf("invalid Split pre-tokenizer: %w", err)
+		}
+		var pattern struct {
+			String *string `json:"String"`
+			Regex  *string `json:"Regex"`
+		}
+		if err := json.Unmarshal(sp.Pattern, &pattern); err != nil {
+			return nil, fmt.Errorf("invalid Split pre-tokenizer: %w", err)
+		}
+		var re *splitRegexp
+		switch {
+		case pattern.String != nil:
+			re = &splitRegexp{re: regexp.MustCompile(regexp.QuoteMeta(*pattern.String)), ws: -1}
+		case pattern.Regex != nil:
+			if re, err = compileSplitPattern(*pattern.Regex); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("invalid Split pre-tokenizer: pattern must be a String or a Regex")
+		}
+		switch sp.Behavior {
+		case splitRemoved, splitIsolated, splitMergedWithPrevious, splitMergedWithNext, splitContiguous:
+		default:
+			return nil, fmt.Errorf("invalid Split pre-tokenizer: unknown behavior %q", sp.Behavior)
+		}
+		return splitPreTokenizer{pattern: re, behavior: sp.Behavior, invert: sp.Invert}, nil
+	default:
+		l.unsupported = append(l.unsupported, "pre_tokenizer "+kind)
+		return nil, nil
+	}
+}
+
+// newMetaspace builds the Metaspace pre-tokenizer, which older files
+// configure through add_prefix_space and newer ones through prepend_scheme
+func newMetaspace(replacement string, addPrefixSpace *bool, prependScheme *string, split *bool) (metaspacePreTokenizer, error) {
+	mp := metaspacePreTokenizer{replacement: '▁', prependScheme: "always", split: split == nil || *split}
+	if replacement != "" {
+		runes := []rune(replacement)
+		if len(runes) != 1 {
+			return mp, fmt.Errorf("Metaspace replacement must be a single character, got %q", replacement)
+		}
+		mp.replacement = runes[0]
+	}
+	switch {
+	case prependScheme != nil:
+		mp.prependScheme = *prependScheme
+	case addPrefixSpace != nil && !*addPrefixSpace:
+		mp.prependScheme = "never"
+	}
+	switch mp.prependScheme {
+	case "always", "first", "never":
+	default:
+		return mp, fmt.Errorf("unknown Metaspace prepend scheme %q", mp.prependScheme)
+	}
+	return mp, nil
+}
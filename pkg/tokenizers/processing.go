@@ -0,0 +1,616 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Direction selects the side of a sequence that truncation or padding applies to
+type Direction string
+
+const (
+	DirectionRight Direction = "Right"
+	DirectionLeft  Direction = "Left"
+)
+
+// TruncationStrategy selects which sequence of a pair is shortened
+type TruncationStrategy string
+
+const (
+	TruncateLongestFirst TruncationStrategy = "LongestFirst"
+	TruncateOnlyFirst    TruncationStrategy = "OnlyFirst"
+	TruncateOnlySecond   TruncationStrategy = "OnlySecond"
+)
+
+// TruncationParams configures truncation. Tokens beyond MaxLength are
+// returned as overflowing windows that overlap by Stride tokens.
+type TruncationParams struct {
+	MaxLength int                `json:"max_length"`
+	Strategy  TruncationStrategy `json:"strategy"`
+	Stride    int                `json:"stride"`
+	Direction Direction          `json:"direction"`
+}
+
+// PaddingStrategy selects the length encodings are padded to
+type PaddingStrategy string
+
+const (
+	PadBatchLongest PaddingStrategy = "BatchLongest"
+	PadFixed        PaddingStrategy = "Fixed"
+)
+
+// PaddingParams configures padding
+type PaddingParams struct {
+	Strategy        PaddingStrategy `json:"strategy"`
+	Length          int             `json:"length,omitempty"` // target length for PadFixed
+	Direction       Direction       `json:"direction"`
+	PadToMultipleOf int             `json:"pad_to_multiple_of,omitempty"`
+	PadID           int             `json:"pad_id"`
+	PadTypeID       int             `json:"pad_type_id"`
+	PadToken        string          `json:"pad_token"`
+}
+
+// PostProcessor adds the special tokens a model expects around one or two
+// encoded sequences
+type PostProcessor interface {
+	// AddedTokens returns the number of special tokens Process adds
+	AddedTokens(isPair bool) int
+
+	// Process merges an encoding and an optional pair encoding
+	Process(enc, pair *Encoding) *Encoding
+}
+
+// TemplatePiece is one element of a post-processing template: either a
+// special token or a placeholder for sequence "A" or "B"
+type TemplatePiece struct {
+	SpecialToken string
+	Sequence     string
+	TypeID       int
+}
+
+// SpecialTokenIDs maps a template special token to the tokens it expands to
+type SpecialTokenIDs struct {
+	IDs    []int
+	Tokens []string
+}
+
+// TemplateProcessing is a PostProcessor that follows the template format of
+// Hugging Face tokenizers. BERT and RoBERTa style processing are both
+// expressed as templates.
+type TemplateProcessing struct {
+	Single        []TemplatePiece
+	Pair          []TemplatePiece
+	SpecialTokens map[string]SpecialTokenIDs
+}
+
+// NewBertProcessing returns the template "[CLS] A [SEP]" / "[CLS] A [SEP] B [SEP]"
+// where B has type ID 1
+func NewBertProcessing(cls string, clsID int, sep string, sepID int) *TemplateProcessing {
+	return &TemplateProcessing{
+		Single: []TemplatePiece{{SpecialToken: cls}, {Sequence: "A"}, {SpecialToken: sep}},
+		Pair: []TemplatePiece{
+			{SpecialToken: cls}, {Sequence: "A"}, {SpecialToken: sep},
+			{Sequence: "B", TypeID: 1}, {SpecialToken: sep, TypeID: 1},
+		},
+		SpecialTokens: map[string]SpecialTokenIDs{
+			cls: {IDs: []int{clsID}, Tokens: []string{cls}},
+			sep: {IDs: []int{sepID}, Tokens: []string{sep}},
+		},
+	}
+}
+
+// NewRobertaProcessing returns the template "<s> A </s>" / "<s> A </s> </s> B </s>"
+func NewRobertaProcessing(cls string, clsID int, sep string, sepID int) *TemplateProcessing {
+	return &TemplateProcessing{
+		Single: []TemplatePiece{{SpecialToken: cls}, {Sequence: "A"}, {SpecialToken: sep}},
+		Pair: []TemplatePiece{
+			{SpecialToken: cls}, {Sequence: "A"}, {SpecialToken: sep},
+			{SpecialToken: sep}, {Sequence: "B"}, {SpecialToken: sep},
+		},
+		SpecialTokens: map[string]SpecialTokenIDs{
+			cls: {IDs: []int{clsID}, Tokens: []string{cls}},
+			sep: {IDs: []int{sepID}, Tokens: []string{sep}},
+		},
+	}
+}
+
+// AddedTokens returns the number of special tokens the template adds
+func (tp *TemplateProcessing) AddedTokens(isPair bool) int {
+	template := tp.Single
+	if isPair {
+		template = tp.Pair
+	}
+	n := 0
+	for _, piece := range template {
+		if piece.SpecialToken != "" {
+			n += len(tp.SpecialTokens[piece.SpecialToken].IDs)
+		}
+	}
+	return n
+}
+
+// Process applies the single or pair template
+func (tp *TemplateProcessing) Process(enc, pair *Encoding) *Encoding {
+	template := tp.Single
+	if pair != nil {
+		template = tp.Pair
+	}
+
+	result := &Encoding{}
+	for _, piece := range template {
+		switch {
+		case piece.SpecialToken != "":
+			special := tp.SpecialTokens[piece.SpecialToken]
+			for i, id := range special.IDs {
+				result.appendSpecial(special.Tokens[i], id, piece.TypeID)
+			}
+		case piece.Sequence == "A":
+			result.appendSequence(enc, piece.TypeID, 0)
+		case piece.Sequence == "B" && pair != nil:
+			result.appendSequence(pair, piece.TypeID, 1)
+		}
+	}
+	return result
+}
+
+// processing holds the truncation, padding and post-processing settings
+// shared by every tokenizer. Tokenizers embed it and supply a function that
+// encodes a single sequence without special tokens.
+type processing struct {
+	truncation *TruncationParams
+	padding    *PaddingParams
+	post       PostProcessor
+}
+
+// SetTruncation enables truncation, or disables it when params is nil
+func (p *processing) SetTruncation(params *TruncationParams) error {
+	params, err := checkTruncation(params)
+	if err != nil {
+		return err
+	}
+	p.truncation = params
+	return nil
+}
+
+// checkTruncation validates truncation settings and fills in their defaults
+func checkTruncation(params *TruncationParams) (*TruncationParams, error) {
+	if params == nil {
+		return nil, nil
+	}
+	if params.MaxLength <= 0 {
+		return nil, fmt.Errorf("truncation max length must be positive")
+	}
+	if params.Stride < 0 || params.Stride >= params.MaxLength {
+		return nil, fmt.Errorf("truncation stride %d must be smaller than max length %d", params.Stride, params.MaxLength)
+	}
+	return withTruncationDefaults(*params), nil
+}
+
+// Truncation returns the truncation settings, or nil if disabled
+func (p *processing) Truncation() *TruncationParams {
+	return p.truncation
+}
+
+// SetPadding enables padding, or disables it when params is nil
+func (p *processing) SetPadding(params *PaddingParams) {
+	if params != nil {
+		params = withPaddingDefaults(*params)
+	}
+	p.padding = params
+}
+
+// Padding returns the padding settings, or nil if disabled
+func (p *processing) Padding() *PaddingParams {
+	return p.padding
+}
+
+// SetPostProcessor replaces the post-processor; nil adds no special tokens
+func (p *processing) SetPostProcessor(post PostProcessor) {
+	p.post = post
+}
+
+func withTruncationDefaults(params TruncationParams) *TruncationParams {
+	if params.Strategy == "" {
+		params.Strategy = TruncateLongestFirst
+	}
+	if params.Direction == "" {
+		params.Direction = DirectionRight
+	}
+	return &params
+}
+
+func withPaddingDefaults(params PaddingParams) *PaddingParams {
+	if params.Strategy == "" {
+		params.Strategy = PadBatchLongest
+	}
+	if params.Direction == "" {
+		params.Direction = DirectionRight
+	}
+	return &params
+}
+
+// encode runs truncation, post-processing and padding over one sequence or,
+// when pair is non-nil, a pair of sequences
+func (p *processing) encode(raw func(string) (*Encoding, error), text string, pair *string) (*Encoding, error) {
+	return p.encodeTruncated(raw, text, pair, p.truncation)
+}
+
+// encodeTruncated is encode with the given truncation settings in place of
+// the tokenizer's own
+func (p *processing) encodeTruncated(raw func(string) (*Encoding, error), text string, pair *string, truncation *TruncationParams) (*Encoding, error) {
+	result, err := p.encodeUnpadded(raw, text, pair, truncation)
+	if err != nil {
+		return nil, err
+	}
+	if p.padding != nil {
+		length := result.Len()
+		if p.padding.Strategy == PadFixed {
+			length = p.padding.Length
+		}
+		p.pad(result, length)
+	}
+	return result, nil
+}
+
+// encodeBatch encodes several sequences, padding them to a common length
+func (p *processing) encodeBatch(raw func(string) (*Encoding, error), texts []string) ([]*Encoding, error) {
+	encodings := make([]*Encoding, len(texts))
+	for i, text := range texts {
+		enc, err := p.encodeUnpadded(raw, text, nil, p.truncation)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		encodings[i] = enc
+	}
+
+	if p.padding != nil {
+		length := p.padding.Length
+		if p.padding.Strategy == PadBatchLongest {
+			length = 0
+			for _, enc := range encodings {
+				length = max(length, enc.Len())
+			}
+		}
+		for _, enc := range encodings {
+			p.pad(enc, length)
+		}
+	}
+	return encodings, nil
+}
+
+// encodeUnpadded runs truncation, when enabled, and post-processing
+func (p *processing) encodeUnpadded(raw func(string) (*Encoding, error), text string, pair *string, truncation *TruncationParams) (*Encoding, error) {
+	enc, err := raw(text)
+	if err != nil {
+		return nil, err
+	}
+	var pairEnc *Encoding
+	if pair != nil {
+		if pairEnc, err = raw(*pair); err != nil {
+			return nil, err
+		}
+	}
+
+	if truncation != nil {
+		if err := p.truncate(truncation, enc, pairEnc); err != nil {
+			return nil, err
+		}
+	}
+	return p.process(enc, pairEnc), nil
+}
+
+// truncate shortens the sequences in place so that, together with the
+// special tokens, they fit in the maximum length
+func (p *processing) truncate(params *TruncationParams, enc, pair *Encoding) error {
+	maxLength := params.MaxLength
+	if p.post != nil {
+		maxLength -= p.post.AddedTokens(pair != nil)
+	}
+
+	total := enc.Len()
+	if pair != nil {
+		total += pair.Len()
+	}
+	if total <= maxLength {
+		return nil
+	}
+	if maxLength <= 0 {
+		return fmt.Errorf("max length %d is too short to fit the special tokens", params.MaxLength)
+	}
+	if pair == nil {
+		if params.Strategy == TruncateOnlySecond {
+			return fmt.Errorf("truncation strategy %s requires a sequence pair", params.Strategy)
+		}
+		return enc.truncate(maxLength, params.Stride, params.Direction)
+	}
+
+	toRemove := total - maxLength
+	switch params.Strategy {
+	case TruncateLongestFirst:
+		n1, n2 := enc.Len(), pair.Len()
+		swap := n1 > n2
+		if swap {
+			n1, n2 = n2, n1
+		}
+		if n1 > maxLength {
+			n2 = n1
+		} else {
+			n2 = max(n1, maxLength-n1)
+		}
+		if n1+n2 > maxLength {
+			n1 = maxLength / 2
+			n2 = n1 + maxLength%2
+		}
+		if swap {
+			n1, n2 = n2, n1
+		}
+		if err := enc.truncate(n1, params.Stride, params.Direction); err != nil {
+			return err
+		}
+		return pair.truncate(n2, params.Stride, params.Direction)
+	case TruncateOnlyFirst, TruncateOnlySecond:
+		target := enc
+		if params.Strategy == TruncateOnlySecond {
+			target = pair
+		}
+		if target.Len() <= toRemove {
+			return fmt.Errorf("sequence to truncate is too short to respect the max length of %d", params.MaxLength)
+		}
+		return target.truncate(target.Len()-toRemove, params.Stride, params.Direction)
+	default:
+		return fmt.Errorf("unknown truncation strategy %q", params.Strategy)
+	}
+}
+
+// process applies the post-processor to the sequences and every
+// combination of their overflowing windows
+func (p *processing) process(enc, pair *Encoding) *Encoding {
+	apply := func(a, b *Encoding) *Encoding {
+		if p.post == nil {
+			result := &Encoding{}
+			result.appendSequence(a, 0, 0)
+			if b != nil {
+				result.appendSequence(b, 1, 1)
+			}
+			return result
+		}
+		return p.post.Process(a, b)
+	}
+
+	result := apply(enc, pair)
+	if pair == nil {
+		for _, o := range enc.Overflowing {
+			result.Overflowing = append(result.Overflowing, apply(o, nil))
+		}
+		return result
+	}
+	for _, o := range enc.Overflowing {
+		result.Overflowing = append(result.Overflowing, apply(o, pair))
+		for _, po := range pair.Overflowing {
+			result.Overflowing = append(result.Overflowing, apply(o, po))
+		}
+	}
+	for _, po := range pair.Overflowing {
+		result.Overflowing = append(result.Overflowing, apply(enc, po))
+	}
+	return result
+}
+
+// pad extends an encoding and its overflowing windows to length
+func (p *processing) pad(enc *Encoding, length int) {
+	if m := p.padding.PadToMultipleOf; m > 0 && length%m != 0 {
+		length += m - length%m
+	}
+	for _, o := range enc.Overflowing {
+		p.pad(o, length)
+	}
+
+	n := length - enc.Len()
+	if n <= 0 {
+		return
+	}
+	padding := &Encoding{}
+	for i := 0; i < n; i++ {
+		padding.appendSpecial(p.padding.PadToken, p.padding.PadID, p.padding.PadTypeID)
+	}
+	for i := range padding.AttentionMask {
+		padding.AttentionMask[i] = 0
+	}
+
+	if p.padding.Direction == DirectionLeft {
+		padding.appendEncoding(enc)
+		padding.Overflowing = enc.Overflowing
+		*enc = *padding
+		return
+	}
+	enc.appendEncoding(padding)
+}
+
+// loadProcessing configures truncation, padding and post-processing from the
+// corresponding sections of a tokenizer.json file
+func (p *processing) loadProcessing(tj *tokenizerJSON) error {
+	if !isNull(tj.Truncation) {
+		var params TruncationParams
+		if err := json.Unmarshal(tj.Truncation, &params); err != nil {
+			return fmt.Errorf("invalid truncation section: %w", err)
+		}
+		if err := p.SetTruncation(&params); err != nil {
+			return err
+		}
+	}
+
+	if !isNull(tj.Padding) {
+		var raw struct {
+			Strategy        json.RawMessage `json:"strategy"`
+			Direction       Direction       `json:"direction"`
+			PadToMultipleOf *int            `json:"pad_to_multiple_of"`
+			PadID           int             `json:"pad_id"`
+			PadTypeID       int             `json:"pad_type_id"`
+			PadToken        string          `json:"pad_token"`
+		}
+		if err := json.Unmarshal(tj.Padding, &raw); err != nil {
+			return fmt.Errorf("invalid padding section: %w", err)
+		}
+		params := PaddingParams{
+			Direction: raw.Direction,
+			PadID:     raw.PadID,
+			PadTypeID: raw.PadTypeID,
+			PadToken:  raw.PadToken,
+		}
+		if raw.PadToMultipleOf != nil {
+			params.PadToMultipleOf = *raw.PadToMultipleOf
+		}
+		// The strategy is either "BatchLongest" or {"Fixed": length}
+		var fixed struct {
+			Fixed *int `json:"Fixed"`
+		}
+		if err := json.Unmarshal(raw.Strategy, &fixed); err == nil && fixed.Fixed != nil {
+			params.Strategy = PadFixed
+			params.Length = *fixed.Fixed
+		} else if err := json.Unmarshal(raw.Strategy, &params.Strategy); err != nil {
+			return fmt.Errorf("invalid padding strategy %s", raw.Strategy)
+		}
+		p.SetPadding(&params)
+	}
+
+	post, err := parsePostProcessor(tj.PostProcessor)
+	if err != nil {
+		return err
+	}
+	p.post = post
+	return nil
+}
+
+// parsePostProcessor decodes the post_processor section of tokenizer.json
+func parsePostProcessor(raw json.RawMessage) (PostProcessor, error) {
+	kind, err := componentType(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid post_processor section: %w", err)
+	}
+
+	switch kind {
+	case "":
+		return nil, nil
+	case "ByteLevel":
+		// Only adjusts offsets; no special tokens are added
+		return nil, nil
+	case "BertProcessing", "RobertaProcessing":
+		var pp struct {
+			SEP [2]json.RawMessage `json:"sep"`
+			CLS [2]json.RawMessage `json:"cls"`
+		}
+		if err := json.Unmarshal(raw, &pp); err != nil {
+			return nil, fmt.Errorf("invalid %s post-processor: %w", kind, err)
+		}
+		sep, sepID, err := parseTokenWithID(pp.SEP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s post-processor: %w", kind, err)
+		}
+		cls, clsID, err := parseTokenWithID(pp.CLS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s post-processor: %w", kind, err)
+		}
+		if kind == "BertProcessing" {
+			return NewBertProcessing(cls, clsID, sep, sepID), nil
+		}
+		return NewRobertaProcessing(cls, clsID, sep, sepID), nil
+	case "TemplateProcessing":
+		return parseTemplateProcessing(raw)
+	case "Sequence":
+		var seq struct {
+			Processors []json.RawMessage `json:"processors"`
+		}
+		if err := json.Unmarshal(raw, &seq); err != nil {
+			return nil, fmt.Errorf("invalid Sequence post-processor: %w", err)
+		}
+		// Sequences pair a ByteLevel offset fixer with the processor that
+		// adds the special tokens
+		var result PostProcessor
+		for _, c := range seq.Processors {
+			post, err := parsePostProcessor(c)
+			if err != nil {
+				return nil, err
+			}
+			if post == nil {
+				continue
+			}
+			if result != nil {
+				return nil, fmt.Errorf("Sequence post-processor may add special tokens only once")
+			}
+			result = post
+		}
+		return result, nil
+	default:
+		return nil, &unsupportedError{section: "post_processor", kind: kind}
+	}
+}
+
+// parseTokenWithID decodes a ["token", id] tuple
+func parseTokenWithID(raw [2]json.RawMessage) (string, int, error) {
+	var token string
+	var id int
+	if err := json.Unmarshal(raw[0], &token); err != nil {
+		return "", 0, err
+	}
+	if err := json.Unmarshal(raw[1], &id); err != nil {
+		return "", 0, err
+	}
+	return token, id, nil
+}
+
+// parseTemplateProcessing decodes a TemplateProcessing post-processor
+func parseTemplateProcessing(raw json.RawMessage) (*TemplateProcessing, error) {
+	type piece struct {
+		SpecialToken *struct {
+			ID     string `json:"id"`
+			TypeID int    `json:"type_id"`
+		} `json:"SpecialToken"`
+		Sequence *struct {
+			ID     string `json:"id"`
+			TypeID int    `json:"type_id"`
+		} `json:"Sequence"`
+	}
+	var tpl struct {
+		Single        []piece `json:"single"`
+		Pair          []piece `json:"pair"`
+		SpecialTokens map[string]struct {
+			IDs    []int    `json:"ids"`
+			Tokens []string `json:"tokens"`
+		} `json:"special_tokens"`
+	}
+	if err := json.Unmarshal(raw, &tpl); err != nil {
+		return nil, fmt.Errorf("invalid TemplateProcessing post-processor: %w", err)
+	}
+
+	tp := &TemplateProcessing{SpecialTokens: make(map[string]SpecialTokenIDs)}
+	for name, st := range tpl.SpecialTokens {
+		if len(st.IDs) != len(st.Tokens) {
+			return nil, fmt.Errorf("special token %q has %d ids but %d tokens", name, len(st.IDs), len(st.Tokens))
+		}
+		tp.SpecialTokens[name] = SpecialTokenIDs{IDs: st.IDs, Tokens: st.Tokens}
+	}
+	convert := func(pieces []piece) ([]TemplatePiece, error) {
+		var result []TemplatePiece
+		for _, p := range pieces {
+			switch {
+			case p.SpecialToken != nil:
+				if _, ok := tp.SpecialTokens[p.SpecialToken.ID]; !ok {
+					return nil, fmt.Errorf("template uses undefined special token %q", p.SpecialToken.ID)
+				}
+				result = append(result, TemplatePiece{SpecialToken: p.SpecialToken.ID, TypeID: p.SpecialToken.TypeID})
+			case p.Sequence != nil:
+				result = append(result, TemplatePiece{Sequence: p.Sequence.ID, TypeID: p.Sequence.TypeID})
+			}
+		}
+		return result, nil
+	}
+
+	var err error
+	if tp.Single, err = convert(tpl.Single); err != nil {
+		return nil, err
+	}
+	if tp.Pair, err = convert(tpl.Pair); err != nil {
+		return nil, err
+	}
+	return tp, nil
+}
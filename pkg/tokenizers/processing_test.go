@@ -0,0 +1,206 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestBertTokenizer(t *testing.T) *WordPieceTokenizer {
+	t.Helper()
+	wpt, err := NewWordPieceTokenizer("testdata/bert-base-uncased-subset.json")
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+	return wpt
+}
+
+func TestEncodePair(t *testing.T) {
+	wpt := newTestBertTokenizer(t)
+
+	enc, err := wpt.EncodePair("I hate this", "hello world")
+	if err != nil {
+		t.Fatalf("EncodePair failed: %v", err)
+	}
+
+	expectedTokens := []string{"[CLS]", "i", "hate", "this", "[SEP]", "hello", "world", "[SEP]"}
+	if !reflect.DeepEqual(enc.Tokens, expectedTokens) {
+		t.Errorf("Expected tokens %v, got %v", expectedTokens, enc.Tokens)
+	}
+
+	expectedTypeIDs := []int{0, 0, 0, 0, 0, 1, 1, 1}
+	if !reflect.DeepEqual(enc.TypeIDs, expectedTypeIDs) {
+		t.Errorf("Expected type IDs %v, got %v", expectedTypeIDs, enc.TypeIDs)
+	}
+
+	expectedSequenceIDs := []int{-1, 0, 0, 0, -1, 1, 1, -1}
+	if !reflect.DeepEqual(enc.SequenceIDs, expectedSequenceIDs) {
+		t.Errorf("Expected sequence IDs %v, got %v", expectedSequenceIDs, enc.SequenceIDs)
+	}
+
+	// Offsets of the second sequence refer to the second input
+	if o := enc.Offsets[6]; o.Start != 6 || o.End != 11 {
+		t.Errorf("Expected offsets {6 11} for 'world', got %v", o)
+	}
+}
+
+func TestTruncation_OnlySecondWithStride(t *testing.T) {
+	wpt := newTestBertTokenizer(t)
+	err := wpt.SetTruncation(&TruncationParams{MaxLength: 8, Strategy: TruncateOnlySecond, Stride: 2})
+	if err != nil {
+		t.Fatalf("SetTruncation failed: %v", err)
+	}
+
+	enc, err := wpt.EncodePair("hello", "I hate this so much!")
+	if err != nil {
+		t.Fatalf("EncodePair failed: %v", err)
+	}
+
+	expected := []string{"[CLS]", "hello", "[SEP]", "i", "hate", "this", "so", "[SEP]"}
+	if !reflect.DeepEqual(enc.Tokens, expected) {
+		t.Errorf("Expected tokens %v, got %v", expected, enc.Tokens)
+	}
+
+	if len(enc.Overflowing) != 1 {
+		t.Fatalf("Expected 1 overflowing window, got %d", len(enc.Overflowing))
+	}
+	expectedOverflow := []string{"[CLS]", "hello", "[SEP]", "this", "so", "much", "!", "[SEP]"}
+	if !reflect.DeepEqual(enc.Overflowing[0].Tokens, expectedOverflow) {
+		t.Errorf("Expected overflowing tokens %v, got %v", expectedOverflow, enc.Overflowing[0].Tokens)
+	}
+}
+
+func TestEncodePairTruncated(t *testing.T) {
+	wpt := newTestBertTokenizer(t)
+
+	enc, err := wpt.EncodePairTruncated("hello", "I hate this so much!",
+		&TruncationParams{MaxLength: 8, Strategy: TruncateOnlySecond, Stride: 2})
+	if err != nil {
+		t.Fatalf("EncodePairTruncated failed: %v", err)
+	}
+	if len(enc.Overflowing) != 1 {
+		t.Fatalf("Expected 1 overflowing window, got %d", len(enc.Overflowing))
+	}
+	expectedOverflow := []string{"[CLS]", "hello", "[SEP]", "this", "so", "much", "!", "[SEP]"}
+	if !reflect.DeepEqual(enc.Overflowing[0].Tokens, expectedOverflow) {
+		t.Errorf("Expected overflowing tokens %v, got %v", expectedOverflow, enc.Overflowing[0].Tokens)
+	}
+
+	// The tokenizer's own settings are left alone
+	if wpt.Truncation() != nil {
+		t.Errorf("Expected truncation to stay disabled, got %+v", wpt.Truncation())
+	}
+	if _, err := wpt.EncodePairTruncated("hello", "world", &TruncationParams{MaxLength: 4, Stride: 4}); err == nil {
+		t.Error("Expected an error for a stride as large as the max length")
+	}
+}
+
+func TestTruncation_LongestFirst(t *testing.T) {
+	wpt := newTestBertTokenizer(t)
+	if err := wpt.SetTruncation(&TruncationParams{MaxLength: 8}); err != nil {
+		t.Fatalf("SetTruncation failed: %v", err)
+	}
+
+	enc, err := wpt.EncodePair("I hate this so much!", "hello world")
+	if err != nil {
+		t.Fatalf("EncodePair failed: %v", err)
+	}
+
+	expected := []string{"[CLS]", "i", "hate", "this", "[SEP]", "hello", "world", "[SEP]"}
+	if !reflect.DeepEqual(enc.Tokens, expected) {
+		t.Errorf("Expected tokens %v, got %v", expected, enc.Tokens)
+	}
+
+	if _, err := wpt.Encode("I hate this so much!"); err != nil {
+		t.Errorf("Single sequence truncation failed: %v", err)
+	}
+}
+
+func TestTruncation_Errors(t *testing.T) {
+	wpt := newTestBertTokenizer(t)
+
+	if err := wpt.SetTruncation(&TruncationParams{MaxLength: 4, Stride: 4}); err == nil {
+		t.Error("Expected an error for a stride as large as the max length")
+	}
+
+	if err := wpt.SetTruncation(&TruncationParams{MaxLength: 4, Strategy: TruncateOnlySecond}); err != nil {
+		t.Fatalf("SetTruncation failed: %v", err)
+	}
+	if _, err := wpt.Encode("I hate this so much!"); err == nil {
+		t.Error("Expected an error when truncating the second sequence of a single input")
+	}
+}
+
+func TestEncodeBatch_Padding(t *testing.T) {
+	wpt := newTestBertTokenizer(t)
+	wpt.SetPadding(&PaddingParams{PadToken: "[PAD]", PadID: 0})
+
+	encodings, err := wpt.EncodeBatch([]string{"hello", "I hate this so much!"})
+	if err != nil {
+		t.Fatalf("EncodeBatch failed: %v", err)
+	}
+
+	expectedIDs := []int{101, 7592, 102, 0, 0, 0, 0, 0}
+	if !reflect.DeepEqual(encodings[0].IDs, expectedIDs) {
+		t.Errorf("Expected IDs %v, got %v", expectedIDs, encodings[0].IDs)
+	}
+	expectedMask := []int{1, 1, 1, 0, 0, 0, 0, 0}
+	if !reflect.DeepEqual(encodings[0].AttentionMask, expectedMask) {
+		t.Errorf("Expected attention mask %v, got %v", expectedMask, encodings[0].AttentionMask)
+	}
+	if encodings[1].Len() != 8 {
+		t.Errorf("Expected the longest encoding to keep 8 tokens, got %d", encodings[1].Len())
+	}
+
+	wpt.SetPadding(&PaddingParams{Direction: DirectionLeft, PadToMultipleOf: 4, PadToken: "[PAD]"})
+	enc, err := wpt.Encode("hello world!")
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	expectedIDs = []int{0, 0, 0, 101, 7592, 2088, 999, 102}
+	if !reflect.DeepEqual(enc.IDs, expectedIDs) {
+		t.Errorf("Expected IDs %v, got %v", expectedIDs, enc.IDs)
+	}
+}
+
+func TestProcessing_FromTokenizerJSON(t *testing.T) {
+	data, err := os.ReadFile("testdata/bert-base-uncased-subset.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tj map[string]any
+	if err := json.Unmarshal(data, &tj); err != nil {
+		t.Fatal(err)
+	}
+	tj["truncation"] = map[string]any{"direction": "Right", "max_length": 6, "strategy": "LongestFirst", "stride": 0}
+	tj["padding"] = map[string]any{
+		"strategy":  map[string]any{"Fixed": 10},
+		"direction": "Right", "pad_to_multiple_of": nil,
+		"pad_id": 0, "pad_type_id": 0, "pad_token": "[PAD]",
+	}
+	path := filepath.Join(t.TempDir(), "tokenizer.json")
+	data, _ = json.Marshal(tj)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	wpt, err := NewWordPieceTokenizer(path)
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+
+	enc, err := wpt.Encode("I hate this so much!")
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	expected := []int{101, 1045, 5223, 2023, 2061, 102, 0, 0, 0, 0}
+	if !reflect.DeepEqual(enc.IDs, expected) {
+		t.Errorf("Expected IDs %v, got %v", expected, enc.IDs)
+	}
+	if len(enc.Overflowing) != 1 || enc.Overflowing[0].Len() != 10 {
+		t.Errorf("Expected one padded overflowing window, got %d", len(enc.Overflowing))
+	}
+}
@@ -0,0 +1,900 @@
+package tokenizers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kelleyblackmore/go-transformer/internal/protowire"
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+var _ Tokenizer = (*SentencePieceTokenizer)(nil)
+
+// SentencePieceModelType selects the segmentation algorithm of a
+// SentencePiece model
+type SentencePieceModelType int
+
+const (
+	SentencePieceUnigram SentencePieceModelType = 1
+	SentencePieceBPE     SentencePieceModelType = 2
+)
+
+// PieceType classifies the entries of a SentencePiece vocabulary
+type PieceType int
+
+const (
+	PieceNormal      PieceType = 1
+	PieceUnknown     PieceType = 2
+	PieceControl     PieceType = 3
+	PieceUserDefined PieceType = 4
+	PieceUnused      PieceType = 5
+	PieceByte        PieceType = 6
+)
+
+// SentencePiece is a vocabulary entry. Its ID is its index in the vocabulary.
+type SentencePiece struct {
+	Piece string    `json:"piece"`
+	Score float64   `json:"score"`
+	Type  PieceType `json:"type"`
+}
+
+// spaceSymbol replaces whitespace so that it can be part of pieces
+const spaceSymbol = "▁"
+
+// unkPenalty is subtracted from the lowest piece score to score unknown
+// characters during Viterbi segmentation
+const unkPenalty = 10.0
+
+// SentencePieceTokenizer implements the SentencePiece Unigram and BPE
+// algorithms used by T5, XLM-R, LLaMA and Mistral models
+type SentencePieceTokenizer struct {
+	Pieces    []SentencePiece        `json:"pieces"`
+	ModelType SentencePieceModelType `json:"model_type"`
+	UNKID     int                    `json:"unk_id"`
+	BOSID     int                    `json:"bos_id"` // -1 when the model has none
+	EOSID     int                    `json:"eos_id"` // -1 when the model has none
+
+	ByteFallback           bool `json:"byte_fallback"`            // encode unknown characters as <0xXX> byte pieces
+	AddDummyPrefix         bool `json:"add_dummy_prefix"`         // prepend a space so the first word looks like the others
+	RemoveExtraWhitespaces bool `json:"remove_extra_whitespaces"` // trim and collapse runs of spaces
+	SplitByWhitespace      bool `json:"split_by_whitespace"`      // never merge pieces across words
+
+	processing
+	vocab         map[string]int
+	merges        map[[2]string]int // merge ranks from tokenizer.json; nil merges by piece score
+	specialTokens []string
+	maxPieceRunes int
+	minScore      float64
+	charsmap      *precompiledCharsmap
+}
+
+// NewSentencePieceTokenizer creates a tokenizer from a SentencePiece
+// tokenizer.model file or from the Unigram or BPE model of a Hugging Face
+// tokenizer.json file. For tokenizer.model files, BOS and EOS insertion is
+// read from a sibling tokenizer_config.json if present.
+func NewSentencePieceTokenizer(path string) (*SentencePieceTokenizer, error) {
+	spt := &SentencePieceTokenizer{
+		ModelType:              SentencePieceUnigram,
+		BOSID:                  -1,
+		EOSID:                  -1,
+		AddDummyPrefix:         true,
+		RemoveExtraWhitespaces: true,
+		SplitByWhitespace:      true,
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		tj, err := readTokenizerJSON(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := spt.loadTokenizerJSON(tj); err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		if err := spt.loadProcessing(tj); err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", path, err)
+		}
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SentencePiece model: %w", err)
+		}
+		if err := spt.loadModelProto(data); err != nil {
+			return nil, fmt.Errorf("failed to parse SentencePiece model %s: %w", path, err)
+		}
+		if err := spt.loadTokenizerConfig(filepath.Join(filepath.Dir(path), "tokenizer_config.json")); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := spt.init(); err != nil {
+		return nil, err
+	}
+	return spt, nil
+}
+
+// init builds the lookup tables once the pieces are known
+func (spt *SentencePieceTokenizer) init() error {
+	if len(spt.Pieces) == 0 {
+		return fmt.Errorf("SentencePiece vocabulary is empty")
+	}
+	if spt.UNKID < 0 || spt.UNKID >= len(spt.Pieces) {
+		return fmt.Errorf("unknown token ID %d is out of range", spt.UNKID)
+	}
+
+	spt.vocab = make(map[string]int, len(spt.Pieces))
+	spt.minScore = math.Inf(1)
+	for id, p := range spt.Pieces {
+		if _, exists := spt.vocab[p.Piece]; !exists {
+			spt.vocab[p.Piece] = id
+		}
+		if p.Type == PieceUserDefined {
+			spt.specialTokens = append(spt.specialTokens, p.Piece)
+		}
+		if p.Type == PieceNormal || p.Type == PieceUserDefined {
+			spt.maxPieceRunes = max(spt.maxPieceRunes, utf8.RuneCountInString(p.Piece))
+			spt.minScore = math.Min(spt.minScore, p.Score)
+		}
+	}
+	if math.IsInf(spt.minScore, 1) {
+		spt.minScore = 0
+	}
+	return nil
+}
+
+// loadModelProto decodes a serialized sentencepiece.ModelProto
+func (spt *SentencePieceTokenizer) loadModelProto(data []byte) error {
+	spt.UNKID, spt.BOSID, spt.EOSID = 0, 1, 2
+
+	d := protowire.NewDecoder(data)
+	for !d.Done() {
+		field, wt, err := d.Next()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			msg, err := d.Bytes()
+			if err != nil {
+				return err
+			}
+			piece, err := parseSentencePiece(msg)
+			if err != nil {
+				return fmt.Errorf("invalid piece %d: %w", len(spt.Pieces), err)
+			}
+			spt.Pieces = append(spt.Pieces, piece)
+		case 2:
+			msg, err := d.Bytes()
+			if err != nil {
+				return err
+			}
+			if err := spt.parseTrainerSpec(msg); err != nil {
+				return fmt.Errorf("invalid trainer spec: %w", err)
+			}
+		case 3:
+			msg, err := d.Bytes()
+			if err != nil {
+				return err
+			}
+			if err := spt.parseNormalizerSpec(msg); err != nil {
+				return fmt.Errorf("invalid normalizer spec: %w", err)
+			}
+		default:
+			if err := d.Skip(wt); err != nil {
+				return err
+			}
+		}
+	}
+
+	if spt.ModelType != SentencePieceUnigram && spt.ModelType != SentencePieceBPE {
+		return fmt.Errorf("SentencePiece model type %d is %w", spt.ModelType, errs.ErrNotImplemented)
+	}
+	for _, id := range []*int{&spt.BOSID, &spt.EOSID} {
+		if *id >= len(spt.Pieces) {
+			*id = -1
+		}
+	}
+	return nil
+}
+
+func parseSentencePiece(msg []byte) (SentencePiece, error) {
+	piece := SentencePiece{Type: PieceNormal}
+	d := protowire.NewDecoder(msg)
+	for !d.Done() {
+		field, wt, err := d.Next()
+		if err != nil {
+			return piece, err
+		}
+		switch field {
+		case 1:
+			piece.Piece, err = d.String()
+		case 2:
+			var score float32
+			score, err = d.Float()
+			piece.Score = float64(score)
+		case 3:
+			var t int64
+			t, err = d.Int64()
+			piece.Type = PieceType(t)
+		default:
+			err = d.Skip(wt)
+		}
+		if err != nil {
+			return piece, err
+		}
+	}
+	return piece, nil
+}
+
+func (spt *SentencePieceTokenizer) parseTrainerSpec(msg []byte) error {
+	d := protowire.NewDecoder(msg)
+	for !d.Done() {
+		field, wt, err := d.Next()
+		if err != nil {
+			return err
+		}
+		var v int64
+		switch field {
+		case 3, 22, 35, 40, 41, 42:
+			if v, err = d.Int64(); err != nil {
+				return err
+			}
+		default:
+			if err := d.Skip(wt); err != nil {
+				return err
+			}
+			continue
+		}
+		switch field {
+		case 3:
+			spt.ModelType = SentencePieceModelType(v)
+		case 22:
+			spt.SplitByWhitespace = v != 0
+		case 35:
+			spt.ByteFallback = v != 0
+		case 40:
+			spt.UNKID = int(int32(v))
+		case 41:
+			spt.BOSID = int(int32(v))
+		case 42:
+			spt.EOSID = int(int32(v))
+		}
+	}
+	return nil
+}
+
+func (spt *SentencePieceTokenizer) parseNormalizerSpec(msg []byte) error {
+	d := protowire.NewDecoder(msg)
+	for !d.Done() {
+		field, wt, err := d.Next()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 2:
+			blob, err := d.Bytes()
+			if err != nil {
+				return err
+			}
+			if len(blob) > 0 {
+				if spt.charsmap, err = parsePrecompiledCharsmap(blob); err != nil {
+					return err
+				}
+			}
+		case 3:
+			if spt.AddDummyPrefix, err = d.Bool(); err != nil {
+				return err
+			}
+		case 4:
+			if spt.RemoveExtraWhitespaces, err = d.Bool(); err != nil {
+				return err
+			}
+		default:
+			if err := d.Skip(wt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadTokenizerConfig reads add_bos_token and add_eos_token from a
+// tokenizer_config.json file. A missing file is not an error.
+func (spt *SentencePieceTokenizer) loadTokenizerConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read tokenizer config: %w", err)
+	}
+
+	var config struct {
+		AddBOSToken bool `json:"add_bos_token"`
+		AddEOSToken bool `json:"add_eos_token"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse tokenizer config %s: %w", path, err)
+	}
+
+	if !config.AddBOSToken && !config.AddEOSToken {
+		return nil
+	}
+
+	tp := &TemplateProcessing{SpecialTokens: make(map[string]SpecialTokenIDs)}
+	wrap := func(seq string, typeID int) []TemplatePiece {
+		var pieces []TemplatePiece
+		special := func(id int) {
+			token := spt.Pieces[id].Piece
+			tp.SpecialTokens[token] = SpecialTokenIDs{IDs: []int{id}, Tokens: []string{token}}
+			pieces = append(pieces, TemplatePiece{SpecialToken: token, TypeID: typeID})
+		}
+		if config.AddBOSToken && spt.BOSID >= 0 {
+			special(spt.BOSID)
+		}
+		pieces = append(pieces, TemplatePiece{Sequence: seq, TypeID: typeID})
+		if config.AddEOSToken && spt.EOSID >= 0 {
+			special(spt.EOSID)
+		}
+		return pieces
+	}
+	tp.Single = wrap("A", 0)
+	tp.Pair = append(wrap("A", 0), wrap("B", 1)...)
+	spt.post = tp
+	return nil
+}
+
+// loadTokenizerJSON configures the tokenizer from a tokenizer.json file with
+// a Unigram or BPE model and Metaspace-style whitespace handling
+func (spt *SentencePieceTokenizer) loadTokenizerJSON(tj *tokenizerJSON) error {
+	spt.AddDummyPrefix = false
+	spt.RemoveExtraWhitespaces = false
+	spt.SplitByWhitespace = false
+
+	kind, err := componentType(tj.Model)
+	if err != nil {
+		return fmt.Errorf("invalid model section: %w", err)
+	}
+
+	special := make(map[string]bool)
+	for _, at := range tj.AddedTokens {
+		special[at.Content] = at.Special
+		if at.Special {
+			spt.specialTokens = append(spt.specialTokens, at.Content)
+		}
+	}
+	pieceType := func(piece string, byteFallback bool) PieceType {
+		switch {
+		case special[piece]:
+			return PieceControl
+		case byteFallback && isBytePiece(piece):
+			return PieceByte
+		}
+		return PieceNormal
+	}
+
+	switch kind {
+	case "Unigram":
+		var model struct {
+			UNKID        *int              `json:"unk_id"`
+			Vocab        []json.RawMessage `json:"vocab"`
+			ByteFallback bool              `json:"byte_fallback"`
+		}
+		if err := json.Unmarshal(tj.Model, &model); err != nil {
+			return fmt.Errorf("invalid model section: %w", err)
+		}
+		spt.ModelType = SentencePieceUnigram
+		spt.ByteFallback = model.ByteFallback
+		for i, raw := range model.Vocab {
+			piece, score, err := parseUnigramEntry(raw)
+			if err != nil {
+				return fmt.Errorf("invalid vocab entry %d: %w", i, err)
+			}
+			spt.Pieces = append(spt.Pieces, SentencePiece{Piece: piece, Score: score, Type: pieceType(piece, model.ByteFallback)})
+		}
+		if model.UNKID != nil {
+			spt.UNKID = *model.UNKID
+			spt.Pieces[spt.UNKID].Type = PieceUnknown
+		}
+	case "BPE":
+		var model struct {
+			UNKToken     *string           `json:"unk_token"`
+			Vocab        map[string]int    `json:"vocab"`
+			Merges       []json.RawMessage `json:"merges"`
+			ByteFallback bool              `json:"byte_fallback"`
+		}
+		if err := json.Unmarshal(tj.Model, &model); err != nil {
+			return fmt.Errorf("invalid model section: %w", err)
+		}
+		if spt.merges, err = parseMerges(model.Merges); err != nil {
+			return err
+		}
+		spt.ModelType = SentencePieceBPE
+		spt.ByteFallback = model.ByteFallback
+		spt.Pieces = make([]SentencePiece, len(model.Vocab))
+		for piece, id := range model.Vocab {
+			if id < 0 || id >= len(spt.Pieces) {
+				return fmt.Errorf("vocabulary IDs must be contiguous, got %d for %q", id, piece)
+			}
+			spt.Pieces[id] = SentencePiece{Piece: piece, Type: pieceType(piece, model.ByteFallback)}
+		}
+		if model.UNKToken != nil {
+			id, ok := model.Vocab[*model.UNKToken]
+			if !ok {
+				return fmt.Errorf("unknown token %q is not in the vocabulary", *model.UNKToken)
+			}
+			spt.UNKID = id
+			spt.Pieces[id].Type = PieceUnknown
+		}
+	default:
+		return fmt.Errorf("expected a Unigram or BPE model, got %s", kind)
+	}
+
+	for _, at := range tj.AddedTokens {
+		if at.ID >= 0 && at.ID < len(spt.Pieces) && !at.Special {
+			spt.Pieces[at.ID].Type = PieceUserDefined
+		}
+	}
+
+	if err := spt.configureWhitespace(tj.Normalizer); err != nil {
+		return err
+	}
+	return spt.configureWhitespace(tj.PreTokenizer)
+}
+
+// parseUnigramEntry decodes a ["piece", score] vocabulary entry
+func parseUnigramEntry(raw json.RawMessage) (string, float64, error) {
+	var entry [2]json.RawMessage
+	var piece string
+	var score float64
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return "", 0, err
+	}
+	if err := json.Unmarshal(entry[0], &piece); err != nil {
+		return "", 0, err
+	}
+	if err := json.Unmarshal(entry[1], &score); err != nil {
+		return "", 0, err
+	}
+	return piece, score, nil
+}
+
+// configureWhitespace maps the normalizers and pre-tokenizers that
+// SentencePiece-based tokenizer.json files use onto the tokenizer settings
+func (spt *SentencePieceTokenizer) configureWhitespace(raw json.RawMessage) error {
+	kind, err := componentType(raw)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case "":
+	case "Sequence":
+		var seq struct {
+			Normalizers   []json.RawMessage `json:"normalizers"`
+			PreTokenizers []json.RawMessage `json:"pretokenizers"`
+		}
+		if err := json.Unmarshal(raw, &seq); err != nil {
+			return err
+		}
+		for _, c := range append(seq.Normalizers, seq.PreTokenizers...) {
+			if err := spt.configureWhitespace(c); err != nil {
+				return err
+			}
+		}
+	case "Precompiled":
+		var pc struct {
+			Charsmap *string `json:"precompiled_charsmap"`
+		}
+		if err := json.Unmarshal(raw, &pc); err != nil {
+			return err
+		}
+		if pc.Charsmap != nil && *pc.Charsmap != "" {
+			blob, err := base64.StdEncoding.DecodeString(*pc.Charsmap)
+			if err != nil {
+				return fmt.Errorf("invalid precompiled charsmap: %w", err)
+			}
+			if spt.charsmap, err = parsePrecompiledCharsmap(blob); err != nil {
+				return err
+			}
+		}
+	case "Prepend":
+		spt.AddDummyPrefix = true
+	case "Replace":
+		var r struct {
+			Pattern struct {
+				String *string `json:"String"`
+				Regex  *string `json:"Regex"`
+			} `json:"pattern"`
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return err
+		}
+		switch {
+		case r.Pattern.String != nil && *r.Pattern.String == " " && r.Content == spaceSymbol:
+			// Spaces are always escaped
+		case r.Pattern.Regex != nil && *r.Pattern.Regex == " {2,}" && r.Content == " ":
+			spt.RemoveExtraWhitespaces = true
+		default:
+			return fmt.Errorf("Replace normalizers for SentencePiece models are %w", errs.ErrNotImplemented)
+		}
+	case "Strip":
+		spt.RemoveExtraWhitespaces = true
+	case "WhitespaceSplit":
+		spt.RemoveExtraWhitespaces = true
+		spt.SplitByWhitespace = true
+	case "Metaspace":
+		var ms struct {
+			AddPrefixSpace *bool   `json:"add_prefix_space"`
+			PrependScheme  *string `json:"prepend_scheme"`
+			Split          *bool   `json:"split"`
+		}
+		if err := json.Unmarshal(raw, &ms); err != nil {
+			return err
+		}
+		spt.AddDummyPrefix = true
+		if ms.PrependScheme != nil {
+			spt.AddDummyPrefix = *ms.PrependScheme != "never"
+		} else if ms.AddPrefixSpace != nil {
+			spt.AddDummyPrefix = *ms.AddPrefixSpace
+		}
+		spt.SplitByWhitespace = ms.Split == nil || *ms.Split
+	default:
+		return fmt.Errorf("component %s for SentencePiece models is %w", kind, errs.ErrNotImplemented)
+	}
+	return nil
+}
+
+// Encode tokenizes text into an encoding, applying the configured
+// post-processing, truncation and padding
+func (spt *SentencePieceTokenizer) Encode(text string) (*Encoding, error) {
+	return spt.encode(spt.encodeSequence, text, nil)
+}
+
+// EncodePair tokenizes a pair of sequences into a single encoding
+func (spt *SentencePieceTokenizer) EncodePair(text, pair string) (*Encoding, error) {
+	return spt.encode(spt.encodeSequence, text, &pair)
+}
+
+// EncodePairTruncated is EncodePair with the given truncation settings in
+// place of the tokenizer's own
+func (spt *SentencePieceTokenizer) EncodePairTruncated(text, pair string, truncation *TruncationParams) (*Encoding, error) {
+	truncation, err := checkTruncation(truncation)
+	if err != nil {
+		return nil, err
+	}
+	return spt.encodeTruncated(spt.encodeSequence, text, &pair, truncation)
+}
+
+// EncodeBatch tokenizes several inputs, padding them to a common length
+// when padding is enabled
+func (spt *SentencePieceTokenizer) EncodeBatch(texts []string) ([]*Encoding, error) {
+	return spt.encodeBatch(spt.encodeSequence, texts)
+}
+
+// Tokenize converts text to token IDs, including special tokens
+func (spt *SentencePieceTokenizer) Tokenize(text string) ([]int, error) {
+	enc, err := spt.Encode(text)
+	if err != nil {
+		return nil, err
+	}
+	return enc.IDs, nil
+}
+
+// Decode converts token IDs back to text. Control tokens are skipped and
+// byte pieces are reassembled into UTF-8.
+func (spt *SentencePieceTokenizer) Decode(ids []int) (string, error) {
+	var sb strings.Builder
+	var pending []byte
+	flush := func() {
+		if len(pending) > 0 {
+			sb.WriteString(strings.ToValidUTF8(string(pending), string(utf8.RuneError)))
+			pending = pending[:0]
+		}
+	}
+
+	for _, id := range ids {
+		if id < 0 || id >= len(spt.Pieces) {
+			return "", fmt.Errorf("%w: token ID %d is not in the vocabulary", errs.ErrInvalidInput, id)
+		}
+		p := spt.Pieces[id]
+		switch p.Type {
+		case PieceControl, PieceUnused:
+			continue
+		case PieceByte:
+			if b, ok := parseBytePiece(p.Piece); ok {
+				pending = append(pending, b)
+				continue
+			}
+		case PieceUnknown:
+			flush()
+			sb.WriteString(" ⁇ ")
+			continue
+		}
+		flush()
+		sb.WriteString(strings.ReplaceAll(p.Piece, spaceSymbol, " "))
+	}
+	flush()
+
+	text := sb.String()
+	if spt.AddDummyPrefix {
+		text = strings.TrimPrefix(text, " ")
+	}
+	return text, nil
+}
+
+// TokenToID returns the ID of a token in the vocabulary
+func (spt *SentencePieceTokenizer) TokenToID(token string) (int, bool) {
+	return lookupID(spt.vocab, token)
+}
+
+// IDToToken returns the token for an ID in the vocabulary
+func (spt *SentencePieceTokenizer) IDToToken(id int) (string, bool) {
+	if id < 0 || id >= len(spt.Pieces) {
+		return "", false
+	}
+	return spt.Pieces[id].Piece, true
+}
+
+// VocabSize returns the number of IDs in the vocabulary
+func (spt *SentencePieceTokenizer) VocabSize() int {
+	return len(spt.Pieces)
+}
+
+// encodeSequence tokenizes a single sequence without special tokens
+func (spt *SentencePieceTokenizer) encodeSequence(text string) (*Encoding, error) {
+	enc := &Encoding{}
+	word := 0
+	for _, seg := range splitSpecialTokens(text, spt.specialTokens) {
+		if seg.special {
+			token := text[seg.start:seg.end]
+			enc.appendToken(wordPiece{token: token, id: spt.vocab[token], start: seg.start, end: seg.end, word: word}, 0)
+			word++
+			continue
+		}
+		for _, w := range spt.splitWords(spt.normalize(text, seg.start, seg.end)) {
+			for _, p := range spt.segment(w) {
+				p.word = word
+				enc.appendToken(p, 0)
+			}
+			word++
+		}
+	}
+	return enc, nil
+}
+
+// normalize applies the character map and whitespace rules to text[start:end],
+// replacing spaces with the meta symbol
+func (spt *SentencePieceTokenizer) normalize(text string, start, end int) []normRune {
+	var out []normRune
+	for i := start; i < end; {
+		var chunk string
+		var n int
+		if spt.charsmap != nil {
+			chunk, n = spt.charsmap.normalize(text[i:end])
+		} else {
+			_, n = utf8.DecodeRuneInString(text[i:end])
+			chunk = text[i : i+n]
+		}
+		for _, r := range chunk {
+			out = append(out, normRune{r, i, i + n})
+		}
+		i += n
+	}
+
+	if spt.RemoveExtraWhitespaces {
+		collapsed := out[:0]
+		for _, nr := range out {
+			if nr.r == ' ' && (len(collapsed) == 0 || collapsed[len(collapsed)-1].r == ' ') {
+				continue
+			}
+			collapsed = append(collapsed, nr)
+		}
+		for len(collapsed) > 0 && collapsed[len(collapsed)-1].r == ' ' {
+			collapsed = collapsed[:len(collapsed)-1]
+		}
+		out = collapsed
+	}
+	if len(out) == 0 {
+		return nil
+	}
+
+	if spt.AddDummyPrefix && out[0].r != ' ' {
+		out = append([]normRune{{' ', out[0].start, out[0].start}}, out...)
+	}
+	for i := range out {
+		if out[i].r == ' ' {
+			out[i].r = '▁'
+		}
+	}
+	return out
+}
+
+// splitWords splits normalized text before each meta symbol when
+// SplitByWhitespace is set
+func (spt *SentencePieceTokenizer) splitWords(text []normRune) [][]normRune {
+	if !spt.SplitByWhitespace {
+		if len(text) == 0 {
+			return nil
+		}
+		return [][]normRune{text}
+	}
+	var words [][]normRune
+	start := 0
+	for i := 1; i <= len(text); i++ {
+		if i == len(text) || text[i].r == '▁' {
+			words = append(words, text[start:i])
+			start = i
+		}
+	}
+	return words
+}
+
+// segment splits a word into pieces with the model's algorithm and resolves
+// pieces missing from the vocabulary through byte fallback or the unknown token
+func (spt *SentencePieceTokenizer) segment(word []normRune) []wordPiece {
+	runes := make([]string, len(word))
+	for i, nr := range word {
+		runes[i] = string(nr.r)
+	}
+
+	var symbols []string
+	switch {
+	case spt.ModelType == SentencePieceUnigram:
+		symbols = spt.viterbi(runes)
+	case spt.merges != nil:
+		symbols = bpeMerge(runes, spt.merges)
+	default:
+		symbols = spt.scoreMerge(runes)
+	}
+
+	var pieces []wordPiece
+	pos := 0
+	for _, sym := range symbols {
+		n := utf8.RuneCountInString(sym)
+		start, end := word[pos].start, word[pos+n-1].end
+		pos += n
+
+		if id, ok := spt.vocab[sym]; ok && spt.Pieces[id].Type != PieceUnused {
+			pieces = append(pieces, wordPiece{token: sym, id: id, start: start, end: end})
+			continue
+		}
+		if spt.ByteFallback {
+			if bytePieces, ok := spt.byteFallback(sym, start, end); ok {
+				pieces = append(pieces, bytePieces...)
+				continue
+			}
+		}
+		// Consecutive unknown pieces are fused into one
+		if k := len(pieces) - 1; k >= 0 && pieces[k].id == spt.UNKID {
+			pieces[k].end = end
+			continue
+		}
+		pieces = append(pieces, wordPiece{token: spt.Pieces[spt.UNKID].Piece, id: spt.UNKID, start: start, end: end})
+	}
+	return pieces
+}
+
+// viterbi finds the segmentation of a word into vocabulary pieces with the
+// highest total score
+func (spt *SentencePieceTokenizer) viterbi(runes []string) []string {
+	n := len(runes)
+	best := make([]float64, n+1)
+	prev := make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = math.Inf(-1)
+	}
+	unkScore := spt.minScore - unkPenalty
+
+	for start := 0; start < n; start++ {
+		if math.IsInf(best[start], -1) {
+			continue
+		}
+		hasSingle := false
+		piece := ""
+		for end := start + 1; end <= n && end-start <= spt.maxPieceRunes; end++ {
+			piece += runes[end-1]
+			id, ok := spt.vocab[piece]
+			if !ok {
+				continue
+			}
+			p := spt.Pieces[id]
+			if p.Type != PieceNormal && p.Type != PieceUserDefined {
+				continue
+			}
+			if end == start+1 {
+				hasSingle = true
+			}
+			if score := best[start] + p.Score; score > best[end] {
+				best[end], prev[end] = score, start
+			}
+		}
+		if !hasSingle {
+			if score := best[start] + unkScore; score > best[start+1] {
+				best[start+1], prev[start+1] = score, start
+			}
+		}
+	}
+
+	var symbols []string
+	for end := n; end > 0; end = prev[end] {
+		symbols = append(symbols, strings.Join(runes[prev[end]:end], ""))
+	}
+	for i, j := 0, len(symbols)-1; i < j; i, j = i+1, j-1 {
+		symbols[i], symbols[j] = symbols[j], symbols[i]
+	}
+	return symbols
+}
+
+// scoreMerge implements SentencePiece BPE, which repeatedly merges the
+// adjacent pair forming the vocabulary piece with the highest score
+func (spt *SentencePieceTokenizer) scoreMerge(symbols []string) []string {
+	word := append([]string(nil), symbols...)
+	for len(word) > 1 {
+		best, bestScore := -1, math.Inf(-1)
+		for i := 0; i < len(word)-1; i++ {
+			id, ok := spt.vocab[word[i]+word[i+1]]
+			if !ok {
+				continue
+			}
+			p := spt.Pieces[id]
+			if (p.Type == PieceNormal || p.Type == PieceUserDefined) && p.Score > bestScore {
+				best, bestScore = i, p.Score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		word[best] += word[best+1]
+		word = append(word[:best+1], word[best+2:]...)
+	}
+	return word
+}
+
+// byteFallback encodes a piece as one <0xXX> token per UTF-8 byte
+func (spt *SentencePieceTokenizer) byteFallback(piece string, start, end int) ([]wordPiece, bool) {
+	pieces := make([]wordPiece, 0, len(piece))
+	for i := 0; i < len(piece); i++ {
+		token := fmt.Sprintf("<0x%02X>", piece[i])
+		id, ok := spt.vocab[token]
+		if !ok {
+			return nil, false
+		}
+		pieces = append(pieces, wordPiece{token: token, id: id, start: start, end: end})
+	}
+	return pieces, true
+}
+
+// isBytePiece reports whether piece has the <0xXX> byte fallback form
+func isBytePiece(piece string) bool {
+	_, ok := parseBytePiece(piece)
+	return ok
+}
+
+// parseBytePiece decodes a <0xXX> byte fallback piece
+func parseBytePiece(piece string) (byte, bool) {
+	if len(piece) != 6 || !strings.HasPrefix(piece, "<0x") || piece[5] != '>' {
+		return 0, false
+	}
+	var b byte
+	for _, c := range piece[3:5] {
+		b <<= 4
+		switch {
+		case c >= '0' && c <= '9':
+			b |= byte(c - '0')
+		case c >= 'A' && c <= 'F':
+			b |= byte(c-'A') + 10
+		case c >= 'a' && c <= 'f':
+			b |= byte(c-'a') + 10
+		default:
+			return 0, false
+		}
+	}
+	return b, true
+}
@@ -0,0 +1,230 @@
+package tokenizers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/internal/protowire"
+)
+
+// writeModelProto serializes a minimal sentencepiece.ModelProto
+func writeModelProto(t *testing.T, dir string, modelType SentencePieceModelType, byteFallback bool, pieces []SentencePiece) string {
+	t.Helper()
+
+	var model []byte
+	for _, p := range pieces {
+		var msg []byte
+		msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, []byte(p.Piece))
+		msg = protowire.AppendTag(msg, 2, protowire.Fixed32Type)
+		msg = protowire.AppendFixed32(msg, math.Float32bits(float32(p.Score)))
+		msg = protowire.AppendTag(msg, 3, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(p.Type))
+		model = protowire.AppendTag(model, 1, protowire.BytesType)
+		model = protowire.AppendBytes(model, msg)
+	}
+
+	var trainer []byte
+	trainer = protowire.AppendTag(trainer, 3, protowire.VarintType)
+	trainer = protowire.AppendVarint(trainer, uint64(modelType))
+	if byteFallback {
+		trainer = protowire.AppendTag(trainer, 35, protowire.VarintType)
+		trainer = protowire.AppendVarint(trainer, 1)
+	}
+	model = protowire.AppendTag(model, 2, protowire.BytesType)
+	model = protowire.AppendBytes(model, trainer)
+
+	path := filepath.Join(dir, "tokenizer.model")
+	if err := os.WriteFile(path, model, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var unigramTestPieces = []SentencePiece{
+	{"<unk>", 0, PieceUnknown},
+	{"<s>", 0, PieceControl},
+	{"</s>", 0, PieceControl},
+	{"▁", -2, PieceNormal},
+	{"▁hello", -1, PieceNormal},
+	{"▁world", -1.5, PieceNormal},
+	{"▁he", -3, PieceNormal},
+	{"llo", -3, PieceNormal},
+	{"h", -4, PieceNormal},
+	{"e", -4, PieceNormal},
+	{"l", -4, PieceNormal},
+	{"o", -4, PieceNormal},
+}
+
+func TestSentencePieceTokenizer_Unigram(t *testing.T) {
+	path := writeModelProto(t, t.TempDir(), SentencePieceUnigram, false, unigramTestPieces)
+	spt, err := NewSentencePieceTokenizer(path)
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+
+	tests := []struct {
+		text   string
+		tokens []string
+	}{
+		{"hello world", []string{"▁hello", "▁world"}},
+		{"  hello   world ", []string{"▁hello", "▁world"}},
+		{"helo", []string{"▁he", "l", "o"}},
+		{"hexxo", []string{"▁he", "<unk>", "o"}},
+	}
+
+	for _, tt := range tests {
+		enc, err := spt.Encode(tt.text)
+		if err != nil {
+			t.Fatalf("Encode(%q) failed: %v", tt.text, err)
+		}
+		if !reflect.DeepEqual(enc.Tokens, tt.tokens) {
+			t.Errorf("Encode(%q): expected %v, got %v", tt.text, tt.tokens, enc.Tokens)
+		}
+	}
+
+	text := "hello world"
+	enc, _ := spt.Encode(text)
+	if o := enc.Offsets[1]; text[o.Start:o.End] != " world" {
+		t.Errorf("Expected offsets of '▁world' to cover ' world', got %q", text[o.Start:o.End])
+	}
+	decoded, err := spt.Decode(enc.IDs)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded != text {
+		t.Errorf("Expected %q, got %q", text, decoded)
+	}
+}
+
+func TestSentencePieceTokenizer_BPEByteFallback(t *testing.T) {
+	pieces := []SentencePiece{
+		{"<unk>", 0, PieceUnknown},
+		{"<s>", 0, PieceControl},
+		{"</s>", 0, PieceControl},
+	}
+	for b := 0; b < 256; b++ {
+		pieces = append(pieces, SentencePiece{fmt.Sprintf("<0x%02X>", b), 0, PieceByte})
+	}
+	for _, p := range []SentencePiece{
+		{"he", -1, PieceNormal},
+		{"ll", -2, PieceNormal},
+		{"hell", -3, PieceNormal},
+		{"hello", -4, PieceNormal},
+		{"▁hello", -5, PieceNormal},
+		{"▁", -6, PieceNormal},
+		{"h", -7, PieceNormal},
+		{"e", -7, PieceNormal},
+		{"l", -7, PieceNormal},
+		{"o", -7, PieceNormal},
+	} {
+		pieces = append(pieces, p)
+	}
+
+	dir := t.TempDir()
+	path := writeModelProto(t, dir, SentencePieceBPE, true, pieces)
+	config := `{"add_bos_token": true, "add_eos_token": false}`
+	if err := os.WriteFile(filepath.Join(dir, "tokenizer_config.json"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spt, err := NewSentencePieceTokenizer(path)
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+
+	text := "hello 世"
+	enc, err := spt.Encode(text)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	expected := []string{"<s>", "▁hello", "▁", "<0xE4>", "<0xB8>", "<0x96>"}
+	if !reflect.DeepEqual(enc.Tokens, expected) {
+		t.Errorf("Expected tokens %v, got %v", expected, enc.Tokens)
+	}
+
+	decoded, err := spt.Decode(enc.IDs)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded != text {
+		t.Errorf("Expected %q, got %q", text, decoded)
+	}
+}
+
+func TestSentencePieceTokenizer_TokenizerJSON(t *testing.T) {
+	var vocab [][2]any
+	for _, p := range unigramTestPieces {
+		vocab = append(vocab, [2]any{p.Piece, p.Score})
+	}
+	tj := map[string]any{
+		"added_tokens": []map[string]any{
+			{"id": 1, "content": "<s>", "special": true},
+			{"id": 2, "content": "</s>", "special": true},
+		},
+		"normalizer":    map[string]any{"type": "Sequence", "normalizers": []any{map[string]any{"type": "Replace", "pattern": map[string]any{"Regex": " {2,}"}, "content": " "}}},
+		"pre_tokenizer": map[string]any{"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always", "split": true},
+		"post_processor": map[string]any{
+			"type":           "TemplateProcessing",
+			"single":         []any{map[string]any{"Sequence": map[string]any{"id": "A", "type_id": 0}}, map[string]any{"SpecialToken": map[string]any{"id": "</s>", "type_id": 0}}},
+			"pair":           []any{},
+			"special_tokens": map[string]any{"</s>": map[string]any{"id": "</s>", "ids": []int{2}, "tokens": []string{"</s>"}}},
+		},
+		"model": map[string]any{"type": "Unigram", "unk_id": 0, "vocab": vocab, "byte_fallback": false},
+	}
+	data, err := json.Marshal(tj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "tokenizer.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spt, err := NewSentencePieceTokenizer(path)
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+
+	ids, err := spt.Tokenize("hello  world</s>")
+	if err != nil {
+		t.Fatalf("Tokenize failed: %v", err)
+	}
+	expected := []int{4, 5, 2, 2}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected %v, got %v", expected, ids)
+	}
+}
+
+func TestPrecompiledCharsmap(t *testing.T) {
+	// A Darts-clone trie with the single rule "A" -> "a": the root points
+	// to offset 1, so the child for 'A' lives at 1^65 = 64 and its leaf at 64^1
+	trie := make([]uint32, 66)
+	trie[0] = 1 << 10
+	trie[64] = 1<<10 | 1<<8 | 'A'
+	trie[65] = 1 << 31
+
+	blob := protowire.AppendFixed32(nil, uint32(len(trie)*4))
+	for _, unit := range trie {
+		blob = protowire.AppendFixed32(blob, unit)
+	}
+	blob = append(blob, 'a', 0)
+
+	pc, err := parsePrecompiledCharsmap(blob)
+	if err != nil {
+		t.Fatalf("Failed to parse charsmap: %v", err)
+	}
+
+	if out, n := pc.normalize("ABC"); out != "a" || n != 1 {
+		t.Errorf("Expected ('a', 1), got (%q, %d)", out, n)
+	}
+	if out, n := pc.normalize("é"); out != "é" || n != 2 {
+		t.Errorf("Expected ('é', 2), got (%q, %d)", out, n)
+	}
+}
@@ -0,0 +1,185 @@
+package tokenizers
+
+import "fmt"
+
+// Tokenizer converts text into model inputs and token IDs back into text
+type Tokenizer interface {
+	// Encode tokenizes text, adding any special tokens the model expects
+	Encode(text string) (*Encoding, error)
+
+	// EncodePair tokenizes a pair of sequences, such as a question and its
+	// context, into a single encoding
+	EncodePair(text, pair string) (*Encoding, error)
+
+	// EncodeBatch tokenizes several inputs, padding them to a common length
+	// when padding is enabled
+	EncodeBatch(texts []string) ([]*Encoding, error)
+
+	// Decode converts token IDs back to text
+	Decode(ids []int) (string, error)
+
+	// TokenToID returns the ID of a token in the vocabulary
+	TokenToID(token string) (int, bool)
+
+	// IDToToken returns the token for an ID in the vocabulary
+	IDToToken(id int) (string, bool)
+
+	// VocabSize returns the number of IDs in the vocabulary
+	VocabSize() int
+}
+
+// Offset is a byte span [Start, End) of the original input text
+type Offset struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Encoding is the output of a tokenizer for a single input. All slices have
+// one entry per token.
+type Encoding struct {
+	IDs               []int    `json:"input_ids"`
+	Tokens            []string `json:"tokens"`
+	TypeIDs           []int    `json:"token_type_ids"`
+	AttentionMask     []int    `json:"attention_mask"`
+	SpecialTokensMask []int    `json:"special_tokens_mask"` // 1 for tokens added by the tokenizer
+	Offsets           []Offset `json:"offsets"`             // byte offsets into the input, empty for special tokens
+	WordIDs           []int    `json:"word_ids"`            // index of the source word, -1 for special tokens
+	SequenceIDs       []int    `json:"sequence_ids"`        // 0 or 1 for the sequence of a pair, -1 for special tokens
+
+	// Overflowing holds the windows cut off by truncation
+	Overflowing []*Encoding `json:"overflowing,omitempty"`
+}
+
+// Len returns the number of tokens in the encoding
+func (e *Encoding) Len() int {
+	return len(e.IDs)
+}
+
+// CharToToken returns the index of the token covering byte offset pos of the
+// input, or -1 if no token covers it
+func (e *Encoding) CharToToken(pos int) int {
+	for i, o := range e.Offsets {
+		if e.SpecialTokensMask[i] == 0 && pos >= o.Start && pos < o.End {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendToken adds a token produced from the input text
+func (e *Encoding) appendToken(p wordPiece, typeID int) {
+	e.IDs = append(e.IDs, p.id)
+	e.Tokens = append(e.Tokens, p.token)
+	e.TypeIDs = append(e.TypeIDs, typeID)
+	e.AttentionMask = append(e.AttentionMask, 1)
+	e.SpecialTokensMask = append(e.SpecialTokensMask, 0)
+	e.Offsets = append(e.Offsets, Offset{p.start, p.end})
+	e.WordIDs = append(e.WordIDs, p.word)
+	e.SequenceIDs = append(e.SequenceIDs, 0)
+}
+
+// appendSpecial adds a special token that has no counterpart in the input
+func (e *Encoding) appendSpecial(token string, id, typeID int) {
+	e.IDs = append(e.IDs, id)
+	e.Tokens = append(e.Tokens, token)
+	e.TypeIDs = append(e.TypeIDs, typeID)
+	e.AttentionMask = append(e.AttentionMask, 1)
+	e.SpecialTokensMask = append(e.SpecialTokensMask, 1)
+	e.Offsets = append(e.Offsets, Offset{})
+	e.WordIDs = append(e.WordIDs, -1)
+	e.SequenceIDs = append(e.SequenceIDs, -1)
+}
+
+// appendEncoding appends every token of other unchanged
+func (e *Encoding) appendEncoding(other *Encoding) {
+	e.IDs = append(e.IDs, other.IDs...)
+	e.Tokens = append(e.Tokens, other.Tokens...)
+	e.TypeIDs = append(e.TypeIDs, other.TypeIDs...)
+	e.AttentionMask = append(e.AttentionMask, other.AttentionMask...)
+	e.SpecialTokensMask = append(e.SpecialTokensMask, other.SpecialTokensMask...)
+	e.Offsets = append(e.Offsets, other.Offsets...)
+	e.WordIDs = append(e.WordIDs, other.WordIDs...)
+	e.SequenceIDs = append(e.SequenceIDs, other.SequenceIDs...)
+}
+
+// appendSequence appends the tokens of other as sequence seqID of a pair
+func (e *Encoding) appendSequence(other *Encoding, typeID, seqID int) {
+	start := e.Len()
+	e.appendEncoding(other)
+	for i := start; i < e.Len(); i++ {
+		e.TypeIDs[i] = typeID
+		if e.SequenceIDs[i] >= 0 {
+			e.SequenceIDs[i] = seqID
+		}
+	}
+}
+
+// slice returns a copy of the tokens in [start, end)
+func (e *Encoding) slice(start, end int) *Encoding {
+	return &Encoding{
+		IDs:               append([]int(nil), e.IDs[start:end]...),
+		Tokens:            append([]string(nil), e.Tokens[start:end]...),
+		TypeIDs:           append([]int(nil), e.TypeIDs[start:end]...),
+		AttentionMask:     append([]int(nil), e.AttentionMask[start:end]...),
+		SpecialTokensMask: append([]int(nil), e.SpecialTokensMask[start:end]...),
+		Offsets:           append([]Offset(nil), e.Offsets[start:end]...),
+		WordIDs:           append([]int(nil), e.WordIDs[start:end]...),
+		SequenceIDs:       append([]int(nil), e.SequenceIDs[start:end]...),
+	}
+}
+
+// truncate keeps the first (or, with DirectionLeft, last) maxLength tokens
+// and moves the rest into overflowing windows. Consecutive windows overlap
+// by stride tokens.
+func (e *Encoding) truncate(maxLength, stride int, direction Direction) error {
+	n := e.Len()
+	if n <= maxLength {
+		return nil
+	}
+	if maxLength == 0 {
+		overflow := e.slice(0, n)
+		*e = Encoding{Overflowing: []*Encoding{overflow}}
+		return nil
+	}
+	if stride >= maxLength {
+		return fmt.Errorf("stride %d must be smaller than the truncated length %d", stride, maxLength)
+	}
+
+	step := maxLength - stride
+	var windows []*Encoding
+	if direction == DirectionLeft {
+		for end := n; ; end -= step {
+			start := max(end-maxLength, 0)
+			windows = append(windows, e.slice(start, end))
+			if start == 0 {
+				break
+			}
+		}
+	} else {
+		for start := 0; ; start += step {
+			end := min(start+maxLength, n)
+			windows = append(windows, e.slice(start, end))
+			if end == n {
+				break
+			}
+		}
+	}
+
+	*e = *windows[0]
+	e.Overflowing = windows[1:]
+	return nil
+}
+
+// lookupID returns the ID of a token in a vocabulary
+func lookupID(vocab map[string]int, token string) (int, bool) {
+	id, ok := vocab[token]
+	return id, ok
+}
+
+// lookupToken returns the token for an ID in a reverse vocabulary
+func lookupToken(idToToken []string, id int) (string, bool) {
+	if id < 0 || id >= len(idToToken) || idToToken[id] == "" {
+		return "", false
+	}
+	return idToToken[id], true
+}
@@ -0,0 +1,130 @@
+package tokenizers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+// tokenizerJSON mirrors the top level of a Hugging Face tokenizer.json file.
+// Pipeline components are kept raw and decoded by the tokenizer that needs them.
+type tokenizerJSON struct {
+	Version       string          `json:"version"`
+	Truncation    json.RawMessage `json:"truncation"`
+	Padding       json.RawMessage `json:"padding"`
+	AddedTokens   []addedToken    `json:"added_tokens"`
+	Normalizer    json.RawMessage `json:"normalizer"`
+	PreTokenizer  json.RawMessage `json:"pre_tokenizer"`
+	PostProcessor json.RawMessage `json:"post_processor"`
+	Decoder       json.RawMessage `json:"decoder"`
+	Model         json.RawMessage `json:"model"`
+}
+
+// addedToken is an entry of the added_tokens section of tokenizer.json
+type addedToken struct {
+	ID      int    `json:"id"`
+	Content string `json:"content"`
+	Special bool   `json:"special"`
+}
+
+// componentType extracts the "type" discriminator of a pipeline component
+func componentType(raw json.RawMessage) (string, error) {
+	if isNull(raw) {
+		return "", nil
+	}
+	var c struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return "", err
+	}
+	return c.Type, nil
+}
+
+// unsupportedError reports a tokenizer.json component that is not implemented
+type unsupportedError struct {
+	section string
+	kind    string
+}
+
+func (e *unsupportedError) Error() string {
+	return fmt.Sprintf("unsupported %s %s", e.section, e.kind)
+}
+
+// Is reports whether target is errs.ErrNotImplemented
+func (e *unsupportedError) Is(target error) bool {
+	return target == errs.ErrNotImplemented
+}
+
+// isNull reports whether a raw JSON value is absent or null
+func isNull(raw json.RawMessage) bool {
+	s := strings.TrimSpace(string(raw))
+	return s == "" || s == "null"
+}
+
+// readTokenizerJSON loads and decodes a tokenizer.json file
+func readTokenizerJSON(path string) (*tokenizerJSON, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer file: %w", err)
+	}
+
+	var tj tokenizerJSON
+	if err := json.Unmarshal(data, &tj); err != nil {
+		return nil, fmt.Errorf("failed to parse tokenizer file %s: %w", path, err)
+	}
+	if isNull(tj.Model) {
+		return nil, fmt.Errorf("tokenizer file %s has no model section", path)
+	}
+	return &tj, nil
+}
+
+// readVocabTxt loads a vocab.txt file where each line holds one token and the
+// token ID is its zero-based line number
+func readVocabTxt(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vocab file: %w", err)
+	}
+	defer f.Close()
+
+	vocab := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	id := 0
+	for scanner.Scan() {
+		token := strings.TrimRight(scanner.Text(), "\r")
+		if _, exists := vocab[token]; !exists {
+			vocab[token] = id
+		}
+		id++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read vocab file: %w", err)
+	}
+	if len(vocab) == 0 {
+		return nil, fmt.Errorf("vocab file %s is empty", path)
+	}
+	return vocab, nil
+}
+
+// reverseVocab builds an ID-indexed token table from a vocabulary
+func reverseVocab(vocab map[string]int) []string {
+	maxID := -1
+	for _, id := range vocab {
+		if id > maxID {
+			maxID = id
+		}
+	}
+	ids := make([]string, maxID+1)
+	for token, id := range vocab {
+		if id >= 0 {
+			ids[id] = token
+		}
+	}
+	return ids
+}
@@ -0,0 +1,175 @@
+package tokenizers
+
+import "unicode"
+
+//go:generate go run gen_unicode.go
+
+// isWhitespace reports whether r separates words, following BERT's definition
+func isWhitespace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r':
+		return true
+	}
+	return unicode.Is(unicode.Zs, r)
+}
+
+// isControl reports whether r is a control character that should be dropped.
+// Tab, newline and carriage return are treated as whitespace instead.
+func isControl(r rune) bool {
+	switch r {
+	case '\t', '\n', '\r':
+		return false
+	}
+	return unicode.In(r, unicode.Cc, unicode.Cf)
+}
+
+// isPunctuation reports whether r is punctuation. All non-alphanumeric ASCII
+// characters are treated as punctuation even if Unicode does not classify
+// them as such (e.g. "^", "$" and "`").
+func isPunctuation(r rune) bool {
+	if (r >= 33 && r <= 47) || (r >= 58 && r <= 64) || (r >= 91 && r <= 96) || (r >= 123 && r <= 126) {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
+
+// isChineseChar reports whether r is in the CJK Unified Ideographs blocks.
+// Hiragana, Katakana and Hangul are deliberately excluded since those
+// scripts use spaces between words.
+func isChineseChar(r rune) bool {
+	return (r >= 0x4E00 && r <= 0x9FFF) ||
+		(r >= 0x3400 && r <= 0x4DBF) ||
+		(r >= 0x20000 && r <= 0x2A6DF) ||
+		(r >= 0x2A700 && r <= 0x2B73F) ||
+		(r >= 0x2B740 && r <= 0x2B81F) ||
+		(r >= 0x2B820 && r <= 0x2CEAF) ||
+		(r >= 0xF900 && r <= 0xFAFF) ||
+		(r >= 0x2F800 && r <= 0x2FA1F)
+}
+
+// Hangul syllables decompose algorithmically rather than via the tables
+const (
+	hangulSBase  = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+// decompose appends the full canonical decomposition (NFD, without
+// reordering) of r to dst
+func decompose(dst []rune, r rune) []rune {
+	return decomposeRune(dst, r, false)
+}
+
+// decomposeRune appends the full canonical or, when compat is set,
+// compatibility decomposition of r to dst without reordering
+func decomposeRune(dst []rune, r rune, compat bool) []rune {
+	if r >= hangulSBase && r < hangulSBase+hangulSCount {
+		s := r - hangulSBase
+		dst = append(dst, hangulLBase+s/hangulNCount, hangulVBase+(s%hangulNCount)/hangulTCount)
+		if t := s % hangulTCount; t != 0 {
+			dst = append(dst, hangulTBase+t)
+		}
+		return dst
+	}
+	parts, ok := canonicalDecompositions[r]
+	if !ok && compat {
+		parts, ok = compatDecompositions[r]
+	}
+	if !ok {
+		return append(dst, r)
+	}
+	for _, p := range parts {
+		dst = decomposeRune(dst, p, compat)
+	}
+	return dst
+}
+
+// composeRunes returns the primary composite of a starter and a following
+// character, if there is one
+func composeRunes(a, b rune) (rune, bool) {
+	if a >= hangulLBase && a < hangulLBase+hangulLCount && b >= hangulVBase && b < hangulVBase+hangulVCount {
+		return hangulSBase + ((a-hangulLBase)*hangulVCount+b-hangulVBase)*hangulTCount, true
+	}
+	if a >= hangulSBase && a < hangulSBase+hangulSCount && (a-hangulSBase)%hangulTCount == 0 &&
+		b > hangulTBase && b < hangulTBase+hangulTCount {
+		return a + b - hangulTBase, true
+	}
+	c, ok := canonicalCompositions[[2]rune{a, b}]
+	return c, ok
+}
+
+// unicodeNormalize applies one of the four Unicode normalization forms to
+// text: canonical (NFD/NFC) or compatibility (NFKD/NFKC) decomposition,
+// canonical reordering and, when compose is set, canonical composition.
+// Every resulting character keeps the span of the characters it came from.
+func unicodeNormalize(text []normRune, compat, compose bool) []normRune {
+	var out []normRune
+	var buf []rune
+	for _, nr := range text {
+		buf = decomposeRune(buf[:0], nr.r, compat)
+		for _, r := range buf {
+			out = append(out, normRune{r, nr.start, nr.end})
+		}
+	}
+
+	// Sort each run of combining marks by combining class, keeping the
+	// relative order of marks of the same class
+	for i := 1; i < len(out); i++ {
+		ccc := combiningClasses[out[i].r]
+		if ccc == 0 {
+			continue
+		}
+		for j := i; j > 0; j-- {
+			prev := combiningClasses[out[j-1].r]
+			if prev == 0 || prev <= ccc {
+				break
+			}
+			out[j-1], out[j] = out[j], out[j-1]
+		}
+	}
+	if !compose {
+		return out
+	}
+
+	composed := out[:0]
+	starter := -1
+	for _, nr := range out {
+		ccc := combiningClasses[nr.r]
+		if starter >= 0 {
+			last := len(composed) - 1
+			// A character is blocked from the starter by an intervening
+			// character of the same or a higher class, or by another starter
+			blocked := last != starter && (combiningClasses[composed[last].r] == 0 || combiningClasses[composed[last].r] >= ccc)
+			if !blocked {
+				if c, ok := composeRunes(composed[starter].r, nr.r); ok {
+					composed[starter].r = c
+					composed[starter].start = min(composed[starter].start, nr.start)
+					composed[starter].end = max(composed[starter].end, nr.end)
+					continue
+				}
+			}
+		}
+		if ccc == 0 {
+			starter = len(composed)
+		}
+		composed = append(composed, nr)
+	}
+	return composed
+}
+
+// stripAccents appends r to dst with any combining marks removed
+func stripAccents(dst []rune, r rune) []rune {
+	var buf [4]rune
+	for _, d := range decompose(buf[:0], r) {
+		if !unicode.Is(unicode.Mn, d) {
+			dst = append(dst, d)
+		}
+	}
+	return dst
+}
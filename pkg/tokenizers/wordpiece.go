@@ -1,33 +1,422 @@
 package tokenizers
 
-// WordPieceTokenizer implements WordPiece tokenization algorithm
-// This is a placeholder for Phase 2 implementation
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+var _ Tokenizer = (*WordPieceTokenizer)(nil)
+
+// WordPieceTokenizer implements the WordPiece tokenization algorithm used by
+// BERT-style models
 type WordPieceTokenizer struct {
 	Vocab          map[string]int `json:"vocab"`
 	UNKToken       string         `json:"unk_token"`
-	MaxInputLength int            `json:"max_input_length"`
+	MaxInputLength int            `json:"max_input_length"` // words longer than this many characters become UNKToken
+
+	ContinuingSubwordPrefix string `json:"continuing_subword_prefix"`
+	CLSToken                string `json:"cls_token"`
+	SEPToken                string `json:"sep_token"`
+	PADToken                string `json:"pad_token"`
+
+	// Basic tokenization settings
+	DoLowerCase          bool `json:"do_lower_case"`
+	StripAccents         bool `json:"strip_accents"`
+	TokenizeChineseChars bool `json:"tokenize_chinese_chars"`
+
+	processing
+	idToToken []string
 }
 
-// NewWordPieceTokenizer creates a new WordPiece tokenizer
-// TODO: Implement in Phase 2
+// normRune is a normalized character together with the byte span of the
+// original text it was produced from
+type normRune struct {
+	r          rune
+	start, end int
+}
+
+// wordPiece is a single subword produced by the tokenizer
+type wordPiece struct {
+	token      string
+	id         int
+	start, end int // byte offsets into the original text
+	word       int // index of the word the piece belongs to
+}
+
+// NewWordPieceTokenizer creates a new WordPiece tokenizer from either a
+// vocab.txt file or a Hugging Face tokenizer.json file. When loading a
+// vocab.txt, settings are read from a sibling tokenizer_config.json if present.
 func NewWordPieceTokenizer(vocabPath string) (*WordPieceTokenizer, error) {
-	return &WordPieceTokenizer{
-		Vocab:          make(map[string]int),
-		UNKToken:       "[UNK]",
-		MaxInputLength: 512,
-	}, nil
+	wpt := &WordPieceTokenizer{
+		UNKToken:                "[UNK]",
+		MaxInputLength:          100,
+		ContinuingSubwordPrefix: "##",
+		CLSToken:                "[CLS]",
+		SEPToken:                "[SEP]",
+		PADToken:                "[PAD]",
+		DoLowerCase:             true,
+		StripAccents:            true,
+		TokenizeChineseChars:    true,
+	}
+
+	if strings.EqualFold(filepath.Ext(vocabPath), ".json") {
+		tj, err := readTokenizerJSON(vocabPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := wpt.loadTokenizerJSON(tj); err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", vocabPath, err)
+		}
+		if err := wpt.loadProcessing(tj); err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", vocabPath, err)
+		}
+	} else {
+		vocab, err := readVocabTxt(vocabPath)
+		if err != nil {
+			return nil, err
+		}
+		wpt.Vocab = vocab
+		if err := wpt.loadTokenizerConfig(filepath.Join(filepath.Dir(vocabPath), "tokenizer_config.json")); err != nil {
+			return nil, err
+		}
+		clsID, hasCLS := wpt.Vocab[wpt.CLSToken]
+		sepID, hasSEP := wpt.Vocab[wpt.SEPToken]
+		if hasCLS && hasSEP {
+			wpt.post = NewBertProcessing(wpt.CLSToken, clsID, wpt.SEPToken, sepID)
+		}
+	}
+
+	if _, ok := wpt.Vocab[wpt.UNKToken]; !ok {
+		return nil, fmt.Errorf("vocabulary does not contain unknown token %q", wpt.UNKToken)
+	}
+	wpt.idToToken = reverseVocab(wpt.Vocab)
+	return wpt, nil
+}
+
+// loadTokenizerJSON configures the tokenizer from a tokenizer.json file
+func (wpt *WordPieceTokenizer) loadTokenizerJSON(tj *tokenizerJSON) error {
+	var model struct {
+		Type                    string         `json:"type"`
+		UNKToken                string         `json:"unk_token"`
+		ContinuingSubwordPrefix *string        `json:"continuing_subword_prefix"`
+		MaxInputCharsPerWord    int            `json:"max_input_chars_per_word"`
+		Vocab                   map[string]int `json:"vocab"`
+	}
+	if err := json.Unmarshal(tj.Model, &model); err != nil {
+		return fmt.Errorf("invalid model section: %w", err)
+	}
+	if model.Type != "" && model.Type != "WordPiece" {
+		return fmt.Errorf("expected a WordPiece model, got %s", model.Type)
+	}
+	if len(model.Vocab) == 0 {
+		return fmt.Errorf("model section has an empty vocabulary")
+	}
+
+	wpt.Vocab = model.Vocab
+	if model.UNKToken != "" {
+		wpt.UNKToken = model.UNKToken
+	}
+	if model.ContinuingSubwordPrefix != nil {
+		wpt.ContinuingSubwordPrefix = *model.ContinuingSubwordPrefix
+	}
+	if model.MaxInputCharsPerWord > 0 {
+		wpt.MaxInputLength = model.MaxInputCharsPerWord
+	}
+
+	normType, err := componentType(tj.Normalizer)
+	if err != nil {
+		return fmt.Errorf("invalid normalizer section: %w", err)
+	}
+	if normType == "BertNormalizer" {
+		var norm struct {
+			HandleChineseChars *bool `json:"handle_chinese_chars"`
+			StripAccents       *bool `json:"strip_accents"`
+			Lowercase          *bool `json:"lowercase"`
+		}
+		if err := json.Unmarshal(tj.Normalizer, &norm); err != nil {
+			return fmt.Errorf("invalid normalizer section: %w", err)
+		}
+		if norm.Lowercase != nil {
+			wpt.DoLowerCase = *norm.Lowercase
+		}
+		// A null strip_accents follows the lowercase setting
+		wpt.StripAccents = wpt.DoLowerCase
+		if norm.StripAccents != nil {
+			wpt.StripAccents = *norm.StripAccents
+		}
+		if norm.HandleChineseChars != nil {
+			wpt.TokenizeChineseChars = *norm.HandleChineseChars
+		}
+	}
+	return nil
+}
+
+// loadTokenizerConfig applies the settings of a tokenizer_config.json file.
+// A missing file is not an error.
+func (wpt *WordPieceTokenizer) loadTokenizerConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read tokenizer config: %w", err)
+	}
+
+	var config struct {
+		DoLowerCase          *bool   `json:"do_lower_case"`
+		StripAccents         *bool   `json:"strip_accents"`
+		TokenizeChineseChars *bool   `json:"tokenize_chinese_chars"`
+		UNKToken             *string `json:"unk_token"`
+		CLSToken             *string `json:"cls_token"`
+		SEPToken             *string `json:"sep_token"`
+		PADToken             *string `json:"pad_token"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse tokenizer config %s: %w", path, err)
+	}
+
+	if config.DoLowerCase != nil {
+		wpt.DoLowerCase = *config.DoLowerCase
+	}
+	wpt.StripAccents = wpt.DoLowerCase
+	if config.StripAccents != nil {
+		wpt.StripAccents = *config.StripAccents
+	}
+	if config.TokenizeChineseChars != nil {
+		wpt.TokenizeChineseChars = *config.TokenizeChineseChars
+	}
+	for _, field := range []struct {
+		dst *string
+		src *string
+	}{
+		{&wpt.UNKToken, config.UNKToken},
+		{&wpt.CLSToken, config.CLSToken},
+		{&wpt.SEPToken, config.SEPToken},
+		{&wpt.PADToken, config.PADToken},
+	} {
+		if field.src != nil {
+			*field.dst = *field.src
+		}
+	}
+	return nil
+}
+
+// Encode tokenizes text into an encoding, applying the configured
+// post-processing (by default "[CLS] text [SEP]"), truncation and padding
+func (wpt *WordPieceTokenizer) Encode(text string) (*Encoding, error) {
+	return wpt.encode(wpt.encodeSequence, text, nil)
+}
+
+// EncodePair tokenizes a pair of sequences, by default as
+// "[CLS] text [SEP] pair [SEP]" with token type 1 for the second sequence
+func (wpt *WordPieceTokenizer) EncodePair(text, pair string) (*Encoding, error) {
+	return wpt.encode(wpt.encodeSequence, text, &pair)
+}
+
+// EncodePairTruncated is EncodePair with the given truncation settings in
+// place of the tokenizer's own. It lets callers split a long sequence into
+// overlapping windows without changing the settings of a shared tokenizer.
+func (wpt *WordPieceTokenizer) EncodePairTruncated(text, pair string, truncation *TruncationParams) (*Encoding, error) {
+	truncation, err := checkTruncation(truncation)
+	if err != nil {
+		return nil, err
+	}
+	return wpt.encodeTruncated(wpt.encodeSequence, text, &pair, truncation)
+}
+
+// EncodeBatch tokenizes several inputs, padding them to a common length
+// when padding is enabled
+func (wpt *WordPieceTokenizer) EncodeBatch(texts []string) ([]*Encoding, error) {
+	return wpt.encodeBatch(wpt.encodeSequence, texts)
 }
 
-// Tokenize converts text to token IDs
-// TODO: Implement in Phase 2
+// encodeSequence tokenizes a single sequence without special tokens
+func (wpt *WordPieceTokenizer) encodeSequence(text string) (*Encoding, error) {
+	enc := &Encoding{}
+	for _, p := range wpt.tokenize(text) {
+		enc.appendToken(p, 0)
+	}
+	return enc, nil
+}
+
+// Tokenize converts text to token IDs, including special tokens
 func (wpt *WordPieceTokenizer) Tokenize(text string) ([]int, error) {
-	// Placeholder implementation
-	return []int{}, nil
+	enc, err := wpt.Encode(text)
+	if err != nil {
+		return nil, err
+	}
+	return enc.IDs, nil
 }
 
-// Decode converts token IDs back to text
-// TODO: Implement in Phase 2
+// Decode converts token IDs back to text. Continuation pieces are joined to
+// the preceding token and CLS, SEP and PAD tokens are skipped.
 func (wpt *WordPieceTokenizer) Decode(tokenIDs []int) (string, error) {
-	// Placeholder implementation
-	return "", nil
+	var sb strings.Builder
+	for _, id := range tokenIDs {
+		token, ok := wpt.IDToToken(id)
+		if !ok {
+			return "", fmt.Errorf("%w: token ID %d is not in the vocabulary", errs.ErrInvalidInput, id)
+		}
+		if token == wpt.CLSToken || token == wpt.SEPToken || token == wpt.PADToken {
+			continue
+		}
+
+		if wpt.ContinuingSubwordPrefix != "" && strings.HasPrefix(token, wpt.ContinuingSubwordPrefix) {
+			sb.WriteString(strings.TrimPrefix(token, wpt.ContinuingSubwordPrefix))
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(token)
+	}
+	return cleanUpTokenization(sb.String()), nil
+}
+
+// TokenToID returns the ID of a token in the vocabulary
+func (wpt *WordPieceTokenizer) TokenToID(token string) (int, bool) {
+	return lookupID(wpt.Vocab, token)
+}
+
+// IDToToken returns the token for an ID in the vocabulary
+func (wpt *WordPieceTokenizer) IDToToken(id int) (string, bool) {
+	return lookupToken(wpt.idToToken, id)
+}
+
+// VocabSize returns the number of IDs in the vocabulary
+func (wpt *WordPieceTokenizer) VocabSize() int {
+	return len(wpt.idToToken)
+}
+
+// tokenize runs basic tokenization followed by WordPiece on each word
+func (wpt *WordPieceTokenizer) tokenize(text string) []wordPiece {
+	var pieces []wordPiece
+	for i, word := range wpt.basicTokenize(text) {
+		pieces = append(pieces, wpt.wordPieces(word, i)...)
+	}
+	return pieces
+}
+
+// basicTokenize cleans and normalizes text and splits it into words on
+// whitespace, punctuation and CJK characters. Each normalized character
+// keeps the span of the original text it came from.
+func (wpt *WordPieceTokenizer) basicTokenize(text string) [][]normRune {
+	var words [][]normRune
+	var current []normRune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, current)
+			current = nil
+		}
+	}
+
+	var buf []rune
+	for start, r := range text {
+		end := start + len(string(r))
+		if r == 0 || r == unicode.ReplacementChar || isControl(r) {
+			continue
+		}
+		if isWhitespace(r) {
+			flush()
+			continue
+		}
+		if wpt.TokenizeChineseChars && isChineseChar(r) {
+			flush()
+			words = append(words, []normRune{{r, start, end}})
+			continue
+		}
+
+		buf = buf[:0]
+		if wpt.DoLowerCase {
+			r = unicode.ToLower(r)
+		}
+		if wpt.StripAccents {
+			buf = stripAccents(buf, r)
+		} else {
+			buf = append(buf, r)
+		}
+
+		for _, nr := range buf {
+			if isPunctuation(nr) {
+				flush()
+				words = append(words, []normRune{{nr, start, end}})
+				continue
+			}
+			current = append(current, normRune{nr, start, end})
+		}
+	}
+	flush()
+	return words
+}
+
+// wordPieces splits a single word into subwords using greedy
+// longest-match-first lookup. Words that cannot be fully covered by the
+// vocabulary, or that exceed MaxInputLength characters, become UNKToken.
+func (wpt *WordPieceTokenizer) wordPieces(word []normRune, wordIndex int) []wordPiece {
+	unknown := []wordPiece{{
+		token: wpt.UNKToken,
+		id:    wpt.Vocab[wpt.UNKToken],
+		start: word[0].start,
+		end:   word[len(word)-1].end,
+		word:  wordIndex,
+	}}
+	if wpt.MaxInputLength > 0 && len(word) > wpt.MaxInputLength {
+		return unknown
+	}
+
+	runes := make([]rune, len(word))
+	for i, nr := range word {
+		runes[i] = nr.r
+	}
+
+	var pieces []wordPiece
+	for start := 0; start < len(runes); {
+		end := len(runes)
+		found := false
+		for ; end > start; end-- {
+			candidate := string(runes[start:end])
+			if start > 0 {
+				candidate = wpt.ContinuingSubwordPrefix + candidate
+			}
+			if id, ok := wpt.Vocab[candidate]; ok {
+				pieces = append(pieces, wordPiece{
+					token: candidate,
+					id:    id,
+					start: word[start].start,
+					end:   word[end-1].end,
+					word:  wordIndex,
+				})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return unknown
+		}
+		start = end
+	}
+	return pieces
+}
+
+// cleanUpTokenization removes spaces the decoder inserts before punctuation
+// and English contractions
+func cleanUpTokenization(text string) string {
+	return strings.NewReplacer(
+		" .", ".",
+		" ?", "?",
+		" !", "!",
+		" ,", ",",
+		" ' ", "'",
+		" n't", "n't",
+		" 'm", "'m",
+		" 's", "'s",
+		" 've", "'ve",
+		" 're", "'re",
+	).Replace(text)
 }
@@ -0,0 +1,186 @@
+package tokenizers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kelleyblackmore/go-transformer/pkg/errs"
+)
+
+// The fixture holds a subset of the bert-base-uncased vocabulary with the
+// original token IDs, so these cases match the Python tokenizer output.
+func TestWordPieceTokenizer_BertBaseUncasedParity(t *testing.T) {
+	wpt, err := NewWordPieceTokenizer("testdata/bert-base-uncased-subset.json")
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+
+	tests := []struct {
+		text string
+		ids  []int
+	}{
+		{
+			text: "I've been waiting for a HuggingFace course my whole life.",
+			ids:  []int{101, 1045, 1005, 2310, 2042, 3403, 2005, 1037, 17662, 12172, 2607, 2026, 2878, 2166, 1012, 102},
+		},
+		{
+			text: "I hate this so much!",
+			ids:  []int{101, 1045, 5223, 2023, 2061, 2172, 999, 102},
+		},
+		{
+			text: "Using a Transformer network is simple",
+			ids:  []int{101, 7993, 1037, 10938, 2121, 2897, 2003, 3722, 102},
+		},
+		{
+			text: "Héllo,\tWORLD!",
+			ids:  []int{101, 7592, 1010, 2088, 999, 102},
+		},
+	}
+
+	for _, tt := range tests {
+		ids, err := wpt.Tokenize(tt.text)
+		if err != nil {
+			t.Fatalf("Tokenize(%q) failed: %v", tt.text, err)
+		}
+		if !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("Tokenize(%q): expected %v, got %v", tt.text, tt.ids, ids)
+		}
+	}
+}
+
+func TestWordPieceTokenizer_VocabTxt(t *testing.T) {
+	wpt, err := NewWordPieceTokenizer("testdata/vocab.txt")
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+
+	tests := []struct {
+		text   string
+		tokens []string
+	}{
+		{"unaffable", []string{"un", "##aff", "##able"}},
+		{"The quick brown foxes.", []string{"the", "quick", "brown", "fox", "##es", "."}},
+		{"中国", []string{"中", "国"}},
+		{"Café", []string{"cafe"}},
+		{"unknownword", []string{"[UNK]"}},
+		{"\x00​", nil},
+	}
+
+	for _, tt := range tests {
+		var tokens []string
+		for _, p := range wpt.tokenize(tt.text) {
+			tokens = append(tokens, p.token)
+		}
+		if !reflect.DeepEqual(tokens, tt.tokens) {
+			t.Errorf("tokenize(%q): expected %v, got %v", tt.text, tt.tokens, tokens)
+		}
+	}
+}
+
+func TestWordPieceTokenizer_MaxInputLength(t *testing.T) {
+	wpt, err := NewWordPieceTokenizer("testdata/vocab.txt")
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+	wpt.MaxInputLength = 5
+
+	ids, err := wpt.Tokenize("unaffable the")
+	if err != nil {
+		t.Fatalf("Tokenize failed: %v", err)
+	}
+
+	expected := []int{2, 1, 8, 3}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected %v, got %v", expected, ids)
+	}
+}
+
+func TestWordPieceTokenizer_Decode(t *testing.T) {
+	wpt, err := NewWordPieceTokenizer("testdata/vocab.txt")
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+
+	ids, err := wpt.Tokenize("The quick brown foxes, unaffable!")
+	if err != nil {
+		t.Fatalf("Tokenize failed: %v", err)
+	}
+
+	text, err := wpt.Decode(ids)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	expected := "the quick brown foxes, unaffable!"
+	if text != expected {
+		t.Errorf("Expected %q, got %q", expected, text)
+	}
+
+	if _, err := wpt.Decode([]int{9999}); !errors.Is(err, errs.ErrInvalidInput) {
+		t.Error("Expected an error for an out-of-vocabulary ID")
+	}
+}
+
+func TestNewWordPieceTokenizer_Errors(t *testing.T) {
+	if _, err := NewWordPieceTokenizer("testdata/missing.txt"); err == nil {
+		t.Error("Expected an error for a missing vocab file")
+	}
+
+	path := filepath.Join(t.TempDir(), "vocab.txt")
+	if err := os.WriteFile(path, []byte("hello\nworld\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewWordPieceTokenizer(path)
+	if err == nil || !strings.Contains(err.Error(), "unknown token") {
+		t.Errorf("Expected an unknown token error, got %v", err)
+	}
+}
+
+func TestWordPieceTokenizer_Encode(t *testing.T) {
+	wpt, err := NewWordPieceTokenizer("testdata/bert-base-uncased-subset.json")
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+
+	text := "Héllo, WORLD! HuggingFace"
+	enc, err := wpt.Encode(text)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	expectedTokens := []string{"[CLS]", "hello", ",", "world", "!", "hugging", "##face", "[SEP]"}
+	if !reflect.DeepEqual(enc.Tokens, expectedTokens) {
+		t.Fatalf("Expected tokens %v, got %v", expectedTokens, enc.Tokens)
+	}
+
+	expectedSpans := []string{"", "Héllo", ",", "WORLD", "!", "Hugging", "Face", ""}
+	for i, o := range enc.Offsets {
+		if span := text[o.Start:o.End]; span != expectedSpans[i] {
+			t.Errorf("Token %d: expected span %q, got %q", i, expectedSpans[i], span)
+		}
+	}
+
+	expectedWordIDs := []int{-1, 0, 1, 2, 3, 4, 4, -1}
+	if !reflect.DeepEqual(enc.WordIDs, expectedWordIDs) {
+		t.Errorf("Expected word IDs %v, got %v", expectedWordIDs, enc.WordIDs)
+	}
+
+	expectedSpecial := []int{1, 0, 0, 0, 0, 0, 0, 1}
+	if !reflect.DeepEqual(enc.SpecialTokensMask, expectedSpecial) {
+		t.Errorf("Expected special tokens mask %v, got %v", expectedSpecial, enc.SpecialTokensMask)
+	}
+
+	for i := range enc.IDs {
+		if enc.AttentionMask[i] != 1 || enc.TypeIDs[i] != 0 {
+			t.Errorf("Token %d: expected attention 1 and type 0, got %d and %d", i, enc.AttentionMask[i], enc.TypeIDs[i])
+		}
+	}
+
+	if idx := enc.CharToToken(strings.Index(text, "Face")); idx != 6 {
+		t.Errorf("Expected CharToToken to return 6, got %d", idx)
+	}
+}